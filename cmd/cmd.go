@@ -8,6 +8,8 @@ import (
 	"gitlab.com/olaris/olaris-server/cmd/identify_movie"
 	"gitlab.com/olaris/olaris-server/cmd/library"
 	"gitlab.com/olaris/olaris-server/cmd/library_create"
+	"gitlab.com/olaris/olaris-server/cmd/nfo"
+	"gitlab.com/olaris/olaris-server/cmd/nfo_export"
 	"gitlab.com/olaris/olaris-server/cmd/root"
 	"gitlab.com/olaris/olaris-server/cmd/serve"
 	"gitlab.com/olaris/olaris-server/cmd/user"
@@ -25,6 +27,8 @@ func New() di.Option {
 		identify_movie.New(),
 		library.New(),
 		library_create.New(),
+		nfo.New(),
+		nfo_export.New(),
 		dumpdebug.New(),
 		version.New(),
 	)
@@ -23,8 +23,13 @@ func main() {
 		log.Fatalf("Failed to find user \"%s\": %s", *username, err.Error())
 	}
 
-	// Create a token quasi-unlimited validity.
-	jwt, err := auth.CreateMetadataJWT(user, 1000*24*time.Hour)
+	// Create a token quasi-unlimited validity. It can still be revoked like any other session.
+	validity := 1000 * 24 * time.Hour
+	session, _, err := db.CreateSession(user.ID, "generate-login-token", validity)
+	if err != nil {
+		log.Fatalf("Failed to create session: %s", err.Error())
+	}
+	jwt, err := auth.CreateMetadataJWT(user, &session, validity)
 	if err != nil {
 		log.Fatalf("Failed to create login token: %s", err.Error())
 	}
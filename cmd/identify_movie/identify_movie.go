@@ -1,7 +1,6 @@
 package identify_movie
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/goava/di"
@@ -41,12 +40,9 @@ func NewIdentifyMovieCommand() *cmd.CobraCommand {
 		Short: "Identify a movie",
 		Long:  "Identify a movie pased on it's file location path.\n* To identify a local file use local#/path/to/file.\n* To identify a Rclone file use rclone#/path/to/file.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var a agents.MetadataRetrievalAgent
-			switch strings.ToLower(agent) {
-			case "tmdb":
-				a = agents.NewTmdbAgent()
-			default:
-				return fmt.Errorf("unknown agent: %s", agent)
+			a, err := agents.NewAgent(strings.ToLower(agent))
+			if err != nil {
+				return err
 			}
 
 			fl, err := filesystem.ParseFileLocator(filePath)
@@ -89,7 +85,7 @@ func NewIdentifyMovieCommand() *cmd.CobraCommand {
 	c.Flags().IntVar(&id, "id", 0, "ID of movie from agent")
 	c.MarkFlagRequired("id")
 
-	c.Flags().StringVar(&agent, "agent", "tmdb", "Agent, defaults to tmdb")
+	c.Flags().StringVar(&agent, "agent", agents.AgentTmdb, "Agent (nfo or tmdb), defaults to tmdb")
 	c.Flags().StringVar(&dbConn, "db-conn", "", "sets the database connection string")
 	c.Flags().BoolVar(&dbLog, "db-log", false, "sets whether the database should log queries")
 
@@ -0,0 +1,35 @@
+package nfo
+
+import (
+	"github.com/goava/di"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/olaris/olaris-server/cmd/root"
+	"gitlab.com/olaris/olaris-server/pkg/cmd"
+)
+
+type NfoCommand cmd.Command
+
+func RegisterNfoCommand(rootCommand root.RootCommand, nfoCommand NfoCommand) {
+	rootCommand.GetCobraCommand().AddCommand(nfoCommand.GetCobraCommand())
+}
+
+func New() di.Option {
+	return di.Options(
+		di.Provide(NewNfoCommand, di.As(new(NfoCommand))),
+		di.Invoke(RegisterNfoCommand),
+	)
+}
+
+func NewNfoCommand() *cmd.CobraCommand {
+	c := &cobra.Command{
+		Use:   "nfo",
+		Short: "Manage Kodi-style .nfo sidecar files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return errors.New("Subcommand required")
+		},
+	}
+
+	return &cmd.CobraCommand{Command: c}
+}
@@ -0,0 +1,62 @@
+package nfo_export
+
+import (
+	"fmt"
+
+	"github.com/goava/di"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/olaris/olaris-server/cmd/nfo"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	mnfo "gitlab.com/olaris/olaris-server/metadata/nfo"
+	"gitlab.com/olaris/olaris-server/pkg/cmd"
+)
+
+type nfoExportCommand cmd.Command
+
+func RegisterNfoExportCommand(nfoCommand nfo.NfoCommand, nfoExportCommand nfoExportCommand) {
+	nfoCommand.GetCobraCommand().AddCommand(nfoExportCommand.GetCobraCommand())
+}
+
+func New() di.Option {
+	return di.Options(
+		di.Provide(NewNfoExportCommand, di.As(new(nfoExportCommand))),
+		di.Invoke(RegisterNfoExportCommand),
+	)
+}
+
+func NewNfoExportCommand() *cmd.CobraCommand {
+	var overwrite bool
+	var dbConn string
+	var dbLog bool
+
+	c := &cobra.Command{
+		Use:   "export",
+		Short: "Write .nfo files for all identified movies and episodes",
+		Long: "Write Kodi-style .nfo files with the current metadata next to all identified movie and episode files " +
+			"in local libraries, so that other tools can reuse the matches.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbOptions := db.DatabaseOptions{
+				Connection: dbConn,
+				LogMode:    dbLog,
+			}
+			mctx := app.NewMDContext(dbOptions)
+			defer mctx.Db.Close()
+
+			result := mnfo.Export(overwrite)
+			fmt.Printf("Wrote %d .nfo files, skipped %d, %d failed\n",
+				result.Written, result.Skipped, result.Failed)
+			if result.Failed > 0 {
+				return fmt.Errorf("failed to write %d .nfo files", result.Failed)
+			}
+			return nil
+		},
+	}
+
+	c.Flags().BoolVar(&overwrite, "overwrite", false, "overwrite existing .nfo files")
+	c.Flags().StringVar(&dbConn, "db-conn", "", "sets the database connection string")
+	c.Flags().BoolVar(&dbLog, "db-log", false, "sets whether the database should log queries")
+
+	return &cmd.CobraCommand{Command: c}
+}
@@ -22,11 +22,13 @@ import (
 	"github.com/spf13/viper"
 
 	"gitlab.com/olaris/olaris-server/cmd/root"
+	"gitlab.com/olaris/olaris-server/dlna"
 	"gitlab.com/olaris/olaris-server/ffmpeg"
 	"gitlab.com/olaris/olaris-server/metadata"
 	"gitlab.com/olaris/olaris-server/metadata/agents"
 	"gitlab.com/olaris/olaris-server/metadata/app"
 	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/metadata/managers"
 	"gitlab.com/olaris/olaris-server/pkg/cmd"
 	"gitlab.com/olaris/olaris-server/react"
 	"gitlab.com/olaris/olaris-server/streaming"
@@ -64,7 +66,14 @@ func NewServeCommand() *cmd.CobraCommand {
 				LogMode:    viper.GetBool("server.DBLog"),
 			}
 
-			mctx := app.NewMDContext(dbOptions, agents.NewTmdbAgent())
+			metadataAgents, err := agents.NewAgents(viper.GetStringSlice("metadata.agents"))
+			if err != nil {
+				log.Fatalf("failed to set up metadata agents: %s", err)
+			}
+
+			mctx := app.NewMDContext(dbOptions, metadataAgents...)
+			// Before any library is scanned, so that all probe results are persisted.
+			ffmpeg.SetProbeStore(managers.DatabaseProbeStore{})
 			if viper.GetBool("server.verbose") {
 				log.SetLevel(log.DebugLevel)
 			}
@@ -91,6 +100,17 @@ func NewServeCommand() *cmd.CobraCommand {
 			// This is also relevant during development because the realize auto-reload
 			// tool doesn't properly send SIGTERM.
 			ffmpeg.CleanTranscodingCache()
+			ffmpeg.InitEncoderBackend(
+				viper.GetString("server.transcoder.backend"),
+				viper.GetString("server.transcoder.device"))
+			ffmpeg.SetLadderPolicy(ffmpeg.LadderPolicy{
+				Heights:             viper.GetIntSlice("server.transcoder.ladder.heights"),
+				SourceHeightRung:    viper.GetBool("server.transcoder.ladder.sourceRung"),
+				CapAtSourceBitRate:  viper.GetBool("server.transcoder.ladder.capAtSourceBitrate"),
+				HighFrameRateFactor: viper.GetFloat64("server.transcoder.ladder.highFrameRateFactor"),
+			})
+			// After the encoder backend is set up, sync jobs transcode with it.
+			managers.GetSyncManager().Start()
 			port := viper.GetInt("server.port")
 
 			if viper.GetBool("server.zeroconf.enabled") {
@@ -105,6 +125,28 @@ func NewServeCommand() *cmd.CobraCommand {
 				defer zeroconfService.Shutdown()
 			}
 
+			if viper.GetBool("server.dlna.enabled") {
+				dlnaServer := dlna.NewServer(dlna.Options{
+					FriendlyName:  viper.GetString("server.dlna.friendlyName"),
+					Username:      viper.GetString("server.dlna.user"),
+					DeviceProfile: viper.GetString("server.dlna.deviceProfile"),
+					Port:          port,
+				})
+				if err := dlnaServer.Start(); err != nil {
+					log.WithError(err).Warn("DLNA setup failed")
+				} else {
+					dlnaServer.RegisterRoutes(mainRouter.PathPrefix(dlna.PathPrefix).Subrouter())
+					defer dlnaServer.Shutdown()
+
+					libraryEvents := mctx.MetadataManager.AddSubscriber()
+					go func() {
+						for range libraryEvents {
+							dlnaServer.LibraryChanged()
+						}
+					}()
+				}
+			}
+
 			appRoute := rrr.PathPrefix("/app").
 				Handler(http.StripPrefix("/olaris/app", react.GetHandler())).
 				Name("app")
@@ -146,6 +188,25 @@ func NewServeCommand() *cmd.CobraCommand {
 	c.Flags().String("db-conn", "", "sets the database connection string")
 	c.Flags().String("sqlite_dir", path.Join(helpers.BaseConfigDir(), "metadb"), "Path where the SQLite database should be stored")
 	c.Flags().Bool("scan-hidden", false, "sets whether to scan hidden directories (directories starting with a .)")
+	c.Flags().String("transcoder-backend", ffmpeg.EncoderBackendSoftware, "video encoder backend to use for transcoding (software, vaapi, nvenc or qsv)")
+	c.Flags().String("transcoder-device", "", "device to use for hardware accelerated transcoding, e.g. /dev/dri/renderD128 for vaapi")
+	c.Flags().IntSlice("ladder-heights", ffmpeg.DefaultLadderPolicy.Heights, "heights of the lower quality versions offered for adaptive streaming, taller ones than the source are left out")
+	c.Flags().Bool("ladder-source-rung", ffmpeg.DefaultLadderPolicy.SourceHeightRung, "sets whether to also offer a version at the source's height if it's between two ladder heights")
+	c.Flags().Bool("ladder-cap-at-source-bitrate", ffmpeg.DefaultLadderPolicy.CapAtSourceBitRate, "sets whether transcoded versions are limited to the bitrate of the source")
+	c.Flags().Float64("ladder-high-frame-rate-factor", ffmpeg.DefaultLadderPolicy.HighFrameRateFactor, "bitrate multiplier for video with more than 30 frames per second")
+	c.Flags().StringSlice("metadata-agents", agents.DefaultAgents, "metadata agents to use, in order of preference (nfo, tmdb)")
+	c.Flags().Bool("trickplay", true, "sets whether to generate seek-preview thumbnails for indexed files")
+	c.Flags().Duration("chapter-interval", 0, "length of the chapters generated for files without any, e.g. 10m, 0 to not generate chapters")
+	c.Flags().Int("max-transcodes", 0, "maximum number of streams to transcode at once, 0 for unlimited")
+	c.Flags().Int("max-playbacks-per-user", 0, "maximum number of files a user may play at once, 0 for unlimited")
+	c.Flags().Int("segment-cache-size", 2048, "size in MB of the cache for transcoded segments, 0 to disable it")
+	c.Flags().String("sync-dir", path.Join(helpers.BaseConfigDir(), "sync"), "Path where files transcoded for offline viewing should be stored")
+	c.Flags().String("opensubtitles-api-key", "", "API key for opensubtitles.com, enables searching and downloading subtitles")
+	c.Flags().Bool("dlna", false, "sets whether to announce the server to smart TVs and other DLNA renderers on the local network, which can then browse and play all libraries of the DLNA user without logging in")
+	c.Flags().String("dlna-name", "", "name that DLNA renderers show for the server, defaults to olaris and the hostname")
+	c.Flags().String("dlna-user", "", "user that DLNA renderers browse and play as, required to enable DLNA")
+	c.Flags().String("dlna-device-profile", "dlna", "device profile that decides whether DLNA renderers are offered files as they are or transcoded first")
+	c.Flags().String("limit-policy", streaming.LimitPolicyReject, "what to do with streams beyond max-transcodes (reject, lower-quality or transmux)")
 
 	viper.BindPFlag("server.port", c.Flags().Lookup("port"))
 	viper.BindPFlag("server.verbose", c.Flags().Lookup("verbose"))
@@ -153,6 +214,25 @@ func NewServeCommand() *cmd.CobraCommand {
 	viper.BindPFlag("server.sqliteDir", c.Flags().Lookup("sqlite_dir"))
 	viper.BindPFlag("database.connection", c.Flags().Lookup("db-conn"))
 	viper.BindPFlag("metadata.scan_hidden", c.Flags().Lookup("scan-hidden"))
+	viper.BindPFlag("server.transcoder.backend", c.Flags().Lookup("transcoder-backend"))
+	viper.BindPFlag("server.transcoder.device", c.Flags().Lookup("transcoder-device"))
+	viper.BindPFlag("server.transcoder.ladder.heights", c.Flags().Lookup("ladder-heights"))
+	viper.BindPFlag("server.transcoder.ladder.sourceRung", c.Flags().Lookup("ladder-source-rung"))
+	viper.BindPFlag("server.transcoder.ladder.capAtSourceBitrate", c.Flags().Lookup("ladder-cap-at-source-bitrate"))
+	viper.BindPFlag("server.transcoder.ladder.highFrameRateFactor", c.Flags().Lookup("ladder-high-frame-rate-factor"))
+	viper.BindPFlag("metadata.agents", c.Flags().Lookup("metadata-agents"))
+	viper.BindPFlag("metadata.trickplay", c.Flags().Lookup("trickplay"))
+	viper.BindPFlag("metadata.chapterInterval", c.Flags().Lookup("chapter-interval"))
+	viper.BindPFlag("server.streaming.maxTranscodes", c.Flags().Lookup("max-transcodes"))
+	viper.BindPFlag("server.streaming.maxPlaybacksPerUser", c.Flags().Lookup("max-playbacks-per-user"))
+	viper.BindPFlag("server.streaming.limitPolicy", c.Flags().Lookup("limit-policy"))
+	viper.BindPFlag("server.streaming.segmentCacheSize", c.Flags().Lookup("segment-cache-size"))
+	viper.BindPFlag("server.syncDir", c.Flags().Lookup("sync-dir"))
+	viper.BindPFlag("server.dlna.enabled", c.Flags().Lookup("dlna"))
+	viper.BindPFlag("server.dlna.friendlyName", c.Flags().Lookup("dlna-name"))
+	viper.BindPFlag("server.dlna.user", c.Flags().Lookup("dlna-user"))
+	viper.BindPFlag("server.dlna.deviceProfile", c.Flags().Lookup("dlna-device-profile"))
+	viper.BindPFlag("subtitles.opensubtitles.apiKey", c.Flags().Lookup("opensubtitles-api-key"))
 
 	return &cmd.CobraCommand{Command: c}
 }
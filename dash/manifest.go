@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"math"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 )
@@ -19,18 +22,39 @@ const dashManifestTemplate = `<?xml version="1.0" encoding="utf-8"?>
 	mediaPresentationDuration="{{ .duration }}"
 	maxSegmentDuration="PT20S">
 	<Period start="PT0S" id="0" duration="{{ .duration }}">
-		<AdaptationSet contentType="video">
-			{{ range $si, $s := .videoStream.Representations -}}
+		{{ range $ai, $representations := .videoAdaptationSets -}}
+		<AdaptationSet id="{{ $ai }}" contentType="video">
+			{{ range $si, $s := $representations -}}
 			<Representation
 					id="{{$s.Representation.RepresentationId}}"
 					mimeType="video/mp4"
 					codecs="{{$s.Representation.Codecs}}"
-					height="{{$s.Representation.Height}}" bandwidth="{{$s.Representation.BitRate}}">
+					{{ with $s.VideoWidth }}width="{{ . }}" {{ end }}height="{{ $s.VideoHeight }}" bandwidth="{{$s.Representation.BitRate}}">
 				<SegmentTemplate timescale="1000" duration="{{$.segmentDurationMs}}" initialization="{{$s.Stream.StreamId}}/$RepresentationID$/init.mp4" media="{{$s.Stream.StreamId}}/$RepresentationID$/$Number$.m4s" startNumber="0">
 				</SegmentTemplate>
 			</Representation>
 			{{ end }}
 		</AdaptationSet>
+		{{ end }}
+		{{ with .trickMode -}}
+		<AdaptationSet id="{{ .AdaptationSetId }}" contentType="video">
+			<EssentialProperty schemeIdUri="http://dashif.org/guidelines/trickmode" value="0"/>
+			<Representation
+					id="{{ .Representation.Representation.RepresentationId }}"
+					mimeType="video/mp4"
+					codecs="{{ .Representation.Representation.Codecs }}"
+					width="{{ .Representation.VideoWidth }}" height="{{ .Representation.VideoHeight }}" bandwidth="{{ .Representation.Representation.BitRate }}"
+					maxPlayoutRate="{{ .MaxPlayoutRate }}" codingDependency="false">
+				<SegmentTemplate timescale="1000" initialization="{{ .Representation.Stream.StreamId }}/$RepresentationID$/init.mp4" media="{{ .Representation.Stream.StreamId }}/$RepresentationID$/$Number$.m4s" startNumber="0">
+					<SegmentTimeline>
+						{{- range .Timeline }}
+						<S {{ with .T }}t="{{ . }}" {{ end }}d="{{ .D }}"{{ with .R }} r="{{ . }}"{{ end }}/>
+						{{- end }}
+					</SegmentTimeline>
+				</SegmentTemplate>
+			</Representation>
+		</AdaptationSet>
+		{{ end }}
 		{{ range $i, $audioStream := .audioStreams -}}
 		<AdaptationSet contentType="audio" lang="{{ $audioStream.Stream.Language }}">
 			{{ range $si, $s := $audioStream.Representations -}}
@@ -38,6 +62,9 @@ const dashManifestTemplate = `<?xml version="1.0" encoding="utf-8"?>
 					id="{{ $s.Representation.RepresentationId }}"
 					mimeType="audio/mp4" codecs="{{ $s.Representation.Codecs }}"
 					bandwidth="{{$s.Representation.BitRate}}">
+				{{ with audioChannelConfiguration $s.Representation -}}
+				<AudioChannelConfiguration schemeIdUri="{{ .SchemeIdUri }}" value="{{ .Value }}"/>
+				{{ end -}}
 				<SegmentTemplate timescale="1000" duration="{{$.segmentDurationMs}}" initialization="{{$s.Stream.StreamId}}/$RepresentationID$/init.mp4" media="{{$s.Stream.StreamId}}/$RepresentationID$/$Number$.m4s" startNumber="0">
 				</SegmentTemplate>
 			</Representation>
@@ -46,6 +73,11 @@ const dashManifestTemplate = `<?xml version="1.0" encoding="utf-8"?>
 		{{ end }}
 		{{ range $i, $s := .subtitleStreams -}}
 		<AdaptationSet contentType="text" mimeType="text/vtt" lang="{{ $s.Stream.Language }}" title="{{ $s.Stream.Language }}">
+			{{ if $s.Stream.Forced -}}
+			<Role schemeIdUri="urn:mpeg:dash:role:2011" value="forced-subtitle"/>
+			{{ else if $s.Stream.HearingImpaired -}}
+			<Role schemeIdUri="urn:mpeg:dash:role:2011" value="caption"/>
+			{{ end -}}
 			<Representation id="{{ $s.Representation.RepresentationId }}">
 				<BaseURL>{{ $s.URI }}</BaseURL>
 			</Representation>
@@ -65,28 +97,154 @@ type StreamRepresentations struct {
 	Representations []ffmpeg.StreamRepresentation
 }
 
+// TrickModeRepresentation is an I-frame representation that clients use for fast forward and
+// rewind, with one segment per keyframe.
+type TrickModeRepresentation struct {
+	ffmpeg.StreamRepresentation
+	Segments []ffmpeg.IFrameSegment
+}
+
+// BuildManifest builds the DASH manifest. trickMode may be nil if there is no I-frame
+// representation yet.
 func BuildManifest(
 	videoStream StreamRepresentations,
 	audioStreams []StreamRepresentations,
-	subtitleStreams []SubtitleStreamRepresentation) string {
+	subtitleStreams []SubtitleStreamRepresentation,
+	trickMode *TrickModeRepresentation) string {
 
 	totalDuration := videoStream.Stream.TotalDuration.Round(time.Millisecond)
 	durationXml := toXmlDuration(totalDuration)
+	videoAdaptationSets := groupByCodecFamily(videoStream.Representations)
 
 	templateData := map[string]interface{}{
-		"videoStream":       videoStream,
-		"audioStreams":      audioStreams,
-		"subtitleStreams":   subtitleStreams,
-		"duration":          durationXml,
-		"segmentDurationMs": int64(ffmpeg.SegmentDuration / time.Millisecond),
+		"videoAdaptationSets": videoAdaptationSets,
+		"audioStreams":        audioStreams,
+		"subtitleStreams":     subtitleStreams,
+		"duration":            durationXml,
+		"segmentDurationMs":   int64(ffmpeg.SegmentDuration / time.Millisecond),
+	}
+	if trickMode != nil && len(trickMode.Segments) > 0 {
+		templateData["trickMode"] = map[string]interface{}{
+			// The trick mode AdaptationSet refers to the first video AdaptationSet, whose id is 0.
+			"AdaptationSetId": len(videoAdaptationSets),
+			"Representation":  trickMode.StreamRepresentation,
+			"MaxPlayoutRate":  maxPlayoutRate(trickMode),
+			"Timeline":        segmentTimeline(trickMode.Segments),
+		}
 	}
 
 	buf := bytes.Buffer{}
-	t := template.Must(template.New("manifest").Parse(dashManifestTemplate))
+	t := template.Must(template.New("manifest").
+		Funcs(template.FuncMap{"audioChannelConfiguration": audioChannelConfiguration}).
+		Parse(dashManifestTemplate))
 	t.Execute(&buf, templateData)
 	return buf.String()
 }
 
+// timelineEntry is an S element of a SegmentTimeline: R+1 segments of duration D, starting at T.
+// T is 0 if the segment directly follows the previous one.
+type timelineEntry struct {
+	T int64
+	D int64
+	R int
+}
+
+// segmentTimeline describes the given segments in milliseconds, collapsing runs of segments of
+// the same duration.
+func segmentTimeline(segments []ffmpeg.IFrameSegment) []timelineEntry {
+	timeline := []timelineEntry{}
+	var end int64
+	for _, s := range segments {
+		start := int64(s.Start / time.Millisecond)
+		duration := int64((s.Start+s.Duration)/time.Millisecond) - start
+		if len(timeline) > 0 && start == end {
+			last := &timeline[len(timeline)-1]
+			if last.D == duration {
+				last.R++
+			} else {
+				timeline = append(timeline, timelineEntry{D: duration})
+			}
+		} else {
+			timeline = append(timeline, timelineEntry{T: start, D: duration})
+		}
+		end = start + duration
+	}
+	return timeline
+}
+
+// maxPlayoutRate is how much faster than normal playback the I-frames can be played, i.e. the
+// number of frames between two keyframes on average.
+func maxPlayoutRate(trickMode *TrickModeRepresentation) int {
+	frameRate := 24.0
+	if trickMode.Stream.FrameRate != nil {
+		frameRate, _ = trickMode.Stream.FrameRate.Float64()
+	}
+	var total time.Duration
+	for _, s := range trickMode.Segments {
+		total += s.Duration
+	}
+	averageInterval := total.Seconds() / float64(len(trickMode.Segments))
+	rate := int(math.Round(averageInterval * frameRate))
+	if rate < 1 {
+		return 1
+	}
+	return rate
+}
+
+type channelConfiguration struct {
+	SchemeIdUri string
+	Value       string
+}
+
+// Dolby's channel configurations for (E-)AC-3, a bitmask of the speaker positions.
+var dolbyChannelConfigurations = map[int]string{
+	1: "4000",
+	2: "A000",
+	6: "F801",
+	8: "FA01",
+}
+
+// audioChannelConfiguration describes the channels of an audio representation, nil if unknown.
+// E-AC-3 uses Dolby's scheme since that's what DASH-IF requires, everything else the plain
+// channel count.
+func audioChannelConfiguration(r ffmpeg.Representation) *channelConfiguration {
+	if r.Channels == 0 {
+		return nil
+	}
+	if r.Codecs == "ec-3" || r.Codecs == "ac-3" {
+		if value, ok := dolbyChannelConfigurations[r.Channels]; ok {
+			return &channelConfiguration{
+				SchemeIdUri: "tag:dolby.com,2014:dash:audio_channel_configuration:2011",
+				Value:       value,
+			}
+		}
+	}
+	return &channelConfiguration{
+		SchemeIdUri: "urn:mpeg:dash:23003:3:audio_channel_configuration:2011",
+		Value:       strconv.Itoa(r.Channels),
+	}
+}
+
+// groupByCodecFamily groups the representations by the codec family (e.g. "avc1" or "hvc1") of
+// their codecs string. Clients can't seamlessly switch between codecs, so each family gets its
+// own AdaptationSet.
+func groupByCodecFamily(representations []ffmpeg.StreamRepresentation) [][]ffmpeg.StreamRepresentation {
+	groups := [][]ffmpeg.StreamRepresentation{}
+	groupIdxByFamily := map[string]int{}
+
+	for _, r := range representations {
+		family := strings.SplitN(r.Representation.Codecs, ".", 2)[0]
+		idx, ok := groupIdxByFamily[family]
+		if !ok {
+			idx = len(groups)
+			groupIdxByFamily[family] = idx
+			groups = append(groups, []ffmpeg.StreamRepresentation{})
+		}
+		groups[idx] = append(groups[idx], r)
+	}
+	return groups
+}
+
 func toXmlDuration(duration time.Duration) string {
 	return fmt.Sprintf("PT%dH%dM%d.%dS",
 		duration/time.Hour,
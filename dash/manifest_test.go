@@ -0,0 +1,81 @@
+package dash
+
+import (
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func assertGolden(t *testing.T, name string, actual string) {
+	goldenPath := path.Join("testdata", name)
+	if *update {
+		require.NoError(t, ioutil.WriteFile(goldenPath, []byte(actual), 0644))
+	}
+	expected, err := ioutil.ReadFile(goldenPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), actual)
+}
+
+func TestBuildManifest_TrickMode(t *testing.T) {
+	fileLocator := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/movies/movie.mkv"}
+	video := ffmpeg.Stream{
+		StreamKey:     ffmpeg.StreamKey{FileLocator: fileLocator, StreamId: 0},
+		TotalDuration: 10 * time.Second,
+		Codecs:        "avc1.640028",
+		BitRate:       8000000,
+		FrameRate:     big.NewRat(24, 1),
+		Width:         1920,
+		Height:        1080,
+		StreamType:    "video",
+	}
+	audio := ffmpeg.Stream{
+		StreamKey:     ffmpeg.StreamKey{FileLocator: fileLocator, StreamId: 1},
+		TotalDuration: 10 * time.Second,
+		Codecs:        "mp4a.40.2",
+		Channels:      2,
+		StreamType:    "audio",
+		Language:      "eng",
+	}
+	videoStream := StreamRepresentations{
+		Stream:          video,
+		Representations: []ffmpeg.StreamRepresentation{ffmpeg.GetTransmuxedRepresentation(video)},
+	}
+	audioStreams := []StreamRepresentations{
+		{Stream: audio, Representations: []ffmpeg.StreamRepresentation{ffmpeg.GetTransmuxedRepresentation(audio)}},
+	}
+
+	keyframes := []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second, 8500 * time.Millisecond}
+	segments := ffmpeg.IFrameSegments(keyframes, 10*time.Second)
+	trickMode := &TrickModeRepresentation{
+		StreamRepresentation: ffmpeg.GetIFrameRepresentation(video, segments),
+		Segments:             segments,
+	}
+
+	assertGolden(t, "trickmode.mpd", BuildManifest(videoStream, audioStreams, nil, trickMode))
+	assertGolden(t, "manifest.mpd", BuildManifest(videoStream, audioStreams, nil, nil))
+}
+
+func TestSegmentTimeline(t *testing.T) {
+	segments := []ffmpeg.IFrameSegment{
+		{Start: 0, Duration: 2 * time.Second},
+		{Start: 2 * time.Second, Duration: 2 * time.Second},
+		{Start: 4 * time.Second, Duration: 1500 * time.Millisecond},
+		// A gap, e.g. because of a keyframe without a duration
+		{Start: 6 * time.Second, Duration: 2 * time.Second},
+	}
+	assert.Equal(t, []timelineEntry{
+		{T: 0, D: 2000, R: 1},
+		{D: 1500},
+		{T: 6000, D: 2000},
+	}, segmentTimeline(segments))
+}
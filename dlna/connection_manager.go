@@ -0,0 +1,54 @@
+package dlna
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func (s *Server) serveConnectionManagerControl(w http.ResponseWriter, r *http.Request) {
+	serveControl(w, r, connectionManagerType, map[string]func(*http.Request, soapAction) ([]soapArg, error){
+		"GetProtocolInfo":          getProtocolInfo,
+		"GetCurrentConnectionIDs":  getCurrentConnectionIDs,
+		"GetCurrentConnectionInfo": getCurrentConnectionInfo,
+	})
+}
+
+// sourceProtocolInfo lists the formats that the server can serve.
+func sourceProtocolInfo() string {
+	mimeTypes := map[string]bool{hlsMimeType: true}
+	for _, c := range containersByExtension {
+		mimeTypes[c.mimeType] = true
+	}
+	infos := []string{}
+	for mimeType := range mimeTypes {
+		infos = append(infos, "http-get:*:"+mimeType+":*")
+	}
+	sort.Strings(infos)
+	return strings.Join(infos, ",")
+}
+
+func getProtocolInfo(*http.Request, soapAction) ([]soapArg, error) {
+	return []soapArg{{"Source", sourceProtocolInfo()}, {"Sink", ""}}, nil
+}
+
+// Connections aren't tracked, renderers just fetch URLs. Connection 0 is the one that always exists
+// in that case.
+func getCurrentConnectionIDs(*http.Request, soapAction) ([]soapArg, error) {
+	return []soapArg{{"ConnectionIDs", "0"}}, nil
+}
+
+func getCurrentConnectionInfo(_ *http.Request, action soapAction) ([]soapArg, error) {
+	if action.arg("ConnectionID") != "0" {
+		return nil, &upnpError{Code: upnpErrorInvalidArgs, Description: "invalid connection reference"}
+	}
+	return []soapArg{
+		{"RcsID", "-1"},
+		{"AVTransportID", "-1"},
+		{"ProtocolInfo", ""},
+		{"PeerConnectionManager", ""},
+		{"PeerConnectionID", "-1"},
+		{"Direction", "Output"},
+		{"Status", "OK"},
+	}, nil
+}
@@ -0,0 +1,517 @@
+package dlna
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// Object IDs of the content directory. The root is "0" by definition, the other containers are
+//
+//	library/<library ID>
+//	series/<library ID>/<series UUID>
+//	season/<library ID>/<season UUID>
+//
+// and the items, which are files, are
+//
+//	movie/<movie file UUID>
+//	episode/<episode file UUID>
+//
+// Series and seasons are shown per library because their episodes can be spread over several.
+const rootID = "0"
+
+func (s *Server) serveContentDirectoryControl(w http.ResponseWriter, r *http.Request) {
+	serveControl(w, r, contentDirectoryType, map[string]func(*http.Request, soapAction) ([]soapArg, error){
+		"Browse": s.browse,
+		"GetSearchCapabilities": func(*http.Request, soapAction) ([]soapArg, error) {
+			return []soapArg{{"SearchCaps", ""}}, nil
+		},
+		"GetSortCapabilities": func(*http.Request, soapAction) ([]soapArg, error) {
+			return []soapArg{{"SortCaps", ""}}, nil
+		},
+		"GetSystemUpdateID": func(*http.Request, soapAction) ([]soapArg, error) {
+			return []soapArg{{"Id", strconv.FormatUint(uint64(s.updateID()), 10)}}, nil
+		},
+	})
+}
+
+// browseContext holds what the objects returned from one Browse request depend on.
+type browseContext struct {
+	userID       uint
+	access       db.LibraryAccess
+	capabilities ffmpeg.ClientCodecCapabilities
+	// Scheme and host that the renderer reached the server at, for the URLs of resources.
+	baseURL string
+}
+
+func (s *Server) newBrowseContext(r *http.Request) (*browseContext, error) {
+	user, err := s.user()
+	if err != nil {
+		return nil, err
+	}
+	capabilities, err := ffmpeg.GetDeviceProfile(s.deviceProfile)
+	if err != nil {
+		log.WithError(err).Warn("Unknown DLNA device profile, transcoding everything")
+	}
+	return &browseContext{
+		userID:       user.ID,
+		access:       db.LibraryAccessForUser(user.ID, user.Admin),
+		capabilities: capabilities,
+		baseURL:      "http://" + r.Host,
+	}, nil
+}
+
+// user returns the configured user that renderers browse and play as.
+func (s *Server) user() (*db.User, error) {
+	if s.username == "" {
+		return nil, errors.New("No DLNA user configured")
+	}
+	user, err := db.FindUserByUsername(s.username)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to find DLNA user %s", s.username)
+	}
+	return user, nil
+}
+
+func (s *Server) browse(r *http.Request, action soapAction) ([]soapArg, error) {
+	startingIndex, err := strconv.ParseUint(action.arg("StartingIndex"), 10, 32)
+	if err != nil {
+		return nil, &upnpError{Code: upnpErrorInvalidArgs, Description: "invalid StartingIndex"}
+	}
+	requestedCount, err := strconv.ParseUint(action.arg("RequestedCount"), 10, 32)
+	if err != nil {
+		return nil, &upnpError{Code: upnpErrorInvalidArgs, Description: "invalid RequestedCount"}
+	}
+
+	bc, err := s.newBrowseContext(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []didlContainer
+	var items []didlItem
+	objectID := action.arg("ObjectID")
+	switch action.arg("BrowseFlag") {
+	case "BrowseMetadata":
+		containers, items, err = s.objectMetadata(bc, objectID)
+	case "BrowseDirectChildren":
+		containers, items, err = s.children(bc, objectID)
+	default:
+		return nil, &upnpError{Code: upnpErrorInvalidArgs, Description: "invalid BrowseFlag"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(containers) + len(items)
+	containers, items = page(containers, items, int(startingIndex), int(requestedCount))
+	result, err := marshalDIDL(containers, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return []soapArg{
+		{"Result", result},
+		{"NumberReturned", strconv.Itoa(len(containers) + len(items))},
+		{"TotalMatches", strconv.Itoa(total)},
+		{"UpdateID", strconv.FormatUint(uint64(s.updateID()), 10)},
+	}, nil
+}
+
+// page returns the requested part of the children, which are the containers followed by the items.
+// A count of 0 means all of them.
+func page(containers []didlContainer, items []didlItem, start int, count int) ([]didlContainer, []didlItem) {
+	if start >= len(containers) {
+		start -= len(containers)
+		containers = nil
+	} else {
+		containers = containers[start:]
+		start = 0
+	}
+	if start >= len(items) {
+		items = nil
+	} else {
+		items = items[start:]
+	}
+
+	if count > 0 {
+		if len(containers) >= count {
+			return containers[:count], nil
+		}
+		if remaining := count - len(containers); len(items) > remaining {
+			items = items[:remaining]
+		}
+	}
+	return containers, items
+}
+
+func noSuchObject(objectID string) error {
+	return &upnpError{Code: upnpErrorNoSuchObject, Description: fmt.Sprintf("no such object %s", objectID)}
+}
+
+// parseObjectID splits an object ID into its kind and the rest. The library of series and seasons is
+// checked against the user's access.
+func parseObjectID(bc *browseContext, objectID string) (kind string, libraryID uint, uuid string, err error) {
+	parts := strings.Split(objectID, "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "library":
+		id, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return "", 0, "", noSuchObject(objectID)
+		}
+		libraryID = uint(id)
+	case len(parts) == 3 && (parts[0] == "series" || parts[0] == "season"):
+		id, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return "", 0, "", noSuchObject(objectID)
+		}
+		libraryID, uuid = uint(id), parts[2]
+	case len(parts) == 2 && (parts[0] == "movie" || parts[0] == "episode"):
+		return parts[0], 0, parts[1], nil
+	default:
+		return "", 0, "", noSuchObject(objectID)
+	}
+	if !bc.access.AllowsLibrary(libraryID) {
+		return "", 0, "", noSuchObject(objectID)
+	}
+	return parts[0], libraryID, uuid, nil
+}
+
+func (s *Server) children(bc *browseContext, objectID string) ([]didlContainer, []didlItem, error) {
+	if objectID == rootID {
+		return s.libraryContainers(bc), nil, nil
+	}
+
+	kind, libraryID, uuid, err := parseObjectID(bc, objectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch kind {
+	case "library":
+		library := db.FindLibrary(int(libraryID))
+		if library.ID == 0 {
+			return nil, nil, noSuchObject(objectID)
+		}
+		if library.Kind == db.MediaTypeSeries {
+			return seriesContainers(bc, library.ID), nil, nil
+		}
+		items, err := s.movieItems(bc, library.ID)
+		return nil, items, err
+	case "series":
+		series, err := db.FindSeriesByUUID(uuid)
+		if err != nil {
+			return nil, nil, noSuchObject(objectID)
+		}
+		return seasonContainers(libraryID, series), nil, nil
+	case "season":
+		season, err := db.FindSeasonByUUID(uuid)
+		if err != nil {
+			return nil, nil, noSuchObject(objectID)
+		}
+		items, err := s.episodeItems(bc, libraryID, season)
+		return nil, items, err
+	}
+	// Items have no children.
+	return nil, nil, nil
+}
+
+func (s *Server) objectMetadata(bc *browseContext, objectID string) ([]didlContainer, []didlItem, error) {
+	if objectID == rootID {
+		count := len(s.libraryContainers(bc))
+		return []didlContainer{{
+			didlObject: didlObject{ID: rootID, ParentID: "-1", Restricted: 1, Title: s.friendlyName, Class: classFolder},
+			ChildCount: &count,
+		}}, nil, nil
+	}
+
+	kind, libraryID, uuid, err := parseObjectID(bc, objectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch kind {
+	case "library":
+		library := db.FindLibrary(int(libraryID))
+		if library.ID == 0 {
+			return nil, nil, noSuchObject(objectID)
+		}
+		return []didlContainer{libraryContainer(library)}, nil, nil
+	case "series":
+		series, err := db.FindSeriesByUUID(uuid)
+		if err != nil {
+			return nil, nil, noSuchObject(objectID)
+		}
+		return []didlContainer{seriesContainer(bc, libraryID, *series)}, nil, nil
+	case "season":
+		season, err := db.FindSeasonByUUID(uuid)
+		if err != nil {
+			return nil, nil, noSuchObject(objectID)
+		}
+		series, err := db.FindSeries(season.SeriesID)
+		if err != nil {
+			return nil, nil, noSuchObject(objectID)
+		}
+		seasons := seasonContainers(libraryID, series)
+		for _, c := range seasons {
+			if c.ID == objectID {
+				return []didlContainer{c}, nil, nil
+			}
+		}
+		return nil, nil, noSuchObject(objectID)
+	case "movie":
+		item, err := s.movieMetadata(bc, uuid)
+		if err != nil {
+			return nil, nil, noSuchObject(objectID)
+		}
+		return nil, []didlItem{item}, nil
+	case "episode":
+		item, err := s.episodeMetadata(bc, uuid)
+		if err != nil {
+			return nil, nil, noSuchObject(objectID)
+		}
+		return nil, []didlItem{item}, nil
+	}
+	return nil, nil, noSuchObject(objectID)
+}
+
+func (s *Server) libraryContainers(bc *browseContext) []didlContainer {
+	containers := []didlContainer{}
+	for _, library := range db.AllLibraries() {
+		if bc.access.AllowsLibrary(library.ID) {
+			containers = append(containers, libraryContainer(library))
+		}
+	}
+	return containers
+}
+
+func libraryContainer(library db.Library) didlContainer {
+	title := library.Name
+	if title == "" {
+		title = library.FilePath
+	}
+	return didlContainer{didlObject: didlObject{
+		ID:         fmt.Sprintf("library/%d", library.ID),
+		ParentID:   rootID,
+		Restricted: 1,
+		Title:      title,
+		Class:      classFolder,
+	}}
+}
+
+func (s *Server) movieItems(bc *browseContext, libraryID uint) ([]didlItem, error) {
+	files, err := db.FindMovieFilesWithMoviesInLibrary(libraryID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to find movie files")
+	}
+	filesPerMovie := map[uint]int{}
+	for _, file := range files {
+		filesPerMovie[file.MovieID]++
+	}
+
+	items := []didlItem{}
+	for _, file := range files {
+		item, err := s.movieItem(bc, file, file.Movie, file.MovieID != 0 && filesPerMovie[file.MovieID] > 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return strings.ToLower(items[i].Title) < strings.ToLower(items[j].Title)
+	})
+	return items, nil
+}
+
+func (s *Server) movieMetadata(bc *browseContext, uuid string) (didlItem, error) {
+	file, err := db.FindMovieFileByUUID(uuid)
+	if err != nil {
+		return didlItem{}, err
+	}
+	if !bc.access.AllowsLibrary(file.LibraryID) {
+		return didlItem{}, fmt.Errorf("no access to library %d", file.LibraryID)
+	}
+	for _, stream := range db.FindStreamsForMovieFileUUID(uuid) {
+		file.Streams = append(file.Streams, *stream)
+	}
+	var movie db.Movie
+	if file.MovieID != 0 {
+		m, err := db.FindMovieByID(file.MovieID)
+		if err != nil {
+			return didlItem{}, err
+		}
+		movie = *m
+	}
+	return s.movieItem(bc, *file, movie, file.MovieID != 0 && !file.IsSingleFile())
+}
+
+// movieItem describes a movie file. If the movie has several files, they are told apart by their
+// file names.
+func (s *Server) movieItem(bc *browseContext, file db.MovieFile, movie db.Movie, showFileName bool) (didlItem, error) {
+	resources, err := s.mediaResources(bc, file.MediaItem, file.Streams)
+	if err != nil {
+		return didlItem{}, err
+	}
+	title := movie.Title
+	if title == "" {
+		title = file.FileName
+	} else if showFileName {
+		title = fmt.Sprintf("%s (%s)", title, file.FileName)
+	}
+	return didlItem{
+		didlObject: didlObject{
+			ID:          "movie/" + file.UUID,
+			ParentID:    fmt.Sprintf("library/%d", file.LibraryID),
+			Restricted:  1,
+			Title:       title,
+			Class:       classMovie,
+			Date:        movie.ReleaseDate,
+			Description: movie.Overview,
+			AlbumArtURI: posterURL(bc, movie.PosterPath),
+		},
+		Resources: resources,
+	}, nil
+}
+
+func seriesContainers(bc *browseContext, libraryID uint) []didlContainer {
+	seriesList := db.FindSeriesInLibrary(libraryID)
+	sort.SliceStable(seriesList, func(i, j int) bool {
+		return strings.ToLower(seriesList[i].Name) < strings.ToLower(seriesList[j].Name)
+	})
+	containers := []didlContainer{}
+	for _, series := range seriesList {
+		containers = append(containers, seriesContainer(bc, libraryID, series))
+	}
+	return containers
+}
+
+func seriesContainer(bc *browseContext, libraryID uint, series db.Series) didlContainer {
+	return didlContainer{didlObject: didlObject{
+		ID:          fmt.Sprintf("series/%d/%s", libraryID, series.UUID),
+		ParentID:    fmt.Sprintf("library/%d", libraryID),
+		Restricted:  1,
+		Title:       series.Name,
+		Class:       classFolder,
+		Description: series.Overview,
+		AlbumArtURI: posterURL(bc, series.PosterPath),
+	}}
+}
+
+// seasonContainers returns the seasons of the series that have episodes in the library.
+func seasonContainers(libraryID uint, series *db.Series) []didlContainer {
+	seasons := db.FindSeasonsForSeries(series.ID)
+	sort.SliceStable(seasons, func(i, j int) bool {
+		return seasons[i].SeasonNumber < seasons[j].SeasonNumber
+	})
+
+	containers := []didlContainer{}
+	for _, season := range seasons {
+		count := 0
+		for _, episode := range season.Episodes {
+			count += len(episodeFilesInLibrary(*episode, libraryID))
+		}
+		if count == 0 {
+			continue
+		}
+		title := season.Name
+		if title == "" {
+			title = fmt.Sprintf("Season %d", season.SeasonNumber)
+		}
+		containers = append(containers, didlContainer{
+			didlObject: didlObject{
+				ID:          fmt.Sprintf("season/%d/%s", libraryID, season.UUID),
+				ParentID:    fmt.Sprintf("series/%d/%s", libraryID, series.UUID),
+				Restricted:  1,
+				Title:       title,
+				Class:       classFolder,
+				Date:        season.AirDate,
+				Description: season.Overview,
+			},
+			ChildCount: &count,
+		})
+	}
+	return containers
+}
+
+func episodeFilesInLibrary(episode db.Episode, libraryID uint) []db.EpisodeFile {
+	files := []db.EpisodeFile{}
+	for _, file := range episode.EpisodeFiles {
+		if file.LibraryID == libraryID {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (s *Server) episodeItems(bc *browseContext, libraryID uint, season *db.Season) ([]didlItem, error) {
+	episodes := db.FindEpisodesForSeason(season.ID)
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[i].EpisodeNum < episodes[j].EpisodeNum
+	})
+
+	parentID := fmt.Sprintf("season/%d/%s", libraryID, season.UUID)
+	items := []didlItem{}
+	for _, episode := range episodes {
+		files := episodeFilesInLibrary(episode, libraryID)
+		for _, file := range files {
+			item, err := s.episodeItem(bc, file, episode, parentID, len(files) > 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (s *Server) episodeMetadata(bc *browseContext, uuid string) (didlItem, error) {
+	file, err := db.FindEpisodeFileByUUID(uuid)
+	if err != nil {
+		return didlItem{}, err
+	}
+	if !bc.access.AllowsLibrary(file.LibraryID) {
+		return didlItem{}, fmt.Errorf("no access to library %d", file.LibraryID)
+	}
+	episode, err := db.FindEpisodeByID(file.EpisodeID)
+	if err != nil {
+		return didlItem{}, err
+	}
+	season, err := db.FindSeason(episode.SeasonID)
+	if err != nil {
+		return didlItem{}, err
+	}
+	parentID := fmt.Sprintf("season/%d/%s", file.LibraryID, season.UUID)
+	return s.episodeItem(bc, *file, *episode, parentID,
+		len(episodeFilesInLibrary(*episode, file.LibraryID)) > 1)
+}
+
+// episodeItem describes an episode file. Renderers sort by title, so it starts with the episode
+// number.
+func (s *Server) episodeItem(bc *browseContext, file db.EpisodeFile, episode db.Episode, parentID string, showFileName bool) (didlItem, error) {
+	resources, err := s.mediaResources(bc, file.MediaItem, file.Streams)
+	if err != nil {
+		return didlItem{}, err
+	}
+	title := fmt.Sprintf("%02d. %s", episode.EpisodeNum, episode.Name)
+	if showFileName {
+		title = fmt.Sprintf("%s (%s)", title, file.FileName)
+	}
+	return didlItem{
+		didlObject: didlObject{
+			ID:          "episode/" + file.UUID,
+			ParentID:    parentID,
+			Restricted:  1,
+			Title:       title,
+			Class:       classVideo,
+			Date:        episode.AirDate,
+			Description: episode.Overview,
+			AlbumArtURI: posterURL(bc, episode.StillPath),
+		},
+		Resources: resources,
+	}, nil
+}
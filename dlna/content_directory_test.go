@@ -0,0 +1,409 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// soapClient calls the actions of the server's services like a renderer would.
+type soapClient struct {
+	t       *testing.T
+	baseURL string
+}
+
+type soapResponse struct {
+	Body struct {
+		Response struct {
+			Args []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+type soapFault struct {
+	ErrorCode int `xml:"Body>Fault>detail>UPnPError>errorCode"`
+}
+
+// call invokes an action and returns its out arguments, or the UPnP error code of the fault.
+func (c *soapClient) call(controlPath string, serviceType string, action string, args ...soapArg) (map[string]string, int) {
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg.Name)
+		xml.EscapeText(&body, []byte(arg.Value))
+		fmt.Fprintf(&body, "</%s>", arg.Name)
+	}
+	fmt.Fprintf(&body, "</u:%s></s:Body></s:Envelope>", action)
+
+	req, err := http.NewRequest("POST", c.baseURL+PathPrefix+controlPath, strings.NewReader(body.String()))
+	require.NoError(c.t, err)
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", fmt.Sprintf(`"%s#%s"`, serviceType, action))
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	require.NoError(c.t, err)
+
+	if res.StatusCode != http.StatusOK {
+		var fault soapFault
+		require.NoError(c.t, xml.Unmarshal(data, &fault), string(data))
+		return nil, fault.ErrorCode
+	}
+	var response soapResponse
+	require.NoError(c.t, xml.Unmarshal(data, &response), string(data))
+	out := map[string]string{}
+	for _, arg := range response.Body.Response.Args {
+		out[arg.XMLName.Local] = arg.Value
+	}
+	return out, 0
+}
+
+// The DIDL-Lite document as a renderer reads it.
+type testDIDL struct {
+	Containers []testDIDLObject `xml:"container"`
+	Items      []testDIDLObject `xml:"item"`
+}
+
+type testDIDLObject struct {
+	ID         string `xml:"id,attr"`
+	ParentID   string `xml:"parentID,attr"`
+	ChildCount string `xml:"childCount,attr"`
+	Title      string `xml:"title"`
+	Class      string `xml:"class"`
+	Resources  []struct {
+		ProtocolInfo string `xml:"protocolInfo,attr"`
+		Duration     string `xml:"duration,attr"`
+		Resolution   string `xml:"resolution,attr"`
+		URL          string `xml:",chardata"`
+	} `xml:"res"`
+}
+
+func (c *soapClient) browse(objectID string, flag string, start int, count int) (testDIDL, map[string]string, int) {
+	out, faultCode := c.call(contentDirectoryControlPath, contentDirectoryType, "Browse",
+		soapArg{"ObjectID", objectID},
+		soapArg{"BrowseFlag", flag},
+		soapArg{"Filter", "*"},
+		soapArg{"StartingIndex", fmt.Sprint(start)},
+		soapArg{"RequestedCount", fmt.Sprint(count)},
+		soapArg{"SortCriteria", ""})
+	if faultCode != 0 {
+		return testDIDL{}, nil, faultCode
+	}
+	var didl testDIDL
+	require.NoError(c.t, xml.Unmarshal([]byte(out["Result"]), &didl), out["Result"])
+	return didl, out, 0
+}
+
+func ids(objects []testDIDLObject) []string {
+	result := []string{}
+	for _, o := range objects {
+		result = append(result, o.ID)
+	}
+	return result
+}
+
+type testLibrary struct {
+	movies     db.Library
+	series     db.Library
+	heat       db.MovieFile
+	hevcMovie  db.MovieFile
+	show       db.Series
+	season     db.Season
+	pilot      db.EpisodeFile
+	otherMovie db.MovieFile
+}
+
+func videoStreams(codecs string) []db.Stream {
+	return []db.Stream{
+		{StreamType: "video", Codecs: codecs, Width: 1920, Height: 1080, TotalDuration: 90*time.Minute + 1500*time.Millisecond},
+		{StreamType: "audio", Codecs: "mp4a.40.2", Channels: 2, StreamKey: db.StreamKey{StreamId: 1}},
+	}
+}
+
+func createTestLibrary(t *testing.T) testLibrary {
+	var l testLibrary
+	l.movies = db.Library{Name: "Movies", FilePath: "/movies", Kind: db.MediaTypeMovie}
+	db.SaveLibrary(&l.movies)
+	l.series = db.Library{Name: "TV", FilePath: "/tv", Kind: db.MediaTypeSeries}
+	db.SaveLibrary(&l.series)
+	other := db.Library{Name: "Kids", FilePath: "/kids", Kind: db.MediaTypeMovie}
+	db.SaveLibrary(&other)
+
+	heat := db.Movie{Title: "Heat", ReleaseDate: "1995-12-15", MovieFiles: []db.MovieFile{{
+		MediaItem: db.MediaItem{FileName: "Heat.mkv", FilePath: "local#/movies/Heat.mkv", Size: 8100000000, LibraryID: l.movies.ID},
+		Streams:   videoStreams("avc1.640028"),
+	}}}
+	require.NoError(t, db.SaveMovie(&heat))
+	l.heat = heat.MovieFiles[0]
+
+	alien := db.Movie{Title: "Alien", MovieFiles: []db.MovieFile{{
+		MediaItem: db.MediaItem{FileName: "Alien.mkv", FilePath: "local#/movies/Alien.mkv", LibraryID: l.movies.ID},
+		Streams:   videoStreams("hvc1.2.4.L120.B0"),
+	}}}
+	require.NoError(t, db.SaveMovie(&alien))
+	l.hevcMovie = alien.MovieFiles[0]
+
+	up := db.Movie{Title: "Up", MovieFiles: []db.MovieFile{{
+		MediaItem: db.MediaItem{FileName: "Up.mp4", FilePath: "local#/kids/Up.mp4", LibraryID: other.ID},
+		Streams:   videoStreams("avc1.640028"),
+	}}}
+	require.NoError(t, db.SaveMovie(&up))
+	l.otherMovie = up.MovieFiles[0]
+
+	l.show = db.Series{Name: "The Wire"}
+	require.NoError(t, db.SaveSeries(&l.show))
+	l.season = db.Season{SeasonNumber: 1, SeriesID: l.show.ID}
+	require.NoError(t, db.SaveSeason(&l.season))
+	for _, num := range []int{2, 1} {
+		episode := db.Episode{Name: fmt.Sprintf("Episode %d", num), EpisodeNum: num, SeasonNum: 1, SeasonID: l.season.ID}
+		require.NoError(t, db.SaveEpisode(&episode))
+		file := db.EpisodeFile{
+			MediaItem: db.MediaItem{
+				FileName:  fmt.Sprintf("S01E0%d.mp4", num),
+				FilePath:  fmt.Sprintf("local#/tv/S01E0%d.mp4", num),
+				LibraryID: l.series.ID,
+			},
+			EpisodeID: episode.ID,
+			Streams:   videoStreams("avc1.640028"),
+		}
+		require.NoError(t, db.SaveEpisodeFile(&file))
+		if num == 1 {
+			l.pilot = file
+		}
+	}
+	return l
+}
+
+func newTestServer(t *testing.T, opts Options) (*soapClient, func()) {
+	dbc := db.NewDb(db.DatabaseOptions{Connection: db.InMemory})
+
+	router := mux.NewRouter()
+	NewServer(opts).RegisterRoutes(router.PathPrefix(PathPrefix).Subrouter())
+	httpServer := httptest.NewServer(router)
+
+	return &soapClient{t: t, baseURL: httpServer.URL}, func() {
+		httpServer.Close()
+		dbc.Close()
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	client, teardown := newTestServer(t, Options{FriendlyName: "Test server", Username: "admin"})
+	defer teardown()
+	_, err := db.CreateUser("admin", "password", true)
+	require.NoError(t, err)
+	l := createTestLibrary(t)
+
+	root, out, _ := client.browse(rootID, "BrowseMetadata", 0, 0)
+	require.Len(t, root.Containers, 1)
+	assert.Equal(t, "Test server", root.Containers[0].Title)
+	assert.Equal(t, "-1", root.Containers[0].ParentID)
+	assert.Equal(t, "3", root.Containers[0].ChildCount)
+	assert.Equal(t, "1", out["NumberReturned"])
+
+	libraries, out, _ := client.browse(rootID, "BrowseDirectChildren", 0, 0)
+	movieLibraryID := fmt.Sprintf("library/%d", l.movies.ID)
+	seriesLibraryID := fmt.Sprintf("library/%d", l.series.ID)
+	assert.Contains(t, ids(libraries.Containers), movieLibraryID)
+	assert.Contains(t, ids(libraries.Containers), seriesLibraryID)
+	assert.Equal(t, "3", out["TotalMatches"])
+
+	// Movies, sorted by title.
+	movies, _, _ := client.browse(movieLibraryID, "BrowseDirectChildren", 0, 0)
+	assert.Empty(t, movies.Containers)
+	assert.Equal(t, []string{"movie/" + l.hevcMovie.UUID, "movie/" + l.heat.UUID}, ids(movies.Items))
+
+	heat := movies.Items[1]
+	assert.Equal(t, "Heat", heat.Title)
+	assert.Equal(t, classMovie, heat.Class)
+	assert.Equal(t, movieLibraryID, heat.ParentID)
+	require.Len(t, heat.Resources, 2)
+	// The device profile plays H.264 in Matroska, so the file itself comes first.
+	assert.True(t, strings.HasPrefix(heat.Resources[0].ProtocolInfo, "http-get:*:video/x-matroska:"))
+	assert.Regexp(t, `^http://127\.0\.0\.1:\d+/olaris/s/files/jwt/[^/]+$`, heat.Resources[0].URL)
+	assert.Equal(t, "1:30:01.500", heat.Resources[0].Duration)
+	assert.Equal(t, "1920x1080", heat.Resources[0].Resolution)
+	assert.True(t, strings.HasPrefix(heat.Resources[1].ProtocolInfo, "http-get:*:"+hlsMimeType+":"))
+	assert.Regexp(t, `/olaris/s/files/jwt/[^/]+/session:\w+/hls-manifest\.m3u8\?deviceProfile=dlna$`, heat.Resources[1].URL)
+
+	// HEVC isn't in the device profile, so the transcoded stream comes first.
+	alien := movies.Items[0]
+	require.Len(t, alien.Resources, 2)
+	assert.True(t, strings.HasPrefix(alien.Resources[0].ProtocolInfo, "http-get:*:"+hlsMimeType+":"))
+
+	// Paging
+	page, out, _ := client.browse(movieLibraryID, "BrowseDirectChildren", 1, 1)
+	assert.Equal(t, []string{"movie/" + l.heat.UUID}, ids(page.Items))
+	assert.Equal(t, "1", out["NumberReturned"])
+	assert.Equal(t, "2", out["TotalMatches"])
+
+	item, _, _ := client.browse("movie/"+l.heat.UUID, "BrowseMetadata", 0, 0)
+	require.Len(t, item.Items, 1)
+	assert.Equal(t, "Heat", item.Items[0].Title)
+	assert.Len(t, item.Items[0].Resources, 2)
+
+	// Series, seasons and episodes
+	seriesList, _, _ := client.browse(seriesLibraryID, "BrowseDirectChildren", 0, 0)
+	seriesID := fmt.Sprintf("series/%d/%s", l.series.ID, l.show.UUID)
+	assert.Equal(t, []string{seriesID}, ids(seriesList.Containers))
+	assert.Equal(t, "The Wire", seriesList.Containers[0].Title)
+
+	seasons, _, _ := client.browse(seriesID, "BrowseDirectChildren", 0, 0)
+	seasonID := fmt.Sprintf("season/%d/%s", l.series.ID, l.season.UUID)
+	require.Equal(t, []string{seasonID}, ids(seasons.Containers))
+	assert.Equal(t, "Season 1", seasons.Containers[0].Title)
+	assert.Equal(t, "2", seasons.Containers[0].ChildCount)
+
+	episodes, _, _ := client.browse(seasonID, "BrowseDirectChildren", 0, 0)
+	require.Len(t, episodes.Items, 2)
+	assert.Equal(t, "episode/"+l.pilot.UUID, episodes.Items[0].ID)
+	assert.Equal(t, "01. Episode 1", episodes.Items[0].Title)
+	assert.Equal(t, seasonID, episodes.Items[0].ParentID)
+	assert.True(t, strings.HasPrefix(episodes.Items[0].Resources[0].ProtocolInfo, "http-get:*:video/mp4:"))
+
+	episode, _, _ := client.browse("episode/"+l.pilot.UUID, "BrowseMetadata", 0, 0)
+	require.Len(t, episode.Items, 1)
+	assert.Equal(t, seasonID, episode.Items[0].ParentID)
+
+	season, _, _ := client.browse(seasonID, "BrowseMetadata", 0, 0)
+	require.Len(t, season.Containers, 1)
+	assert.Equal(t, seriesID, season.Containers[0].ParentID)
+
+	_, _, faultCode := client.browse("movie/nope", "BrowseMetadata", 0, 0)
+	assert.Equal(t, upnpErrorNoSuchObject, faultCode)
+	_, _, faultCode = client.browse("library/1", "BrowseSideways", 0, 0)
+	assert.Equal(t, upnpErrorInvalidArgs, faultCode)
+}
+
+func TestBrowseLibraryAccess(t *testing.T) {
+	client, teardown := newTestServer(t, Options{Username: "livingroom"})
+	defer teardown()
+	_, err := db.CreateUser("admin", "password", true)
+	require.NoError(t, err)
+	user, err := db.CreateUser("livingroom", "password", false)
+	require.NoError(t, err)
+	l := createTestLibrary(t)
+	require.NoError(t, db.GrantLibraryAccess(user.ID, l.movies.ID))
+
+	libraries, _, _ := client.browse(rootID, "BrowseDirectChildren", 0, 0)
+	assert.Equal(t, []string{fmt.Sprintf("library/%d", l.movies.ID)}, ids(libraries.Containers))
+
+	_, _, faultCode := client.browse(fmt.Sprintf("library/%d", l.series.ID), "BrowseDirectChildren", 0, 0)
+	assert.Equal(t, upnpErrorNoSuchObject, faultCode)
+	_, _, faultCode = client.browse("movie/"+l.otherMovie.UUID, "BrowseMetadata", 0, 0)
+	assert.Equal(t, upnpErrorNoSuchObject, faultCode)
+}
+
+func TestServiceActions(t *testing.T) {
+	client, teardown := newTestServer(t, Options{})
+	defer teardown()
+
+	out, _ := client.call(contentDirectoryControlPath, contentDirectoryType, "GetSystemUpdateID")
+	assert.NotEmpty(t, out["Id"])
+	out, _ = client.call(contentDirectoryControlPath, contentDirectoryType, "GetSortCapabilities")
+	assert.Contains(t, out, "SortCaps")
+
+	out, _ = client.call(connectionManagerCtrlPath, connectionManagerType, "GetProtocolInfo")
+	assert.Contains(t, out["Source"], "http-get:*:video/x-matroska:*")
+	assert.Contains(t, out["Source"], "http-get:*:"+hlsMimeType+":*")
+
+	_, faultCode := client.call(contentDirectoryControlPath, contentDirectoryType, "DestroyObject")
+	assert.Equal(t, upnpErrorInvalidAction, faultCode)
+	_, faultCode = client.call(connectionManagerCtrlPath, contentDirectoryType, "GetProtocolInfo")
+	assert.Equal(t, upnpErrorInvalidAction, faultCode)
+}
+
+func TestDeviceDescription(t *testing.T) {
+	client, teardown := newTestServer(t, Options{FriendlyName: "Living <room>"})
+	defer teardown()
+
+	res, err := http.Get(client.baseURL + PathPrefix + descriptionPath)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var description deviceDescription
+	require.NoError(t, xml.NewDecoder(res.Body).Decode(&description))
+	assert.Equal(t, "Living <room>", description.Device.FriendlyName)
+	assert.True(t, strings.HasPrefix(description.Device.UDN, "uuid:"))
+	require.Len(t, description.Device.Services, 2)
+
+	// Renderers fetch the service descriptions from the URLs in the device description.
+	for _, service := range description.Device.Services {
+		res, err := http.Get(client.baseURL + service.SCPDURL)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode, service.SCPDURL)
+	}
+}
+
+func TestLocalNetworkOnly(t *testing.T) {
+	dbc := db.NewDb(db.DatabaseOptions{Connection: db.InMemory})
+	defer dbc.Close()
+	router := mux.NewRouter()
+	NewServer(Options{Username: "admin"}).RegisterRoutes(router.PathPrefix(PathPrefix).Subrouter())
+
+	get := func(remoteAddr string, forwardedFor string) int {
+		req := httptest.NewRequest("GET", PathPrefix+descriptionPath, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("127.0.0.1:50000", ""))
+	assert.Equal(t, http.StatusOK, get("192.168.1.20:50000", ""))
+	assert.Equal(t, http.StatusOK, get("[fe80::1]:50000", ""))
+	assert.Equal(t, http.StatusOK, get("127.0.0.1:50000", "10.0.0.5"))
+	assert.Equal(t, http.StatusForbidden, get("203.0.113.5:50000", ""))
+	assert.Equal(t, http.StatusForbidden, get("[2001:db8::1]:50000", ""))
+	// Behind a reverse proxy, the proxy's address is local but the client's isn't.
+	assert.Equal(t, http.StatusForbidden, get("127.0.0.1:50000", "203.0.113.5, 10.0.0.1"))
+
+	// The control endpoints are protected as well.
+	req := httptest.NewRequest("POST", PathPrefix+contentDirectoryControlPath, strings.NewReader(""))
+	req.RemoteAddr = "203.0.113.5:50000"
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+}
+
+func TestLibraryChanged(t *testing.T) {
+	dbc := db.NewDb(db.DatabaseOptions{Connection: db.InMemory})
+	defer dbc.Close()
+	server := NewServer(Options{Username: "admin"})
+	router := mux.NewRouter()
+	server.RegisterRoutes(router.PathPrefix(PathPrefix).Subrouter())
+	httpServer := httptest.NewServer(router)
+	defer httpServer.Close()
+	client := &soapClient{t: t, baseURL: httpServer.URL}
+	_, err := db.CreateUser("admin", "password", true)
+	require.NoError(t, err)
+
+	before, _ := client.call(contentDirectoryControlPath, contentDirectoryType, "GetSystemUpdateID")
+	_, browsed, _ := client.browse(rootID, "BrowseDirectChildren", 0, 0)
+	assert.Equal(t, before["Id"], browsed["UpdateID"])
+
+	server.LibraryChanged()
+	after, _ := client.call(contentDirectoryControlPath, contentDirectoryType, "GetSystemUpdateID")
+	assert.NotEqual(t, before["Id"], after["Id"])
+	_, browsed, _ = client.browse(rootID, "BrowseDirectChildren", 0, 0)
+	assert.Equal(t, after["Id"], browsed["UpdateID"])
+}
@@ -0,0 +1,174 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/helpers"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/metadata/managers"
+)
+
+// didlLite is the document that Browse returns, describing containers (folders) and items (files).
+type didlLite struct {
+	XMLName    xml.Name        `xml:"urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/ DIDL-Lite"`
+	XmlnsDC    string          `xml:"xmlns:dc,attr"`
+	XmlnsUPnP  string          `xml:"xmlns:upnp,attr"`
+	XmlnsDLNA  string          `xml:"xmlns:dlna,attr"`
+	Containers []didlContainer `xml:"container"`
+	Items      []didlItem      `xml:"item"`
+}
+
+type didlObject struct {
+	ID          string `xml:"id,attr"`
+	ParentID    string `xml:"parentID,attr"`
+	Restricted  int    `xml:"restricted,attr"`
+	Title       string `xml:"dc:title"`
+	Class       string `xml:"upnp:class"`
+	Date        string `xml:"dc:date,omitempty"`
+	Description string `xml:"dc:description,omitempty"`
+	AlbumArtURI string `xml:"upnp:albumArtURI,omitempty"`
+}
+
+type didlContainer struct {
+	didlObject
+	ChildCount *int `xml:"childCount,attr,omitempty"`
+	Searchable int  `xml:"searchable,attr"`
+}
+
+type didlItem struct {
+	didlObject
+	Resources []didlResource `xml:"res"`
+}
+
+type didlResource struct {
+	ProtocolInfo string `xml:"protocolInfo,attr"`
+	Size         int64  `xml:"size,attr,omitempty"`
+	Duration     string `xml:"duration,attr,omitempty"`
+	Resolution   string `xml:"resolution,attr,omitempty"`
+	// In bytes per second, unlike everywhere else.
+	BitRate int64  `xml:"bitrate,attr,omitempty"`
+	URL     string `xml:",chardata"`
+}
+
+const (
+	classFolder = "object.container.storageFolder"
+	classMovie  = "object.item.videoItem.movie"
+	classVideo  = "object.item.videoItem"
+)
+
+func marshalDIDL(containers []didlContainer, items []didlItem) (string, error) {
+	doc := didlLite{
+		XmlnsDC:    "http://purl.org/dc/elements/1.1/",
+		XmlnsUPnP:  "urn:schemas-upnp-org:metadata-1-0/upnp/",
+		XmlnsDLNA:  "urn:schemas-dlna-org:metadata-1-0/",
+		Containers: containers,
+		Items:      items,
+	}
+	b, err := xml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// formatDuration formats a duration as H+:MM:SS.F+, as the duration of resources is written.
+func formatDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+type containerFormat struct {
+	mimeType string
+	// The format name as ffprobe names it, to check whether renderers play the file directly.
+	formatName string
+}
+
+// Files aren't probed while browsing, their container is guessed from the extension.
+var containersByExtension = map[string]containerFormat{
+	".mkv":  {"video/x-matroska", "matroska,webm"},
+	".webm": {"video/webm", "matroska,webm"},
+	".mp4":  {"video/mp4", "mov,mp4,m4a,3gp,3g2,mj2"},
+	".m4v":  {"video/mp4", "mov,mp4,m4a,3gp,3g2,mj2"},
+	".mov":  {"video/quicktime", "mov,mp4,m4a,3gp,3g2,mj2"},
+	".ts":   {"video/mp2t", "mpegts"},
+	".m2ts": {"video/mp2t", "mpegts"},
+	".avi":  {"video/x-msvideo", "avi"},
+	".mpg":  {"video/mpeg", "mpeg"},
+	".mpeg": {"video/mpeg", "mpeg"},
+	".wmv":  {"video/x-ms-wmv", "asf"},
+}
+
+const hlsMimeType = "application/vnd.apple.mpegurl"
+
+// DLNA.ORG_FLAGS: streaming transfer mode, background transfer mode, connection stalling and
+// DLNA 1.5.
+const dlnaFlags = "DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+// mediaResources returns the URLs that renderers can play the file from: the file itself, which
+// supports seeking by byte range, and the transcoded HLS stream. The first one that the renderer
+// supports is usually played, so the transcoded stream comes first if the device profile can't
+// play the file as it is.
+func (s *Server) mediaResources(bc *browseContext, file db.MediaItem, streams []db.Stream) ([]didlResource, error) {
+	token, err := auth.CreateStreamingJWT(bc.userID, file.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	basePath := fmt.Sprintf("/olaris/s/files/jwt/%s", token)
+
+	format, ok := containersByExtension[strings.ToLower(path.Ext(file.FileName))]
+	if !ok {
+		format = containerFormat{mimeType: "application/octet-stream"}
+	}
+	ffmpegStreams := &ffmpeg.Streams{FormatName: format.formatName}
+	for _, stream := range streams {
+		switch stream.StreamType {
+		case "video":
+			ffmpegStreams.VideoStreams = append(ffmpegStreams.VideoStreams, managers.FfmpegStreamFromDatabaseStream(stream))
+		case "audio":
+			ffmpegStreams.AudioStreams = append(ffmpegStreams.AudioStreams, managers.FfmpegStreamFromDatabaseStream(stream))
+		}
+	}
+
+	direct := didlResource{
+		ProtocolInfo: fmt.Sprintf("http-get:*:%s:DLNA.ORG_OP=01;DLNA.ORG_CI=0;%s", format.mimeType, dlnaFlags),
+		Size:         file.Size,
+		URL:          bc.baseURL + basePath,
+	}
+	transcoded := didlResource{
+		ProtocolInfo: fmt.Sprintf("http-get:*:%s:DLNA.ORG_OP=00;DLNA.ORG_CI=1;%s", hlsMimeType, dlnaFlags),
+		URL: fmt.Sprintf("%s%s/session:%s/hls-manifest.m3u8?deviceProfile=%s",
+			bc.baseURL, basePath, helpers.RandAlphaString(16), url.QueryEscape(s.deviceProfile)),
+	}
+	if len(ffmpegStreams.VideoStreams) > 0 {
+		video := ffmpegStreams.GetVideoStream()
+		for _, r := range []*didlResource{&direct, &transcoded} {
+			r.Duration = formatDuration(video.TotalDuration)
+		}
+		if video.Width > 0 && video.Height > 0 {
+			direct.Resolution = fmt.Sprintf("%dx%d", video.Width, video.Height)
+		}
+		if seconds := video.TotalDuration.Seconds(); seconds > 0 && file.Size > 0 {
+			direct.BitRate = int64(float64(file.Size) / seconds)
+		}
+	}
+
+	if bc.capabilities.CanDirectPlay(ffmpegStreams) {
+		return []didlResource{direct, transcoded}, nil
+	}
+	return []didlResource{transcoded, direct}, nil
+}
+
+// posterURL returns the URL of a poster from themoviedb.org through the image cache.
+func posterURL(bc *browseContext, posterPath string) string {
+	if posterPath == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/olaris/m/images/tmdb/w342/%s", bc.baseURL, strings.TrimPrefix(posterPath, "/"))
+}
@@ -0,0 +1,297 @@
+// Package dlna implements a DLNA media server so that smart TVs, consoles and other UPnP renderers
+// can browse the libraries and play their files. It announces itself over SSDP and implements the
+// UPnP ContentDirectory and ConnectionManager services. Media is served through the regular
+// streaming routes.
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/helpers"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+)
+
+const (
+	deviceType                = "urn:schemas-upnp-org:device:MediaServer:1"
+	contentDirectoryType      = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	connectionManagerType     = "urn:schemas-upnp-org:service:ConnectionManager:1"
+	contentDirectoryServiceID = "urn:upnp-org:serviceId:ContentDirectory"
+	connectionManagerID       = "urn:upnp-org:serviceId:ConnectionManager"
+)
+
+// PathPrefix is where the routes of the DLNA server must be registered. Renderers find them in the
+// device description, which contains absolute paths.
+const PathPrefix = "/olaris/dlna"
+
+const (
+	descriptionPath             = "/rootDesc.xml"
+	contentDirectorySCPDPath    = "/ContentDirectory.xml"
+	contentDirectoryControlPath = "/ContentDirectory/control"
+	contentDirectoryEventPath   = "/ContentDirectory/event"
+	connectionManagerSCPDPath   = "/ConnectionManager.xml"
+	connectionManagerCtrlPath   = "/ConnectionManager/control"
+	connectionManagerEventPath  = "/ConnectionManager/event"
+)
+
+// The resource URLs in browse results contain streaming tickets, which expire. Renderers cache
+// browse results until SystemUpdateID changes, so it changes well before the tickets in them expire.
+const updateIDRefreshInterval = auth.StreamingTicketLifetime / 2
+
+// Options configure the DLNA server.
+type Options struct {
+	// Name that renderers show for the server. Defaults to "olaris" and the hostname.
+	FriendlyName string
+	// Username of the user that renderers browse and play as. Required, renderers can't log in, so
+	// they must not get more than this user's libraries.
+	Username string
+	// Name of the device profile that decides whether files are offered as they are or transcoded
+	// first, see ffmpeg.DeviceProfiles.
+	DeviceProfile string
+	// Port of the HTTP server that the routes are registered on.
+	Port int
+}
+
+// Server is a DLNA media server.
+type Server struct {
+	// Unique device name, e.g. "uuid:2fac1234-31f8-11b4-a222-08002b34c003". Renderers remember
+	// servers by it, so it stays the same across restarts.
+	udn           string
+	friendlyName  string
+	username      string
+	deviceProfile string
+	port          int
+	// Renderers cache browse results until this changes. It changes when the libraries do and
+	// every updateIDRefreshInterval. Only access it atomically.
+	systemUpdateID uint32
+
+	ssdp *ssdpAnnouncer
+	done chan struct{}
+}
+
+// NewServer creates a DLNA server. Register its routes and start it to make it visible.
+func NewServer(opts Options) *Server {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	friendlyName := opts.FriendlyName
+	if friendlyName == "" {
+		friendlyName = fmt.Sprintf("olaris (%s)", hostname)
+	}
+	deviceProfile := opts.DeviceProfile
+	if deviceProfile == "" {
+		deviceProfile = "dlna"
+	}
+
+	return &Server{
+		udn: "uuid:" + uuid.NewV5(uuid.NamespaceDNS,
+			fmt.Sprintf("olaris-dlna.%s:%d", hostname, opts.Port)).String(),
+		friendlyName:   friendlyName,
+		username:       opts.Username,
+		deviceProfile:  deviceProfile,
+		port:           opts.Port,
+		systemUpdateID: uint32(time.Now().Unix()),
+	}
+}
+
+// RegisterRoutes registers the device description and the UPnP services on a router for
+// PathPrefix. They only answer requests from the local network, see localNetworkOnly.
+func (s *Server) RegisterRoutes(router *mux.Router) {
+	router.Use(localNetworkOnly)
+	router.HandleFunc(descriptionPath, s.serveDescription).Methods("GET", "HEAD")
+	router.HandleFunc(contentDirectorySCPDPath, serveXML(contentDirectorySCPD)).Methods("GET", "HEAD")
+	router.HandleFunc(connectionManagerSCPDPath, serveXML(connectionManagerSCPD)).Methods("GET", "HEAD")
+	router.HandleFunc(contentDirectoryControlPath, s.serveContentDirectoryControl).Methods("POST")
+	router.HandleFunc(connectionManagerCtrlPath, s.serveConnectionManagerControl).Methods("POST")
+	router.HandleFunc(contentDirectoryEventPath, serveEventSubscription).Methods("SUBSCRIBE", "UNSUBSCRIBE")
+	router.HandleFunc(connectionManagerEventPath, serveEventSubscription).Methods("SUBSCRIBE", "UNSUBSCRIBE")
+}
+
+// Start announces the server on the local network.
+func (s *Server) Start() error {
+	if s.username == "" {
+		return errors.New("A DLNA user is required, renderers browse and play as that user")
+	}
+	announcer, err := newSSDPAnnouncer(s)
+	if err != nil {
+		return err
+	}
+	s.ssdp = announcer
+	go announcer.run()
+	s.done = make(chan struct{})
+	go s.refreshUpdateID(s.done)
+	log.WithFields(log.Fields{"udn": s.udn, "name": s.friendlyName}).Info("DLNA server started")
+	return nil
+}
+
+// Shutdown tells renderers that the server is going away.
+func (s *Server) Shutdown() {
+	if s.ssdp != nil {
+		s.ssdp.stop()
+		s.ssdp = nil
+	}
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+}
+
+// LibraryChanged tells renderers that browse results they cached are out of date. Call it when
+// media is added, updated or removed.
+func (s *Server) LibraryChanged() {
+	atomic.AddUint32(&s.systemUpdateID, 1)
+}
+
+func (s *Server) updateID() uint32 {
+	return atomic.LoadUint32(&s.systemUpdateID)
+}
+
+// refreshUpdateID changes SystemUpdateID regularly so that renderers browse again and get new
+// streaming tickets before the ones they cached expire. Renderers that ignore SystemUpdateID and
+// play expired URLs get errors until they browse again.
+func (s *Server) refreshUpdateID(done chan struct{}) {
+	ticker := time.NewTicker(updateIDRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.LibraryChanged()
+		case <-done:
+			return
+		}
+	}
+}
+
+// localNetworkOnly rejects requests from outside the local network. Renderers don't authenticate,
+// so anyone who can browse gets streaming tickets for the DLNA user's files. The routes share the
+// listener with the rest of the server, which may well be reachable from the internet. Requests
+// forwarded by a reverse proxy are judged by the client addresses it reports, too.
+func localNetworkOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addresses := []string{r.RemoteAddr}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			addresses[0] = host
+		}
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			addresses = append(addresses, strings.Split(header, ",")...)
+		}
+		addresses = append(addresses, r.Header.Values("X-Real-IP")...)
+
+		for _, address := range addresses {
+			if !isLocalAddress(net.ParseIP(strings.TrimSpace(address))) {
+				http.Error(w, "DLNA is only available on the local network", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLocalAddress(ip net.IP) bool {
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast())
+}
+
+func (s *Server) serverHeader() string {
+	return fmt.Sprintf("Linux/1.0 UPnP/1.0 olaris/%s", helpers.Version)
+}
+
+type deviceDescription struct {
+	XMLName     xml.Name `xml:"urn:schemas-upnp-org:device-1-0 root"`
+	XmlnsDLNA   string   `xml:"xmlns:dlna,attr"`
+	SpecVersion struct {
+		Major int `xml:"major"`
+		Minor int `xml:"minor"`
+	} `xml:"specVersion"`
+	Device struct {
+		DeviceType      string               `xml:"deviceType"`
+		FriendlyName    string               `xml:"friendlyName"`
+		Manufacturer    string               `xml:"manufacturer"`
+		ManufacturerURL string               `xml:"manufacturerURL"`
+		ModelName       string               `xml:"modelName"`
+		ModelNumber     string               `xml:"modelNumber"`
+		UDN             string               `xml:"UDN"`
+		DLNADoc         string               `xml:"dlna:X_DLNADOC"`
+		Services        []serviceDescription `xml:"serviceList>service"`
+		PresentationURL string               `xml:"presentationURL"`
+	} `xml:"device"`
+}
+
+type serviceDescription struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceID   string `xml:"serviceId"`
+	SCPDURL     string `xml:"SCPDURL"`
+	ControlURL  string `xml:"controlURL"`
+	EventSubURL string `xml:"eventSubURL"`
+}
+
+func (s *Server) description() deviceDescription {
+	d := deviceDescription{XmlnsDLNA: "urn:schemas-dlna-org:device-1-0"}
+	d.SpecVersion.Major = 1
+	d.Device.DeviceType = deviceType
+	d.Device.FriendlyName = s.friendlyName
+	d.Device.Manufacturer = "olaris"
+	d.Device.ManufacturerURL = "https://gitlab.com/olaris/olaris-server"
+	d.Device.ModelName = "olaris-server"
+	d.Device.ModelNumber = helpers.Version
+	d.Device.UDN = s.udn
+	d.Device.DLNADoc = "DMS-1.50"
+	d.Device.Services = []serviceDescription{
+		{
+			ServiceType: contentDirectoryType,
+			ServiceID:   contentDirectoryServiceID,
+			SCPDURL:     PathPrefix + contentDirectorySCPDPath,
+			ControlURL:  PathPrefix + contentDirectoryControlPath,
+			EventSubURL: PathPrefix + contentDirectoryEventPath,
+		},
+		{
+			ServiceType: connectionManagerType,
+			ServiceID:   connectionManagerID,
+			SCPDURL:     PathPrefix + connectionManagerSCPDPath,
+			ControlURL:  PathPrefix + connectionManagerCtrlPath,
+			EventSubURL: PathPrefix + connectionManagerEventPath,
+		},
+	}
+	d.Device.PresentationURL = "/olaris/app"
+	return d
+}
+
+func (s *Server) serveDescription(w http.ResponseWriter, r *http.Request) {
+	body, err := xml.MarshalIndent(s.description(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveXML(xml.Header+string(body))(w, r)
+}
+
+func serveXML(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		w.Write([]byte(body))
+	}
+}
+
+// serveEventSubscription accepts subscriptions to state variable changes so that renderers that
+// insist on subscribing work. No events are sent, renderers poll SystemUpdateID instead.
+func serveEventSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "SUBSCRIBE" {
+		sid := r.Header.Get("SID")
+		if sid == "" {
+			sid = "uuid:" + uuid.NewV4().String()
+		}
+		w.Header().Set("SID", sid)
+		w.Header().Set("TIMEOUT", "Second-1800")
+	}
+	w.WriteHeader(http.StatusOK)
+}
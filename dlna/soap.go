@@ -0,0 +1,151 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// UPnP error codes returned in SOAP faults.
+const (
+	upnpErrorInvalidAction = 401
+	upnpErrorInvalidArgs   = 402
+	upnpErrorActionFailed  = 501
+	upnpErrorNoSuchObject  = 701
+)
+
+// upnpError is an error that is reported to the control point with its code.
+type upnpError struct {
+	Code        int
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// soapArg is an in or out argument of an action. Out arguments must be in the order the service
+// description declares them.
+type soapArg struct {
+	Name  string
+	Value string
+}
+
+type soapRequestEnvelope struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+type soapAction struct {
+	serviceType string
+	name        string
+	args        map[string]string
+}
+
+func (a soapAction) arg(name string) string {
+	return a.args[name]
+}
+
+// parseSOAPAction reads the action and its arguments from a control request.
+func parseSOAPAction(r *http.Request) (soapAction, error) {
+	// SOAPACTION: "urn:schemas-upnp-org:service:ContentDirectory:1#Browse", quotes included.
+	header := strings.Trim(r.Header.Get("SOAPACTION"), `"`)
+	hash := strings.LastIndex(header, "#")
+	if hash < 0 {
+		return soapAction{}, fmt.Errorf("invalid SOAPACTION header %q", header)
+	}
+	action := soapAction{serviceType: header[:hash], name: header[hash+1:], args: map[string]string{}}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return soapAction{}, errors.Wrap(err, "Failed to read SOAP request")
+	}
+	var envelope soapRequestEnvelope
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return soapAction{}, errors.Wrap(err, "Failed to parse SOAP request")
+	}
+	if envelope.Body.Action.XMLName.Local != action.name {
+		return soapAction{}, fmt.Errorf("SOAPACTION %s does not match body action %s",
+			action.name, envelope.Body.Action.XMLName.Local)
+	}
+	for _, a := range envelope.Body.Action.Args {
+		action.args[a.XMLName.Local] = a.Value
+	}
+	return action, nil
+}
+
+func writeSOAPResponse(w http.ResponseWriter, action soapAction, out []soapArg) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&b, `<u:%sResponse xmlns:u="%s">`, action.name, action.serviceType)
+	for _, arg := range out {
+		fmt.Fprintf(&b, "<%s>", arg.Name)
+		xml.EscapeText(&b, []byte(arg.Value))
+		fmt.Fprintf(&b, "</%s>", arg.Name)
+	}
+	fmt.Fprintf(&b, "</u:%sResponse>", action.name)
+	b.WriteString("</s:Body></s:Envelope>")
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("EXT", "")
+	w.Write([]byte(b.String()))
+}
+
+func writeSOAPFault(w http.ResponseWriter, err error) {
+	uerr, ok := err.(*upnpError)
+	if !ok {
+		log.WithError(err).Warn("DLNA action failed")
+		uerr = &upnpError{Code: upnpErrorActionFailed, Description: err.Error()}
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault>`)
+	b.WriteString(`<faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`)
+	fmt.Fprintf(&b, `<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode>`, uerr.Code)
+	b.WriteString("<errorDescription>")
+	xml.EscapeText(&b, []byte(uerr.Description))
+	b.WriteString("</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>")
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(b.String()))
+}
+
+// serveControl answers a control request with the handler of its action.
+func serveControl(w http.ResponseWriter, r *http.Request, serviceType string,
+	handlers map[string]func(*http.Request, soapAction) ([]soapArg, error)) {
+	action, err := parseSOAPAction(r)
+	if err != nil {
+		writeSOAPFault(w, &upnpError{Code: upnpErrorInvalidAction, Description: err.Error()})
+		return
+	}
+	handler, ok := handlers[action.name]
+	if !ok || action.serviceType != serviceType {
+		writeSOAPFault(w, &upnpError{Code: upnpErrorInvalidAction,
+			Description: fmt.Sprintf("unknown action %s#%s", action.serviceType, action.name)})
+		return
+	}
+	out, err := handler(r, action)
+	if err != nil {
+		writeSOAPFault(w, err)
+		return
+	}
+	writeSOAPResponse(w, action, out)
+}
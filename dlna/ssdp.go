@@ -0,0 +1,235 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ssdpMulticastAddr = "239.255.255.250:1900"
+	ssdpMaxAge        = 1800
+	// Announcements are repeated well within max-age so that renderers don't forget the server
+	// when a packet is lost.
+	ssdpAnnounceInterval = 10 * time.Minute
+)
+
+// notificationTypes returns what the server announces itself as: a root device, the device itself
+// and each of its services.
+func (s *Server) notificationTypes() []string {
+	return []string{"upnp:rootdevice", s.udn, deviceType, contentDirectoryType, connectionManagerType}
+}
+
+// usn returns the unique service name for a notification type.
+func (s *Server) usn(nt string) string {
+	if nt == s.udn {
+		return s.udn
+	}
+	return s.udn + "::" + nt
+}
+
+func (s *Server) location(ip net.IP) string {
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(ip.String(), strconv.Itoa(s.port)), PathPrefix+descriptionPath)
+}
+
+func (s *Server) notifyMessage(nt string, nts string, location string) []byte {
+	var b strings.Builder
+	b.WriteString("NOTIFY * HTTP/1.1\r\n")
+	fmt.Fprintf(&b, "HOST: %s\r\n", ssdpMulticastAddr)
+	fmt.Fprintf(&b, "NT: %s\r\n", nt)
+	fmt.Fprintf(&b, "NTS: %s\r\n", nts)
+	fmt.Fprintf(&b, "USN: %s\r\n", s.usn(nt))
+	if nts == "ssdp:alive" {
+		fmt.Fprintf(&b, "CACHE-CONTROL: max-age=%d\r\n", ssdpMaxAge)
+		fmt.Fprintf(&b, "LOCATION: %s\r\n", location)
+		fmt.Fprintf(&b, "SERVER: %s\r\n", s.serverHeader())
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// searchResponses returns the responses to an M-SEARCH request, one per matching search target,
+// and how long to wait at most before sending them. Other requests get no response.
+func (s *Server) searchResponses(request []byte, location string) ([][]byte, time.Duration) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(request)))
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+		return nil, 0
+	}
+
+	st := req.Header.Get("ST")
+	var targets []string
+	for _, nt := range s.notificationTypes() {
+		if st == "ssdp:all" || st == nt {
+			targets = append(targets, nt)
+		}
+	}
+
+	responses := [][]byte{}
+	for _, target := range targets {
+		var b strings.Builder
+		b.WriteString("HTTP/1.1 200 OK\r\n")
+		fmt.Fprintf(&b, "CACHE-CONTROL: max-age=%d\r\n", ssdpMaxAge)
+		fmt.Fprintf(&b, "DATE: %s\r\n", time.Now().UTC().Format(http.TimeFormat))
+		b.WriteString("EXT:\r\n")
+		fmt.Fprintf(&b, "LOCATION: %s\r\n", location)
+		fmt.Fprintf(&b, "SERVER: %s\r\n", s.serverHeader())
+		fmt.Fprintf(&b, "ST: %s\r\n", target)
+		fmt.Fprintf(&b, "USN: %s\r\n", s.usn(target))
+		b.WriteString("\r\n")
+		responses = append(responses, []byte(b.String()))
+	}
+
+	// MX is the number of seconds over which the control point wants responses spread out.
+	mx, _ := strconv.Atoi(req.Header.Get("MX"))
+	if mx > 5 {
+		mx = 5
+	}
+	if mx < 1 {
+		mx = 1
+	}
+	return responses, time.Duration(mx) * time.Second
+}
+
+// ssdpConn is the SSDP socket of one network interface.
+type ssdpConn struct {
+	conn  *net.UDPConn
+	ipNet *net.IPNet
+}
+
+type ssdpAnnouncer struct {
+	server *Server
+	conns  []*ssdpConn
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newSSDPAnnouncer(s *Server) (*ssdpAnnouncer, error) {
+	group, err := net.ResolveUDPAddr("udp4", ssdpMulticastAddr)
+	if err != nil {
+		return nil, err
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list network interfaces")
+	}
+
+	a := &ssdpAnnouncer{server: s, done: make(chan struct{})}
+	for i := range interfaces {
+		iface := interfaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ipNet := interfaceIPv4Net(iface)
+		if ipNet == nil {
+			continue
+		}
+		conn, err := net.ListenMulticastUDP("udp4", &iface, group)
+		if err != nil {
+			log.WithError(err).WithField("interface", iface.Name).Warn("Failed to join SSDP multicast group")
+			continue
+		}
+		a.conns = append(a.conns, &ssdpConn{conn: conn, ipNet: ipNet})
+	}
+	if len(a.conns) == 0 {
+		return nil, errors.New("No network interface to announce the DLNA server on")
+	}
+	return a, nil
+}
+
+func interfaceIPv4Net(iface net.Interface) *net.IPNet {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet
+		}
+	}
+	return nil
+}
+
+func (a *ssdpAnnouncer) run() {
+	for _, c := range a.conns {
+		a.wg.Add(1)
+		go a.serve(c)
+	}
+
+	a.notifyAll("ssdp:alive")
+	ticker := time.NewTicker(ssdpAnnounceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.notifyAll("ssdp:alive")
+		case <-a.done:
+			return
+		}
+	}
+}
+
+func (a *ssdpAnnouncer) stop() {
+	close(a.done)
+	a.notifyAll("ssdp:byebye")
+	for _, c := range a.conns {
+		c.conn.Close()
+	}
+	a.wg.Wait()
+}
+
+func (a *ssdpAnnouncer) notifyAll(nts string) {
+	group, _ := net.ResolveUDPAddr("udp4", ssdpMulticastAddr)
+	for _, c := range a.conns {
+		location := a.server.location(c.ipNet.IP)
+		for _, nt := range a.server.notificationTypes() {
+			if _, err := c.conn.WriteToUDP(a.server.notifyMessage(nt, nts, location), group); err != nil {
+				log.WithError(err).Debug("Failed to send SSDP notification")
+			}
+		}
+	}
+}
+
+// serve answers searches for the server from the network of the interface. Every socket receives
+// the searches from all interfaces, the others answer those.
+func (a *ssdpAnnouncer) serve(c *ssdpConn) {
+	defer a.wg.Done()
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-a.done:
+				return
+			default:
+			}
+			log.WithError(err).Warn("Failed to read SSDP request")
+			continue
+		}
+		if !c.ipNet.Contains(addr.IP) {
+			continue
+		}
+
+		responses, maxDelay := a.server.searchResponses(buf[:n], a.server.location(c.ipNet.IP))
+		if len(responses) == 0 {
+			continue
+		}
+		go func() {
+			time.Sleep(time.Duration(rand.Int63n(int64(maxDelay))))
+			for _, response := range responses {
+				if _, err := c.conn.WriteToUDP(response, addr); err != nil {
+					log.WithError(err).Debug("Failed to send SSDP response")
+				}
+			}
+		}()
+	}
+}
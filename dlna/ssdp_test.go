@@ -0,0 +1,64 @@
+package dlna
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mSearch(st string, mx string) []byte {
+	return []byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: " + mx + "\r\n" +
+		"ST: " + st + "\r\n\r\n")
+}
+
+func TestSearchResponses(t *testing.T) {
+	s := NewServer(Options{Port: 8080})
+	location := "http://192.168.1.2:8080/olaris/dlna/rootDesc.xml"
+
+	responses, maxDelay := s.searchResponses(mSearch("ssdp:all", "3"), location)
+	assert.Len(t, responses, 5)
+	assert.Equal(t, 3*time.Second, maxDelay)
+
+	responses, maxDelay = s.searchResponses(mSearch(contentDirectoryType, "120"), location)
+	if assert.Len(t, responses, 1) {
+		response := string(responses[0])
+		assert.True(t, strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n"))
+		assert.Contains(t, response, "\r\nST: "+contentDirectoryType+"\r\n")
+		assert.Contains(t, response, "\r\nUSN: "+s.udn+"::"+contentDirectoryType+"\r\n")
+		assert.Contains(t, response, "\r\nLOCATION: "+location+"\r\n")
+	}
+	assert.Equal(t, 5*time.Second, maxDelay)
+
+	responses, _ = s.searchResponses(mSearch(s.udn, "1"), location)
+	if assert.Len(t, responses, 1) {
+		assert.Contains(t, string(responses[0]), "\r\nUSN: "+s.udn+"\r\n")
+	}
+
+	responses, _ = s.searchResponses(mSearch("urn:schemas-upnp-org:device:MediaRenderer:1", "1"), location)
+	assert.Empty(t, responses)
+
+	notify := []byte(strings.Replace(string(mSearch("ssdp:all", "1")), "M-SEARCH", "NOTIFY", 1))
+	responses, _ = s.searchResponses(notify, location)
+	assert.Empty(t, responses)
+}
+
+func TestNotifyMessage(t *testing.T) {
+	s := NewServer(Options{Port: 8080})
+	alive := string(s.notifyMessage(deviceType, "ssdp:alive", "http://192.168.1.2:8080/olaris/dlna/rootDesc.xml"))
+	assert.True(t, strings.HasPrefix(alive, "NOTIFY * HTTP/1.1\r\n"))
+	assert.Contains(t, alive, "\r\nNT: "+deviceType+"\r\n")
+	assert.Contains(t, alive, "\r\nLOCATION: http://192.168.1.2:8080/olaris/dlna/rootDesc.xml\r\n")
+	assert.True(t, strings.HasSuffix(alive, "\r\n\r\n"))
+
+	byebye := string(s.notifyMessage(deviceType, "ssdp:byebye", ""))
+	assert.NotContains(t, byebye, "LOCATION")
+
+	// The device keeps its UDN across restarts.
+	assert.Equal(t, s.udn, NewServer(Options{Port: 8080}).udn)
+	assert.NotEqual(t, s.udn, NewServer(Options{Port: 8081}).udn)
+}
@@ -0,0 +1,188 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// LadderPolicy controls which transcoded video representations are offered for a stream.
+type LadderPolicy struct {
+	// Heights of the rungs. Rungs taller than the source are left out, we never upscale.
+	Heights []int
+	// Whether to add a rung at the source's height if it's noticeably taller than the tallest rung
+	// below it, e.g. 576 for a DVD rip.
+	SourceHeightRung bool
+	// Whether rungs are capped at the bitrate of the source. Encoding at a higher bitrate than the
+	// source only wastes bandwidth.
+	CapAtSourceBitRate bool
+	// Bitrates are multiplied by this for video with more than 30 frames per second.
+	HighFrameRateFactor float64
+}
+
+// DefaultLadderPolicy is the ladder that is used unless configured otherwise.
+var DefaultLadderPolicy = LadderPolicy{
+	Heights:             []int{360, 480, 720, 1080, 1440, 2160},
+	SourceHeightRung:    true,
+	CapAtSourceBitRate:  true,
+	HighFrameRateFactor: 1.5,
+}
+
+var ladderPolicy = DefaultLadderPolicy
+
+// SetLadderPolicy sets the policy for generating the transcoding ladder. It should be called once on
+// startup. Invalid values are replaced with the defaults.
+func SetLadderPolicy(policy LadderPolicy) {
+	heights := []int{}
+	for _, h := range policy.Heights {
+		if h >= minLadderHeight && h <= maxLadderHeight {
+			heights = append(heights, h&^1)
+		}
+	}
+	if len(heights) == 0 {
+		heights = DefaultLadderPolicy.Heights
+	}
+	sort.Ints(heights)
+	policy.Heights = heights
+	if policy.HighFrameRateFactor < 1 {
+		policy.HighFrameRateFactor = 1
+	}
+	ladderPolicy = policy
+}
+
+const (
+	minLadderHeight = 144
+	maxLadderHeight = 4320
+)
+
+// ladderBitRates are the bitrates in bits/s of video of up to 30 frames per second at the given
+// heights, per video codec. Bitrates for heights in between are interpolated.
+var ladderBitRates = map[string][]struct{ height, bitRate int }{
+	VideoCodecH264: {
+		{360, 700000}, {480, 1000000}, {720, 5000000}, {1080, 10000000}, {1440, 16000000}, {2160, 25000000}},
+	// HEVC and AV1 achieve similar quality at a considerably lower bitrate than H.264.
+	VideoCodecHEVC: {
+		{360, 400000}, {480, 600000}, {720, 3000000}, {1080, 6000000}, {1440, 10000000}, {2160, 16000000}},
+	VideoCodecAV1: {
+		{360, 350000}, {480, 500000}, {720, 2500000}, {1080, 5000000}, {1440, 8000000}, {2160, 13000000}},
+}
+
+// ladderBitRate returns the bitrate for video of the given height.
+func ladderBitRate(videoCodec string, height int) int {
+	points := ladderBitRates[videoCodec]
+	first, last := points[0], points[len(points)-1]
+	// Outside of the table, scale by the number of pixels.
+	if height <= first.height {
+		return int(float64(first.bitRate) * math.Pow(float64(height)/float64(first.height), 2))
+	}
+	if height >= last.height {
+		return int(float64(last.bitRate) * math.Pow(float64(height)/float64(last.height), 2))
+	}
+	for i := 1; i < len(points); i++ {
+		lower, upper := points[i-1], points[i]
+		if height <= upper.height {
+			return lower.bitRate + (upper.bitRate-lower.bitRate)*(height-lower.height)/(upper.height-lower.height)
+		}
+	}
+	return last.bitRate
+}
+
+// roundBitRate rounds to 50 kbit/s, or 100 kbit/s above 1 Mbit/s, to get readable preset names.
+func roundBitRate(bitRate int) int {
+	step := 50000
+	if bitRate > 1000000 {
+		step = 100000
+	}
+	rounded := (bitRate + step/2) / step * step
+	if rounded < step {
+		return step
+	}
+	return rounded
+}
+
+// ladderPresets returns the names of the presets that make up the transcoding ladder of the given
+// stream in the given video codec, lowest quality first.
+func ladderPresets(stream Stream, videoCodec string) []string {
+	policy := ladderPolicy
+
+	heights := []int{}
+	for _, h := range policy.Heights {
+		if stream.Height <= 0 || h <= stream.Height {
+			heights = append(heights, h)
+		}
+	}
+	if policy.SourceHeightRung && stream.Height >= minLadderHeight && stream.Height <= maxLadderHeight {
+		sourceHeight := stream.Height &^ 1
+		if len(heights) == 0 || sourceHeight > heights[len(heights)-1]*11/10 {
+			heights = append(heights, sourceHeight)
+		}
+	}
+	// Sources smaller than all rungs get a single rung at their own height.
+	if len(heights) == 0 {
+		heights = append(heights, stream.Height&^1)
+	}
+
+	frameRateFactor := 1.0
+	if stream.FrameRate != nil && stream.FrameRate.Cmp(big.NewRat(30, 1)) > 0 {
+		frameRateFactor = policy.HighFrameRateFactor
+	}
+
+	// Go from the top so that a rung that would have the same bitrate as the one above it after
+	// capping is left out rather than the one with the higher resolution.
+	presets := []string{}
+	previousBitRate := math.MaxInt64
+	for i := len(heights) - 1; i >= 0; i-- {
+		bitRate := int(float64(ladderBitRate(videoCodec, heights[i])) * frameRateFactor)
+		if policy.CapAtSourceBitRate && stream.BitRate > 0 && int64(bitRate) > stream.BitRate {
+			bitRate = int(stream.BitRate)
+		}
+		bitRate = roundBitRate(bitRate)
+		if bitRate >= previousBitRate {
+			continue
+		}
+		previousBitRate = bitRate
+		presets = append([]string{ladderPresetName(videoCodec, heights[i], bitRate)}, presets...)
+	}
+	return presets
+}
+
+func ladderPresetName(videoCodec string, height int, bitRate int) string {
+	if videoCodec == "" || videoCodec == VideoCodecH264 {
+		return fmt.Sprintf("%d-%dk-video", height, bitRate/1000)
+	}
+	return fmt.Sprintf("%d-%dk-%s-video", height, bitRate/1000, videoCodec)
+}
+
+var ladderPresetNameRegex = regexp.MustCompile(`^(\d+)-(\d+)k(?:-(hevc|av1))?-video$`)
+
+// isLadderPreset checks whether name is one of the presets of the ladder of the given stream.
+func isLadderPreset(stream Stream, videoCodec string, name string) bool {
+	if videoCodec == "" {
+		videoCodec = VideoCodecH264
+	}
+	for _, preset := range ladderPresets(stream, videoCodec) {
+		if preset == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLadderPresetName returns the encoder params for a preset name as generated by ladderPresets.
+func parseLadderPresetName(name string) (EncoderParams, bool) {
+	m := ladderPresetNameRegex.FindStringSubmatch(name)
+	if m == nil {
+		return EncoderParams{}, false
+	}
+	height, _ := strconv.Atoi(m[1])
+	kbits, _ := strconv.Atoi(m[2])
+	if height <= 0 || height > maxLadderHeight || height%2 != 0 || kbits < 50 || kbits > 200000 {
+		return EncoderParams{}, false
+	}
+	return EncoderParams{
+		height: height, width: -2,
+		videoBitrate: kbits * 1000, videoCodec: m[3]}, true
+}
@@ -0,0 +1,111 @@
+package ffmpeg
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLadderPresets(t *testing.T) {
+	defer SetLadderPolicy(DefaultLadderPolicy)
+	SetLadderPolicy(DefaultLadderPolicy)
+
+	fullHD := Stream{Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	assert.Equal(t,
+		[]string{"360-700k-video", "480-1000k-video", "720-5000k-video", "1080-10000k-video"},
+		ladderPresets(fullHD, VideoCodecH264))
+	assert.Equal(t,
+		[]string{"360-400k-hevc-video", "480-600k-hevc-video", "720-3000k-hevc-video", "1080-6000k-hevc-video"},
+		ladderPresets(fullHD, VideoCodecHEVC))
+
+	// A DVD rip is not upscaled, but gets a rung at its own height.
+	dvd := Stream{Width: 720, Height: 576, FrameRate: big.NewRat(25, 1), StreamType: "video"}
+	assert.Equal(t,
+		[]string{"360-700k-video", "480-1000k-video", "576-2600k-video"},
+		ladderPresets(dvd, VideoCodecH264))
+
+	uhd := Stream{Width: 3840, Height: 2160, FrameRate: big.NewRat(24000, 1001), StreamType: "video"}
+	assert.Equal(t,
+		[]string{"360-350k-av1-video", "480-500k-av1-video", "720-2500k-av1-video",
+			"1080-5000k-av1-video", "1440-8000k-av1-video", "2160-13000k-av1-video"},
+		ladderPresets(uhd, VideoCodecAV1))
+
+	// Cinemascope is barely taller than 720, no extra rung for it.
+	scope := Stream{Width: 1920, Height: 784, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	assert.Equal(t,
+		[]string{"360-700k-video", "480-1000k-video", "720-5000k-video"},
+		ladderPresets(scope, VideoCodecH264))
+
+	highFrameRate := Stream{Width: 1280, Height: 720, FrameRate: big.NewRat(60000, 1001), StreamType: "video"}
+	assert.Equal(t,
+		[]string{"360-1100k-video", "480-1500k-video", "720-7500k-video"},
+		ladderPresets(highFrameRate, VideoCodecH264))
+
+	// Rungs above the source bitrate are capped, ones that end up the same as the rung above are left out.
+	lowBitRate := Stream{Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), BitRate: 2000000, StreamType: "video"}
+	assert.Equal(t,
+		[]string{"360-700k-video", "480-1000k-video", "1080-2000k-video"},
+		ladderPresets(lowBitRate, VideoCodecH264))
+
+	tiny := Stream{Width: 320, Height: 240, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	assert.Equal(t, []string{"240-300k-video"}, ladderPresets(tiny, VideoCodecH264))
+}
+
+func TestLadderPresets_Policy(t *testing.T) {
+	defer SetLadderPolicy(DefaultLadderPolicy)
+	SetLadderPolicy(LadderPolicy{Heights: []int{1080, 540, 99999}, HighFrameRateFactor: 0})
+
+	dvd := Stream{Width: 720, Height: 576, FrameRate: big.NewRat(50, 1), BitRate: 500000, StreamType: "video"}
+	assert.Equal(t, []string{"540-2000k-video"}, ladderPresets(dvd, VideoCodecH264))
+
+	fullHD := Stream{Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	assert.Equal(t, []string{"540-2000k-video", "1080-10000k-video"}, ladderPresets(fullHD, VideoCodecH264))
+
+	// Sources smaller than all rungs aren't upscaled
+	small := Stream{Width: 640, Height: 360, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	assert.Equal(t, []string{"360-700k-video"}, ladderPresets(small, VideoCodecH264))
+	tiny := Stream{Width: 176, Height: 121, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	assert.Equal(t, []string{"120-100k-video"}, ladderPresets(tiny, VideoCodecH264))
+	_, err := GetVideoEncoderPreset(tiny, "120-100k-video")
+	assert.NoError(t, err)
+
+	SetLadderPolicy(LadderPolicy{})
+	assert.Equal(t, DefaultLadderPolicy.Heights, ladderPolicy.Heights)
+}
+
+func TestGetVideoEncoderPreset_Ladder(t *testing.T) {
+	stream := Stream{Width: 720, Height: 576, FrameRate: big.NewRat(25, 1), StreamType: "video"}
+
+	params, err := GetVideoEncoderPreset(stream, "576-2600k-video")
+	assert.NoError(t, err)
+	assert.Equal(t, 576, params.height)
+	assert.Equal(t, 2600000, params.videoBitrate)
+	assert.Equal(t, "", params.videoCodec)
+
+	params, err = GetVideoEncoderPreset(stream, "360-400k-hevc-video")
+	assert.NoError(t, err)
+	assert.Equal(t, VideoCodecHEVC, params.videoCodec)
+	assert.Regexp(t, "^hvc1\\.", params.Codecs)
+
+	// Well-formed, but not on the ladder of the stream
+	for _, name := range []string{"576-9000k-video", "1080-9800k-video", "360-50k-video", "2160-200000k-av1-video"} {
+		_, err = GetVideoEncoderPreset(stream, name)
+		assert.Error(t, err, name)
+	}
+
+	for _, name := range []string{"575-2600k-video", "100000-1000k-video", "720-1k-video", "720-1000k-vp9-video"} {
+		_, err = GetVideoEncoderPreset(stream, name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestStreamRepresentation_VideoSize(t *testing.T) {
+	stream := Stream{Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	r, err := StreamRepresentationFromRepresentationId(stream, "preset:720-5000k-video")
+	assert.NoError(t, err)
+	assert.Equal(t, 1280, r.VideoWidth())
+	assert.Equal(t, 720, r.VideoHeight())
+
+	assert.Equal(t, 0, StreamRepresentation{}.VideoWidth())
+}
@@ -0,0 +1,90 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// Chapter is a named part of a file, e.g. a scene of a movie.
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+	// Whether the chapter was generated because the file has none.
+	Generated bool
+}
+
+// GetChapters returns the chapters of the given file as stored in its container, in order.
+func GetChapters(fileLocator filesystem.FileLocator) ([]Chapter, error) {
+	container, err := Probe(fileLocator)
+	if err != nil {
+		return nil, err
+	}
+	return container.ParseChapters(), nil
+}
+
+// ParseChapters returns the chapters that ffprobe found in the container, in order.
+func (container *ProbeContainer) ParseChapters() []Chapter {
+	chapters := []Chapter{}
+	for _, c := range container.Chapters {
+		start := time.Duration(c.StartTimeSeconds * float64(time.Second))
+		end := time.Duration(c.EndTimeSeconds * float64(time.Second))
+		if end <= start {
+			continue
+		}
+		chapters = append(chapters, Chapter{Title: chapterTitle(c, len(chapters)), Start: start, End: end})
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	return chapters
+}
+
+func chapterTitle(c ProbeChapter, index int) string {
+	for k, v := range c.Tags {
+		if strings.ToLower(k) == "title" && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return fmt.Sprintf("Chapter %d", index+1)
+}
+
+// GeneratedChapterInterval returns how long generated chapters are, 0 if chapters should not be
+// generated for files without any.
+func GeneratedChapterInterval() time.Duration {
+	return viper.GetDuration("metadata.chapterInterval")
+}
+
+// GenerateChapters divides a file of the given duration into chapters of the given length. The
+// last one is shorter unless the duration is a multiple of the interval.
+func GenerateChapters(duration time.Duration, interval time.Duration) []Chapter {
+	chapters := []Chapter{}
+	if interval <= 0 {
+		return chapters
+	}
+	for start := time.Duration(0); start < duration; start += interval {
+		end := start + interval
+		if end > duration {
+			end = duration
+		}
+		chapters = append(chapters, Chapter{
+			Title:     fmt.Sprintf("Chapter %d", len(chapters)+1),
+			Start:     start,
+			End:       end,
+			Generated: true,
+		})
+	}
+	return chapters
+}
+
+// ChaptersOrGenerated returns the given chapters, or evenly spaced ones for a file of the given
+// duration if there are none and generating them is enabled.
+func ChaptersOrGenerated(chapters []Chapter, duration time.Duration) []Chapter {
+	if len(chapters) > 0 {
+		return chapters
+	}
+	return GenerateChapters(duration, GeneratedChapterInterval())
+}
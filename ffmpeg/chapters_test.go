@@ -0,0 +1,53 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeContainer_ParseChapters(t *testing.T) {
+	output := `{
+		"chapters": [
+			{"id": 1, "time_base": "1/1000", "start": 300000, "start_time": "300.000000",
+			 "end": 600500, "end_time": "600.500000", "tags": {"title": "The Heist"}},
+			{"id": 0, "time_base": "1/1000", "start": 0, "start_time": "0.000000",
+			 "end": 300000, "end_time": "300.000000", "tags": {"TITLE": " Opening "}},
+			{"id": 2, "time_base": "1/1000", "start": 600500, "start_time": "600.500000",
+			 "end": 900000, "end_time": "900.000000"},
+			{"id": 3, "time_base": "1/1000", "start": 900000, "start_time": "900.000000",
+			 "end": 900000, "end_time": "900.000000", "tags": {"title": "Empty"}}
+		]
+	}`
+	var container ProbeContainer
+	require.NoError(t, json.Unmarshal([]byte(output), &container))
+
+	assert.Equal(t, []Chapter{
+		{Title: "Opening", Start: 0, End: 300 * time.Second},
+		{Title: "The Heist", Start: 300 * time.Second, End: 600500 * time.Millisecond},
+		{Title: "Chapter 3", Start: 600500 * time.Millisecond, End: 900 * time.Second},
+	}, container.ParseChapters())
+
+	assert.Equal(t, []Chapter{}, (&ProbeContainer{}).ParseChapters())
+}
+
+func TestChaptersOrGenerated(t *testing.T) {
+	chapters := []Chapter{{Title: "Opening", Start: 0, End: time.Minute}}
+	duration := 25 * time.Minute
+
+	assert.Empty(t, ChaptersOrGenerated(nil, duration))
+	assert.Equal(t, chapters, ChaptersOrGenerated(chapters, duration))
+
+	viper.Set("metadata.chapterInterval", "10m")
+	defer viper.Set("metadata.chapterInterval", "0s")
+	assert.Equal(t, chapters, ChaptersOrGenerated(chapters, duration))
+	assert.Equal(t, []Chapter{
+		{Title: "Chapter 1", Start: 0, End: 10 * time.Minute, Generated: true},
+		{Title: "Chapter 2", Start: 10 * time.Minute, End: 20 * time.Minute, Generated: true},
+		{Title: "Chapter 3", Start: 20 * time.Minute, End: 25 * time.Minute, Generated: true},
+	}, ChaptersOrGenerated(nil, duration))
+}
@@ -1,26 +1,229 @@
 package ffmpeg
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClientCodecCapabilities describes what a client can play. All limits are optional, the zero
+// value means that the client plays everything we serve.
 type ClientCodecCapabilities struct {
+	// Exact codecs strings (https://tools.ietf.org/html/rfc6381#section-3.3) that the client plays.
 	PlayableCodecs []string `json:"playableCodecs"`
+	// Codec families that the client plays up to a certain profile and level, matched against
+	// the codecs strings in addition to PlayableCodecs.
+	CodecProfiles []CodecProfile `json:"codecProfiles"`
+
+	// Largest video size and highest video bitrate in bits/s. 0 means no limit.
+	MaxWidth   int `json:"maxWidth"`
+	MaxHeight  int `json:"maxHeight"`
+	MaxBitRate int `json:"maxBitRate"`
+	// Whether the client can display HDR video. If false, HDR video is transcoded to SDR. If true,
+	// transcodes keep it in HDR where possible. nil means unknown, clients that list the codecs of
+	// HDR video usually play it.
+	HDR *bool `json:"hdr"`
+	// Maximum number of audio channels. 0 means no limit.
+	MaxAudioChannels int `json:"maxAudioChannels"`
+	// Containers that the client can play files in directly, as named by ffprobe, e.g. "mp4" or
+	// "matroska". Without any, files are never played directly.
+	Containers []string `json:"containers"`
+}
+
+// CodecProfile describes which profiles and levels of a codec family the client plays.
+type CodecProfile struct {
+	// The part of the codecs string before the first dot, e.g. "avc1" or "hvc1".
+	Family string `json:"family"`
+	// Profiles as they appear in the codecs string, e.g. "64" (High) for avc1 or "2" (Main 10)
+	// for hvc1. No profiles means all of them.
+	Profiles []string `json:"profiles"`
+	// Highest level as a number in the codec's own notation: 41 for H.264 level 4.1, 153 for
+	// HEVC level 5.1 and 8 for AV1 level 4.0. 0 means no limit.
+	MaxLevel int `json:"maxLevel"`
 }
 
+// ParseCodecProfile parses the "<family>:<profile>,<profile>:<maxLevel>" notation used in
+// request parameters, e.g. "hvc1:1,2:153". Profiles and level may be omitted.
+func ParseCodecProfile(s string) (CodecProfile, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return CodecProfile{}, fmt.Errorf("invalid codec profile %q", s)
+	}
+	p := CodecProfile{Family: parts[0]}
+	if len(parts) > 1 && parts[1] != "" {
+		p.Profiles = strings.Split(parts[1], ",")
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		level, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return CodecProfile{}, fmt.Errorf("invalid level in codec profile %q", s)
+		}
+		p.MaxLevel = level
+	}
+	return p, nil
+}
+
+// HasCodecPreference returns whether the client stated which codecs it plays.
+func (c *ClientCodecCapabilities) HasCodecPreference() bool {
+	return len(c.PlayableCodecs) > 0 || len(c.CodecProfiles) > 0
+}
+
+// Filter returns the representations that the client can play.
 func (c *ClientCodecCapabilities) Filter(
 	representations []StreamRepresentation) []StreamRepresentation {
 	filtered := []StreamRepresentation{}
 
 	for _, r := range representations {
-		for _, playableCodec := range c.PlayableCodecs {
-			if playableCodec == r.Representation.Codecs {
-				filtered = append(filtered, r)
-			}
+		if c.CanPlay(r) {
+			filtered = append(filtered, r)
 		}
 	}
 	return filtered
 }
 
+// CanPlay returns whether the client plays the codec of the given representation and whether the
+// representation is within all of the client's limits.
 func (c *ClientCodecCapabilities) CanPlay(sr StreamRepresentation) bool {
+	if c.HasCodecPreference() && !c.canPlayCodecs(sr.Representation.Codecs) {
+		return false
+	}
+
+	switch sr.Stream.StreamType {
+	case "video":
+		width, height := representationSize(sr)
+		if c.MaxWidth > 0 && width > c.MaxWidth {
+			return false
+		}
+		if c.MaxHeight > 0 && height > c.MaxHeight {
+			return false
+		}
+		if c.MaxBitRate > 0 && sr.Representation.BitRate > c.MaxBitRate {
+			return false
+		}
+		if c.HDR != nil && !*c.HDR && sr.IsHDR() {
+			return false
+		}
+	case "audio":
+		if c.MaxAudioChannels > 0 && sr.Representation.Channels > c.MaxAudioChannels {
+			return false
+		}
+	}
+	return true
+}
+
+// KeepHDR returns the given video representations with HDR video kept in HDR where the client
+// supports it, see GetHDRVideoRepresentation. Clients have to state that they support HDR.
+func (c *ClientCodecCapabilities) KeepHDR(representations []StreamRepresentation) []StreamRepresentation {
+	if c.HDR == nil || !*c.HDR {
+		return representations
+	}
+	result := []StreamRepresentation{}
+	for _, sr := range representations {
+		if hdr, ok := GetHDRVideoRepresentation(sr); ok && c.CanPlay(hdr) {
+			sr = hdr
+		}
+		result = append(result, sr)
+	}
+	return result
+}
+
+// CanDirectPlay returns whether the client can play the file of the given streams as it is,
+// without transmuxing it. The client must support the container, the video stream and the default
+// audio stream.
+func (c *ClientCodecCapabilities) CanDirectPlay(streams *Streams) bool {
+	if !c.canPlayContainer(streams.FormatName) {
+		return false
+	}
+	if len(streams.VideoStreams) > 0 && !c.CanPlay(GetTransmuxedRepresentation(streams.GetVideoStream())) {
+		return false
+	}
+	if len(streams.AudioStreams) > 0 && !c.CanPlay(GetTransmuxedRepresentation(streams.GetDefaultAudioStream())) {
+		return false
+	}
+	return true
+}
+
+func (c *ClientCodecCapabilities) canPlayContainer(formatName string) bool {
+	// ffprobe names formats by all the containers that they cover, e.g. "mov,mp4,m4a,3gp,3g2,mj2".
+	for _, name := range strings.Split(formatName, ",") {
+		for _, container := range c.Containers {
+			if name == container {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *ClientCodecCapabilities) canPlayCodecs(codecs string) bool {
 	for _, playableCodec := range c.PlayableCodecs {
-		if playableCodec == sr.Representation.Codecs {
+		if playableCodec == codecs {
+			return true
+		}
+	}
+
+	family, profile, level := parseCodecsString(codecs)
+	for _, p := range c.CodecProfiles {
+		if p.Family != family {
+			continue
+		}
+		if len(p.Profiles) > 0 && !containsFold(p.Profiles, profile) {
+			continue
+		}
+		if p.MaxLevel > 0 && level > p.MaxLevel {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// parseCodecsString splits a codecs string into the codec family, the profile and the level.
+// Profile and level are empty and 0 for codecs that we don't know the notation of.
+func parseCodecsString(codecs string) (family string, profile string, level int) {
+	parts := strings.Split(codecs, ".")
+	family = parts[0]
+
+	switch family {
+	case "avc1", "avc3":
+		// avc1.PPCCLL with profile_idc, constraint flags and level_idc in hex
+		if len(parts) < 2 || len(parts[1]) != 6 {
+			return family, "", 0
+		}
+		l, _ := strconv.ParseInt(parts[1][4:], 16, 32)
+		return family, strings.ToUpper(parts[1][:2]), int(l)
+	case "hvc1", "hev1":
+		// hvc1.P.C.Tnnn.B0 with the profile optionally prefixed by the profile space and the
+		// level prefixed by the tier
+		if len(parts) < 4 {
+			return family, "", 0
+		}
+		l, _ := strconv.Atoi(strings.TrimLeft(parts[3], "LH"))
+		return family, strings.TrimLeft(parts[1], "ABC"), l
+	case "av01":
+		// av01.P.LLT.DD with the seq_level_idx followed by the tier
+		if len(parts) < 3 || len(parts[2]) < 2 {
+			return family, "", 0
+		}
+		l, _ := strconv.Atoi(parts[2][:2])
+		return family, parts[1], l
+	}
+	return family, "", 0
+}
+
+// representationSize returns the size of the video that the representation produces. Transcoded
+// representations may leave the width to be derived from the aspect ratio.
+func representationSize(sr StreamRepresentation) (width int, height int) {
+	width, height = sr.Representation.Width, sr.Representation.Height
+	if width <= 0 && height > 0 && sr.Stream.Height > 0 {
+		width = sr.Stream.Width * height / sr.Stream.Height
+	}
+	return width, height
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
 			return true
 		}
 	}
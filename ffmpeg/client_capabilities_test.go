@@ -0,0 +1,170 @@
+package ffmpeg
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCodecsString(t *testing.T) {
+	tests := []struct {
+		codecs  string
+		family  string
+		profile string
+		level   int
+	}{
+		{"avc1.640028", "avc1", "64", 40},
+		{"avc1.4d401f", "avc1", "4D", 31},
+		{"hvc1.2.4.L153.B0", "hvc1", "2", 153},
+		{"hvc1.1.6.L93.B0", "hvc1", "1", 93},
+		{"hev1.A1.6.H120.90", "hev1", "1", 120},
+		{"av01.0.08M.08", "av01", "0", 8},
+		{"mp4a.40.2", "mp4a", "", 0},
+		{"ec-3", "ec-3", "", 0},
+	}
+	for _, tt := range tests {
+		family, profile, level := parseCodecsString(tt.codecs)
+		assert.Equal(t, tt.family, family, tt.codecs)
+		assert.Equal(t, tt.profile, profile, tt.codecs)
+		assert.Equal(t, tt.level, level, tt.codecs)
+	}
+}
+
+func TestParseCodecProfile(t *testing.T) {
+	p, err := ParseCodecProfile("hvc1:1,2:153")
+	assert.NoError(t, err)
+	assert.Equal(t, CodecProfile{Family: "hvc1", Profiles: []string{"1", "2"}, MaxLevel: 153}, p)
+
+	p, err = ParseCodecProfile("mp4a")
+	assert.NoError(t, err)
+	assert.Equal(t, CodecProfile{Family: "mp4a"}, p)
+
+	_, err = ParseCodecProfile("avc1:64:high")
+	assert.Error(t, err)
+	_, err = ParseCodecProfile(":64")
+	assert.Error(t, err)
+}
+
+func TestClientCodecCapabilities_CanPlay(t *testing.T) {
+	video := Stream{StreamType: "video", Width: 3840, Height: 2160, Codecs: "hvc1.2.4.L153.B0", BitRate: 30000000}
+	transmuxed := GetTransmuxedRepresentation(video)
+
+	// No codecs and no limits means no preference.
+	c := ClientCodecCapabilities{}
+	assert.True(t, c.CanPlay(transmuxed))
+
+	c = ClientCodecCapabilities{PlayableCodecs: []string{"hvc1.2.4.L153.B0"}}
+	assert.True(t, c.CanPlay(transmuxed))
+
+	c = ClientCodecCapabilities{CodecProfiles: []CodecProfile{{Family: "hvc1", Profiles: []string{"1"}}}}
+	assert.False(t, c.CanPlay(transmuxed), "Main 10 isn't supported")
+	c.CodecProfiles[0].Profiles = []string{"1", "2"}
+	assert.True(t, c.CanPlay(transmuxed))
+	c.CodecProfiles[0].MaxLevel = 150
+	assert.False(t, c.CanPlay(transmuxed), "level 5.1 is too high")
+
+	c = ClientCodecCapabilities{MaxHeight: 1080}
+	assert.False(t, c.CanPlay(transmuxed))
+	c = ClientCodecCapabilities{MaxWidth: 1920}
+	assert.False(t, c.CanPlay(transmuxed))
+	c = ClientCodecCapabilities{MaxBitRate: 20000000}
+	assert.False(t, c.CanPlay(transmuxed))
+
+	hdr := video
+	hdr.ColorTransfer = "smpte2084"
+	c = ClientCodecCapabilities{}
+	assert.True(t, c.CanPlay(GetTransmuxedRepresentation(hdr)))
+	supported := false
+	c = ClientCodecCapabilities{HDR: &supported}
+	assert.False(t, c.CanPlay(GetTransmuxedRepresentation(hdr)))
+	assert.True(t, c.CanPlay(transmuxed))
+	supported = true
+	assert.True(t, c.CanPlay(GetTransmuxedRepresentation(hdr)))
+
+	audio := Stream{StreamType: "audio", Codecs: "ec-3", Channels: 6}
+	c = ClientCodecCapabilities{MaxAudioChannels: 2}
+	assert.False(t, c.CanPlay(GetTransmuxedRepresentation(audio)))
+	c.MaxAudioChannels = 6
+	assert.True(t, c.CanPlay(GetTransmuxedRepresentation(audio)))
+}
+
+func TestGetTransmuxedOrTranscodedRepresentation_Limits(t *testing.T) {
+	video := Stream{
+		StreamType: "video",
+		Width:      3840,
+		Height:     2160,
+		FrameRate:  big.NewRat(24, 1),
+		Codecs:     "avc1.640033",
+		BitRate:    40000000,
+	}
+
+	r, err := GetTransmuxedOrTranscodedRepresentation(video, ClientCodecCapabilities{})
+	assert.NoError(t, err)
+	assert.True(t, r.Representation.Transmuxed)
+
+	// Too large for the client, so the best preset that fits is used.
+	r, err = GetTransmuxedOrTranscodedRepresentation(video, ClientCodecCapabilities{MaxHeight: 1080})
+	assert.NoError(t, err)
+	assert.Equal(t, "preset:1080-10000k-video", r.Representation.RepresentationId)
+
+	r, err = GetTransmuxedOrTranscodedRepresentation(video, ClientCodecCapabilities{MaxBitRate: 6000000})
+	assert.NoError(t, err)
+	assert.Equal(t, "preset:720-5000k-video", r.Representation.RepresentationId)
+
+	// The AAC preset for clients that don't state their codecs, stereo for those that can't play more.
+	audio := Stream{StreamType: "audio", Codecs: "dts", Channels: 8}
+	r, err = GetTransmuxedOrTranscodedRepresentation(audio, ClientCodecCapabilities{MaxAudioChannels: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, "preset:384k-5.1-aac-audio", r.Representation.RepresentationId)
+	r, err = GetTransmuxedOrTranscodedRepresentation(audio, ClientCodecCapabilities{MaxAudioChannels: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, r.Representation.Channels)
+}
+
+func TestClientCodecCapabilities_CanDirectPlay(t *testing.T) {
+	streams := &Streams{
+		FormatName: "matroska,webm",
+		VideoStreams: []Stream{
+			{StreamType: "video", Width: 1920, Height: 1080, Codecs: "avc1.640028", BitRate: 8000000},
+		},
+		AudioStreams: []Stream{
+			{StreamType: "audio", Codecs: "ac-3", Channels: 6},
+			{StreamType: "audio", Codecs: "mp4a.40.2", Channels: 2, EnabledByDefault: true},
+		},
+	}
+
+	web, err := GetDeviceProfile("web")
+	assert.NoError(t, err)
+	assert.True(t, web.CanDirectPlay(streams), "the default audio stream is AAC")
+
+	streams.FormatName = "avi"
+	assert.False(t, web.CanDirectPlay(streams))
+	streams.FormatName = "matroska,webm"
+
+	streams.AudioStreams[1].EnabledByDefault = false
+	assert.False(t, web.CanDirectPlay(streams), "browsers can't play AC-3")
+
+	chromecast, err := GetDeviceProfile("chromecast")
+	assert.NoError(t, err)
+	assert.True(t, chromecast.CanDirectPlay(streams))
+
+	assert.False(t, (&ClientCodecCapabilities{}).CanDirectPlay(streams), "no containers")
+}
+
+func TestGetDeviceProfile(t *testing.T) {
+	_, err := GetDeviceProfile("toaster")
+	assert.Error(t, err)
+
+	for _, name := range DeviceProfileNames() {
+		p, err := GetDeviceProfile(name)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, p.CodecProfiles, name)
+
+		// Extending the returned profile must not change the built-in one.
+		p.PlayableCodecs = append(p.PlayableCodecs, "foo")
+		p.CodecProfiles[0].MaxLevel = 1
+		assert.Empty(t, DeviceProfiles[name].PlayableCodecs)
+		assert.NotEqual(t, 1, DeviceProfiles[name].CodecProfiles[0].MaxLevel)
+	}
+}
@@ -0,0 +1,122 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// MinCreditsDuration is the shortest stretch at the end of a file that is considered credits.
+const MinCreditsDuration = 15 * time.Second
+
+var blackDetectRegexp = regexp.MustCompile(`black_start:\s*([0-9.]+)\s+black_end:\s*([0-9.]+)`)
+var silenceStartRegexp = regexp.MustCompile(`silence_start:\s*(-?[0-9.]+)`)
+var silenceEndRegexp = regexp.MustCompile(`silence_end:\s*([0-9.]+)`)
+
+// DetectBlackAndSilence finds the black and the silent parts of the given file, starting at start.
+func DetectBlackAndSilence(
+	fileLocator filesystem.FileLocator,
+	start time.Duration,
+	totalDuration time.Duration) (black []TimeRange, silence []TimeRange, err error) {
+
+	args := []string{
+		"-hide_banner", "-nostats",
+		"-ss", fmt.Sprintf("%.3f", start.Seconds()),
+		"-i", buildFfmpegUrlFromFileLocator(fileLocator),
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", "blackdetect=d=0.5:pix_th=0.10",
+		"-af", "silencedetect=noise=-50dB:d=0.5",
+		"-f", "null",
+		"-",
+	}
+	cmd := exec.Command(executable.GetFFmpegExecutablePath(), args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	log.Debugf("Starting %s with args %s", cmd.Path, cmd.Args)
+
+	if err := cmd.Run(); err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to analyse video: %s", stderr.String())
+	}
+
+	// Seeking with -ss before -i resets the timestamps, so the output is relative to start.
+	black, silence = parseBlackAndSilence(&stderr, totalDuration-start)
+	for i := range black {
+		black[i].Start += start
+		black[i].End += start
+	}
+	for i := range silence {
+		silence[i].Start += start
+		silence[i].End += start
+	}
+	return black, silence, nil
+}
+
+// parseBlackAndSilence parses the log output of the blackdetect and silencedetect filters.
+// Silence that lasts until the end is closed at end.
+func parseBlackAndSilence(r io.Reader, end time.Duration) (black []TimeRange, silence []TimeRange) {
+	var silenceStart *time.Duration
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := blackDetectRegexp.FindStringSubmatch(line); m != nil {
+			black = append(black, TimeRange{Start: parseSeconds(m[1]), End: parseSeconds(m[2])})
+		} else if m := silenceStartRegexp.FindStringSubmatch(line); m != nil {
+			t := parseSeconds(m[1])
+			if t < 0 {
+				t = 0
+			}
+			silenceStart = &t
+		} else if m := silenceEndRegexp.FindStringSubmatch(line); m != nil && silenceStart != nil {
+			silence = append(silence, TimeRange{Start: *silenceStart, End: parseSeconds(m[1])})
+			silenceStart = nil
+		}
+	}
+	if silenceStart != nil {
+		silence = append(silence, TimeRange{Start: *silenceStart, End: end})
+	}
+	return black, silence
+}
+
+func parseSeconds(s string) time.Duration {
+	seconds, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// FindCreditsStart guesses where the credits start: most shows fade to black and silence between
+// the end of the episode and the credits. The earliest such transition that leaves at least
+// MinCreditsDuration until the end of the file is used.
+func FindCreditsStart(
+	black []TimeRange,
+	silence []TimeRange,
+	totalDuration time.Duration) (time.Duration, bool) {
+
+	var candidates []time.Duration
+	for _, b := range black {
+		for _, s := range silence {
+			if b.Overlaps(s) {
+				candidates = append(candidates, b.Start)
+				break
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+	for _, c := range candidates {
+		if totalDuration-c >= MinCreditsDuration {
+			return c, true
+		}
+	}
+	return 0, false
+}
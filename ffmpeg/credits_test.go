@@ -0,0 +1,53 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDetectOutput = `Input #0, matroska,webm, from 'episode.mkv':
+[blackdetect @ 0x55d5c8a1f2c0] black_start:12.5 black_end:14 black_duration:1.5
+[silencedetect @ 0x55d5c8a20f40] silence_start: 12.1
+[silencedetect @ 0x55d5c8a20f40] silence_end: 13.9 | silence_duration: 1.8
+[blackdetect @ 0x55d5c8a1f2c0] black_start:100.04 black_end:101.2 black_duration:1.16
+[silencedetect @ 0x55d5c8a20f40] silence_start: 280.5
+`
+
+func TestParseBlackAndSilence(t *testing.T) {
+	black, silence := parseBlackAndSilence(strings.NewReader(testDetectOutput), 300*time.Second)
+
+	assert.Equal(t, []TimeRange{
+		{Start: 12500 * time.Millisecond, End: 14 * time.Second},
+		{Start: 100040 * time.Millisecond, End: 101200 * time.Millisecond},
+	}, black)
+	assert.Equal(t, []TimeRange{
+		{Start: 12100 * time.Millisecond, End: 13900 * time.Millisecond},
+		{Start: 280500 * time.Millisecond, End: 300 * time.Second},
+	}, silence)
+}
+
+func TestFindCreditsStart(t *testing.T) {
+	black := []TimeRange{
+		{Start: 1000 * time.Second, End: 1001 * time.Second},
+		// Black but not silent, e.g. a night scene
+		{Start: 1200 * time.Second, End: 1205 * time.Second},
+		{Start: 1300 * time.Second, End: 1302 * time.Second},
+		{Start: 1395 * time.Second, End: 1400 * time.Second},
+	}
+	silence := []TimeRange{
+		{Start: 999 * time.Second, End: 1000500 * time.Millisecond},
+		{Start: 1299 * time.Second, End: 1301 * time.Second},
+		{Start: 1395 * time.Second, End: 1400 * time.Second},
+	}
+
+	start, ok := FindCreditsStart(black, silence, 1400*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 1000*time.Second, start)
+
+	// Too close to the end
+	_, ok = FindCreditsStart(black[3:], silence[2:], 1400*time.Second)
+	assert.False(t, ok)
+}
@@ -0,0 +1,109 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"sort"
+)
+
+var hdrSupported, hdrUnsupported = true, false
+
+// DeviceProfiles are the capabilities of common clients. Clients refer to them by name instead of
+// listing everything they can play.
+var DeviceProfiles = map[string]ClientCodecCapabilities{
+	// Any current desktop browser: H.264 and AAC in MP4, stereo only.
+	"web": {
+		CodecProfiles: []CodecProfile{
+			{Family: "avc1", Profiles: []string{"42", "4D", "64"}, MaxLevel: 51},
+			{Family: "mp4a"},
+			{Family: "opus"},
+		},
+		HDR:              &hdrUnsupported,
+		MaxAudioChannels: 2,
+		Containers:       []string{"mp4", "webm"},
+	},
+	"chromecast": {
+		CodecProfiles: []CodecProfile{
+			{Family: "avc1", Profiles: []string{"42", "4D", "64"}, MaxLevel: 41},
+			{Family: "mp4a"},
+			{Family: "opus"},
+			{Family: "ac-3"},
+			{Family: "ec-3"},
+		},
+		MaxWidth:   1920,
+		MaxHeight:  1080,
+		MaxBitRate: 20000000,
+		HDR:        &hdrUnsupported,
+		Containers: []string{"mp4", "webm", "matroska"},
+	},
+	"chromecast-ultra": {
+		CodecProfiles: []CodecProfile{
+			{Family: "avc1", Profiles: []string{"42", "4D", "64"}, MaxLevel: 42},
+			{Family: "hvc1", Profiles: []string{"1", "2"}, MaxLevel: 153},
+			{Family: "hev1", Profiles: []string{"1", "2"}, MaxLevel: 153},
+			{Family: "mp4a"},
+			{Family: "opus"},
+			{Family: "ac-3"},
+			{Family: "ec-3"},
+		},
+		MaxWidth:   3840,
+		MaxHeight:  2160,
+		MaxBitRate: 40000000,
+		HDR:        &hdrSupported,
+		Containers: []string{"mp4", "webm", "matroska"},
+	},
+	"apple-tv-4k": {
+		CodecProfiles: []CodecProfile{
+			{Family: "avc1", Profiles: []string{"42", "4D", "64"}, MaxLevel: 52},
+			{Family: "hvc1", Profiles: []string{"1", "2"}, MaxLevel: 153},
+			{Family: "mp4a"},
+			{Family: "ac-3"},
+			{Family: "ec-3"},
+		},
+		MaxWidth:   3840,
+		MaxHeight:  2160,
+		HDR:        &hdrSupported,
+		Containers: []string{"mp4", "mov"},
+	},
+	// A typical smart TV or console playing files from a DLNA server: H.264 up to 1080p and the
+	// common audio codecs in most containers.
+	"dlna": {
+		CodecProfiles: []CodecProfile{
+			{Family: "avc1", Profiles: []string{"42", "4D", "64"}, MaxLevel: 41},
+			{Family: "mp4a"},
+			{Family: "ac-3"},
+			{Family: "ec-3"},
+		},
+		MaxWidth:         1920,
+		MaxHeight:        1080,
+		HDR:              &hdrUnsupported,
+		MaxAudioChannels: 6,
+		Containers:       []string{"mp4", "matroska", "mpegts", "avi"},
+	},
+}
+
+// GetDeviceProfile returns the capabilities of the device profile with the given name.
+func GetDeviceProfile(name string) (ClientCodecCapabilities, error) {
+	profile, ok := DeviceProfiles[name]
+	if !ok {
+		return ClientCodecCapabilities{}, fmt.Errorf("unknown device profile %q", name)
+	}
+	// Callers add their own codecs and limits, so don't hand out the shared slices.
+	profile.PlayableCodecs = append([]string{}, profile.PlayableCodecs...)
+	profile.CodecProfiles = append([]CodecProfile{}, profile.CodecProfiles...)
+	profile.Containers = append([]string{}, profile.Containers...)
+	if profile.HDR != nil {
+		hdr := *profile.HDR
+		profile.HDR = &hdr
+	}
+	return profile, nil
+}
+
+// DeviceProfileNames returns the names of all device profiles, sorted.
+func DeviceProfileNames() []string {
+	names := []string{}
+	for name := range DeviceProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
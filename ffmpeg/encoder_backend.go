@@ -0,0 +1,179 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+)
+
+// Names of the available encoder backends, as used in the server.transcoder.backend config option.
+const (
+	EncoderBackendSoftware = "software"
+	EncoderBackendVAAPI    = "vaapi"
+	EncoderBackendNVENC    = "nvenc"
+	EncoderBackendQSV      = "qsv"
+)
+
+// EncoderBackend builds the ffmpeg arguments for one way of encoding video, e.g. in software
+// or with a particular kind of hardware acceleration.
+type EncoderBackend interface {
+	Name() string
+	// GlobalArgs are passed to ffmpeg before the input, e.g. to initialize a hardware device.
+	GlobalArgs() []string
+	// EncoderArgs select and configure the encoder for the given VideoCodec* constant.
+	EncoderArgs(videoCodec string) []string
+	// VideoFilter returns the filter chain that scales the video to the given size (one of the
+	// values may be negative, see EncoderParams) and prepares the frames for the encoder. Zero
+	// for both values means no scaling. An empty string means no filter is required.
+	VideoFilter(width int, height int) string
+}
+
+// EncoderProbeFunc runs ffmpeg with the given arguments and returns an error if it failed.
+type EncoderProbeFunc func(args []string) error
+
+var activeEncoderBackend EncoderBackend = softwareEncoderBackend{}
+
+// Codecs that activeEncoderBackend can encode. Until InitEncoderBackend is called, we simply
+// assume that the software encoders for all codecs are available.
+var supportedVideoCodecs = map[string]bool{
+	VideoCodecH264: true,
+	VideoCodecHEVC: true,
+	VideoCodecAV1:  true,
+}
+
+// NewEncoderBackend returns the encoder backend with the given name. device is backend-specific,
+// e.g. the DRM render node for VAAPI or the GPU index for NVENC. It may be empty to use the default.
+func NewEncoderBackend(name string, device string) (EncoderBackend, error) {
+	switch name {
+	case EncoderBackendSoftware, "":
+		return softwareEncoderBackend{}, nil
+	case EncoderBackendVAAPI:
+		if device == "" {
+			device = defaultVAAPIDevice
+		}
+		return vaapiEncoderBackend{device: device}, nil
+	case EncoderBackendNVENC:
+		return nvencEncoderBackend{gpu: device}, nil
+	case EncoderBackendQSV:
+		return qsvEncoderBackend{device: device}, nil
+	}
+	return nil, fmt.Errorf("unknown encoder backend \"%s\"", name)
+}
+
+// SelectEncoderBackend creates the backend with the given name and probes which video codecs it
+// can encode. If the backend doesn't exist or can't even encode H.264 on this machine, it falls
+// back to software encoding.
+func SelectEncoderBackend(name string, device string, probe EncoderProbeFunc) (EncoderBackend, map[string]bool) {
+	backend, err := NewEncoderBackend(name, device)
+	if err != nil {
+		log.WithError(err).Warnln("Falling back to software encoding")
+		backend = softwareEncoderBackend{}
+	}
+
+	codecs := ProbeVideoCodecs(backend, probe)
+	if backend.Name() != EncoderBackendSoftware && !codecs[VideoCodecH264] {
+		log.WithField("backend", backend.Name()).
+			Warnln("Encoder backend can't encode H.264 on this machine, falling back to software encoding")
+		backend = softwareEncoderBackend{}
+		codecs = ProbeVideoCodecs(backend, probe)
+	}
+
+	if backend.Name() == EncoderBackendSoftware {
+		// libx264 is what we've always used, so assume it's there even if the probe fails for
+		// some other reason.
+		codecs[VideoCodecH264] = true
+	}
+
+	return backend, codecs
+}
+
+// ProbeVideoCodecs checks which video codecs the backend can encode on this machine by encoding a
+// single frame of a generated test pattern with each of them.
+func ProbeVideoCodecs(backend EncoderBackend, probe EncoderProbeFunc) map[string]bool {
+	codecs := map[string]bool{}
+	for _, videoCodec := range videoCodecPreference {
+		err := probe(encoderProbeArgs(backend, videoCodec))
+		codecs[videoCodec] = err == nil
+
+		log.WithFields(log.Fields{
+			"backend":   backend.Name(),
+			"codec":     videoCodec,
+			"supported": err == nil,
+		}).Debugln("Probed video encoder")
+	}
+	return codecs
+}
+
+// InitEncoderBackend selects and probes the configured encoder backend. It should be called once on
+// startup before any transcoding sessions are started.
+func InitEncoderBackend(name string, device string) {
+	activeEncoderBackend, supportedVideoCodecs = SelectEncoderBackend(name, device, runEncoderProbe)
+
+	log.WithFields(log.Fields{
+		"backend": activeEncoderBackend.Name(),
+		"codecs":  supportedVideoCodecs,
+	}).Infoln("Selected video encoder backend")
+}
+
+func isVideoCodecSupported(videoCodec string) bool {
+	if videoCodec == "" {
+		videoCodec = VideoCodecH264
+	}
+	return supportedVideoCodecs[videoCodec]
+}
+
+func encoderProbeArgs(backend EncoderBackend, videoCodec string) []string {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, backend.GlobalArgs()...)
+	args = append(args, "-f", "lavfi", "-i", "testsrc2=size=640x360:rate=25:duration=1")
+	args = append(args, backend.EncoderArgs(videoCodec)...)
+	if filter := backend.VideoFilter(-2, 240); filter != "" {
+		args = append(args, "-filter:0", filter)
+	}
+	return append(args, "-frames:v", "1", "-f", "null", "-")
+}
+
+func runEncoderProbe(args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return exec.CommandContext(ctx, executable.GetFFmpegExecutablePath(), args...).Run()
+}
+
+func scaleFilter(width int, height int) string {
+	return fmt.Sprintf("scale=%d:%d", width, height)
+}
+
+// softwareEncoderBackend encodes on the CPU, using libx264, libx265 and libaom.
+type softwareEncoderBackend struct{}
+
+func (b softwareEncoderBackend) Name() string {
+	return EncoderBackendSoftware
+}
+
+func (b softwareEncoderBackend) GlobalArgs() []string {
+	return []string{}
+}
+
+func (b softwareEncoderBackend) EncoderArgs(videoCodec string) []string {
+	switch videoCodec {
+	case VideoCodecHEVC:
+		// Apple devices only play HEVC in fMP4 if it's tagged hvc1 instead of ffmpeg's default hev1.
+		return []string{"-c:0", "libx265", "-preset:0", "veryfast", "-tag:0", "hvc1",
+			"-x265-params", "log-level=error"}
+	case VideoCodecAV1:
+		return []string{"-c:0", "libaom-av1", "-usage:0", "realtime", "-cpu-used:0", "8", "-row-mt:0", "1"}
+	}
+	return []string{"-c:0", "libx264", "-preset:0", "veryfast"}
+}
+
+func (b softwareEncoderBackend) VideoFilter(width int, height int) string {
+	if width == 0 && height == 0 {
+		return ""
+	}
+	return scaleFilter(width, height)
+}
@@ -0,0 +1,112 @@
+package ffmpeg
+
+const defaultVAAPIDevice = "/dev/dri/renderD128"
+
+// hardwareEncoders maps each VideoCodec* constant to the name of the hardware encoder, minus
+// the backend-specific suffix, e.g. "h264" + "_vaapi".
+var hardwareEncoders = map[string]string{
+	VideoCodecH264: "h264",
+	VideoCodecHEVC: "hevc",
+	VideoCodecAV1:  "av1",
+}
+
+func hardwareEncoderArgs(videoCodec string, suffix string) []string {
+	encoder, ok := hardwareEncoders[videoCodec]
+	if !ok {
+		encoder = hardwareEncoders[VideoCodecH264]
+	}
+	args := []string{"-c:0", encoder + suffix}
+	if videoCodec == VideoCodecHEVC {
+		// Apple devices only play HEVC in fMP4 if it's tagged hvc1 instead of ffmpeg's default hev1.
+		args = append(args, "-tag:0", "hvc1")
+	}
+	return args
+}
+
+// hardwareUploadFilter scales in software (if required) and then uploads the frames to the
+// hardware device. Decoding and scaling are cheap compared to encoding and doing them in software
+// avoids depending on the hardware supporting the source codec.
+func hardwareUploadFilter(width int, height int, upload string) string {
+	if width == 0 && height == 0 {
+		return "format=nv12," + upload
+	}
+	return scaleFilter(width, height) + ",format=nv12," + upload
+}
+
+// vaapiEncoderBackend encodes with VA-API, usually on Intel or AMD GPUs.
+type vaapiEncoderBackend struct {
+	// DRM render node, e.g. /dev/dri/renderD128
+	device string
+}
+
+func (b vaapiEncoderBackend) Name() string {
+	return EncoderBackendVAAPI
+}
+
+func (b vaapiEncoderBackend) GlobalArgs() []string {
+	return []string{"-vaapi_device", b.device}
+}
+
+func (b vaapiEncoderBackend) EncoderArgs(videoCodec string) []string {
+	return hardwareEncoderArgs(videoCodec, "_vaapi")
+}
+
+func (b vaapiEncoderBackend) VideoFilter(width int, height int) string {
+	return hardwareUploadFilter(width, height, "hwupload")
+}
+
+// nvencEncoderBackend encodes on NVIDIA GPUs.
+type nvencEncoderBackend struct {
+	// Index of the GPU to use, empty for the default
+	gpu string
+}
+
+func (b nvencEncoderBackend) Name() string {
+	return EncoderBackendNVENC
+}
+
+func (b nvencEncoderBackend) GlobalArgs() []string {
+	return []string{}
+}
+
+func (b nvencEncoderBackend) EncoderArgs(videoCodec string) []string {
+	args := append(hardwareEncoderArgs(videoCodec, "_nvenc"), "-preset:0", "p4")
+	if b.gpu != "" {
+		args = append(args, "-gpu:0", b.gpu)
+	}
+	return args
+}
+
+func (b nvencEncoderBackend) VideoFilter(width int, height int) string {
+	// NVENC accepts frames in system memory, so no upload is required.
+	if width == 0 && height == 0 {
+		return ""
+	}
+	return scaleFilter(width, height)
+}
+
+// qsvEncoderBackend encodes with Intel Quick Sync Video.
+type qsvEncoderBackend struct {
+	// DRM render node, empty for the default
+	device string
+}
+
+func (b qsvEncoderBackend) Name() string {
+	return EncoderBackendQSV
+}
+
+func (b qsvEncoderBackend) GlobalArgs() []string {
+	device := "qsv=hw"
+	if b.device != "" {
+		device += ":" + b.device
+	}
+	return []string{"-init_hw_device", device, "-filter_hw_device", "hw"}
+}
+
+func (b qsvEncoderBackend) EncoderArgs(videoCodec string) []string {
+	return append(hardwareEncoderArgs(videoCodec, "_qsv"), "-preset:0", "veryfast")
+}
+
+func (b qsvEncoderBackend) VideoFilter(width int, height int) string {
+	return hardwareUploadFilter(width, height, "hwupload=extra_hw_frames=64")
+}
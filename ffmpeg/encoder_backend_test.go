@@ -0,0 +1,90 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProbe pretends that only the given ffmpeg encoders are available.
+func fakeProbe(availableEncoders ...string) EncoderProbeFunc {
+	return func(args []string) error {
+		joinedArgs := strings.Join(args, " ")
+		for _, encoder := range availableEncoders {
+			if strings.Contains(joinedArgs, "-c:0 "+encoder+" ") {
+				return nil
+			}
+		}
+		return fmt.Errorf("encoder not available")
+	}
+}
+
+func TestSelectEncoderBackend_DefaultsToSoftware(t *testing.T) {
+	backend, codecs := SelectEncoderBackend("", "", fakeProbe("libx264", "libx265"))
+	assert.Equal(t, EncoderBackendSoftware, backend.Name())
+	assert.Equal(t, map[string]bool{
+		VideoCodecH264: true,
+		VideoCodecHEVC: true,
+		VideoCodecAV1:  false,
+	}, codecs)
+}
+
+func TestSelectEncoderBackend_SoftwareAlwaysSupportsH264(t *testing.T) {
+	backend, codecs := SelectEncoderBackend(EncoderBackendSoftware, "", fakeProbe())
+	assert.Equal(t, EncoderBackendSoftware, backend.Name())
+	assert.True(t, codecs[VideoCodecH264])
+	assert.False(t, codecs[VideoCodecHEVC])
+}
+
+func TestSelectEncoderBackend_Hardware(t *testing.T) {
+	backend, codecs := SelectEncoderBackend(
+		EncoderBackendVAAPI, "/dev/dri/renderD129", fakeProbe("h264_vaapi", "hevc_vaapi"))
+	assert.Equal(t, EncoderBackendVAAPI, backend.Name())
+	assert.Equal(t, []string{"-vaapi_device", "/dev/dri/renderD129"}, backend.GlobalArgs())
+	assert.Equal(t, map[string]bool{
+		VideoCodecH264: true,
+		VideoCodecHEVC: true,
+		VideoCodecAV1:  false,
+	}, codecs)
+}
+
+func TestSelectEncoderBackend_FallbackWhenHardwareUnavailable(t *testing.T) {
+	backend, codecs := SelectEncoderBackend(EncoderBackendNVENC, "", fakeProbe("libx264"))
+	assert.Equal(t, EncoderBackendSoftware, backend.Name())
+	assert.True(t, codecs[VideoCodecH264])
+}
+
+func TestSelectEncoderBackend_Unknown(t *testing.T) {
+	backend, _ := SelectEncoderBackend("voodoo", "", fakeProbe("libx264"))
+	assert.Equal(t, EncoderBackendSoftware, backend.Name())
+}
+
+func TestEncoderBackend_VideoFilter(t *testing.T) {
+	software, _ := NewEncoderBackend(EncoderBackendSoftware, "")
+	assert.Equal(t, "", software.VideoFilter(0, 0))
+	assert.Equal(t, "scale=-2:720", software.VideoFilter(-2, 720))
+
+	vaapi, _ := NewEncoderBackend(EncoderBackendVAAPI, "")
+	assert.Equal(t, "format=nv12,hwupload", vaapi.VideoFilter(0, 0))
+	assert.Equal(t, "scale=-2:720,format=nv12,hwupload", vaapi.VideoFilter(-2, 720))
+
+	qsv, _ := NewEncoderBackend(EncoderBackendQSV, "")
+	assert.Equal(t, []string{"-c:0", "hevc_qsv", "-tag:0", "hvc1", "-preset:0", "veryfast"},
+		qsv.EncoderArgs(VideoCodecHEVC))
+}
+
+func TestStreamRepresentationFromRepresentationId_UnsupportedCodec(t *testing.T) {
+	defer func(codecs map[string]bool) { supportedVideoCodecs = codecs }(supportedVideoCodecs)
+	supportedVideoCodecs = map[string]bool{VideoCodecH264: true}
+	stream := Stream{Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+
+	_, err := StreamRepresentationFromRepresentationId(stream, "preset:720-5000k-video")
+	assert.NoError(t, err)
+	_, err = StreamRepresentationFromRepresentationId(stream, "preset:720-3000k-hevc-video")
+	assert.Error(t, err, "HEVC presets can't be requested if the backend can't encode HEVC")
+	_, err = StreamRepresentationFromRepresentationId(stream, "burn:3:preset:720-3000k-hevc-video")
+	assert.Error(t, err)
+}
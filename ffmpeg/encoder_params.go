@@ -13,11 +13,83 @@ type EncoderParams struct {
 	height       int
 	videoBitrate int
 	audioBitrate int
+	// One of the VideoCodec* constants. Empty means H.264 for backwards compatibility.
+	videoCodec string
+	// Stream ID of a bitmap subtitle stream that is overlaid on the video. 0 for none, which is
+	// unambiguous because the first stream of a file is never a subtitle stream we burn in.
+	burnInSubtitleStreamId int64
+	// One of the AudioCodec* constants. Empty means AAC for backwards compatibility.
+	audioCodec string
+	// Number of audio channels. 0 means stereo for backwards compatibility.
+	audioChannels int
+	// Whether HDR video stays HDR instead of being tone mapped to SDR, see GetHDRVideoRepresentation.
+	keepHDR bool
 
 	// The codecs (https://tools.ietf.org/html/rfc6381#section-3.3) that these params will produce.
 	Codecs string
 }
 
+// channels returns the number of audio channels that these params produce.
+func (p EncoderParams) channels() int {
+	if p.audioChannels == 0 {
+		return 2
+	}
+	return p.audioChannels
+}
+
+// encoderParamsGob mirrors EncoderParams with exported fields, gob ignores unexported ones.
+type encoderParamsGob struct {
+	Width                  int
+	Height                 int
+	VideoBitrate           int
+	AudioBitrate           int
+	VideoCodec             string
+	BurnInSubtitleStreamId int64
+	AudioCodec             string
+	AudioChannels          int
+	KeepHDR                bool
+	Codecs                 string
+}
+
+// GobEncode implements gob.GobEncoder so that the unexported fields survive in representation IDs.
+func (p EncoderParams) GobEncode() ([]byte, error) {
+	b := bytes.Buffer{}
+	err := gob.NewEncoder(&b).Encode(encoderParamsGob{
+		Width:                  p.width,
+		Height:                 p.height,
+		VideoBitrate:           p.videoBitrate,
+		AudioBitrate:           p.audioBitrate,
+		VideoCodec:             p.videoCodec,
+		BurnInSubtitleStreamId: p.burnInSubtitleStreamId,
+		AudioCodec:             p.audioCodec,
+		AudioChannels:          p.audioChannels,
+		KeepHDR:                p.keepHDR,
+		Codecs:                 p.Codecs,
+	})
+	return b.Bytes(), err
+}
+
+// GobDecode implements gob.GobDecoder.
+func (p *EncoderParams) GobDecode(data []byte) error {
+	g := encoderParamsGob{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g); err != nil {
+		return err
+	}
+	*p = EncoderParams{
+		width:                  g.Width,
+		height:                 g.Height,
+		videoBitrate:           g.VideoBitrate,
+		audioBitrate:           g.AudioBitrate,
+		videoCodec:             g.VideoCodec,
+		burnInSubtitleStreamId: g.BurnInSubtitleStreamId,
+		audioCodec:             g.AudioCodec,
+		audioChannels:          g.AudioChannels,
+		keepHDR:                g.KeepHDR,
+		Codecs:                 g.Codecs,
+	}
+	return nil
+}
+
 func EncoderParamsToString(m EncoderParams) string {
 	b := bytes.Buffer{}
 	e := gob.NewEncoder(&b)
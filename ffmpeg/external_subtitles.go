@@ -0,0 +1,318 @@
+package ffmpeg
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/helpers"
+)
+
+// Extensions of the subtitle files that we pick up next to media files, with the name ffmpeg
+// uses for their codec.
+var externalSubtitleCodecs = map[string]string{
+	".srt": "subrip",
+	".ass": "ass",
+	".ssa": "ass",
+	".vtt": "webvtt",
+	// MicroDVD. A .sub file next to an .idx file of the same name is VobSub instead, which we
+	// skip because bitmap subtitles can only be burnt in from the media file itself.
+	".sub": "microdvd",
+}
+
+// Names of the folders next to media files that subtitles are commonly kept in, lowercase.
+var subtitleDirNames = map[string]bool{
+	"subs":      true,
+	"subtitles": true,
+}
+
+// Markers in subtitle filenames, lowercase. "hi" and "cc" are only recognised after the language
+// because "hi" is also the code for Hindi.
+var forcedSubtitleMarkers = map[string]bool{"forced": true, "foreign": true}
+var hearingImpairedSubtitleMarkers = map[string]bool{"sdh": true}
+var hearingImpairedSubtitleMarkersAfterLanguage = map[string]bool{"hi": true, "cc": true}
+
+// humanizedToLangTag with lowercase keys, for matching filenames like "movie.english.srt"
+var lowercaseHumanizedToLangTag = func() map[string]string {
+	m := map[string]string{}
+	for humanized, tag := range humanizedToLangTag {
+		m[strings.ToLower(humanized)] = tag
+	}
+	return m
+}()
+
+// externalSubtitleFile is a subtitle file that belongs to a media file.
+type externalSubtitleFile struct {
+	fileLocator filesystem.FileLocator
+	codecName   string
+	// The part of the name between the media file name and the extension, e.g. ".en.forced"
+	tag string
+}
+
+// ErrSubtitleAlreadyDownloaded is returned when saving a subtitle that has been downloaded before.
+var ErrSubtitleAlreadyDownloaded = errors.New("subtitle has already been downloaded")
+
+// DownloadedSubtitle is a subtitle file downloaded from an online database for a media file.
+type DownloadedSubtitle struct {
+	// ID of the subtitle at the provider, unique among the subtitles of a media file
+	ID string
+	// FileName is the name the provider gave the file, only its extension is used.
+	FileName        string
+	Language        string
+	Forced          bool
+	HearingImpaired bool
+	Data            []byte
+}
+
+// GetDownloadedSubtitlesDir returns the directory that subtitles downloaded for the given media
+// file are kept in. Unlike sidecar files, they work for read-only libraries as well.
+func GetDownloadedSubtitlesDir(fileLocator filesystem.FileLocator) string {
+	hash := sha1.Sum([]byte(fileLocator.String()))
+	return path.Join(viper.GetString("server.cacheDir"), "subtitles", hex.EncodeToString(hash[:]))
+}
+
+// SaveDownloadedSubtitle stores a subtitle file downloaded for the given media file, which is
+// picked up like the sidecar files from then on, and returns its stream.
+func SaveDownloadedSubtitle(
+	fileLocator filesystem.FileLocator,
+	sub DownloadedSubtitle,
+	duration time.Duration) (Stream, error) {
+
+	ext := strings.ToLower(path.Ext(sub.FileName))
+	codecName, ok := externalSubtitleCodecs[ext]
+	if !ok {
+		return Stream{}, fmt.Errorf("unsupported subtitle format \"%s\"", ext)
+	}
+
+	lang := sub.Language
+	if lang == "" {
+		lang = "unk"
+	}
+	// The ID comes first so that the rest of the name can be parsed like the names of sidecar files.
+	name := strings.NewReplacer(".", "-", "/", "-", "_", "-").Replace(sub.ID) + "." + lang
+	if sub.Forced {
+		name += ".forced"
+	}
+	if sub.HearingImpaired {
+		name += ".sdh"
+	}
+	name += ext
+
+	dir := GetDownloadedSubtitlesDir(fileLocator)
+	if err := helpers.EnsurePath(dir); err != nil {
+		return Stream{}, err
+	}
+	f, err := os.OpenFile(path.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return Stream{}, ErrSubtitleAlreadyDownloaded
+	} else if err != nil {
+		return Stream{}, err
+	}
+	_, err = f.Write(sub.Data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return Stream{}, err
+	}
+
+	return externalSubtitleStream(externalSubtitleFile{
+		fileLocator: filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: path.Join(dir, name)},
+		codecName:   codecName,
+		tag:         name[strings.Index(name, ".") : len(name)-len(ext)],
+	}, duration), nil
+}
+
+// buildExternalSubtitleStreams finds the subtitle files that belong to the given media file,
+// either next to it, in a Subs folder or among the downloaded subtitles, in any backend.
+func buildExternalSubtitleStreams(
+	fileLocator filesystem.FileLocator,
+	duration time.Duration) ([]Stream, error) {
+
+	dir := filesystem.FileLocator{Backend: fileLocator.Backend, Path: path.Dir(fileLocator.Path)}
+	mediaName := strings.TrimSuffix(path.Base(fileLocator.Path), path.Ext(fileLocator.Path))
+
+	files := findExternalSubtitleFiles(dir, mediaName)
+	files = append(files, findDownloadedSubtitleFiles(fileLocator)...)
+
+	streams := []Stream{}
+	for _, f := range files {
+		streams = append(streams, externalSubtitleStream(f, duration))
+	}
+	return streams, nil
+}
+
+func externalSubtitleStream(f externalSubtitleFile, duration time.Duration) Stream {
+	lang, forced, hearingImpaired := parseSubtitleFileTag(f.tag)
+	return Stream{
+		StreamKey: StreamKey{
+			FileLocator: f.fileLocator,
+			StreamId:    0,
+		},
+		TotalDuration:    duration,
+		StreamType:       "subtitle",
+		CodecName:        f.codecName,
+		Language:         lang,
+		Title:            externalSubtitleTitle(lang, forced, hearingImpaired),
+		EnabledByDefault: false,
+		Forced:           forced,
+		HearingImpaired:  hearingImpaired,
+	}
+}
+
+// findDownloadedSubtitleFiles returns the subtitle files saved by SaveDownloadedSubtitle.
+func findDownloadedSubtitleFiles(fileLocator filesystem.FileLocator) []externalSubtitleFile {
+	dir := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: GetDownloadedSubtitlesDir(fileLocator)}
+	node, err := filesystem.GetNodeFromFileLocator(dir)
+	if err != nil {
+		// Nothing has been downloaded for this file
+		return nil
+	}
+	files := subtitleFilesIn(node, dir, "")
+	for i := range files {
+		// Skip the ID
+		if dot := strings.Index(files[i].tag, "."); dot >= 0 {
+			files[i].tag = files[i].tag[dot:]
+		}
+	}
+	return files
+}
+
+func findExternalSubtitleFiles(dir filesystem.FileLocator, mediaName string) []externalSubtitleFile {
+	node, err := filesystem.GetNodeFromFileLocator(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir.String()).Debugln("Failed to look for external subtitles")
+		return nil
+	}
+	files := subtitleFilesIn(node, dir, mediaName)
+
+	subDirs, _ := node.ListDir()
+	for _, subDir := range subDirs {
+		if !subtitleDirNames[strings.ToLower(subDir)] {
+			continue
+		}
+		subsDir := filesystem.FileLocator{Backend: dir.Backend, Path: path.Join(dir.Path, subDir)}
+		subsNode, err := filesystem.GetNodeFromFileLocator(subsDir)
+		if err != nil {
+			continue
+		}
+		files = append(files, subtitleFilesIn(subsNode, subsDir, mediaName)...)
+
+		// Releases of whole seasons often have a folder per episode in there, containing files
+		// like "2_English.srt".
+		mediaDirs, _ := subsNode.ListDir()
+		for _, mediaDir := range mediaDirs {
+			if mediaDir != mediaName {
+				continue
+			}
+			mediaSubsDir := filesystem.FileLocator{Backend: dir.Backend, Path: path.Join(subsDir.Path, mediaDir)}
+			if mediaSubsNode, err := filesystem.GetNodeFromFileLocator(mediaSubsDir); err == nil {
+				files = append(files, subtitleFilesIn(mediaSubsNode, mediaSubsDir, "")...)
+			}
+		}
+	}
+	return files
+}
+
+// subtitleFilesIn returns the subtitle files in the given directory whose names start with prefix.
+func subtitleFilesIn(node filesystem.Node, dir filesystem.FileLocator, prefix string) []externalSubtitleFile {
+	names, err := node.ListFiles()
+	if err != nil {
+		return nil
+	}
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[strings.ToLower(name)] = true
+	}
+
+	files := []externalSubtitleFile{}
+	for _, name := range names {
+		ext := path.Ext(name)
+		codecName, ok := externalSubtitleCodecs[strings.ToLower(ext)]
+		if !ok {
+			continue
+		}
+		nameWithoutExt := strings.TrimSuffix(name, ext)
+		if !strings.HasPrefix(nameWithoutExt, prefix) {
+			continue
+		}
+		tag := nameWithoutExt[len(prefix):]
+		// Don't pick up the subtitles of "Movie 2.mkv" for "Movie.mkv"
+		if prefix != "" && tag != "" && tag[0] != '.' && tag[0] != '_' {
+			continue
+		}
+		if codecName == "microdvd" && exists[strings.ToLower(nameWithoutExt)+".idx"] {
+			continue
+		}
+		files = append(files, externalSubtitleFile{
+			fileLocator: filesystem.FileLocator{Backend: dir.Backend, Path: path.Join(dir.Path, name)},
+			codecName:   codecName,
+			tag:         tag,
+		})
+	}
+	return files
+}
+
+// parseSubtitleFileTag extracts the language and markers from the part of a subtitle filename
+// after the media file name, e.g. ".en.forced", ".English.SDH" or "2_English".
+func parseSubtitleFileTag(tag string) (lang string, forced bool, hearingImpaired bool) {
+	tokens := strings.FieldsFunc(tag, func(r rune) bool {
+		return r == '.' || r == '_' || r == ' '
+	})
+	for _, token := range tokens {
+		lower := strings.ToLower(token)
+		switch {
+		case forcedSubtitleMarkers[lower]:
+			forced = true
+		case hearingImpairedSubtitleMarkers[lower]:
+			hearingImpaired = true
+		case lang != "" && hearingImpairedSubtitleMarkersAfterLanguage[lower]:
+			hearingImpaired = true
+		case lang != "" || isNumeric(token):
+			// Track numbers and anything else after the language, e.g. the name of the release group
+		default:
+			if langTag, ok := lowercaseHumanizedToLangTag[lower]; ok {
+				// The language is spelled out, e.g. "English" or "Polski"
+				lang = langTag
+			} else {
+				lang = token
+			}
+		}
+	}
+	if lang == "" {
+		lang = "unk"
+	}
+	return lang, forced, hearingImpaired
+}
+
+func externalSubtitleTitle(lang string, forced bool, hearingImpaired bool) string {
+	title := lang
+	if humanized, ok := langTagToHumanized[lang]; ok {
+		title = humanized
+	}
+	if forced {
+		title += " (Forced)"
+	}
+	if hearingImpaired {
+		title += " (SDH)"
+	}
+	return title
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
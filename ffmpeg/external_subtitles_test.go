@@ -0,0 +1,155 @@
+package ffmpeg
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+func TestParseSubtitleFileTag(t *testing.T) {
+	tests := []struct {
+		tag             string
+		lang            string
+		forced          bool
+		hearingImpaired bool
+	}{
+		{"", "unk", false, false},
+		{".en", "en", false, false},
+		{".eng", "eng", false, false},
+		{".English", "eng", false, false},
+		{".en.forced", "en", true, false},
+		{".forced.en", "en", true, false},
+		{".de.FOREIGN", "de", true, false},
+		{".en.sdh", "en", false, true},
+		{".en.hi", "en", false, true},
+		{".en.cc", "en", false, true},
+		{".hi", "hi", false, false},
+		{"_2_English", "eng", false, false},
+		{"2_English.SDH", "eng", false, true},
+		{".en.GROUP", "en", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			lang, forced, hearingImpaired := parseSubtitleFileTag(tt.tag)
+			assert.Equal(t, tt.lang, lang)
+			assert.Equal(t, tt.forced, forced)
+			assert.Equal(t, tt.hearingImpaired, hearingImpaired)
+		})
+	}
+}
+
+func TestExternalSubtitleTitle(t *testing.T) {
+	assert.Equal(t, "English", externalSubtitleTitle("eng", false, false))
+	assert.Equal(t, "English (Forced)", externalSubtitleTitle("eng", true, false))
+	assert.Equal(t, "English (SDH)", externalSubtitleTitle("eng", false, true))
+	assert.Equal(t, "xx", externalSubtitleTitle("xx", false, false))
+}
+
+func TestBuildExternalSubtitleStreams(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"Movie.mkv",
+		"Movie.en.srt",
+		"Movie.ger.forced.ass",
+		"Movie.en.sdh.vtt",
+		"Movie.fr.ssa",
+		"Movie.nl.sub",
+		// VobSub, which can't be used
+		"Movie.es.idx",
+		"Movie.es.sub",
+		// Belongs to another file
+		"Movie 2.en.srt",
+		"Movie.en.txt",
+		"Subs/Movie.it.srt",
+		"Subs/Other.en.srt",
+		"Subs/Movie/2_English.srt",
+		"Subs/Movie/3_Polish.srt",
+	}
+	for _, f := range files {
+		require.NoError(t, os.MkdirAll(path.Dir(path.Join(dir, f)), 0755))
+		require.NoError(t, os.WriteFile(path.Join(dir, f), []byte{}, 0644))
+	}
+
+	streams, err := buildExternalSubtitleStreams(
+		filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: path.Join(dir, "Movie.mkv")},
+		time.Hour)
+	require.NoError(t, err)
+
+	found := map[string]Stream{}
+	for _, s := range streams {
+		rel := s.FileLocator.Path[len(dir)+1:]
+		found[rel] = s
+		assert.Equal(t, "subtitle", s.StreamType)
+		assert.Equal(t, time.Hour, s.TotalDuration)
+	}
+	assert.Len(t, found, 8)
+
+	assert.Equal(t, "subrip", found["Movie.en.srt"].CodecName)
+	assert.Equal(t, "en", found["Movie.en.srt"].Language)
+
+	assert.Equal(t, "ass", found["Movie.ger.forced.ass"].CodecName)
+	assert.True(t, found["Movie.ger.forced.ass"].Forced)
+	assert.Equal(t, "German (Forced)", found["Movie.ger.forced.ass"].Title)
+
+	assert.Equal(t, "webvtt", found["Movie.en.sdh.vtt"].CodecName)
+	assert.True(t, found["Movie.en.sdh.vtt"].HearingImpaired)
+
+	assert.Equal(t, "ass", found["Movie.fr.ssa"].CodecName)
+	assert.Equal(t, "microdvd", found["Movie.nl.sub"].CodecName)
+	assert.NotContains(t, found, "Movie.es.sub")
+
+	assert.Equal(t, "it", found["Subs/Movie.it.srt"].Language)
+	assert.Equal(t, "eng", found["Subs/Movie/2_English.srt"].Language)
+	assert.Equal(t, "pol", found["Subs/Movie/3_Polish.srt"].Language)
+}
+
+func TestAssSubtitleArgs(t *testing.T) {
+	args := assSubtitleArgs(StreamKey{
+		FileLocator: filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/movies/movie.mkv"},
+		StreamId:    4,
+	})
+	assert.Contains(t, args, "file:///movies/movie.mkv")
+	assert.Equal(t, []string{"-map", "0:4", "-c:s", "copy", "-f", "ass", "-"}, args[len(args)-7:])
+}
+
+func TestSaveDownloadedSubtitle(t *testing.T) {
+	viper.Set("server.cacheDir", t.TempDir())
+	defer viper.Set("server.cacheDir", "")
+
+	mediaDir := t.TempDir()
+	mediaFile := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: path.Join(mediaDir, "Movie.mkv")}
+	require.NoError(t, os.WriteFile(mediaFile.Path, []byte{}, 0644))
+
+	sub := DownloadedSubtitle{
+		ID:              "opensubtitles-101",
+		FileName:        "Movie.2019.720p.WEB.srt",
+		Language:        "eng",
+		HearingImpaired: true,
+		Data:            []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n"),
+	}
+	stream, err := SaveDownloadedSubtitle(mediaFile, sub, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "subrip", stream.CodecName)
+	assert.Equal(t, "eng", stream.Language)
+	assert.True(t, stream.HearingImpaired)
+	assert.Equal(t, "English (SDH)", stream.Title)
+	assert.Equal(t, GetDownloadedSubtitlesDir(mediaFile), path.Dir(stream.FileLocator.Path))
+
+	_, err = SaveDownloadedSubtitle(mediaFile, sub, time.Hour)
+	assert.Equal(t, ErrSubtitleAlreadyDownloaded, err)
+
+	sub.FileName = "subtitle.exe"
+	_, err = SaveDownloadedSubtitle(mediaFile, sub, time.Hour)
+	assert.Error(t, err)
+
+	// It's found like the sidecar files
+	streams, err := buildExternalSubtitleStreams(mediaFile, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []Stream{stream}, streams)
+}
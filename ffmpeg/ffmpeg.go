@@ -25,6 +25,8 @@ type Representation struct {
 	Container string
 	// codecs string ready for DASH/HLS serving
 	Codecs string
+	// Number of audio channels, 0 for video
+	Channels int
 
 	// Mutually exclusive
 	Transcoded bool
@@ -36,6 +38,30 @@ type StreamRepresentation struct {
 	Representation Representation
 }
 
+// IsHDR returns whether the representation produces HDR video. Transcoding tone maps HDR video to
+// SDR unless the representation keeps it in HDR.
+func (sr StreamRepresentation) IsHDR() bool {
+	return sr.Stream.IsHDR() && (!sr.Representation.Transcoded || sr.Representation.encoderParams.keepHDR)
+}
+
+// VideoWidth returns the width of the video that the representation produces, 0 if unknown.
+func (sr StreamRepresentation) VideoWidth() int {
+	width, _ := representationSize(sr)
+	if width < 0 {
+		return 0
+	}
+	return width
+}
+
+// VideoHeight returns the height of the video that the representation produces, 0 if unknown.
+func (sr StreamRepresentation) VideoHeight() int {
+	_, height := representationSize(sr)
+	if height < 0 {
+		return 0
+	}
+	return height
+}
+
 // SegmentDuration defines the duration of segments that ffmpeg will generate. In the transmuxing case this is really
 // just a minimum time, the actual segments will be longer because they are cut at keyframes. For transcoding, we can
 // force keyframes to occur exactly every SegmentDuration, so SegmentDuration will be the actual duration of the
@@ -64,11 +90,23 @@ func GetTransmuxedOrTranscodedRepresentation(
 	capabilities ClientCodecCapabilities) (StreamRepresentation, error) {
 
 	transmuxed := GetTransmuxedRepresentation(stream)
-	// We interpret empty PlayableCodecs as no preference
-	if len(capabilities.PlayableCodecs) == 0 || capabilities.CanPlay(transmuxed) {
+	// Capabilities without any codecs or limits allow everything
+	if capabilities.CanPlay(transmuxed) {
 		return transmuxed, nil
 	}
-	return GetSimilarTranscodedRepresentation(stream), nil
+	if stream.StreamType == "audio" {
+		return GetPreferredTranscodedAudioRepresentation(stream, capabilities), nil
+	}
+
+	similar := GetSimilarTranscodedRepresentation(stream)
+	if stream.StreamType == "video" && !capabilities.CanPlay(similar) {
+		// Most likely the video is too large for the client, use the best preset that fits.
+		presets := GetPreferredPresetVideoRepresentations(stream, capabilities)
+		if len(presets) > 0 {
+			return presets[len(presets)-1], nil
+		}
+	}
+	return similar, nil
 }
 
 func GetSimilarTranscodedRepresentation(stream Stream) StreamRepresentation {
@@ -98,20 +136,60 @@ func StreamRepresentationFromRepresentationId(
 	representationId string) (StreamRepresentation, error) {
 
 	if s.StreamType == "subtitle" {
+		if s.IsBitmapSubtitle() {
+			return StreamRepresentation{},
+				fmt.Errorf("Bitmap subtitle stream %d of %s can't be converted to WebVTT", s.StreamId, s.FileLocator)
+		}
 		return GetSubtitleStreamRepresentation(s), nil
 	}
 
+	if strings.HasPrefix(representationId, "burn:") && s.StreamType == "video" {
+		subtitleStreamId, baseRepresentationId, err := parseBurnInRepresentationId(representationId)
+		if err != nil {
+			return StreamRepresentation{}, err
+		}
+		base, err := StreamRepresentationFromRepresentationId(s, baseRepresentationId)
+		if err != nil {
+			return StreamRepresentation{}, err
+		}
+		if !base.Representation.Transcoded {
+			return StreamRepresentation{}, fmt.Errorf("Subtitles can only be burnt into transcoded video")
+		}
+		return GetBurnInVideoRepresentation(base, Stream{StreamKey: StreamKey{StreamId: subtitleStreamId}}), nil
+	}
+
+	if strings.HasPrefix(representationId, hdrRepresentationIdPrefix) && s.StreamType == "video" {
+		base, err := StreamRepresentationFromRepresentationId(s, strings.TrimPrefix(representationId, hdrRepresentationIdPrefix))
+		if err != nil {
+			return StreamRepresentation{}, err
+		}
+		hdr, ok := GetHDRVideoRepresentation(base)
+		if !ok {
+			return StreamRepresentation{}, fmt.Errorf("Representation %s can't keep the video in HDR", representationId)
+		}
+		return hdr, nil
+	}
+
 	if representationId == "direct" {
 		return GetTransmuxedRepresentation(s), nil
 	} else if strings.HasPrefix(representationId, "preset:") {
 		presetId := representationId[7:]
 
-		encoderParams, err := GetVideoEncoderPreset(s, presetId)
-		if err == nil {
-			return GetTranscodedVideoRepresentation(s, representationId, encoderParams), nil
-		}
-		if encoderParams, ok := AudioEncoderPresets[presetId]; ok {
-			return GetTranscodedAudioRepresentation(s, representationId, encoderParams), nil
+		// Preset names are unique across video and audio, but only apply the ones matching the stream type
+		// so that e.g. an HEVC preset can't be requested for an audio stream.
+		if s.StreamType == "video" {
+			encoderParams, err := GetVideoEncoderPreset(s, presetId)
+			if err == nil {
+				if !isVideoCodecSupported(encoderParams.videoCodec) {
+					return StreamRepresentation{},
+						fmt.Errorf("The encoder backend can't encode preset %s", presetId)
+				}
+				return GetTranscodedVideoRepresentation(s, representationId, encoderParams), nil
+			}
+		} else if s.StreamType == "audio" {
+			if encoderParams, ok := AudioEncoderPresets[presetId]; ok {
+				return GetTranscodedAudioRepresentation(s, representationId, encoderParams), nil
+			}
 		}
 	} else if strings.HasPrefix(representationId, "transcode:") {
 		encoderParamsStr := representationId[10:]
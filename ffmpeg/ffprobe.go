@@ -14,7 +14,6 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -23,6 +22,16 @@ var extraDataRegex = regexp.MustCompile(`0{8}: \d{2}(.{2})\s(.{4})`)
 type ProbeContainer struct {
 	Streams []ProbeStream `json:"streams"`
 	Format  ProbeFormat   `json:"format"`
+	// nil if the file was probed before chapters were, empty if it has none.
+	Chapters []ProbeChapter `json:"chapters"`
+}
+
+// ProbeChapter is a chapter of the container, as reported by ffprobe.
+type ProbeChapter struct {
+	ID               int64             `json:"id"`
+	StartTimeSeconds float64           `json:"start_time,string"`
+	EndTimeSeconds   float64           `json:"end_time,string"`
+	Tags             map[string]string `json:"tags"`
 }
 
 type ProbeStream struct {
@@ -44,6 +53,12 @@ type ProbeStream struct {
 	TimeBase      string            `json:"time_base"`
 	DurationTs    int               `json:"duration_ts"`
 	RFrameRate    string            `json:"r_frame_rate"`
+	ColorTransfer string            `json:"color_transfer"`
+	// Only relevant for video
+	ColorPrimaries   string `json:"color_primaries"`
+	ColorSpace       string `json:"color_space"`
+	PixFmt           string `json:"pix_fmt"`
+	BitsPerRawSample string `json:"bits_per_raw_sample"`
 }
 
 func (ps *ProbeStream) String() string {
@@ -71,9 +86,63 @@ func (self *ProbeStream) GetMime() string {
 	if self.CodecName == "aac" {
 		return fmt.Sprintf("mp4a.40.2")
 	}
+	// The names used in MP4, which differ from ffprobe's codec names
+	if mime, ok := audioCodecMimes[self.CodecName]; ok {
+		return mime
+	}
 	return self.CodecName
 }
 
+var audioCodecMimes = map[string]string{
+	"ac3":  "ac-3",
+	"eac3": "ec-3",
+	"flac": "fLaC",
+}
+
+// Number of channels of ffmpeg's standard channel layouts
+var channelLayoutChannels = map[string]int{
+	"mono":      1,
+	"stereo":    2,
+	"2.1":       3,
+	"3.0":       3,
+	"quad":      4,
+	"4.0":       4,
+	"5.0":       5,
+	"5.0(side)": 5,
+	"5.1":       6,
+	"5.1(side)": 6,
+	"6.1":       7,
+	"7.1":       8,
+	"7.1(wide)": 8,
+}
+
+var pixFmtBitDepthRegex = regexp.MustCompile(`p(\d+)(le|be)?$`)
+
+// GetBitDepth returns the number of bits per colour component of a video stream, 0 if unknown.
+func (self *ProbeStream) GetBitDepth() int {
+	if bits, err := strconv.Atoi(self.BitsPerRawSample); err == nil && bits > 0 {
+		return bits
+	}
+	// Formats like yuv420p10le carry the depth in their name, the plain ones have 8 bits.
+	if m := pixFmtBitDepthRegex.FindStringSubmatch(self.PixFmt); m != nil {
+		bits, _ := strconv.Atoi(m[1])
+		return bits
+	}
+	if self.PixFmt != "" {
+		return 8
+	}
+	return 0
+}
+
+// GetChannels returns the number of audio channels, derived from the channel layout if ffprobe
+// didn't report it.
+func (self *ProbeStream) GetChannels() int {
+	if self.Channels > 0 {
+		return self.Channels
+	}
+	return channelLayoutChannels[self.ChannelLayout]
+}
+
 type ProbeFormat struct {
 	Filename         string            `json:"filename"`
 	NBStreams        int               `json:"nb_streams"`
@@ -96,23 +165,22 @@ type ProbeData struct {
 	Format *ProbeFormat `json:"format,omitempty"`
 }
 
-// TODO: limit size of cache, possibly user-configurable?
-var probeCache = map[filesystem.FileLocator]ProbeContainer{}
-var probeMutex = &sync.Mutex{}
-
 // Probe analyzes the given file, attempting to parse the container's metadata
-// and discover the number and types of streams contained within. Metadata from probed
-// files is cached in a global probeCache, with access restricted by the probeMutex.
+// and discover the number and types of streams contained within. The results are cached in
+// memory and, if a ProbeStore is set, persistently, until the size or modification time of the
+// file changes.
 func Probe(fileLocator filesystem.FileLocator) (*ProbeContainer, error) {
 	log.WithFields(log.Fields{"fileLocator": fileLocator}).Debugln("Probing file")
 
 	// TODO: add per-file mutex lock to try to avoid double-scanning things
-	probeMutex.Lock()
-	probedFile, inCache := probeCache[fileLocator]
-	probeMutex.Unlock()
-
-	if inCache {
-		return &probedFile, nil
+	node, err := filesystem.GetNodeFromFileLocator(fileLocator)
+	if err != nil {
+		return nil, err
+	}
+	cached := getCachedProbeResult(node)
+	if cached != nil && cached.isComplete() {
+		container := cached.Container
+		return &container, nil
 	}
 
 	log.WithFields(log.Fields{"fileLocator": fileLocator}).
@@ -122,6 +190,7 @@ func Probe(fileLocator filesystem.FileLocator) (*ProbeContainer, error) {
 		executable.GetFFprobeExecutablePath(),
 		"-show_data",
 		"-show_format",
+		"-show_chapters",
 		"-show_streams", ffmpegUrl, "-print_format", "json", "-v", "quiet")
 	cmd.Stderr = os.Stderr
 
@@ -157,9 +226,21 @@ func Probe(fileLocator filesystem.FileLocator) (*ProbeContainer, error) {
 		return nil, fmt.Errorf("no streams found, is this an actual media file")
 	}
 
-	probeMutex.Lock()
-	probeCache[fileLocator] = v
-	probeMutex.Unlock()
+	if v.Chapters == nil {
+		v.Chapters = []ProbeChapter{}
+	}
+
+	result := &ProbeResult{
+		FileLocator: fileLocator,
+		Size:        node.Size(),
+		ModTime:     node.ModTime(),
+		Container:   v,
+	}
+	if cached != nil {
+		// Only the chapters were missing, keep what was probed since.
+		result.Keyframes = cached.Keyframes
+	}
+	cacheProbeResult(result)
 
 	return &v, nil
 }
@@ -2,9 +2,15 @@ package ffmpeg
 
 import (
 	_ "bytes"
+	"encoding/json"
+	"io/ioutil"
 	"math/big"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"gitlab.com/olaris/olaris-server/filesystem"
 )
 
 func Test_parseRational(t *testing.T) {
@@ -48,3 +54,144 @@ func Test_parseRational(t *testing.T) {
 		})
 	}
 }
+
+func TestProbeStream_GetChannels(t *testing.T) {
+	tests := []struct {
+		stream ProbeStream
+		want   int
+	}{
+		{ProbeStream{Channels: 6, ChannelLayout: "5.1(side)"}, 6},
+		{ProbeStream{ChannelLayout: "5.1(side)"}, 6},
+		{ProbeStream{ChannelLayout: "7.1"}, 8},
+		{ProbeStream{ChannelLayout: "stereo"}, 2},
+		{ProbeStream{}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.stream.GetChannels(); got != tt.want {
+			t.Errorf("GetChannels() for %q = %d, want %d", tt.stream.ChannelLayout, got, tt.want)
+		}
+	}
+}
+
+func TestProbeStream_GetMime_Audio(t *testing.T) {
+	for codecName, want := range map[string]string{
+		"aac":  "mp4a.40.2",
+		"eac3": "ec-3",
+		"ac3":  "ac-3",
+		"opus": "opus",
+		"flac": "fLaC",
+	} {
+		s := ProbeStream{CodecName: codecName, CodecType: "audio"}
+		if got := s.GetMime(); got != want {
+			t.Errorf("GetMime() for %s = %s, want %s", codecName, got, want)
+		}
+	}
+}
+
+// streamsFromFixture builds the streams from a saved ffprobe output in testdata/ffprobe.
+func streamsFromFixture(t *testing.T, name string) *Streams {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "ffprobe", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := ProbeContainer{}
+	if err := json.Unmarshal(data, &container); err != nil {
+		t.Fatal(err)
+	}
+	fileLocator := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/nonexistent/" + name}
+	streams, err := streamsFromProbeContainer(fileLocator, &container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return streams
+}
+
+func TestStreamsFromProbeContainer_HDR(t *testing.T) {
+	tests := []struct {
+		fixture        string
+		hdr            bool
+		colorTransfer  string
+		colorPrimaries string
+		bitDepth       int
+		// Prefix of the filter that converts the video to 8-bit SDR when transcoding
+		sourceFilter string
+	}{
+		{"hdr10_hevc.json", true, "smpte2084", "bt2020", 10, "zscale=tin=smpte2084:pin=bt2020:"},
+		{"hlg_hevc.json", true, "arib-std-b67", "bt2020", 10, "zscale=tin=arib-std-b67:pin=bt2020:"},
+		{"sdr_10bit_hevc.json", false, "bt709", "bt709", 10, "format=yuv420p"},
+		{"sdr_h264.json", false, "", "", 8, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			video := streamsFromFixture(t, tt.fixture).GetVideoStream()
+			if video.IsHDR() != tt.hdr {
+				t.Errorf("IsHDR() = %v, want %v", video.IsHDR(), tt.hdr)
+			}
+			if video.ColorTransfer != tt.colorTransfer {
+				t.Errorf("ColorTransfer = %q, want %q", video.ColorTransfer, tt.colorTransfer)
+			}
+			if video.ColorPrimaries != tt.colorPrimaries {
+				t.Errorf("ColorPrimaries = %q, want %q", video.ColorPrimaries, tt.colorPrimaries)
+			}
+			if video.BitDepth != tt.bitDepth {
+				t.Errorf("BitDepth = %d, want %d", video.BitDepth, tt.bitDepth)
+			}
+			filter := sourceVideoFilter(video)
+			if !strings.HasPrefix(filter, tt.sourceFilter) || (tt.sourceFilter == "") != (filter == "") {
+				t.Errorf("sourceVideoFilter() = %q, want prefix %q", filter, tt.sourceFilter)
+			}
+			if tt.hdr && !strings.HasSuffix(filter, "tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p") {
+				t.Errorf("sourceVideoFilter() = %q doesn't tone map to BT.709", filter)
+			}
+		})
+	}
+}
+
+func TestStreamsFromProbeContainer(t *testing.T) {
+	streams := streamsFromFixture(t, "hdr10_hevc.json")
+	if streams.FormatName != "matroska,webm" {
+		t.Errorf("FormatName = %q", streams.FormatName)
+	}
+
+	video := streams.GetVideoStream()
+	// Matroska doesn't have per-stream bitrates.
+	if video.BitRate != 53062402 {
+		t.Errorf("BitRate = %d, want the overall bitrate", video.BitRate)
+	}
+	if video.Width != 3840 || video.Height != 2160 {
+		t.Errorf("size = %dx%d", video.Width, video.Height)
+	}
+
+	if len(streams.AudioStreams) != 1 {
+		t.Fatalf("got %d audio streams", len(streams.AudioStreams))
+	}
+	audio := streams.AudioStreams[0]
+	if audio.Codecs != "ec-3" || audio.Channels != 6 || audio.ChannelLayout != "5.1(side)" {
+		t.Errorf("audio = %s with %d channels (%s)", audio.Codecs, audio.Channels, audio.ChannelLayout)
+	}
+
+	video = streamsFromFixture(t, "sdr_h264.json").GetVideoStream()
+	if video.Codecs != "avc1.64001f" {
+		t.Errorf("Codecs = %q", video.Codecs)
+	}
+}
+
+func TestProbeStream_GetBitDepth(t *testing.T) {
+	tests := []struct {
+		stream ProbeStream
+		want   int
+	}{
+		{ProbeStream{BitsPerRawSample: "10", PixFmt: "yuv420p10le"}, 10},
+		{ProbeStream{PixFmt: "yuv420p10le"}, 10},
+		{ProbeStream{PixFmt: "yuv444p12be"}, 12},
+		{ProbeStream{PixFmt: "yuv420p"}, 8},
+		{ProbeStream{PixFmt: "nv12"}, 8},
+		{ProbeStream{}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.stream.GetBitDepth(); got != tt.want {
+			t.Errorf("GetBitDepth() for %q = %d, want %d", tt.stream.PixFmt, got, tt.want)
+		}
+	}
+}
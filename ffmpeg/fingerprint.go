@@ -0,0 +1,203 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// The fingerprint follows Haitsma and Kalker, "A Highly Robust Audio Fingerprinting System":
+// every frame is reduced to 32 bits describing how the energy in neighbouring frequency bands
+// changes compared to the previous frame.
+const (
+	fingerprintSampleRate = 8000
+	fingerprintFrameSize  = 2048
+	fingerprintHopSize    = 1024
+	fingerprintMinFreq    = 300
+	fingerprintMaxFreq    = 2000
+	fingerprintBands      = 33
+)
+
+// FingerprintFrameDuration is the time between two values of an audio fingerprint.
+const FingerprintFrameDuration = time.Second * fingerprintHopSize / fingerprintSampleRate
+
+// silentFrame is the fingerprint value of frames without sound, which never match.
+const silentFrame = 0
+
+const (
+	// Maximum number of differing bits for two fingerprint values to be considered a match.
+	fingerprintMaxBitErrors = 8
+	// Number of consecutive mismatching values tolerated within a common segment.
+	fingerprintMaxGap = 4
+)
+
+// TimeRange is a part of a media file.
+type TimeRange struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Duration returns the length of the range.
+func (r TimeRange) Duration() time.Duration {
+	return r.End - r.Start
+}
+
+// Overlaps checks whether the two ranges have any time in common.
+func (r TimeRange) Overlaps(o TimeRange) bool {
+	return r.Start < o.End && o.Start < r.End
+}
+
+// AudioFingerprint computes the acoustic fingerprint of the first duration of the file's
+// first audio stream, with one value every FingerprintFrameDuration.
+func AudioFingerprint(fileLocator filesystem.FileLocator, duration time.Duration) ([]uint32, error) {
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-i", buildFfmpegUrlFromFileLocator(fileLocator),
+		"-t", fmt.Sprintf("%.3f", duration.Seconds()),
+		"-map", "0:a:0",
+		"-ac", "1",
+		"-ar", fmt.Sprintf("%d", fingerprintSampleRate),
+		"-f", "s16le",
+		"-",
+	}
+	cmd := exec.Command(executable.GetFFmpegExecutablePath(), args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	log.Debugf("Starting %s with args %s", cmd.Path, cmd.Args)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode audio: %s", stderr.String())
+	}
+
+	samples := make([]float64, len(out)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(out[2*i:]))) / math.MaxInt16
+	}
+	return Fingerprint(samples), nil
+}
+
+// Fingerprint computes the fingerprint of mono audio samples at 8kHz.
+func Fingerprint(samples []float64) []uint32 {
+	window := make([]float64, fingerprintFrameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(fingerprintFrameSize-1))
+	}
+	bandEdges := make([]int, fingerprintBands+1)
+	for b := range bandEdges {
+		freq := fingerprintMinFreq * math.Pow(
+			float64(fingerprintMaxFreq)/fingerprintMinFreq, float64(b)/fingerprintBands)
+		bandEdges[b] = int(freq * fingerprintFrameSize / fingerprintSampleRate)
+	}
+
+	var fingerprint []uint32
+	var previous []float64
+	frame := make([]complex128, fingerprintFrameSize)
+	for offset := 0; offset+fingerprintFrameSize <= len(samples); offset += fingerprintHopSize {
+		var total float64
+		for i := range frame {
+			frame[i] = complex(samples[offset+i]*window[i], 0)
+		}
+		fft(frame)
+
+		energies := make([]float64, fingerprintBands)
+		for b := range energies {
+			for k := bandEdges[b]; k < bandEdges[b+1]; k++ {
+				energies[b] += real(frame[k])*real(frame[k]) + imag(frame[k])*imag(frame[k])
+			}
+			total += energies[b]
+		}
+
+		if previous != nil {
+			var value uint32
+			for b := 0; b < fingerprintBands-1; b++ {
+				if energies[b]-energies[b+1]-(previous[b]-previous[b+1]) > 0 {
+					value |= 1 << uint(b)
+				}
+			}
+			if total < 1e-6 {
+				value = silentFrame
+			}
+			fingerprint = append(fingerprint, value)
+		}
+		previous = energies
+	}
+	return fingerprint
+}
+
+// fft is an in-place radix-2 fast Fourier transform. len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := x[start+k]
+				v := x[start+k+size/2] * w
+				x[start+k] = u + v
+				x[start+k+size/2] = u - v
+				w *= step
+			}
+		}
+	}
+}
+
+// FindCommonSegment finds the longest stretch of audio that occurs in both fingerprints,
+// e.g. the intro shared by two episodes. It returns the segment's position in a and in b.
+func FindCommonSegment(a []uint32, b []uint32, minDuration time.Duration) (TimeRange, TimeRange, bool) {
+	var bestLength, bestA, bestB int
+
+	// Try every alignment of the two fingerprints and look for the longest run of matches.
+	for shift := -(len(b) - 1); shift < len(a); shift++ {
+		runStart, lastMatch := -1, -1
+		i := 0
+		if shift > 0 {
+			i = shift
+		}
+		for ; i < len(a) && i-shift < len(b); i++ {
+			j := i - shift
+			if a[i] != silentFrame && b[j] != silentFrame &&
+				bits.OnesCount32(a[i]^b[j]) <= fingerprintMaxBitErrors {
+				if runStart < 0 || i-lastMatch > fingerprintMaxGap {
+					runStart = i
+				}
+				lastMatch = i
+				if length := lastMatch - runStart + 1; length > bestLength {
+					bestLength, bestA, bestB = length, runStart, runStart-shift
+				}
+			}
+		}
+	}
+
+	if time.Duration(bestLength)*FingerprintFrameDuration < minDuration {
+		return TimeRange{}, TimeRange{}, false
+	}
+	toRange := func(start int) TimeRange {
+		return TimeRange{
+			Start: time.Duration(start) * FingerprintFrameDuration,
+			End:   time.Duration(start+bestLength) * FingerprintFrameDuration,
+		}
+	}
+	return toRange(bestA), toRange(bestB), true
+}
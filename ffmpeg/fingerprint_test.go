@@ -0,0 +1,58 @@
+package ffmpeg
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAudio generates noise, which is different for every seed.
+func testAudio(seconds int, seed int64) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	samples := make([]float64, seconds*fingerprintSampleRate)
+	for i := range samples {
+		samples[i] = r.Float64() - 0.5
+	}
+	return samples
+}
+
+func concat(parts ...[]float64) (samples []float64) {
+	for _, p := range parts {
+		samples = append(samples, p...)
+	}
+	return samples
+}
+
+func TestFindCommonSegment(t *testing.T) {
+	intro := testAudio(32, 1)
+	a := Fingerprint(concat(testAudio(64, 2), intro, testAudio(64, 3)))
+	b := Fingerprint(concat(testAudio(128, 4), intro, testAudio(32, 5)))
+
+	inA, inB, ok := FindCommonSegment(a, b, 15*time.Second)
+	require.True(t, ok)
+
+	assert.InDelta(t, 64, inA.Start.Seconds(), 1)
+	assert.InDelta(t, 96, inA.End.Seconds(), 1)
+	assert.InDelta(t, 128, inB.Start.Seconds(), 1)
+	assert.InDelta(t, 160, inB.End.Seconds(), 1)
+}
+
+func TestFindCommonSegment_NothingShared(t *testing.T) {
+	a := Fingerprint(testAudio(64, 1))
+	b := Fingerprint(testAudio(64, 2))
+
+	_, _, ok := FindCommonSegment(a, b, 15*time.Second)
+	assert.False(t, ok)
+}
+
+func TestFindCommonSegment_SilenceDoesNotMatch(t *testing.T) {
+	silence := make([]float64, 32*fingerprintSampleRate)
+	a := Fingerprint(concat(silence, testAudio(32, 1)))
+	b := Fingerprint(concat(silence, testAudio(32, 2)))
+
+	_, _, ok := FindCommonSegment(a, b, 15*time.Second)
+	assert.False(t, ok)
+}
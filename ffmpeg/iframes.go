@@ -0,0 +1,263 @@
+package ffmpeg
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/helpers"
+)
+
+// IFrameRepresentationId identifies the representation of a video stream that only contains its
+// keyframes, one per segment. Clients use it for fast forward and rewind and for thumbnails while
+// scrubbing.
+const IFrameRepresentationId = "iframes"
+
+const (
+	// I-frames are small previews, there's no point in sending them at full resolution.
+	iFrameHeight = 360
+	// Rough size in bytes of a keyframe at iFrameHeight, to estimate the bitrate.
+	iFrameSizeEstimate = 30000
+	// I-frames closer together than this are counted as this far apart when estimating the peak
+	// bitrate.
+	minIFrameInterval = 500 * time.Millisecond
+)
+
+// IFrameSegment is a segment of the I-frame representation. It contains the keyframe at Start,
+// which is shown until the next keyframe.
+type IFrameSegment struct {
+	Start    time.Duration
+	Duration time.Duration
+}
+
+// IFrameSegments builds the I-frame segments from the keyframe timestamps of a stream.
+func IFrameSegments(keyframes []time.Duration, totalDuration time.Duration) []IFrameSegment {
+	segments := []IFrameSegment{}
+	for i, k := range keyframes {
+		end := totalDuration
+		if i+1 < len(keyframes) {
+			end = keyframes[i+1]
+		}
+		if end <= k {
+			continue
+		}
+		segments = append(segments, IFrameSegment{Start: k, Duration: end - k})
+	}
+	return segments
+}
+
+// GetCachedIFrameSegments returns the I-frame segments of the given video stream if its keyframes
+// are already known. Otherwise it returns nil and, for local files, starts finding them in the
+// background so that they are available for the next playback. Remote files would have to be
+// downloaded completely for that, their keyframes are found along with the trickplay thumbnails.
+func GetCachedIFrameSegments(stream Stream) []IFrameSegment {
+	if keyframes := getCachedKeyframes(stream.FileLocator); keyframes != nil {
+		return IFrameSegments(keyframes, stream.TotalDuration)
+	}
+	if stream.FileLocator.Backend == filesystem.BackendLocal {
+		probeKeyframesInBackground(stream.FileLocator)
+	}
+	return nil
+}
+
+var keyframeProbesInProgress = map[filesystem.FileLocator]bool{}
+var keyframeProbesMutex = &sync.Mutex{}
+
+func probeKeyframesInBackground(fileLocator filesystem.FileLocator) {
+	keyframeProbesMutex.Lock()
+	defer keyframeProbesMutex.Unlock()
+	if keyframeProbesInProgress[fileLocator] {
+		return
+	}
+	keyframeProbesInProgress[fileLocator] = true
+
+	go func() {
+		if _, err := ProbeKeyframes(fileLocator); err != nil {
+			log.WithError(err).WithField("fileLocator", fileLocator).Warnln("Failed to find keyframes")
+		}
+		keyframeProbesMutex.Lock()
+		delete(keyframeProbesInProgress, fileLocator)
+		keyframeProbesMutex.Unlock()
+	}()
+}
+
+// GetIFrameRepresentation returns the I-frame representation of the given video stream. The
+// keyframes are scaled down and re-encoded as H.264 so that every client can decode them.
+func GetIFrameRepresentation(stream Stream, segments []IFrameSegment) StreamRepresentation {
+	height := iFrameHeight
+	if stream.Height > 0 && stream.Height < height {
+		height = stream.Height &^ 1
+	}
+	width := height * 16 / 9
+	if stream.Width > 0 && stream.Height > 0 {
+		width, height = scalePreserveAspectRatio(stream.Width, stream.Height, -2, height)
+	}
+
+	// BANDWIDTH of an I-frame playlist is the peak bitrate, i.e. that of the shortest segment.
+	shortest := time.Duration(0)
+	for _, s := range segments {
+		if shortest == 0 || s.Duration < shortest {
+			shortest = s.Duration
+		}
+	}
+	if shortest < minIFrameInterval {
+		shortest = minIFrameInterval
+	}
+	bitRate := int(float64(iFrameSizeEstimate*8) / shortest.Seconds())
+
+	frameRate := stream.FrameRate
+	if frameRate == nil {
+		frameRate = big.NewRat(24, 1)
+	}
+	encoderParams := EncoderParams{
+		width:        -2,
+		height:       height,
+		videoBitrate: bitRate,
+		videoCodec:   VideoCodecH264,
+		Codecs:       GetAVC1Tag(width, height, int64(bitRate), frameRate),
+	}
+
+	return StreamRepresentation{
+		Stream: stream,
+		Representation: Representation{
+			RepresentationId: IFrameRepresentationId,
+			BitRate:          bitRate,
+			Width:            width,
+			Height:           height,
+			Container:        "video/mp4",
+			Codecs:           encoderParams.Codecs,
+			Transcoded:       true,
+			encoderParams:    encoderParams,
+		},
+	}
+}
+
+// IFrameInitFileName is the name of the initialization segment that all I-frame segments of a
+// stream share.
+const IFrameInitFileName = "init.mp4"
+
+// GetIFrameDir returns the directory that the I-frame segments of the given file are stored in,
+// in a subdirectory per stream.
+func GetIFrameDir(fileLocator filesystem.FileLocator) string {
+	hash := sha1.Sum([]byte(fileLocator.String()))
+	return path.Join(viper.GetString("server.cacheDir"), "iframes", hex.EncodeToString(hash[:]))
+}
+
+// DeleteIFrames removes the I-frame segments of the given file.
+func DeleteIFrames(fileLocator filesystem.FileLocator) error {
+	return os.RemoveAll(GetIFrameDir(fileLocator))
+}
+
+func getIFrameStreamDir(streamKey StreamKey) string {
+	return path.Join(GetIFrameDir(streamKey.FileLocator), strconv.FormatInt(streamKey.StreamId, 10))
+}
+
+// maxIFrameExtractions is the maximum number of ffmpeg processes that extract I-frames at once.
+// Clients request many of them in quick succession while scrubbing.
+const maxIFrameExtractions = 2
+
+var iFrameExtractions = make(chan struct{}, maxIFrameExtractions)
+
+// GetIFrameSegmentPath returns the path of the given I-frame segment of the stream, extracting it
+// from the file if that wasn't done before. The initialization segment is written along with the
+// first segment that is extracted.
+func GetIFrameSegmentPath(sr StreamRepresentation, segments []IFrameSegment, segmentIdx int) (string, error) {
+	if segmentIdx < 0 || segmentIdx >= len(segments) {
+		return "", fmt.Errorf("no I-frame segment %d", segmentIdx)
+	}
+	dir := getIFrameStreamDir(sr.Stream.StreamKey)
+	segmentPath := path.Join(dir, fmt.Sprintf("%d.m4s", segmentIdx))
+	if _, err := os.Stat(segmentPath); err == nil {
+		return segmentPath, nil
+	}
+
+	iFrameExtractions <- struct{}{}
+	defer func() { <-iFrameExtractions }()
+	// Another request may have extracted it while we were waiting.
+	if _, err := os.Stat(segmentPath); err == nil {
+		return segmentPath, nil
+	}
+
+	if err := helpers.EnsurePath(dir); err != nil {
+		return "", err
+	}
+	tmpDir, err := ioutil.TempDir(dir, "extract-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := runIFrameFFmpeg(sr, segments[segmentIdx], tmpDir); err != nil {
+		return "", errors.Wrap(err, "Failed to extract I-frame")
+	}
+
+	// All segments are encoded with the same settings, so any of their initialization segments
+	// works for all of them.
+	initPath := path.Join(dir, IFrameInitFileName)
+	if _, err := os.Stat(initPath); os.IsNotExist(err) {
+		if err := os.Rename(path.Join(tmpDir, IFrameInitFileName), initPath); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Rename(path.Join(tmpDir, "segment.m4s"), segmentPath); err != nil {
+		return "", err
+	}
+	return segmentPath, nil
+}
+
+// GetIFrameInitPath returns the path of the initialization segment of the I-frame representation.
+func GetIFrameInitPath(sr StreamRepresentation, segments []IFrameSegment) (string, error) {
+	initPath := path.Join(getIFrameStreamDir(sr.Stream.StreamKey), IFrameInitFileName)
+	if _, err := os.Stat(initPath); err == nil {
+		return initPath, nil
+	}
+	if _, err := GetIFrameSegmentPath(sr, segments, 0); err != nil {
+		return "", err
+	}
+	return initPath, nil
+}
+
+func runIFrameFFmpeg(sr StreamRepresentation, segment IFrameSegment, outputDir string) error {
+	encoderParams := sr.Representation.encoderParams
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		// The segment starts at a keyframe, so seeking before the input lands exactly on it.
+		"-ss", fmt.Sprintf("%.3f", segment.Start.Seconds()),
+		"-i", buildFfmpegUrlFromFileLocator(sr.Stream.FileLocator),
+		"-copyts",
+		"-map", fmt.Sprintf("0:%d", sr.Stream.StreamId),
+		"-frames:v", "1",
+		"-filter:0", joinFilters(
+			sourceVideoFilter(sr.Stream),
+			scaleFilter(encoderParams.width, encoderParams.height)),
+		"-c:0", "libx264", "-preset:0", "veryfast", "-pix_fmt", "yuv420p",
+		"-x264-params", "keyint=1",
+		"-video_track_timescale", "1000",
+		"-f", "hls",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", IFrameInitFileName,
+		"-hls_segment_filename", path.Join(outputDir, "segment.m4s"),
+		"-hls_playlist_type", "vod",
+		path.Join(outputDir, "generated_by_ffmpeg.m3u8"),
+	}
+
+	cmd := exec.Command(executable.GetFFmpegExecutablePath(), args...)
+	if viper.GetBool("debug.transcoderLog") {
+		cmd.Stderr = os.Stderr
+	}
+	log.Debugf("Starting %s with args %s", cmd.Path, cmd.Args)
+	return cmd.Run()
+}
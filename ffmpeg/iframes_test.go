@@ -0,0 +1,36 @@
+package ffmpeg
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIFrameSegments(t *testing.T) {
+	keyframes := []time.Duration{0, 2 * time.Second, 2 * time.Second, 5 * time.Second}
+	assert.Equal(t, []IFrameSegment{
+		{Start: 0, Duration: 2 * time.Second},
+		{Start: 2 * time.Second, Duration: 3 * time.Second},
+		{Start: 5 * time.Second, Duration: time.Second},
+	}, IFrameSegments(keyframes, 6*time.Second))
+
+	assert.Empty(t, IFrameSegments(nil, 6*time.Second))
+}
+
+func TestGetIFrameRepresentation(t *testing.T) {
+	segments := []IFrameSegment{{Start: 0, Duration: 100 * time.Millisecond}, {Start: 100 * time.Millisecond, Duration: time.Second}}
+
+	stream := Stream{Width: 1920, Height: 800, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	r := GetIFrameRepresentation(stream, segments)
+	assert.Equal(t, IFrameRepresentationId, r.Representation.RepresentationId)
+	assert.Equal(t, 864, r.VideoWidth())
+	assert.Equal(t, 360, r.VideoHeight())
+	// Segments shorter than minIFrameInterval don't inflate the bitrate.
+	assert.Equal(t, 480000, r.Representation.BitRate)
+
+	// Small videos are not upscaled.
+	small := GetIFrameRepresentation(Stream{Width: 480, Height: 270, StreamType: "video"}, segments)
+	assert.Equal(t, 270, small.VideoHeight())
+}
@@ -0,0 +1,219 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// ProbeResult is what probing a file found. It's only valid as long as the file has the same size
+// and modification time.
+type ProbeResult struct {
+	FileLocator filesystem.FileLocator
+	Size        int64
+	ModTime     time.Time
+	Container   ProbeContainer
+	// Timestamps of the keyframes of the first video stream. nil until ProbeKeyframes is called
+	// for the file, because finding them requires reading the whole file.
+	Keyframes []time.Duration
+}
+
+// isCurrent returns whether the result still describes the given file.
+func (r *ProbeResult) isCurrent(node filesystem.Node) bool {
+	return r.Size == node.Size() && r.ModTime.Equal(node.ModTime())
+}
+
+// isComplete returns whether the result has everything that Probe reads. Results stored before
+// chapters were probed don't, so those files are probed again.
+func (r *ProbeResult) isComplete() bool {
+	return r.Container.Chapters != nil
+}
+
+// ProbeStore persists probe results, so that files don't have to be probed again after a restart.
+// That is slow, especially for files on rclone remotes.
+type ProbeStore interface {
+	// LoadProbeResult returns the stored result for the given file, nil if there is none.
+	LoadProbeResult(fileLocator filesystem.FileLocator) (*ProbeResult, error)
+	// SaveProbeResult stores the result, replacing any previous result for the file.
+	SaveProbeResult(result *ProbeResult) error
+	DeleteProbeResult(fileLocator filesystem.FileLocator) error
+}
+
+var probeStore ProbeStore
+
+// TODO: limit size of cache, possibly user-configurable?
+var probeCache = map[filesystem.FileLocator]*ProbeResult{}
+var probeMutex = &sync.Mutex{}
+
+// SetProbeStore sets where probe results are persisted. Without a store, they are only cached in
+// memory.
+func SetProbeStore(store ProbeStore) {
+	probeMutex.Lock()
+	defer probeMutex.Unlock()
+	probeStore = store
+	probeCache = map[filesystem.FileLocator]*ProbeResult{}
+}
+
+// getCachedProbeResult returns the cached result for the given file if the file didn't change since.
+func getCachedProbeResult(node filesystem.Node) *ProbeResult {
+	fileLocator := node.FileLocator()
+
+	probeMutex.Lock()
+	cached, ok := probeCache[fileLocator]
+	store := probeStore
+	probeMutex.Unlock()
+	if ok && cached.isCurrent(node) {
+		return cached
+	}
+	if store == nil {
+		return nil
+	}
+
+	stored, err := store.LoadProbeResult(fileLocator)
+	if err != nil {
+		log.WithError(err).WithField("fileLocator", fileLocator).Warnln("Failed to load probe result")
+		return nil
+	}
+	if stored == nil || !stored.isCurrent(node) {
+		return nil
+	}
+	probeMutex.Lock()
+	probeCache[fileLocator] = stored
+	probeMutex.Unlock()
+	return stored
+}
+
+// cacheProbeResult remembers the given result in memory and in the store.
+func cacheProbeResult(result *ProbeResult) {
+	probeMutex.Lock()
+	probeCache[result.FileLocator] = result
+	store := probeStore
+	probeMutex.Unlock()
+
+	if store == nil {
+		return
+	}
+	if err := store.SaveProbeResult(result); err != nil {
+		log.WithError(err).WithField("fileLocator", result.FileLocator).Warnln("Failed to store probe result")
+	}
+}
+
+// HasCurrentProbeResult returns whether the given file was probed since it last changed.
+func HasCurrentProbeResult(node filesystem.Node) bool {
+	cached := getCachedProbeResult(node)
+	return cached != nil && cached.isComplete()
+}
+
+// HasStaleProbeResult returns whether the given file was probed before but changed since.
+func HasStaleProbeResult(node filesystem.Node) bool {
+	fileLocator := node.FileLocator()
+
+	probeMutex.Lock()
+	cached, ok := probeCache[fileLocator]
+	store := probeStore
+	probeMutex.Unlock()
+	if !ok && store != nil {
+		cached, _ = store.LoadProbeResult(fileLocator)
+	}
+	return cached != nil && !cached.isCurrent(node)
+}
+
+// InvalidateProbeResult forgets the probe result of the given file, e.g. because it was deleted.
+func InvalidateProbeResult(fileLocator filesystem.FileLocator) error {
+	probeMutex.Lock()
+	delete(probeCache, fileLocator)
+	store := probeStore
+	probeMutex.Unlock()
+
+	if store == nil {
+		return nil
+	}
+	return store.DeleteProbeResult(fileLocator)
+}
+
+// getCachedKeyframes returns the keyframes of the given file if they were probed since the file
+// last changed, nil otherwise.
+func getCachedKeyframes(fileLocator filesystem.FileLocator) []time.Duration {
+	node, err := filesystem.GetNodeFromFileLocator(fileLocator)
+	if err != nil {
+		return nil
+	}
+	if cached := getCachedProbeResult(node); cached != nil {
+		return cached.Keyframes
+	}
+	return nil
+}
+
+// HasKeyframes returns whether the keyframes of the given file were probed since it last changed.
+func HasKeyframes(fileLocator filesystem.FileLocator) bool {
+	return getCachedKeyframes(fileLocator) != nil
+}
+
+// ProbeKeyframes returns the timestamps of the keyframes of the first video stream of the given
+// file. They are cached along with the rest of the probe result.
+func ProbeKeyframes(fileLocator filesystem.FileLocator) ([]time.Duration, error) {
+	if _, err := Probe(fileLocator); err != nil {
+		return nil, err
+	}
+	node, err := filesystem.GetNodeFromFileLocator(fileLocator)
+	if err != nil {
+		return nil, err
+	}
+	cached := getCachedProbeResult(node)
+	if cached == nil {
+		return nil, errors.Errorf("%s changed while probing it", fileLocator)
+	}
+	if cached.Keyframes != nil {
+		return cached.Keyframes, nil
+	}
+
+	// Only the packet headers are read, nothing is decoded.
+	cmd := exec.Command(
+		executable.GetFFprobeExecutablePath(),
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=print_section=0",
+		buildFfmpegUrlFromFileLocator(fileLocator))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to probe keyframes")
+	}
+	keyframes := parseKeyframes(string(out))
+
+	result := *cached
+	result.Keyframes = keyframes
+	cacheProbeResult(&result)
+	return keyframes, nil
+}
+
+// parseKeyframes parses ffprobe's "<pts_time>,<flags>" lines into the sorted timestamps of the
+// packets flagged as keyframes.
+func parseKeyframes(output string) []time.Duration {
+	keyframes := []time.Duration{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		ptsTime, flags, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if !ok || !strings.Contains(flags, "K") {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(ptsTime, 64)
+		if err != nil {
+			continue
+		}
+		keyframes = append(keyframes, time.Duration(math.Round(seconds*float64(time.Second))))
+	}
+	// Packets are in decoding order, which may differ from presentation order.
+	sort.Slice(keyframes, func(i, j int) bool { return keyframes[i] < keyframes[j] })
+	return keyframes
+}
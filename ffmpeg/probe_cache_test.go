@@ -0,0 +1,103 @@
+package ffmpeg
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+type memoryProbeStore struct {
+	results map[filesystem.FileLocator]ProbeResult
+}
+
+func (s *memoryProbeStore) LoadProbeResult(fileLocator filesystem.FileLocator) (*ProbeResult, error) {
+	r, ok := s.results[fileLocator]
+	if !ok {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+func (s *memoryProbeStore) SaveProbeResult(result *ProbeResult) error {
+	s.results[result.FileLocator] = *result
+	return nil
+}
+
+func (s *memoryProbeStore) DeleteProbeResult(fileLocator filesystem.FileLocator) error {
+	delete(s.results, fileLocator)
+	return nil
+}
+
+func TestProbeCache(t *testing.T) {
+	store := &memoryProbeStore{results: map[filesystem.FileLocator]ProbeResult{}}
+	SetProbeStore(store)
+	defer SetProbeStore(nil)
+
+	// Not a media file, so Probe can only succeed by using the cache.
+	file := path.Join(t.TempDir(), "movie.mkv")
+	require.NoError(t, ioutil.WriteFile(file, []byte("not a movie"), 0644))
+	node, err := filesystem.LocalNodeFromPath(file)
+	require.NoError(t, err)
+	assert.False(t, HasCurrentProbeResult(node))
+	assert.False(t, HasStaleProbeResult(node))
+
+	// Results from before chapters were probed are probed again.
+	cacheProbeResult(&ProbeResult{
+		FileLocator: node.FileLocator(),
+		Size:        node.Size(),
+		ModTime:     node.ModTime(),
+		Container:   ProbeContainer{Streams: []ProbeStream{{Index: 0, CodecType: "video", CodecName: "h264"}}},
+	})
+	assert.False(t, HasCurrentProbeResult(node))
+	assert.False(t, HasStaleProbeResult(node))
+
+	container := ProbeContainer{
+		Streams:  []ProbeStream{{Index: 0, CodecType: "video", CodecName: "h264"}},
+		Chapters: []ProbeChapter{},
+	}
+	cacheProbeResult(&ProbeResult{
+		FileLocator: node.FileLocator(),
+		Size:        node.Size(),
+		ModTime:     node.ModTime(),
+		Container:   container,
+	})
+	assert.Contains(t, store.results, node.FileLocator())
+
+	probed, err := Probe(node.FileLocator())
+	require.NoError(t, err)
+	assert.Equal(t, container, *probed)
+
+	// After a restart, the result comes from the store.
+	SetProbeStore(store)
+	assert.True(t, HasCurrentProbeResult(node))
+	probed, err = Probe(node.FileLocator())
+	require.NoError(t, err)
+	assert.Equal(t, container, *probed)
+
+	// Changing the file invalidates the result.
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Hour)))
+	node, err = filesystem.LocalNodeFromPath(file)
+	require.NoError(t, err)
+	assert.False(t, HasCurrentProbeResult(node))
+	assert.True(t, HasStaleProbeResult(node))
+	_, err = Probe(node.FileLocator())
+	assert.Error(t, err)
+
+	require.NoError(t, InvalidateProbeResult(node.FileLocator()))
+	assert.Empty(t, store.results)
+	assert.False(t, HasStaleProbeResult(node))
+}
+
+func TestParseKeyframes(t *testing.T) {
+	output := "0.000000,K__\n0.083417,___\n2.002000,K__\n1.001000,K_D\nN/A,K__\n\n"
+	assert.Equal(t,
+		[]time.Duration{0, 1001 * time.Millisecond, 2002 * time.Millisecond},
+		parseKeyframes(output))
+	assert.Equal(t, []time.Duration{}, parseKeyframes(""))
+}
@@ -0,0 +1,264 @@
+package ffmpeg
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/helpers"
+)
+
+// SegmentCacheKey identifies a segment of a representation of a stream.
+type SegmentCacheKey struct {
+	StreamKey
+	RepresentationID string
+	// InitialSegmentIdx for the init segment
+	SegmentIdx int
+}
+
+// SegmentCache keeps transcoded segments on disk so that they can be served again without running
+// ffmpeg, e.g. to another user watching the same file or when rewatching. Segments of different
+// transcoding sessions can be mixed because their timestamps are copied from the source and
+// keyframes are forced at fixed intervals. When the cache grows beyond its maximum size, the least
+// recently used segments are evicted.
+type SegmentCache struct {
+	dir     string
+	maxSize int64
+
+	mtx  sync.Mutex
+	size int64
+	// Least recently used at the back
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type segmentCacheEntry struct {
+	path string
+	size int64
+}
+
+var segmentCache *SegmentCache
+var segmentCacheOnce sync.Once
+
+// GetSegmentCache returns the segment cache in the cache directory. Its size is configured in
+// megabytes, 0 disables it.
+func GetSegmentCache() *SegmentCache {
+	segmentCacheOnce.Do(func() {
+		segmentCache = NewSegmentCache(
+			path.Join(viper.GetString("server.cacheDir"), "segments"),
+			viper.GetInt64("server.streaming.segmentCacheSize")*1024*1024)
+	})
+	return segmentCache
+}
+
+// NewSegmentCache creates a cache of at most maxSize bytes in dir, picking up the segments that
+// are already stored there.
+func NewSegmentCache(dir string, maxSize int64) *SegmentCache {
+	c := &SegmentCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	var files []os.FileInfo
+	var paths []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		// Leftovers of an interrupted Put
+		if strings.HasSuffix(p, ".tmp") {
+			os.Remove(p)
+			return nil
+		}
+		files = append(files, info)
+		paths = append(paths, p)
+		return nil
+	})
+
+	// We don't know when the segments were last served, so go by when they were created.
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return files[order[i]].ModTime().Before(files[order[j]].ModTime())
+	})
+	for _, i := range order {
+		c.add(paths[i], files[i].Size())
+	}
+
+	c.mtx.Lock()
+	c.evict()
+	c.mtx.Unlock()
+	return c
+}
+
+func hashString(s string) string {
+	hash := sha1.Sum([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func (c *SegmentCache) fileDir(fileLocator filesystem.FileLocator) string {
+	return path.Join(c.dir, hashString(fileLocator.String()))
+}
+
+func (c *SegmentCache) path(key SegmentCacheKey) string {
+	// The encoder backend is part of the key because the init segment of one encoder doesn't
+	// necessarily fit the segments of another.
+	representationDir := hashString(fmt.Sprintf("%d/%s/%s",
+		key.StreamId, key.RepresentationID, activeEncoderBackend.Name()))
+
+	name := fmt.Sprintf("%d.m4s", key.SegmentIdx)
+	if key.SegmentIdx == InitialSegmentIdx {
+		name = "init.mp4"
+	}
+	return path.Join(c.fileDir(key.FileLocator), representationDir, name)
+}
+
+// add records a segment as most recently used. c.mtx must not be held.
+func (c *SegmentCache) add(p string, size int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e, ok := c.entries[p]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[p] = c.lru.PushFront(&segmentCacheEntry{path: p, size: size})
+	c.size += size
+}
+
+// evict removes the least recently used segments until the cache fits its maximum size.
+// c.mtx must be held.
+func (c *SegmentCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove deletes a segment. c.mtx must be held.
+func (c *SegmentCache) remove(e *list.Element) {
+	entry := e.Value.(*segmentCacheEntry)
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("path", entry.path).Warnln("Failed to remove cached segment")
+	}
+	c.lru.Remove(e)
+	delete(c.entries, entry.path)
+	c.size -= entry.size
+}
+
+// Open opens the cached segment with the given key. The error satisfies os.IsNotExist if the
+// segment is not cached.
+func (c *SegmentCache) Open(key SegmentCacheKey) (*os.File, error) {
+	p := c.path(key)
+
+	c.mtx.Lock()
+	e, ok := c.entries[p]
+	if ok {
+		c.lru.MoveToFront(e)
+	}
+	c.mtx.Unlock()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(p)
+}
+
+// Put adds the segment at segmentPath to the cache. The file is left in place.
+func (c *SegmentCache) Put(key SegmentCacheKey, segmentPath string) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	p := c.path(key)
+
+	c.mtx.Lock()
+	e, ok := c.entries[p]
+	if ok {
+		c.lru.MoveToFront(e)
+	}
+	c.mtx.Unlock()
+	if ok {
+		return nil
+	}
+
+	if err := helpers.EnsurePath(path.Dir(p)); err != nil {
+		return err
+	}
+	// Write to a temporary file first so that a half-written segment is never served.
+	tmpPath := p + ".tmp"
+	os.Remove(tmpPath)
+	// Transcoding sessions run in the cache directory too, so hard links usually work.
+	if err := os.Link(segmentPath, tmpPath); err != nil {
+		if err := copyFile(segmentPath, tmpPath); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	stat, err := os.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, p); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	c.add(p, stat.Size())
+	c.mtx.Lock()
+	c.evict()
+	c.mtx.Unlock()
+	return nil
+}
+
+// DeleteFile removes all cached segments of the given file, e.g. because it changed or is gone.
+func (c *SegmentCache) DeleteFile(fileLocator filesystem.FileLocator) error {
+	dir := c.fileDir(fileLocator) + string(os.PathSeparator)
+
+	c.mtx.Lock()
+	for p, e := range c.entries {
+		if strings.HasPrefix(p, dir) {
+			c.remove(e)
+		}
+	}
+	c.mtx.Unlock()
+
+	return os.RemoveAll(dir)
+}
+
+// Size returns the total size of the cached segments in bytes.
+func (c *SegmentCache) Size() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.size
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
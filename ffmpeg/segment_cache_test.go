@@ -0,0 +1,92 @@
+package ffmpeg
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+func writeSegment(t *testing.T, dir string, name string, size int) string {
+	p := path.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(p, make([]byte, size), 0644))
+	return p
+}
+
+func segmentKey(file string, segmentIdx int) SegmentCacheKey {
+	return SegmentCacheKey{
+		StreamKey:        StreamKey{FileLocator: filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: file}},
+		RepresentationID: "preset:480-1000k-video",
+		SegmentIdx:       segmentIdx,
+	}
+}
+
+func TestSegmentCache(t *testing.T) {
+	sessionDir := t.TempDir()
+	cacheDir := t.TempDir()
+	c := NewSegmentCache(cacheDir, 200)
+
+	_, err := c.Open(segmentKey("/a.mkv", 0))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, c.Put(segmentKey("/a.mkv", InitialSegmentIdx), writeSegment(t, sessionDir, "init.mp4", 50)))
+	assert.NoError(t, c.Put(segmentKey("/a.mkv", 0), writeSegment(t, sessionDir, "stream0_0.m4s", 100)))
+	assert.EqualValues(t, 150, c.Size())
+
+	f, err := c.Open(segmentKey("/a.mkv", 0))
+	if assert.NoError(t, err) {
+		stat, _ := f.Stat()
+		assert.EqualValues(t, 100, stat.Size())
+		f.Close()
+	}
+	_, err = c.Open(segmentKey("/b.mkv", 0))
+	assert.Error(t, err, "Other files don't share segments")
+
+	// The init segment is now the least recently used one and gets evicted.
+	assert.NoError(t, c.Put(segmentKey("/a.mkv", 1), writeSegment(t, sessionDir, "stream0_1.m4s", 100)))
+	assert.EqualValues(t, 200, c.Size())
+	_, err = c.Open(segmentKey("/a.mkv", InitialSegmentIdx))
+	assert.Error(t, err)
+	_, err = c.Open(segmentKey("/a.mkv", 0))
+	assert.NoError(t, err)
+
+	_, err = os.Stat(path.Join(sessionDir, "stream0_1.m4s"))
+	assert.NoError(t, err, "The original segment is left in place")
+}
+
+func TestSegmentCache_Reload(t *testing.T) {
+	sessionDir := t.TempDir()
+	cacheDir := t.TempDir()
+	c := NewSegmentCache(cacheDir, 1000)
+	assert.NoError(t, c.Put(segmentKey("/a.mkv", 0), writeSegment(t, sessionDir, "stream0_0.m4s", 100)))
+	assert.NoError(t, c.Put(segmentKey("/a.mkv", 1), writeSegment(t, sessionDir, "stream0_1.m4s", 100)))
+	assert.NoError(t, c.Put(segmentKey("/b.mkv", 0), writeSegment(t, sessionDir, "stream0_2.m4s", 100)))
+	// Make sure the oldest segment is clearly the oldest
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(c.path(segmentKey("/a.mkv", 0)), old, old))
+
+	reloaded := NewSegmentCache(cacheDir, 250)
+	assert.EqualValues(t, 200, reloaded.Size())
+	_, err := reloaded.Open(segmentKey("/a.mkv", 0))
+	assert.Error(t, err, "The oldest segment is evicted to fit the smaller size")
+	_, err = reloaded.Open(segmentKey("/a.mkv", 1))
+	assert.NoError(t, err)
+
+	assert.NoError(t, reloaded.DeleteFile(segmentKey("/a.mkv", 0).FileLocator))
+	assert.EqualValues(t, 100, reloaded.Size())
+	_, err = reloaded.Open(segmentKey("/a.mkv", 1))
+	assert.Error(t, err)
+	_, err = reloaded.Open(segmentKey("/b.mkv", 0))
+	assert.NoError(t, err)
+}
+
+func TestSegmentCache_Disabled(t *testing.T) {
+	c := NewSegmentCache(t.TempDir(), 0)
+	assert.NoError(t, c.Put(segmentKey("/a.mkv", 0), writeSegment(t, t.TempDir(), "stream0_0.m4s", 100)))
+	_, err := c.Open(segmentKey("/a.mkv", 0))
+	assert.Error(t, err)
+}
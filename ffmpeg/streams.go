@@ -6,10 +6,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"gitlab.com/olaris/olaris-server/filesystem"
 	"math/big"
-	"path/filepath"
-	"regexp"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -49,24 +46,44 @@ type Stream struct {
 	// User-visible string for this audio or subtitle track
 	Title            string
 	EnabledByDefault bool
+	// Only relevant for video. Transfer characteristics and colour primaries as named by ffprobe,
+	// e.g. "smpte2084" and "bt2020" for HDR10, and the bits per colour component.
+	ColorTransfer  string
+	ColorPrimaries string
+	BitDepth       int
+	// Only relevant for audio. The layout is ffmpeg's name for it, e.g. "5.1(side)".
+	Channels      int
+	ChannelLayout string
+	// Only relevant for subtitles. Forced subtitles only cover foreign-language parts, SDH
+	// (subtitles for the deaf and hard of hearing) also describe sounds.
+	Forced          bool
+	HearingImpaired bool
 }
 
 type Streams struct {
 	VideoStreams    []Stream
 	AudioStreams    []Stream
 	SubtitleStreams []Stream
+	// The container format as named by ffprobe, e.g. "matroska,webm"
+	FormatName string
 }
 
 func GetStreams(fileLocator filesystem.FileLocator) (*Streams, error) {
 	log.WithFields(log.Fields{"filePath": fileLocator.String()}).
 		Debugln("reading stream information from file")
 
-	streams := Streams{}
-
 	container, err := Probe(fileLocator)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to probe with ffmpeg")
 	}
+	return streamsFromProbeContainer(fileLocator, container)
+}
+
+// streamsFromProbeContainer builds the streams of the file from what ffprobe found in it, plus
+// the external subtitles next to it.
+func streamsFromProbeContainer(fileLocator filesystem.FileLocator, container *ProbeContainer) (*Streams, error) {
+	streams := Streams{}
+	streams.FormatName = container.Format.FormatName
 
 	totalDurationSeconds := TotalDurationInvalid
 	if container.Format.DurationSeconds > 0 {
@@ -101,7 +118,10 @@ func GetStreams(fileLocator filesystem.FileLocator) (*Streams, error) {
 						StreamId:    int64(stream.Index),
 					},
 					Codecs:           stream.GetMime(),
+					CodecName:        stream.CodecName,
 					BitRate:          int64(bitrate),
+					Channels:         stream.GetChannels(),
+					ChannelLayout:    stream.ChannelLayout,
 					TotalDuration:    time.Duration(totalDurationSeconds * float64(time.Second)),
 					TotalDurationDts: totalDurationTs,
 					StreamType:       stream.CodecType,
@@ -117,6 +137,10 @@ func GetStreams(fileLocator filesystem.FileLocator) (*Streams, error) {
 
 			bitrate, _ := strconv.Atoi(stream.BitRate)
 
+			// Matroska doesn't store the bitrate of each stream, the overall bitrate is close enough.
+			if bitrate == 0 && container.Format.BitRate > 0 {
+				bitrate = int(container.Format.BitRate)
+			}
 			if bitrate == 0 {
 				node, err := filesystem.GetNodeFromFileLocator(fileLocator)
 				if err != nil {
@@ -148,6 +172,9 @@ func GetStreams(fileLocator filesystem.FileLocator) (*Streams, error) {
 				StreamType:       stream.CodecType,
 				CodecName:        stream.CodecName,
 				Profile:          stream.Profile,
+				ColorTransfer:    stream.ColorTransfer,
+				ColorPrimaries:   stream.ColorPrimaries,
+				BitDepth:         stream.GetBitDepth(),
 			})
 		} else if stream.CodecType == "subtitle" {
 			// TODO(Leon Handreke): This usually happens for next-to-the-file .srt files, ffprobe doesn't return
@@ -165,9 +192,12 @@ func GetStreams(fileLocator filesystem.FileLocator) (*Streams, error) {
 				TotalDurationDts: DtsTimestamp(totalDurationSeconds * 1000),
 				TimeBase:         big.NewRat(1, 1000),
 				StreamType:       "subtitle",
+				CodecName:        stream.CodecName,
 				Language:         GetLanguageTag(stream),
 				Title:            GetTitleOrHumanizedLanguage(stream),
 				EnabledByDefault: stream.Disposition["default"] != 0,
+				Forced:           stream.Disposition["forced"] != 0,
+				HearingImpaired:  stream.Disposition["hearing_impaired"] != 0,
 			})
 
 		}
@@ -192,61 +222,20 @@ func (s *Streams) GetVideoStream() Stream {
 
 }
 
-func buildExternalSubtitleStreams(
-	fileLocator filesystem.FileLocator,
-	duration time.Duration) ([]Stream, error) {
-
-	streams := []Stream{}
-
-	// TODO(Leon Handreke): We should be able to support other backends, but it will be another
-	// point where the abstraction will be a bit leaky
-	if fileLocator.Backend != filesystem.BackendLocal {
-		return []Stream{}, nil
-	}
-
-	mediaFilePath := fileLocator.Path
-	mediaFilePathWithoutExt := strings.TrimSuffix(mediaFilePath, filepath.Ext(mediaFilePath))
-	r := regexp.MustCompile(regexp.QuoteMeta(mediaFilePathWithoutExt) + "\\.?(?P<lang>.*).srt")
-
-	subtitleFiles, _ := filepath.Glob(mediaFilePathWithoutExt + "*.srt")
-	for _, subtitleFile := range subtitleFiles {
-		match := r.FindStringSubmatch(subtitleFile)
-		if match == nil {
-			log.Error("Failed to parse subtitle filename: ", subtitleFile)
-			continue
+// GetDefaultAudioStream returns the audio stream that players start with, the first one if no
+// stream is marked as the default. There must be at least one audio stream.
+func (s *Streams) GetDefaultAudioStream() Stream {
+	for _, a := range s.AudioStreams {
+		if a.EnabledByDefault {
+			return a
 		}
-
-		lang := "unk"
-
-		// TODO(Leon Handreke): This is a case of aggressive programming, can this ever fail?
-		tag := match[1]
-		if tag != "" {
-			// If the language tag is "English" or "Polish" instead of a code
-			if _, ok := humanizedToLangTag[tag]; ok {
-				lang = humanizedToLangTag[tag]
-			} else {
-				lang = tag
-			}
-		}
-
-		streams = append(streams,
-			Stream{
-				StreamKey: StreamKey{
-					FileLocator: filesystem.FileLocator{
-						Backend: fileLocator.Backend,
-						Path:    subtitleFile,
-					},
-					StreamId: 0,
-				},
-				TotalDuration:    duration,
-				StreamType:       "subtitle",
-				Language:         lang,
-				Title:            lang,
-				EnabledByDefault: false,
-			})
 	}
+	return s.AudioStreams[0]
+}
 
-	return streams, nil
+// IsHDR returns whether the stream is HDR video, i.e. uses the PQ or HLG transfer function.
+func (s Stream) IsHDR() bool {
+	return s.ColorTransfer == "smpte2084" || s.ColorTransfer == "arib-std-b67"
 }
 
 func GetStream(streamKey StreamKey) (Stream, error) {
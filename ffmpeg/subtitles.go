@@ -1,13 +1,50 @@
 package ffmpeg
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	log "github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+)
+
+// Kinds of subtitle codecs, see SubtitleKind.
+const (
+	// Text-based subtitles can be converted to WebVTT.
+	SubtitleKindText = "text"
+	// Bitmap subtitles consist of images, they can only be burnt into the video.
+	SubtitleKindBitmap = "bitmap"
 )
 
+// Subtitle codecs, as named by ffprobe, that consist of images instead of text.
+var bitmapSubtitleCodecs = map[string]bool{
+	"hdmv_pgs_subtitle": true,
+	"dvd_subtitle":      true,
+	"dvb_subtitle":      true,
+	"xsub":              true,
+}
+
+// SubtitleKind returns whether the subtitle codec with the given ffprobe name is text or bitmap based.
+func SubtitleKind(codecName string) string {
+	if bitmapSubtitleCodecs[codecName] {
+		return SubtitleKindBitmap
+	}
+	return SubtitleKindText
+}
+
+// IsBitmapSubtitle returns whether s is a subtitle stream that can't be converted to WebVTT.
+func (s Stream) IsBitmapSubtitle() bool {
+	return s.StreamType == "subtitle" && SubtitleKind(s.CodecName) == SubtitleKindBitmap
+}
+
 func NewSubtitleSession(
 	stream StreamRepresentation,
 	outputDirBase string) (*TranscodingSession, error) {
@@ -44,11 +81,91 @@ func GetSubtitleStreamRepresentation(stream Stream) StreamRepresentation {
 	}
 }
 
+// GetSubtitleStreamRepresentations returns the WebVTT representations of the given subtitle
+// streams. Bitmap subtitles are left out, see GetBurnInVideoRepresentation.
 func GetSubtitleStreamRepresentations(streams []Stream) []StreamRepresentation {
 	subtitleRepresentations := []StreamRepresentation{}
 	for _, s := range streams {
+		if s.IsBitmapSubtitle() {
+			continue
+		}
 		subtitleRepresentations = append(subtitleRepresentations,
 			GetSubtitleStreamRepresentation(s))
 	}
 	return subtitleRepresentations
 }
+
+// GetBitmapSubtitleStreams returns the subtitle streams that can only be burnt into the video.
+func GetBitmapSubtitleStreams(streams []Stream) []Stream {
+	bitmapStreams := []Stream{}
+	for _, s := range streams {
+		if s.IsBitmapSubtitle() {
+			bitmapStreams = append(bitmapStreams, s)
+		}
+	}
+	return bitmapStreams
+}
+
+// GetBurnInVideoRepresentation returns a representation of the video stream of sr that has the
+// given subtitle stream overlaid. This always requires transcoding, so a transmuxed sr is replaced
+// by a similar transcoded representation.
+func GetBurnInVideoRepresentation(sr StreamRepresentation, subtitleStream Stream) StreamRepresentation {
+	if !sr.Representation.Transcoded {
+		sr = GetSimilarTranscodedRepresentation(sr.Stream)
+	}
+	sr.Representation.RepresentationId = burnInRepresentationId(
+		subtitleStream.StreamId, sr.Representation.RepresentationId)
+	sr.Representation.encoderParams.burnInSubtitleStreamId = subtitleStream.StreamId
+	return sr
+}
+
+func burnInRepresentationId(subtitleStreamId int64, representationId string) string {
+	return fmt.Sprintf("burn:%d:%s", subtitleStreamId, representationId)
+}
+
+// parseBurnInRepresentationId splits a representation ID as built by burnInRepresentationId.
+func parseBurnInRepresentationId(representationId string) (int64, string, error) {
+	parts := strings.SplitN(representationId, ":", 3)
+	if len(parts) != 3 || parts[0] != "burn" {
+		return 0, "", fmt.Errorf("invalid burn-in representation %s", representationId)
+	}
+	subtitleStreamId, err := strconv.ParseInt(parts[1], 10, 64)
+	// 0 means no burn-in, see EncoderParams.
+	if err != nil || subtitleStreamId <= 0 {
+		return 0, "", fmt.Errorf("invalid burn-in representation %s", representationId)
+	}
+	return subtitleStreamId, parts[2], nil
+}
+
+// IsASSSubtitle returns whether s is an ASS/SSA subtitle stream, which capable clients can render
+// with its styling instead of the plain WebVTT conversion.
+func (s Stream) IsASSSubtitle() bool {
+	// Older versions of ffmpeg call SSA "ssa", newer ones treat it as a flavour of ASS.
+	return s.StreamType == "subtitle" && (s.CodecName == "ass" || s.CodecName == "ssa")
+}
+
+// assSubtitleArgs returns the ffmpeg arguments to copy the given ASS stream to stdout unchanged.
+func assSubtitleArgs(streamKey StreamKey) []string {
+	return []string{
+		"-hide_banner", "-nostats",
+		"-i", buildFfmpegUrlFromFileLocator(streamKey.FileLocator),
+		"-map", fmt.Sprintf("0:%d", streamKey.StreamId),
+		"-c:s", "copy",
+		"-f", "ass",
+		"-",
+	}
+}
+
+// ExtractASSSubtitle writes the given ASS subtitle stream, with its styling, to w.
+func ExtractASSSubtitle(ctx context.Context, streamKey StreamKey, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, executable.GetFFmpegExecutablePath(), assSubtitleArgs(streamKey)...)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	log.Debugf("Starting %s with args %s", cmd.Path, cmd.Args)
+
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "Failed to extract subtitles: %s", stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package ffmpeg
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubtitleKind(t *testing.T) {
+	assert.Equal(t, SubtitleKindText, SubtitleKind("subrip"))
+	assert.Equal(t, SubtitleKindText, SubtitleKind("ass"))
+	assert.Equal(t, SubtitleKindBitmap, SubtitleKind("hdmv_pgs_subtitle"))
+	assert.Equal(t, SubtitleKindBitmap, SubtitleKind("dvd_subtitle"))
+}
+
+func TestGetSubtitleStreamRepresentations_SkipsBitmap(t *testing.T) {
+	text := Stream{StreamKey: StreamKey{StreamId: 2}, StreamType: "subtitle", CodecName: "subrip"}
+	pgs := Stream{StreamKey: StreamKey{StreamId: 3}, StreamType: "subtitle", CodecName: "hdmv_pgs_subtitle"}
+
+	representations := GetSubtitleStreamRepresentations([]Stream{text, pgs})
+	require.Len(t, representations, 1)
+	assert.EqualValues(t, 2, representations[0].Stream.StreamId)
+	assert.Equal(t, []Stream{pgs}, GetBitmapSubtitleStreams([]Stream{text, pgs}))
+
+	_, err := StreamRepresentationFromRepresentationId(pgs, "webvtt")
+	assert.Error(t, err)
+}
+
+func TestGetBurnInVideoRepresentation(t *testing.T) {
+	video := Stream{
+		Width:      1920,
+		Height:     1080,
+		BitRate:    8000000,
+		FrameRate:  big.NewRat(24, 1),
+		StreamType: "video",
+	}
+	pgs := Stream{StreamKey: StreamKey{StreamId: 3}, StreamType: "subtitle", CodecName: "hdmv_pgs_subtitle"}
+
+	preset, err := StreamRepresentationFromRepresentationId(video, "preset:720-5000k-video")
+	require.NoError(t, err)
+	burnt := GetBurnInVideoRepresentation(preset, pgs)
+	assert.Equal(t, "burn:3:preset:720-5000k-video", burnt.Representation.RepresentationId)
+	assert.Equal(t, preset.Representation.Codecs, burnt.Representation.Codecs)
+
+	parsed, err := StreamRepresentationFromRepresentationId(video, burnt.Representation.RepresentationId)
+	require.NoError(t, err)
+	assert.Equal(t, burnt, parsed)
+
+	// Burning in requires transcoding.
+	burntDirect := GetBurnInVideoRepresentation(GetTransmuxedRepresentation(video), pgs)
+	assert.True(t, burntDirect.Representation.Transcoded)
+	_, err = StreamRepresentationFromRepresentationId(video, "burn:3:direct")
+	assert.Error(t, err)
+	_, err = StreamRepresentationFromRepresentationId(video, "burn:0:preset:720-5000k-video")
+	assert.Error(t, err)
+
+	lowest, ok := GetLowestPresetRepresentation(burnt)
+	assert.True(t, ok)
+	assert.Equal(t, "burn:3:preset:360-700k-video", lowest.Representation.RepresentationId)
+}
+
+func TestVideoMapAndFilterArgs(t *testing.T) {
+	video := Stream{StreamKey: StreamKey{StreamId: 0}, Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	preset, _ := StreamRepresentationFromRepresentationId(video, "preset:720-5000k-video")
+
+	assert.Equal(t,
+		[]string{"-map", "0:0", "-filter:0", "scale=-2:720"},
+		videoMapAndFilterArgs(preset, softwareEncoderBackend{}))
+
+	burnt := GetBurnInVideoRepresentation(preset, Stream{StreamKey: StreamKey{StreamId: 3}})
+	assert.Equal(t,
+		[]string{"-filter_complex", "[0:0][0:3]overlay,scale=-2:720[v]", "-map", "[v]"},
+		videoMapAndFilterArgs(burnt, softwareEncoderBackend{}))
+
+	// HDR video is tone mapped before the subtitles are overlaid.
+	hdr := video
+	hdr.ColorTransfer = "smpte2084"
+	hdr.ColorPrimaries = "bt2020"
+	hdr.BitDepth = 10
+	preset, _ = StreamRepresentationFromRepresentationId(hdr, "preset:720-5000k-video")
+	assert.Equal(t,
+		[]string{"-map", "0:0", "-filter:0", toneMapFilter(hdr) + ",scale=-2:720"},
+		videoMapAndFilterArgs(preset, softwareEncoderBackend{}))
+
+	burnt = GetBurnInVideoRepresentation(preset, Stream{StreamKey: StreamKey{StreamId: 3}})
+	assert.Equal(t,
+		[]string{"-filter_complex", "[0:0]" + toneMapFilter(hdr) + "[sdr];[sdr][0:3]overlay,scale=-2:720[v]", "-map", "[v]"},
+		videoMapAndFilterArgs(burnt, softwareEncoderBackend{}))
+}
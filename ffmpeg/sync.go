@@ -0,0 +1,172 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// syncAudioPreset is used for the audio of offline copies.
+const syncAudioPreset = "128k-audio"
+
+// Number of running SyncTranscode ffmpeg processes, accessed atomically
+var runningSyncTranscodes int32
+
+// RunningSyncTranscodes returns the number of ffmpeg processes making offline copies.
+func RunningSyncTranscodes() int {
+	return int(atomic.LoadInt32(&runningSyncTranscodes))
+}
+
+// SyncPresets returns the names of the video presets that offline copies can be made with.
+func SyncPresets() []string {
+	presets := []string{}
+	for name, encoderParams := range videoEncoderPresets {
+		if isVideoCodecSupported(encoderParams.videoCodec) {
+			presets = append(presets, name)
+		}
+	}
+	sort.Strings(presets)
+	return presets
+}
+
+// SyncTranscode transcodes the video and first audio stream of the given file with the given
+// video preset into a single MP4 file at outputPath, e.g. so that it can be downloaded to watch
+// offline. progress is called with values between 0 and 1 while ffmpeg runs. Cancelling ctx
+// stops ffmpeg.
+func SyncTranscode(
+	ctx context.Context,
+	fileLocator filesystem.FileLocator,
+	preset string,
+	outputPath string,
+	progress func(float64)) error {
+
+	if _, ok := videoEncoderPresets[preset]; !ok || !isVideoCodecSupported(videoEncoderPresets[preset].videoCodec) {
+		return fmt.Errorf("no preset \"%s\"", preset)
+	}
+
+	streams, err := GetStreams(fileLocator)
+	if err != nil {
+		return err
+	}
+	if len(streams.VideoStreams) == 0 {
+		return fmt.Errorf("%s has no video stream", fileLocator)
+	}
+	videoStream := streams.GetVideoStream()
+	encoderParams, err := GetVideoEncoderPreset(videoStream, preset)
+	if err != nil {
+		return err
+	}
+	var audioStream *Stream
+	if len(streams.AudioStreams) > 0 {
+		audioStream = &streams.AudioStreams[0]
+	}
+
+	args := buildSyncTranscodeArgs(fileLocator, videoStream, audioStream, encoderParams, outputPath)
+	cmd := exec.CommandContext(ctx, executable.GetFFmpegExecutablePath(), args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	log.Infoln("ffmpeg started with", cmd.Path, cmd.Args)
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "Failed to start ffmpeg")
+	}
+	atomic.AddInt32(&runningSyncTranscodes, 1)
+	defer atomic.AddInt32(&runningSyncTranscodes, -1)
+	parseSyncProgress(stdout, videoStream.TotalDuration, progress)
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errors.Wrapf(err, "Failed to transcode: %s", lastLines(stderr.String(), 5))
+	}
+	return nil
+}
+
+func buildSyncTranscodeArgs(
+	fileLocator filesystem.FileLocator,
+	videoStream Stream,
+	audioStream *Stream,
+	encoderParams EncoderParams,
+	outputPath string) []string {
+
+	backend := activeEncoderBackend
+
+	args := backend.GlobalArgs()
+	args = append(args,
+		"-hide_banner", "-nostats",
+		"-i", buildFfmpegUrlFromFileLocator(fileLocator),
+		"-map", fmt.Sprintf("0:%d", videoStream.StreamId))
+	if audioStream != nil {
+		args = append(args, "-map", fmt.Sprintf("0:%d", audioStream.StreamId))
+	}
+
+	args = append(args, backend.EncoderArgs(encoderParams.videoCodec)...)
+	args = append(args, "-b:v", strconv.Itoa(encoderParams.videoBitrate))
+	filter := joinFilters(
+		sourceVideoFilter(videoStream),
+		backend.VideoFilter(encoderParams.width, encoderParams.height))
+	if filter != "" {
+		args = append(args, "-filter:v", filter)
+	}
+	if audioStream != nil {
+		args = append(args,
+			"-c:a", "aac",
+			"-ac", "2",
+			"-b:a", strconv.Itoa(AudioEncoderPresets[syncAudioPreset].audioBitrate))
+	}
+
+	return append(args,
+		"-sn", "-dn",
+		// Put the index at the start so that players can start before having read the whole file.
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		"-progress", "pipe:1",
+		"-y", outputPath)
+}
+
+// parseSyncProgress reads the output of ffmpeg's -progress option and reports how much of a
+// file of the given duration has been transcoded.
+func parseSyncProgress(r io.Reader, totalDuration time.Duration, progress func(float64)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		// Despite the name, out_time_ms is in microseconds.
+		if !ok || key != "out_time_ms" || totalDuration <= 0 {
+			continue
+		}
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || us < 0 {
+			continue
+		}
+		p := float64(time.Duration(us)*time.Microsecond) / float64(totalDuration)
+		if p > 1 {
+			p = 1
+		}
+		progress(p)
+	}
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
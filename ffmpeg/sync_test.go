@@ -0,0 +1,54 @@
+package ffmpeg
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+func TestSyncPresets(t *testing.T) {
+	defer func(codecs map[string]bool) { supportedVideoCodecs = codecs }(supportedVideoCodecs)
+	supportedVideoCodecs = map[string]bool{VideoCodecH264: true}
+
+	assert.Equal(t, []string{"1080-10000k-video", "480-1000k-video", "720-5000k-video"}, SyncPresets())
+}
+
+func TestBuildSyncTranscodeArgs(t *testing.T) {
+	fileLocator, _ := filesystem.ParseFileLocator("local#/media/movie.mkv")
+	videoStream := Stream{StreamKey: StreamKey{StreamId: 0}, StreamType: "video", Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1)}
+	audioStream := Stream{StreamKey: StreamKey{StreamId: 2}, StreamType: "audio"}
+	encoderParams, err := GetVideoEncoderPreset(videoStream, "720-5000k-video")
+	assert.NoError(t, err)
+
+	args := strings.Join(buildSyncTranscodeArgs(fileLocator, videoStream, &audioStream, encoderParams, "/sync/out.mp4"), " ")
+	assert.Contains(t, args, "-i file:///media/movie.mkv -map 0:0 -map 0:2")
+	assert.Contains(t, args, "-b:v 5000000")
+	assert.Contains(t, args, "-c:a aac -ac 2 -b:a 128000")
+	assert.Contains(t, args, "-movflags +faststart -f mp4")
+	assert.True(t, strings.HasSuffix(args, "-y /sync/out.mp4"))
+
+	args = strings.Join(buildSyncTranscodeArgs(fileLocator, videoStream, nil, encoderParams, "/sync/out.mp4"), " ")
+	assert.NotContains(t, args, "-c:a")
+	assert.NotContains(t, args, "0:2")
+}
+
+func TestParseSyncProgress(t *testing.T) {
+	output := `frame=100
+out_time_ms=30000000
+progress=continue
+out_time_ms=N/A
+out_time_ms=60000000
+progress=continue
+out_time_ms=130000000
+progress=end
+`
+	var reported []float64
+	parseSyncProgress(strings.NewReader(output), 2*time.Minute, func(p float64) {
+		reported = append(reported, p)
+	})
+	assert.Equal(t, []float64{0.25, 0.5, 1}, reported)
+}
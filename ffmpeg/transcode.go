@@ -41,6 +41,64 @@ func GetAVC1Tag(width int, height int, biteRate int64, frameRate *big.Rat) strin
 	return fmt.Sprintf("avc1.6400%x", level.Level)
 }
 
+// GetHVC1Tag returns the RFC 6381 codecs string for HEVC Main profile, Main tier at the lowest
+// level that supports the given parameters. See ISO/IEC 14496-15 Annex E.3 for the format.
+func GetHVC1Tag(width int, height int, bitRate int64, frameRate *big.Rat) string {
+	return hvc1Tag(width, height, bitRate, frameRate, false)
+}
+
+// hvc1Tag is GetHVC1Tag, for the Main 10 profile if tenBit is set.
+func hvc1Tag(width int, height int, bitRate int64, frameRate *big.Rat, tenBit bool) string {
+	lumaPictureSize := int64(width) * int64(height)
+	frameRateFloat, _ := frameRate.Float64()
+	lumaSampleRate := float64(lumaPictureSize) * frameRateFloat
+	level := hvc1Levels[len(hvc1Levels)-1]
+	for _, l := range hvc1Levels {
+		if bitRate < l.MaxBitrate &&
+			lumaPictureSize <= l.MaxLumaPictureSize &&
+			lumaSampleRate <= float64(l.MaxLumaSampleRate) {
+			level = l
+			break
+		}
+	}
+	if tenBit {
+		// general_profile_idc 2 (Main 10), compatibility flag for Main 10 (0x20000000, bit-reversed).
+		return fmt.Sprintf("hvc1.2.4.L%d.B0", level.Level)
+	}
+	// general_profile_idc 1 (Main), compatibility flags for Main and Main 10 (0x60000000, bit-reversed
+	// and with trailing zeroes omitted), Main tier. The constraint byte B0 sets progressive_source,
+	// non_packed_constraint and frame_only_constraint.
+	return fmt.Sprintf("hvc1.1.6.L%d.B0", level.Level)
+}
+
+// GetAV01Tag returns the RFC 6381 codecs string for AV1 Main profile, Main tier, 8 bit at the lowest
+// level that supports the given parameters. See the "Codecs Parameter String" section of the AV1
+// ISOBMFF binding spec for the format.
+func GetAV01Tag(width int, height int, bitRate int64, frameRate *big.Rat) string {
+	return av01Tag(width, height, bitRate, frameRate, false)
+}
+
+// av01Tag is GetAV01Tag, for 10 bit if tenBit is set.
+func av01Tag(width int, height int, bitRate int64, frameRate *big.Rat, tenBit bool) string {
+	pictureSize := int64(width) * int64(height)
+	frameRateFloat, _ := frameRate.Float64()
+	displayRate := float64(pictureSize) * frameRateFloat
+	level := av01Levels[len(av01Levels)-1]
+	for _, l := range av01Levels {
+		if bitRate < l.MaxBitrate &&
+			pictureSize <= l.MaxPictureSize &&
+			displayRate <= float64(l.MaxDisplayRate) {
+			level = l
+			break
+		}
+	}
+	bitDepth := 8
+	if tenBit {
+		bitDepth = 10
+	}
+	return fmt.Sprintf("av01.0.%02dM.%02d", level.SeqLevelIdx, bitDepth)
+}
+
 // scalePreserveAspectRatio implements ffmpeg-eseque scaling: For one of the two values, a negative value must
 // be specified, the result will be divisible by the absolute of the negative value.
 func scalePreserveAspectRatio(width int, height int, newWidth int, newHeight int) (int, int) {
@@ -97,3 +155,54 @@ var avc1Levels = []avc1Level{
 	{61, 8355840, 139264, 480000000},
 	{62, 16711680, 139264, 800000000},
 }
+
+type hvc1Level struct {
+	// general_level_idc, i.e. 30 times the level number
+	Level              uint
+	MaxLumaSampleRate  int64
+	MaxLumaPictureSize int64
+	// Max bitrate for the Main tier
+	MaxBitrate int64
+}
+
+// Table A.8 and A.9 of ITU-T H.265
+var hvc1Levels = []hvc1Level{
+	{30, 552960, 36864, 128000},
+	{60, 3686400, 122880, 1500000},
+	{63, 7372800, 245760, 3000000},
+	{90, 16588800, 552960, 6000000},
+	{93, 33177600, 983040, 10000000},
+	{120, 66846720, 2228224, 12000000},
+	{123, 133693440, 2228224, 20000000},
+	{150, 267386880, 8912896, 25000000},
+	{153, 534773760, 8912896, 40000000},
+	{156, 1069547520, 8912896, 60000000},
+	{180, 1069547520, 35651584, 60000000},
+	{183, 2139095040, 35651584, 120000000},
+	{186, 4278190080, 35651584, 240000000},
+}
+
+type av01Level struct {
+	// seq_level_idx, (major - 2) * 4 + minor
+	SeqLevelIdx    uint
+	MaxDisplayRate int64
+	MaxPictureSize int64
+	// Max bitrate for the Main tier
+	MaxBitrate int64
+}
+
+// Annex A.3 of the AV1 bitstream specification
+var av01Levels = []av01Level{
+	{0, 4423680, 147456, 1500000},
+	{1, 8363520, 278784, 3000000},
+	{4, 19975680, 665856, 6000000},
+	{5, 31950720, 1065024, 10000000},
+	{8, 70778880, 2359296, 12000000},
+	{9, 141557760, 2359296, 20000000},
+	{12, 267386880, 8912896, 30000000},
+	{13, 534773760, 8912896, 40000000},
+	{14, 1069547520, 8912896, 60000000},
+	{16, 1069547520, 35651584, 60000000},
+	{17, 2139095040, 35651584, 100000000},
+	{18, 4278190080, 35651584, 160000000},
+}
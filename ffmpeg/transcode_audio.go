@@ -12,9 +12,86 @@ import (
 	"time"
 )
 
+// Audio codecs that we can encode to.
+const (
+	AudioCodecAAC  = "aac"
+	AudioCodecEAC3 = "eac3"
+	AudioCodecOpus = "opus"
+)
+
 var AudioEncoderPresets = map[string]EncoderParams{
 	"64k-audio":  {audioBitrate: 64000, Codecs: "mp4a.40.2"},
 	"128k-audio": {audioBitrate: 128000, Codecs: "mp4a.40.2"},
+
+	"384k-5.1-aac-audio": {
+		audioBitrate: 384000, audioCodec: AudioCodecAAC, audioChannels: 6, Codecs: "mp4a.40.2"},
+	"640k-5.1-eac3-audio": {
+		audioBitrate: 640000, audioCodec: AudioCodecEAC3, audioChannels: 6, Codecs: "ec-3"},
+	"256k-5.1-opus-audio": {
+		audioBitrate: 256000, audioCodec: AudioCodecOpus, audioChannels: 6, Codecs: "opus"},
+}
+
+// Presets for streams with more than two channels, most preferred first. E-AC-3 is what home
+// theater receivers understand, Opus sounds best for its bitrate and every client can play AAC.
+var multichannelAudioPresets = []string{
+	"640k-5.1-eac3-audio",
+	"256k-5.1-opus-audio",
+	"384k-5.1-aac-audio",
+}
+
+// GetPreferredTranscodedAudioRepresentation returns the transcoded representation of the given
+// audio stream that the client plays best. Surround sound is kept if the stream has it, in the
+// first multichannel codec that the client can play and within its channel limit. Clients that
+// don't state their codecs get AAC. Everything else is downmixed to stereo AAC.
+func GetPreferredTranscodedAudioRepresentation(
+	stream Stream,
+	capabilities ClientCodecCapabilities) StreamRepresentation {
+
+	for _, r := range GetMultichannelPresetAudioRepresentations(stream) {
+		if !capabilities.HasCodecPreference() && r.Representation.Codecs != "mp4a.40.2" {
+			continue
+		}
+		if capabilities.CanPlay(r) {
+			return r
+		}
+	}
+	return GetSimilarTranscodedRepresentation(stream)
+}
+
+// GetMultichannelPresetAudioRepresentations returns the surround sound representations of the
+// given audio stream, most preferred first. There are none for mono or stereo streams.
+func GetMultichannelPresetAudioRepresentations(stream Stream) []StreamRepresentation {
+	representations := []StreamRepresentation{}
+	if stream.Channels <= 2 {
+		return representations
+	}
+	for _, presetId := range multichannelAudioPresets {
+		representations = append(representations,
+			GetTranscodedAudioRepresentation(stream, "preset:"+presetId, AudioEncoderPresets[presetId]))
+	}
+	return representations
+}
+
+// audioEncoderArgs selects and configures the encoder for the given params.
+func audioEncoderArgs(encoderParams EncoderParams) []string {
+	channels := encoderParams.channels()
+
+	var args []string
+	switch encoderParams.audioCodec {
+	case AudioCodecEAC3:
+		args = []string{"-c:0", "eac3"}
+	case AudioCodecOpus:
+		args = []string{"-c:0", "libopus"}
+		if channels > 2 {
+			// Opus only supports surround sound with the Vorbis channel mapping.
+			args = append(args, "-mapping_family", "1")
+		}
+	default:
+		args = []string{"-c:0", "aac"}
+	}
+	return append(args,
+		"-ac", strconv.Itoa(channels),
+		"-ab", strconv.Itoa(encoderParams.audioBitrate))
 }
 
 func NewAudioTranscodingSession(
@@ -43,7 +120,9 @@ func NewAudioTranscodingSession(
 		"-i", buildFfmpegUrlFromFileLocator(stream.Stream.FileLocator),
 		"-copyts",
 		"-map", fmt.Sprintf("0:%d", stream.Stream.StreamId),
-		"-c:0", "aac", "-ac", "2", "-ab", strconv.Itoa(encoderParams.audioBitrate),
+	}...)
+	args = append(args, audioEncoderArgs(encoderParams)...)
+	args = append(args, []string{
 		"-f", "hls",
 		"-start_number", fmt.Sprintf("%d", segmentStartIndex),
 		"-hls_time", fmt.Sprintf("%.3f", SegmentDuration.Seconds()),
@@ -75,9 +154,11 @@ func GetTranscodedAudioRepresentation(stream Stream, representationId string, en
 		Stream: stream,
 		Representation: Representation{
 			RepresentationId: representationId,
+			encoderParams:    encoderParams,
 			BitRate:          encoderParams.audioBitrate,
 			Container:        "audio/mp4",
 			Codecs:           encoderParams.Codecs,
+			Channels:         encoderParams.channels(),
 			Transcoded:       true,
 		},
 	}
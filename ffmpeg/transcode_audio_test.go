@@ -0,0 +1,72 @@
+package ffmpeg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPreferredTranscodedAudioRepresentation(t *testing.T) {
+	surround := Stream{StreamType: "audio", Codecs: "dts", BitRate: 1500000, Channels: 6}
+
+	// Clients that only play AAC still get surround sound.
+	r := GetPreferredTranscodedAudioRepresentation(surround,
+		ClientCodecCapabilities{PlayableCodecs: []string{"mp4a.40.2"}})
+	assert.Equal(t, "preset:384k-5.1-aac-audio", r.Representation.RepresentationId)
+	assert.Equal(t, 6, r.Representation.Channels)
+
+	r = GetPreferredTranscodedAudioRepresentation(surround,
+		ClientCodecCapabilities{PlayableCodecs: []string{"mp4a.40.2", "opus", "ec-3"}})
+	assert.Equal(t, "preset:640k-5.1-eac3-audio", r.Representation.RepresentationId)
+	assert.Equal(t, "ec-3", r.Representation.Codecs)
+
+	r = GetPreferredTranscodedAudioRepresentation(surround,
+		ClientCodecCapabilities{PlayableCodecs: []string{"mp4a.40.2", "opus"}})
+	assert.Equal(t, "opus", r.Representation.Codecs)
+
+	// Stereo is never upmixed.
+	stereo := Stream{StreamType: "audio", Codecs: "fLaC", BitRate: 128000, Channels: 2}
+	r = GetPreferredTranscodedAudioRepresentation(stereo,
+		ClientCodecCapabilities{PlayableCodecs: []string{"mp4a.40.2", "ec-3"}})
+	assert.Equal(t, "mp4a.40.2", r.Representation.Codecs)
+	assert.Equal(t, 2, r.Representation.Channels)
+}
+
+func TestGetTransmuxedOrTranscodedRepresentation_Audio(t *testing.T) {
+	surround := Stream{StreamType: "audio", Codecs: "ec-3", Channels: 6}
+
+	r, err := GetTransmuxedOrTranscodedRepresentation(surround,
+		ClientCodecCapabilities{PlayableCodecs: []string{"mp4a.40.2", "ec-3"}})
+	assert.NoError(t, err)
+	assert.True(t, r.Representation.Transmuxed)
+	assert.Equal(t, 6, r.Representation.Channels)
+
+	r, err = GetTransmuxedOrTranscodedRepresentation(surround,
+		ClientCodecCapabilities{PlayableCodecs: []string{"mp4a.40.2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "preset:384k-5.1-aac-audio", r.Representation.RepresentationId)
+}
+
+func TestAudioEncoderArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"-c:0", "aac", "-ac", "2", "-ab", "128000"},
+		audioEncoderArgs(AudioEncoderPresets["128k-audio"]))
+	assert.Equal(t,
+		[]string{"-c:0", "aac", "-ac", "6", "-ab", "384000"},
+		audioEncoderArgs(AudioEncoderPresets["384k-5.1-aac-audio"]))
+	assert.Equal(t,
+		[]string{"-c:0", "eac3", "-ac", "6", "-ab", "640000"},
+		audioEncoderArgs(AudioEncoderPresets["640k-5.1-eac3-audio"]))
+	assert.Equal(t,
+		[]string{"-c:0", "libopus", "-mapping_family", "1", "-ac", "6", "-ab", "256000"},
+		audioEncoderArgs(AudioEncoderPresets["256k-5.1-opus-audio"]))
+}
+
+func TestAudioEncoderParams_StringRoundTrip(t *testing.T) {
+	params := AudioEncoderPresets["256k-5.1-opus-audio"]
+	r, err := StreamRepresentationFromRepresentationId(
+		Stream{StreamType: "audio"}, "transcode:"+EncoderParamsToString(params))
+	assert.NoError(t, err)
+	assert.Equal(t, params, r.Representation.encoderParams)
+	assert.Equal(t, 6, r.Representation.Channels)
+}
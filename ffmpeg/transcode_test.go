@@ -0,0 +1,161 @@
+package ffmpeg
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHVC1Tag(t *testing.T) {
+	frameRate := big.NewRat(24, 1)
+	assert.Equal(t, "hvc1.1.6.L90.B0", GetHVC1Tag(854, 480, 600000, frameRate))
+	assert.Equal(t, "hvc1.1.6.L93.B0", GetHVC1Tag(1280, 720, 3000000, frameRate))
+	assert.Equal(t, "hvc1.1.6.L120.B0", GetHVC1Tag(1920, 1080, 6000000, frameRate))
+	assert.Equal(t, "hvc1.1.6.L150.B0", GetHVC1Tag(3840, 2160, 20000000, frameRate))
+}
+
+func TestGetAV01Tag(t *testing.T) {
+	frameRate := big.NewRat(24, 1)
+	assert.Equal(t, "av01.0.04M.08", GetAV01Tag(854, 480, 500000, frameRate))
+	assert.Equal(t, "av01.0.05M.08", GetAV01Tag(1280, 720, 2500000, frameRate))
+	assert.Equal(t, "av01.0.08M.08", GetAV01Tag(1920, 1080, 5000000, frameRate))
+	assert.Equal(t, "av01.0.12M.08", GetAV01Tag(3840, 2160, 20000000, frameRate))
+}
+
+func TestGetHDRVideoRepresentation(t *testing.T) {
+	stream := Stream{
+		Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video",
+		ColorTransfer: "smpte2084", ColorPrimaries: "bt2020", BitDepth: 10,
+	}
+	hevc, err := StreamRepresentationFromRepresentationId(stream, "preset:720-3000k-hevc-video")
+	assert.NoError(t, err)
+	assert.False(t, hevc.IsHDR(), "Transcodes are tone mapped by default")
+
+	hdr, ok := GetHDRVideoRepresentation(hevc)
+	if assert.True(t, ok) {
+		assert.True(t, hdr.IsHDR())
+		assert.Equal(t, "hdr:preset:720-3000k-hevc-video", hdr.Representation.RepresentationId)
+		assert.Equal(t, "hvc1.2.4.L93.B0", hdr.Representation.Codecs)
+		assert.Equal(t,
+			[]string{"-map", "0:0", "-filter:0", "format=yuv420p10le,scale=-2:720"},
+			videoMapAndFilterArgs(hdr, softwareEncoderBackend{}))
+
+		parsed, err := StreamRepresentationFromRepresentationId(stream, hdr.Representation.RepresentationId)
+		assert.NoError(t, err)
+		assert.Equal(t, hdr, parsed)
+
+		lowest, ok := GetLowestPresetRepresentation(hdr)
+		assert.True(t, ok)
+		assert.True(t, lowest.IsHDR(), "Falling back to a cheaper preset keeps HDR")
+	}
+
+	av1, _ := StreamRepresentationFromRepresentationId(stream, "preset:1080-5000k-av1-video")
+	hdr, ok = GetHDRVideoRepresentation(av1)
+	assert.True(t, ok)
+	assert.Equal(t, "av01.0.08M.10", hdr.Representation.Codecs)
+
+	// H.264 is 8 bit only
+	h264, _ := StreamRepresentationFromRepresentationId(stream, "preset:720-5000k-video")
+	_, ok = GetHDRVideoRepresentation(h264)
+	assert.False(t, ok)
+	_, err = StreamRepresentationFromRepresentationId(stream, "hdr:preset:720-5000k-video")
+	assert.Error(t, err)
+
+	sdr := stream
+	sdr.ColorTransfer = "bt709"
+	hevc, _ = StreamRepresentationFromRepresentationId(sdr, "preset:720-3000k-hevc-video")
+	_, ok = GetHDRVideoRepresentation(hevc)
+	assert.False(t, ok)
+}
+
+func TestKeepHDR(t *testing.T) {
+	stream := Stream{
+		Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video",
+		ColorTransfer: "arib-std-b67", ColorPrimaries: "bt2020", BitDepth: 10,
+	}
+	hevc, _ := StreamRepresentationFromRepresentationId(stream, "preset:720-3000k-hevc-video")
+	representations := []StreamRepresentation{GetTransmuxedRepresentation(stream), hevc}
+
+	hdrSupported, hdrUnsupported := true, false
+	for _, c := range []ClientCodecCapabilities{{}, {HDR: &hdrUnsupported}} {
+		assert.Equal(t, representations, c.KeepHDR(representations))
+	}
+
+	c := ClientCodecCapabilities{HDR: &hdrSupported}
+	kept := c.KeepHDR(representations)
+	assert.Equal(t, "direct", kept[0].Representation.RepresentationId)
+	assert.Equal(t, "hdr:preset:720-3000k-hevc-video", kept[1].Representation.RepresentationId)
+
+	// Clients that can't decode Main 10 get the tone mapped version
+	c.PlayableCodecs = []string{"hvc1.1.6.L93.B0"}
+	assert.Equal(t, hevc, c.KeepHDR([]StreamRepresentation{hevc})[0])
+
+	c = ClientCodecCapabilities{HDR: &hdrUnsupported}
+	assert.False(t, c.CanPlay(kept[1]))
+	assert.True(t, c.CanPlay(hevc))
+}
+
+func TestGetPreferredPresetVideoRepresentations(t *testing.T) {
+	stream := Stream{
+		Width:      1920,
+		Height:     1080,
+		FrameRate:  big.NewRat(24, 1),
+		StreamType: "video",
+	}
+
+	representations := GetPreferredPresetVideoRepresentations(stream, ClientCodecCapabilities{})
+	assert.Len(t, representations, 4)
+	for _, r := range representations {
+		assert.Regexp(t, "^avc1\\.", r.Representation.Codecs)
+	}
+
+	capabilities := ClientCodecCapabilities{
+		PlayableCodecs: []string{"avc1.64001f", "avc1.640028", "hvc1.1.6.L93.B0", "hvc1.1.6.L120.B0"},
+	}
+	representations = GetPreferredPresetVideoRepresentations(stream, capabilities)
+	assert.Len(t, representations, 2)
+	for _, r := range representations {
+		assert.Regexp(t, "^hvc1\\.", r.Representation.Codecs)
+		assert.True(t, r.Representation.Transcoded)
+	}
+	assert.Equal(t, "preset:720-3000k-hevc-video", representations[0].Representation.RepresentationId)
+}
+
+func TestStreamRepresentationFromRepresentationId_PresetStreamType(t *testing.T) {
+	audioStream := Stream{StreamType: "audio"}
+	_, err := StreamRepresentationFromRepresentationId(audioStream, "preset:720-3000k-hevc-video")
+	assert.Error(t, err)
+
+	r, err := StreamRepresentationFromRepresentationId(audioStream, "preset:128k-audio")
+	assert.NoError(t, err)
+	assert.Equal(t, 128000, r.Representation.BitRate)
+}
+
+func TestGetLowestPresetRepresentation(t *testing.T) {
+	stream := Stream{
+		Width:      1920,
+		Height:     1080,
+		FrameRate:  big.NewRat(24, 1),
+		StreamType: "video",
+	}
+
+	high, _ := StreamRepresentationFromRepresentationId(stream, "preset:1080-6000k-hevc-video")
+	lowest, ok := GetLowestPresetRepresentation(high)
+	assert.True(t, ok)
+	assert.Equal(t, "preset:360-400k-hevc-video", lowest.Representation.RepresentationId)
+
+	_, ok = GetLowestPresetRepresentation(lowest)
+	assert.False(t, ok, "Already the lowest preset")
+
+	similar := GetSimilarTranscodedRepresentation(Stream{
+		Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), BitRate: 8000000, StreamType: "video"})
+	lowest, ok = GetLowestPresetRepresentation(similar)
+	assert.True(t, ok)
+	assert.Equal(t, "preset:360-700k-video", lowest.Representation.RepresentationId)
+
+	audio, _ := StreamRepresentationFromRepresentationId(Stream{StreamType: "audio"}, "preset:128k-audio")
+	lowest, ok = GetLowestPresetRepresentation(audio)
+	assert.True(t, ok)
+	assert.Equal(t, "preset:64k-audio", lowest.Representation.RepresentationId)
+}
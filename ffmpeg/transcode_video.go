@@ -5,50 +5,179 @@ import (
 	log "github.com/sirupsen/logrus"
 	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"os/exec"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func GetVideoEncoderPreset(stream Stream, name string) (EncoderParams, error) {
-	encoderParams, exists := map[string]EncoderParams{
-		"480-1000k-video": {
-			height: 480, width: -2,
-			videoBitrate: 1000000},
-		"720-5000k-video": {
-			height: 720, width: -2,
-			videoBitrate: 5000000},
-		"1080-10000k-video": {
-			height: 1080, width: -2,
-			videoBitrate: 10000000},
-	}[name]
+// Video codecs that we can transcode to.
+const (
+	VideoCodecH264 = "h264"
+	VideoCodecHEVC = "hevc"
+	VideoCodecAV1  = "av1"
+)
 
+// videoEncoderPresets are the presets that offline copies can be made with. Any preset of the
+// transcoding ladder can be used for streaming as well, see ladderPresets.
+var videoEncoderPresets = map[string]EncoderParams{
+	"480-1000k-video": {
+		height: 480, width: -2,
+		videoBitrate: 1000000},
+	"720-5000k-video": {
+		height: 720, width: -2,
+		videoBitrate: 5000000},
+	"1080-10000k-video": {
+		height: 1080, width: -2,
+		videoBitrate: 10000000},
+	// HEVC and AV1 achieve similar quality at a considerably lower bitrate than H.264.
+	"480-600k-hevc-video": {
+		height: 480, width: -2,
+		videoBitrate: 600000, videoCodec: VideoCodecHEVC},
+	"720-3000k-hevc-video": {
+		height: 720, width: -2,
+		videoBitrate: 3000000, videoCodec: VideoCodecHEVC},
+	"1080-6000k-hevc-video": {
+		height: 1080, width: -2,
+		videoBitrate: 6000000, videoCodec: VideoCodecHEVC},
+	"480-500k-av1-video": {
+		height: 480, width: -2,
+		videoBitrate: 500000, videoCodec: VideoCodecAV1},
+	"720-2500k-av1-video": {
+		height: 720, width: -2,
+		videoBitrate: 2500000, videoCodec: VideoCodecAV1},
+	"1080-5000k-av1-video": {
+		height: 1080, width: -2,
+		videoBitrate: 5000000, videoCodec: VideoCodecAV1},
+}
+
+func GetVideoEncoderPreset(stream Stream, name string) (EncoderParams, error) {
+	encoderParams, exists := videoEncoderPresets[name]
+	if !exists {
+		encoderParams, exists = parseLadderPresetName(name)
+		// Only offer the rungs of the stream's ladder, clients must not pick arbitrary sizes and bitrates.
+		exists = exists && isLadderPreset(stream, encoderParams.videoCodec, name)
+	}
 	if !exists {
 		return EncoderParams{}, fmt.Errorf("no preset \"%s\"", name)
 	}
 	scaledWidth, scaledHeight := scalePreserveAspectRatio(
 		stream.Width, stream.Height,
 		-2, encoderParams.height)
-	encoderParams.Codecs = GetAVC1Tag(
+	encoderParams.Codecs = getVideoCodecTag(
+		encoderParams.videoCodec,
 		scaledWidth, scaledHeight,
 		int64(encoderParams.videoBitrate),
-		stream.FrameRate)
+		stream.FrameRate,
+		false)
 
 	return encoderParams, nil
 }
 
-// List of standard presets that are offered by default
-var standardPresets = []string{
-	"preset:480-1000k-video",
-	"preset:720-5000k-video",
-	"preset:1080-10000k-video"}
+// getVideoCodecTag returns the codecs string for the given video codec. tenBit is only supported for
+// HEVC and AV1.
+func getVideoCodecTag(videoCodec string, width int, height int, bitRate int64, frameRate *big.Rat, tenBit bool) string {
+	switch videoCodec {
+	case VideoCodecHEVC:
+		return hvc1Tag(width, height, bitRate, frameRate, tenBit)
+	case VideoCodecAV1:
+		return av01Tag(width, height, bitRate, frameRate, tenBit)
+	}
+	return GetAVC1Tag(width, height, bitRate, frameRate)
+}
+
+// videoCodecPreference lists the video codecs that we transcode to, most efficient first.
+var videoCodecPreference = []string{VideoCodecAV1, VideoCodecHEVC, VideoCodecH264}
 
+// GetStandardPresetVideoRepresentations returns the H.264 transcoding ladder for the given stream.
 func GetStandardPresetVideoRepresentations(stream Stream) []StreamRepresentation {
+	return getPresetVideoRepresentations(stream, VideoCodecH264)
+}
+
+// GetAllStandardPresetVideoRepresentations returns the transcoding ladders for all video codecs that
+// the encoder backend supports.
+func GetAllStandardPresetVideoRepresentations(stream Stream) []StreamRepresentation {
 	representations := []StreamRepresentation{}
-	for _, preset := range standardPresets {
-		r, _ := StreamRepresentationFromRepresentationId(stream, preset)
+	for _, videoCodec := range videoCodecPreference {
+		if !isVideoCodecSupported(videoCodec) {
+			continue
+		}
+		representations = append(representations, getPresetVideoRepresentations(stream, videoCodec)...)
+	}
+	return representations
+}
+
+// GetPreferredPresetVideoRepresentations returns the transcoding ladder in the most efficient video
+// codec that both the client and the encoder backend support, lowest quality first. If the client
+// doesn't state its codecs or can't play any of the HEVC/AV1 presets, the H.264 ladder is
+// returned. Presets that exceed the client's size or bitrate limits are left out.
+func GetPreferredPresetVideoRepresentations(
+	stream Stream,
+	capabilities ClientCodecCapabilities) []StreamRepresentation {
+
+	// We interpret empty codecs as no preference
+	if !capabilities.HasCodecPreference() {
+		return capabilities.Filter(GetStandardPresetVideoRepresentations(stream))
+	}
+
+	for _, videoCodec := range videoCodecPreference {
+		if !isVideoCodecSupported(videoCodec) {
+			continue
+		}
+		representations := capabilities.Filter(getPresetVideoRepresentations(stream, videoCodec))
+		if len(representations) > 0 {
+			return representations
+		}
+	}
+	return withinLimits(capabilities, GetStandardPresetVideoRepresentations(stream))
+}
+
+// withinLimits returns the representations that are within the client's limits, ignoring its
+// codecs.
+func withinLimits(capabilities ClientCodecCapabilities, representations []StreamRepresentation) []StreamRepresentation {
+	capabilities.PlayableCodecs = nil
+	capabilities.CodecProfiles = nil
+	return capabilities.Filter(representations)
+}
+
+// GetLowestPresetRepresentation returns the cheapest preset that produces the same codec as the
+// given transcoded representation, e.g. to fall back to when the server is busy. ok is false if
+// the given representation is already at least as cheap.
+func GetLowestPresetRepresentation(sr StreamRepresentation) (lowest StreamRepresentation, ok bool) {
+	var presetID string
+	switch sr.Stream.StreamType {
+	case "video":
+		videoCodec := sr.Representation.encoderParams.videoCodec
+		if videoCodec == "" {
+			videoCodec = VideoCodecH264
+		}
+		presetID = "preset:" + ladderPresets(sr.Stream, videoCodec)[0]
+	case "audio":
+		presetID = "preset:64k-audio"
+	default:
+		return StreamRepresentation{}, false
+	}
+
+	lowest, err := StreamRepresentationFromRepresentationId(sr.Stream, presetID)
+	if err != nil || lowest.Representation.BitRate >= sr.Representation.BitRate {
+		return StreamRepresentation{}, false
+	}
+	if sr.Representation.encoderParams.keepHDR {
+		lowest, _ = GetHDRVideoRepresentation(lowest)
+	}
+	if subtitleStreamId := sr.Representation.encoderParams.burnInSubtitleStreamId; subtitleStreamId != 0 {
+		lowest = GetBurnInVideoRepresentation(lowest, Stream{StreamKey: StreamKey{StreamId: subtitleStreamId}})
+	}
+	return lowest, true
+}
+
+func getPresetVideoRepresentations(stream Stream, videoCodec string) []StreamRepresentation {
+	representations := []StreamRepresentation{}
+	for _, preset := range ladderPresets(stream, videoCodec) {
+		r, _ := StreamRepresentationFromRepresentationId(stream, "preset:"+preset)
 		representations = append(representations, r)
 	}
 	return representations
@@ -67,8 +196,9 @@ func NewVideoTranscodingSession(
 	}
 
 	encoderParams := stream.Representation.encoderParams
+	backend := activeEncoderBackend
 
-	args := []string{}
+	args := backend.GlobalArgs()
 	if startTime != 0 {
 		args = append(args, []string{
 			// -ss being before -i is important for fast seeking
@@ -79,9 +209,14 @@ func NewVideoTranscodingSession(
 	args = append(args, []string{
 		"-i", buildFfmpegUrlFromFileLocator(stream.Stream.FileLocator),
 		"-copyts",
-		"-map", fmt.Sprintf("0:%d", stream.Stream.StreamId),
-		"-c:0", "libx264", "-b:v", strconv.Itoa(encoderParams.videoBitrate),
-		"-preset:0", "veryfast",
+	}...)
+	args = append(args, videoMapAndFilterArgs(stream, backend)...)
+	args = append(args, backend.EncoderArgs(encoderParams.videoCodec)...)
+	if encoderParams.keepHDR {
+		args = append(args, hdrEncoderArgs(stream.Stream)...)
+	}
+	args = append(args, []string{
+		"-b:v", strconv.Itoa(encoderParams.videoBitrate),
 		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%.3f)", SegmentDuration.Seconds()),
 		"-f", "hls",
 		"-start_number", fmt.Sprintf("%d", segmentStartIndex),
@@ -91,11 +226,6 @@ func NewVideoTranscodingSession(
 		"-olaris_feedback_url", feedbackURL,
 	}...)
 
-	if encoderParams.width != 0 || encoderParams.height != 0 {
-		args = append(args, []string{
-			"-filter:0", fmt.Sprintf("scale=%d:%d", encoderParams.width, encoderParams.height),
-		}...)
-	}
 	// We serve our own manifest, so we don't really care about this.
 	args = append(args, path.Join(outputDir, "generated_by_ffmpeg.m3u"))
 
@@ -120,6 +250,126 @@ func NewVideoTranscodingSession(
 	}, nil
 }
 
+// videoMapAndFilterArgs returns the arguments that select the video stream of the given
+// representation and apply its filters, i.e. the conversion to 8-bit SDR (or 10-bit HDR), the
+// subtitle overlay and the backend's filter chain.
+func videoMapAndFilterArgs(stream StreamRepresentation, backend EncoderBackend) []string {
+	encoderParams := stream.Representation.encoderParams
+	sourceFilter := sourceVideoFilter(stream.Stream)
+	if encoderParams.keepHDR {
+		sourceFilter = hdrVideoFilter
+	}
+	filter := backend.VideoFilter(encoderParams.width, encoderParams.height)
+
+	if encoderParams.burnInSubtitleStreamId == 0 {
+		args := []string{"-map", fmt.Sprintf("0:%d", stream.Stream.StreamId)}
+		if filter := joinFilters(sourceFilter, filter); filter != "" {
+			args = append(args, "-filter:0", filter)
+		}
+		return args
+	}
+
+	// The subtitles are overlaid in software at the original resolution, after the video has been
+	// converted to SDR (or 10-bit HDR) and before the backend scales the frames and possibly uploads
+	// them to the GPU.
+	video := fmt.Sprintf("[0:%d]", stream.Stream.StreamId)
+	filterGraph := ""
+	if sourceFilter != "" {
+		filterGraph = video + sourceFilter + "[sdr];"
+		video = "[sdr]"
+	}
+	filterGraph += fmt.Sprintf("%s[0:%d]overlay", video, encoderParams.burnInSubtitleStreamId)
+	if filter != "" {
+		filterGraph += "," + filter
+	}
+	return []string{"-filter_complex", filterGraph + "[v]", "-map", "[v]"}
+}
+
+// sourceVideoFilter returns the filter chain that converts the video stream to what all our
+// encoders accept and all clients can display: 8-bit SDR. HDR video is tone mapped, otherwise its
+// colours look washed out. An empty string means no conversion is required.
+func sourceVideoFilter(stream Stream) string {
+	if stream.IsHDR() {
+		return toneMapFilter(stream)
+	}
+	if stream.BitDepth > 8 {
+		return "format=yuv420p"
+	}
+	return ""
+}
+
+// hdrVideoFilter converts HDR video to what the HEVC and AV1 software encoders accept without
+// touching its transfer function and primaries.
+const hdrVideoFilter = "format=yuv420p10le"
+
+// GetHDRVideoRepresentation returns the given transcoded representation of HDR video with the video
+// kept in HDR instead of tone mapping it to SDR. ok is false if that isn't possible: only the
+// software HEVC and AV1 encoders get the 10-bit input HDR needs, the hardware backends convert the
+// frames to 8 bit.
+func GetHDRVideoRepresentation(sr StreamRepresentation) (hdr StreamRepresentation, ok bool) {
+	encoderParams := sr.Representation.encoderParams
+	if !sr.Representation.Transcoded || !sr.Stream.IsHDR() ||
+		activeEncoderBackend.Name() != EncoderBackendSoftware {
+		return StreamRepresentation{}, false
+	}
+	if encoderParams.videoCodec != VideoCodecHEVC && encoderParams.videoCodec != VideoCodecAV1 {
+		return StreamRepresentation{}, false
+	}
+	if encoderParams.keepHDR {
+		return sr, true
+	}
+
+	width, height := representationSize(sr)
+	sr.Representation.encoderParams.keepHDR = true
+	sr.Representation.Codecs = getVideoCodecTag(encoderParams.videoCodec,
+		width, height, int64(encoderParams.videoBitrate), sr.Stream.FrameRate, true)
+	sr.Representation.encoderParams.Codecs = sr.Representation.Codecs
+	sr.Representation.RepresentationId = hdrRepresentationIdPrefix + sr.Representation.RepresentationId
+	return sr, true
+}
+
+const hdrRepresentationIdPrefix = "hdr:"
+
+// hdrEncoderArgs tag the encoded video with the colour properties of the HDR source stream.
+func hdrEncoderArgs(stream Stream) []string {
+	primaries := stream.ColorPrimaries
+	if primaries == "" || primaries == "unknown" {
+		primaries = "bt2020"
+	}
+	return []string{
+		"-color_primaries:0", primaries,
+		"-color_trc:0", stream.ColorTransfer,
+		"-colorspace:0", "bt2020nc",
+	}
+}
+
+// toneMapFilter maps HDR10 or HLG video to SDR BT.709. The source's transfer function and primaries
+// are passed explicitly because many files don't tag the individual frames.
+func toneMapFilter(stream Stream) string {
+	primaries := stream.ColorPrimaries
+	if primaries == "" || primaries == "unknown" {
+		primaries = "bt2020"
+	}
+	return joinFilters(
+		fmt.Sprintf("zscale=tin=%s:pin=%s:min=bt2020nc:t=linear:npl=100", stream.ColorTransfer, primaries),
+		"format=gbrpf32le",
+		"zscale=p=bt709",
+		"tonemap=tonemap=hable:desat=0",
+		"zscale=t=bt709:m=bt709:r=tv",
+		"format=yuv420p")
+}
+
+// joinFilters joins the given filter chains, leaving out empty ones.
+func joinFilters(filters ...string) string {
+	nonEmpty := []string{}
+	for _, f := range filters {
+		if f != "" {
+			nonEmpty = append(nonEmpty, f)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
 func GetTranscodedVideoRepresentation(
 	stream Stream,
 	representationId string,
@@ -74,6 +74,7 @@ func GetTransmuxedRepresentation(stream Stream) StreamRepresentation {
 			RepresentationId: "direct",
 			Container:        "video/mp4",
 			Codecs:           stream.Codecs,
+			Channels:         stream.Channels,
 			BitRate:          int(stream.BitRate),
 			Height:           stream.Height,
 			Width:            stream.Width,
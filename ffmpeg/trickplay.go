@@ -0,0 +1,249 @@
+package ffmpeg
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.com/olaris/olaris-server/ffmpeg/executable"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/helpers"
+)
+
+// TrickplayInterval is the time between two trickplay thumbnails.
+const TrickplayInterval = 10 * time.Second
+
+// TrickplayVTTFileName is the name of the WebVTT thumbnail track in the trickplay directory of a file.
+const TrickplayVTTFileName = "thumbnails.vtt"
+
+const (
+	trickplayInfoFileName   = "trickplay.json"
+	trickplayThumbnailWidth = 320
+	trickplayColumns        = 10
+	trickplayRows           = 10
+)
+
+// Trickplay describes the seek-preview thumbnails of a file. The thumbnails are tiled into sprite
+// sheets of Columns x Rows thumbnails, in order from left to right and top to bottom.
+type Trickplay struct {
+	Interval        time.Duration
+	ThumbnailWidth  int
+	ThumbnailHeight int
+	Columns         int
+	Rows            int
+	ThumbnailCount  int
+}
+
+// NewTrickplay computes the trickplay layout for the given video stream.
+func NewTrickplay(videoStream Stream) Trickplay {
+	height := trickplayThumbnailWidth * 9 / 16
+	if videoStream.Width > 0 && videoStream.Height > 0 {
+		height = trickplayThumbnailWidth * videoStream.Height / videoStream.Width
+	}
+	// Most encoders want even dimensions
+	height += height % 2
+
+	count := int(videoStream.TotalDuration / TrickplayInterval)
+	if videoStream.TotalDuration%TrickplayInterval != 0 {
+		count++
+	}
+
+	return Trickplay{
+		Interval:        TrickplayInterval,
+		ThumbnailWidth:  trickplayThumbnailWidth,
+		ThumbnailHeight: height,
+		Columns:         trickplayColumns,
+		Rows:            trickplayRows,
+		ThumbnailCount:  count,
+	}
+}
+
+// SpriteCount returns the number of sprite sheets.
+func (t Trickplay) SpriteCount() int {
+	perSprite := t.Columns * t.Rows
+	return (t.ThumbnailCount + perSprite - 1) / perSprite
+}
+
+// SpriteFileName returns the file name of the sprite sheet with the given zero-based index.
+func SpriteFileName(index int) string {
+	// ffmpeg's image2 muxer starts numbering at 1
+	return fmt.Sprintf("sprite-%03d.jpg", index+1)
+}
+
+// WriteVTT writes the WebVTT thumbnail track, with one cue per thumbnail pointing to its
+// region in the sprite sheet using a media fragment.
+func (t Trickplay) WriteVTT(w io.Writer) error {
+	if _, err := fmt.Fprint(w, "WEBVTT\n"); err != nil {
+		return err
+	}
+
+	for i := 0; i < t.ThumbnailCount; i++ {
+		start := time.Duration(i) * t.Interval
+		_, err := fmt.Fprintf(w, "\n%s --> %s\n%s\n",
+			vttTimestamp(start), vttTimestamp(start+t.Interval), t.thumbnail(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ThumbnailAt returns the sprite sheet and region of the thumbnail shown at the given time, e.g.
+// "sprite-001.jpg#xywh=320,0,320,180".
+func (t Trickplay) ThumbnailAt(d time.Duration) string {
+	i := int(d / t.Interval)
+	if i >= t.ThumbnailCount {
+		i = t.ThumbnailCount - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return t.thumbnail(i)
+}
+
+func (t Trickplay) thumbnail(i int) string {
+	perSprite := t.Columns * t.Rows
+	tile := i % perSprite
+	x := (tile % t.Columns) * t.ThumbnailWidth
+	y := (tile / t.Columns) * t.ThumbnailHeight
+	return fmt.Sprintf("%s#xywh=%d,%d,%d,%d",
+		SpriteFileName(i/perSprite), x, y, t.ThumbnailWidth, t.ThumbnailHeight)
+}
+
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d",
+		ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// GetTrickplayDir returns the directory that the trickplay thumbnails of the given file are stored in.
+func GetTrickplayDir(fileLocator filesystem.FileLocator) string {
+	hash := sha1.Sum([]byte(fileLocator.String()))
+	return path.Join(getTrickplayRuntimeDir(), hex.EncodeToString(hash[:]))
+}
+
+func getTrickplayRuntimeDir() string {
+	return path.Join(viper.GetString("server.cacheDir"), "trickplay")
+}
+
+// GetTrickplay returns the trickplay layout of the given file,
+// or nil if no thumbnails have been generated for it yet.
+func GetTrickplay(fileLocator filesystem.FileLocator) (*Trickplay, error) {
+	data, err := ioutil.ReadFile(path.Join(GetTrickplayDir(fileLocator), trickplayInfoFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var t Trickplay
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, errors.Wrap(err, "Failed to read trickplay info")
+	}
+	return &t, nil
+}
+
+// HasTrickplay checks whether trickplay thumbnails have been generated for the given file.
+func HasTrickplay(fileLocator filesystem.FileLocator) bool {
+	t, _ := GetTrickplay(fileLocator)
+	return t != nil
+}
+
+// DeleteTrickplay removes the trickplay thumbnails of the given file.
+func DeleteTrickplay(fileLocator filesystem.FileLocator) error {
+	return os.RemoveAll(GetTrickplayDir(fileLocator))
+}
+
+// GenerateTrickplay extracts a thumbnail every TrickplayInterval from the given file and stores
+// them as sprite sheets along with a WebVTT thumbnail track. This takes a while for long files,
+// so it should be run in the background.
+func GenerateTrickplay(fileLocator filesystem.FileLocator) error {
+	streams, err := GetStreams(fileLocator)
+	if err != nil {
+		return err
+	}
+	if len(streams.VideoStreams) == 0 {
+		return fmt.Errorf("%s has no video stream", fileLocator)
+	}
+	videoStream := streams.GetVideoStream()
+	if videoStream.TotalDuration <= 0 {
+		return fmt.Errorf("%s has no known duration", fileLocator)
+	}
+	t := NewTrickplay(videoStream)
+
+	// Build everything in a temporary directory so that a half-finished run is never served.
+	outputDir := GetTrickplayDir(fileLocator)
+	tmpDir := outputDir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := helpers.EnsurePath(tmpDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	log.WithFields(log.Fields{"fileLocator": fileLocator, "thumbnails": t.ThumbnailCount}).
+		Infoln("Generating trickplay thumbnails")
+
+	if err := runTrickplayFFmpeg(fileLocator, t, tmpDir); err != nil {
+		return errors.Wrap(err, "Failed to extract trickplay thumbnails")
+	}
+
+	vtt, err := os.Create(path.Join(tmpDir, TrickplayVTTFileName))
+	if err != nil {
+		return err
+	}
+	err = t.WriteVTT(vtt)
+	vtt.Close()
+	if err != nil {
+		return err
+	}
+
+	info, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(tmpDir, trickplayInfoFileName), info, 0644); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(outputDir); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, outputDir)
+}
+
+func runTrickplayFFmpeg(fileLocator filesystem.FileLocator, t Trickplay, outputDir string) error {
+	filter := fmt.Sprintf("fps=1/%d,scale=%d:%d,tile=%dx%d",
+		int(t.Interval.Seconds()), t.ThumbnailWidth, t.ThumbnailHeight, t.Columns, t.Rows)
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		// Decoding only keyframes is much faster and plenty accurate for thumbnails.
+		"-skip_frame", "nokey",
+		"-i", buildFfmpegUrlFromFileLocator(fileLocator),
+		"-an", "-sn", "-dn",
+		"-vf", filter,
+		"-q:v", "5",
+		"-f", "image2",
+		path.Join(outputDir, "sprite-%03d.jpg"),
+	}
+
+	cmd := exec.Command(executable.GetFFmpegExecutablePath(), args...)
+	if viper.GetBool("debug.transcoderLog") {
+		cmd.Stderr = os.Stderr
+	}
+	log.Debugf("Starting %s with args %s", cmd.Path, cmd.Args)
+	return cmd.Run()
+}
@@ -0,0 +1,101 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+func TestNewTrickplay(t *testing.T) {
+	tp := NewTrickplay(Stream{Width: 1920, Height: 800, TotalDuration: 1005 * time.Second})
+
+	assert.Equal(t, 320, tp.ThumbnailWidth)
+	// 133.33 rounded down, then up to the next even number
+	assert.Equal(t, 134, tp.ThumbnailHeight)
+	assert.Equal(t, 101, tp.ThumbnailCount)
+	assert.Equal(t, 2, tp.SpriteCount())
+}
+
+func TestNewTrickplay_UnknownDimensions(t *testing.T) {
+	tp := NewTrickplay(Stream{TotalDuration: 20 * time.Second})
+
+	assert.Equal(t, 180, tp.ThumbnailHeight)
+	assert.Equal(t, 2, tp.ThumbnailCount)
+	assert.Equal(t, 1, tp.SpriteCount())
+}
+
+func TestTrickplay_WriteVTT(t *testing.T) {
+	tp := Trickplay{
+		Interval:        10 * time.Second,
+		ThumbnailWidth:  320,
+		ThumbnailHeight: 180,
+		Columns:         2,
+		Rows:            2,
+		ThumbnailCount:  5,
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, tp.WriteVTT(&b))
+
+	assert.Equal(t, strings.Join([]string{
+		"WEBVTT",
+		"",
+		"00:00:00.000 --> 00:00:10.000",
+		"sprite-001.jpg#xywh=0,0,320,180",
+		"",
+		"00:00:10.000 --> 00:00:20.000",
+		"sprite-001.jpg#xywh=320,0,320,180",
+		"",
+		"00:00:20.000 --> 00:00:30.000",
+		"sprite-001.jpg#xywh=0,180,320,180",
+		"",
+		"00:00:30.000 --> 00:00:40.000",
+		"sprite-001.jpg#xywh=320,180,320,180",
+		"",
+		"00:00:40.000 --> 00:00:50.000",
+		"sprite-002.jpg#xywh=0,0,320,180",
+		"",
+	}, "\n"), b.String())
+}
+
+func TestTrickplay_ThumbnailAt(t *testing.T) {
+	tp := Trickplay{
+		Interval:        10 * time.Second,
+		ThumbnailWidth:  320,
+		ThumbnailHeight: 180,
+		Columns:         2,
+		Rows:            2,
+		ThumbnailCount:  5,
+	}
+
+	assert.Equal(t, "sprite-001.jpg#xywh=0,0,320,180", tp.ThumbnailAt(0))
+	assert.Equal(t, "sprite-001.jpg#xywh=320,0,320,180", tp.ThumbnailAt(19*time.Second))
+	assert.Equal(t, "sprite-002.jpg#xywh=0,0,320,180", tp.ThumbnailAt(45*time.Second))
+	// Chapters may end after the last thumbnail.
+	assert.Equal(t, "sprite-002.jpg#xywh=0,0,320,180", tp.ThumbnailAt(time.Hour))
+}
+
+func TestGetTrickplay_NotGenerated(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "olaris-trickplay")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	viper.Set("server.cacheDir", cacheDir)
+	defer viper.Set("server.cacheDir", "")
+
+	fileLocator := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/movies/Movie.mkv"}
+	tp, err := GetTrickplay(fileLocator)
+	assert.NoError(t, err)
+	assert.Nil(t, tp)
+	assert.False(t, HasTrickplay(fileLocator))
+	assert.NotEqual(t,
+		GetTrickplayDir(fileLocator),
+		GetTrickplayDir(filesystem.FileLocator{Backend: filesystem.BackendRclone, Path: "/movies/Movie.mkv"}))
+}
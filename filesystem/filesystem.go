@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 )
 
 // BackendType specifies what kind of Library backend is being used.
@@ -35,9 +36,12 @@ type WalkFunc func(path string, node Node, err error) error
 type Node interface {
 	BackendType() BackendType
 	Size() int64
+	// ModTime returns when the contents of the file last changed.
+	ModTime() time.Time
 	Name() string
 	Path() string
 	ListDir() ([]string, error)
+	ListFiles() ([]string, error)
 	IsDir() bool
 	Walk(walkFunc WalkFunc, followFileSymlinks bool) error
 	FileLocator() FileLocator
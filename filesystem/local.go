@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type LocalNode struct {
@@ -25,6 +26,9 @@ func (n *LocalNode) Name() string {
 func (n *LocalNode) Size() int64 {
 	return n.fileInfo.Size()
 }
+func (n *LocalNode) ModTime() time.Time {
+	return n.fileInfo.ModTime()
+}
 func (n *LocalNode) IsDir() bool {
 	return n.fileInfo.IsDir()
 }
@@ -46,6 +50,23 @@ func (n *LocalNode) ListDir() ([]string, error) {
 	return dirs, nil
 }
 
+// ListFiles lists the names of all files (not dirs) inside the given node
+func (n *LocalNode) ListFiles() ([]string, error) {
+	names := []string{}
+	if n.IsDir() {
+		files, err := ioutil.ReadDir(n.Path())
+		if err != nil {
+			return names, err
+		}
+		for _, file := range files {
+			if !file.IsDir() {
+				names = append(names, file.Name())
+			}
+		}
+	}
+	return names, nil
+}
+
 func (n *LocalNode) Path() string {
 	return n.path
 }
@@ -7,6 +7,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	_ "github.com/rclone/rclone/backend/all"
@@ -100,6 +101,10 @@ func (n *RcloneNode) Size() int64 {
 	return n.Node.Size()
 }
 
+func (n *RcloneNode) ModTime() time.Time {
+	return n.Node.ModTime()
+}
+
 func (n *RcloneNode) IsDir() bool {
 	return n.Node.IsDir()
 }
@@ -121,6 +126,23 @@ func (n *RcloneNode) ListDir() ([]string, error) {
 	return []string{}, nil
 }
 
+// ListFiles lists the names of all files (not dirs) inside the given node
+func (n *RcloneNode) ListFiles() ([]string, error) {
+	names := []string{}
+	if n.IsDir() {
+		nodes, err := n.Node.(*vfs.Dir).ReadDirAll()
+		if err != nil {
+			return names, err
+		}
+		for _, file := range nodes {
+			if !file.IsDir() {
+				names = append(names, file.Name())
+			}
+		}
+	}
+	return names, nil
+}
+
 func (n *RcloneNode) BackendType() BackendType {
 	return BackendRclone
 }
@@ -2,7 +2,9 @@ package hls
 
 import (
 	"bytes"
+	"encoding/json"
 	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"math"
 	"text/template"
 )
 
@@ -21,10 +23,12 @@ type SubtitlePlaylistItem struct {
 const transcodingMasterPlaylistTemplate = `#EXTM3U
 #EXT-X-VERSION:7
 #EXT-X-INDEPENDENT-SEGMENTS
-
+{{ with .chaptersURI -}}
+#EXT-X-SESSION-DATA:DATA-ID="com.apple.hls.chapters",URI="{{ . }}"
+{{ end }}
 {{ range $ci, $c := .representationCombinations -}}
 {{ range $si, $s := $c.AudioStreams -}}
-#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="{{$c.AudioGroupName}}",NAME="{{$s.Stream.Title}}",CHANNELS="2",URI="{{$s.Stream.StreamId}}/{{$s.Representation.RepresentationId}}/media.m3u8",AUTOSELECT=YES
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="{{$c.AudioGroupName}}",NAME="{{$s.Stream.Title}}",CHANNELS="{{ or $s.Representation.Channels 2 }}",URI="{{$s.Stream.StreamId}}/{{$s.Representation.RepresentationId}}/media.m3u8",AUTOSELECT=YES
 {{- if $s.Stream.EnabledByDefault -}}
 ,DEFAULT=YES
 {{ else -}}
@@ -35,6 +39,12 @@ const transcodingMasterPlaylistTemplate = `#EXTM3U
 
 {{ range $i, $s := .subtitlePlaylistItems -}}
 #EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="webvtt",NAME="{{$s.Stream.Title}}",LANGUAGE="{{$s.Stream.Language}}",AUTOSELECT=YES,URI="{{$s.URI}}"
+{{- if $s.Stream.Forced -}}
+,FORCED=YES
+{{- end -}}
+{{- if $s.Stream.HearingImpaired -}}
+,CHARACTERISTICS="public.accessibility.transcribes-spoken-dialog,public.accessibility.describes-music-and-sound"
+{{- end -}}
 {{- if $s.Stream.EnabledByDefault -}}
 ,DEFAULT=YES
 {{ else -}}
@@ -43,12 +53,23 @@ const transcodingMasterPlaylistTemplate = `#EXTM3U
 {{ end }}
 
 {{ range $ci, $c := .representationCombinations -}}
-#EXT-X-STREAM-INF:BANDWIDTH={{$c.VideoStream.Representation.BitRate}},CODECS="{{$c.VideoStream.Representation.Codecs}},{{$c.AudioCodecs}}",AUDIO="{{$c.AudioGroupName}}"
+#EXT-X-STREAM-INF:BANDWIDTH={{$c.VideoStream.Representation.BitRate}},CODECS="{{$c.VideoStream.Representation.Codecs}},{{$c.AudioCodecs}}"
+{{- if and $c.VideoStream.VideoWidth $c.VideoStream.VideoHeight -}}
+,RESOLUTION={{$c.VideoStream.VideoWidth}}x{{$c.VideoStream.VideoHeight}}
+{{- end -}}
+,AUDIO="{{$c.AudioGroupName}}"
 {{- if $.subtitlePlaylistItems -}}
 ,SUBTITLES="webvtt"
 {{- end }}
 {{$c.VideoStream.Stream.StreamId}}/{{$c.VideoStream.Representation.RepresentationId}}/media.m3u8
 {{ end }}
+{{- range $i, $s := .iFrameStreams }}
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH={{$s.Representation.BitRate}},CODECS="{{$s.Representation.Codecs}}"
+{{- if and $s.VideoWidth $s.VideoHeight -}}
+,RESOLUTION={{$s.VideoWidth}}x{{$s.VideoHeight}}
+{{- end -}}
+,URI="{{$s.Stream.StreamId}}/{{$s.Representation.RepresentationId}}/media.m3u8"
+{{ end }}
 `
 
 /*
@@ -67,6 +88,20 @@ const transcodingMediaPlaylistTemplate = `#EXTM3U
 #EXT-X-ENDLIST
 `
 
+// Each segment of the I-frame playlist is a single keyframe, shown until the next one.
+const iFramePlaylistTemplate = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:{{ .targetDuration }}
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-I-FRAMES-ONLY
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MAP:URI="init.mp4"
+{{ range $index, $s := .segments }}
+#EXTINF:{{ printf "%.3f" $s.Duration.Seconds }},
+{{ $index }}.m4s{{ end }}
+#EXT-X-ENDLIST
+`
+
 // The subtitle playlist only contains one "segment",
 // therefore the target duration equals the total duration
 const subtitleMediaPlaylistTemplate = `#EXTM3U
@@ -79,9 +114,14 @@ const subtitleMediaPlaylistTemplate = `#EXTM3U
 #EXT-X-ENDLIST
 `
 
+// BuildMasterPlaylistFromFile builds the master playlist. iFrameStreams are the I-frame
+// representations offered for trick play, there may be none. chaptersURI is the chapters JSON
+// file, see BuildChaptersJSON. It is empty if the file has no chapters.
 func BuildMasterPlaylistFromFile(
 	representationCombinations []RepresentationCombination,
-	subtitlePlaylistItems []SubtitlePlaylistItem) string {
+	subtitlePlaylistItems []SubtitlePlaylistItem,
+	iFrameStreams []ffmpeg.StreamRepresentation,
+	chaptersURI string) string {
 
 	buf := bytes.Buffer{}
 	t := template.Must(template.New("manifest").Parse(transcodingMasterPlaylistTemplate))
@@ -89,6 +129,55 @@ func BuildMasterPlaylistFromFile(
 	t.Execute(&buf, map[string]interface{}{
 		"subtitlePlaylistItems":      subtitlePlaylistItems,
 		"representationCombinations": representationCombinations,
+		"iFrameStreams":              iFrameStreams,
+		"chaptersURI":                chaptersURI,
+	})
+	return buf.String()
+}
+
+// chapterJSON is a chapter in the format of the chapters JSON file of the HLS authoring spec.
+type chapterJSON struct {
+	Chapter   int                `json:"chapter"`
+	StartTime float64            `json:"start-time"`
+	Duration  float64            `json:"duration"`
+	Titles    []chapterTitleJSON `json:"titles"`
+}
+
+type chapterTitleJSON struct {
+	Language string `json:"language"`
+	Title    string `json:"title"`
+}
+
+// BuildChaptersJSON builds the chapters JSON file that the master playlist refers to with the
+// com.apple.hls.chapters session data. We don't know the language of chapter titles.
+func BuildChaptersJSON(chapters []ffmpeg.Chapter) string {
+	entries := []chapterJSON{}
+	for i, c := range chapters {
+		entries = append(entries, chapterJSON{
+			Chapter:   i + 1,
+			StartTime: c.Start.Seconds(),
+			Duration:  (c.End - c.Start).Seconds(),
+			Titles:    []chapterTitleJSON{{Language: "und", Title: c.Title}},
+		})
+	}
+	b, _ := json.MarshalIndent(entries, "", "  ")
+	return string(b)
+}
+
+// BuildIFramePlaylist builds the media playlist of an I-frame representation.
+func BuildIFramePlaylist(segments []ffmpeg.IFrameSegment) string {
+	targetDuration := 1
+	for _, s := range segments {
+		if d := int(math.Ceil(s.Duration.Seconds())); d > targetDuration {
+			targetDuration = d
+		}
+	}
+
+	buf := bytes.Buffer{}
+	t := template.Must(template.New("manifest").Parse(iFramePlaylistTemplate))
+	t.Execute(&buf, map[string]interface{}{
+		"targetDuration": targetDuration,
+		"segments":       segments,
 	})
 	return buf.String()
 }
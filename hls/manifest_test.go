@@ -0,0 +1,88 @@
+package hls
+
+import (
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func assertGolden(t *testing.T, name string, actual string) {
+	goldenPath := path.Join("testdata", name)
+	if *update {
+		require.NoError(t, ioutil.WriteFile(goldenPath, []byte(actual), 0644))
+	}
+	expected, err := ioutil.ReadFile(goldenPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), actual)
+}
+
+var testFileLocator = filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/movies/movie.mkv"}
+
+func testStreams() (ffmpeg.Stream, ffmpeg.Stream) {
+	video := ffmpeg.Stream{
+		StreamKey:     ffmpeg.StreamKey{FileLocator: testFileLocator, StreamId: 0},
+		TotalDuration: 10 * time.Second,
+		Codecs:        "avc1.640028",
+		BitRate:       8000000,
+		FrameRate:     big.NewRat(24, 1),
+		Width:         1920,
+		Height:        1080,
+		StreamType:    "video",
+	}
+	audio := ffmpeg.Stream{
+		StreamKey:        ffmpeg.StreamKey{FileLocator: testFileLocator, StreamId: 1},
+		TotalDuration:    10 * time.Second,
+		Codecs:           "mp4a.40.2",
+		Channels:         2,
+		StreamType:       "audio",
+		Language:         "eng",
+		Title:            "English",
+		EnabledByDefault: true,
+	}
+	return video, audio
+}
+
+func testIFrameSegments() []ffmpeg.IFrameSegment {
+	keyframes := []time.Duration{0, 2 * time.Second, 4 * time.Second, 6500 * time.Millisecond}
+	return ffmpeg.IFrameSegments(keyframes, 10*time.Second)
+}
+
+func TestBuildMasterPlaylistFromFile_IFrames(t *testing.T) {
+	video, audio := testStreams()
+	audioRepresentations := []ffmpeg.StreamRepresentation{ffmpeg.GetTransmuxedRepresentation(audio)}
+	combinations := []RepresentationCombination{
+		{
+			VideoStream:    ffmpeg.GetTransmuxedRepresentation(video),
+			AudioStreams:   audioRepresentations,
+			AudioGroupName: "audio",
+			AudioCodecs:    "mp4a.40.2",
+		},
+	}
+	iFrames := []ffmpeg.StreamRepresentation{ffmpeg.GetIFrameRepresentation(video, testIFrameSegments())}
+
+	assertGolden(t, "master_iframes.m3u8", BuildMasterPlaylistFromFile(combinations, nil, iFrames, ""))
+	assertGolden(t, "master.m3u8", BuildMasterPlaylistFromFile(combinations, nil, nil, ""))
+	assertGolden(t, "master_chapters.m3u8", BuildMasterPlaylistFromFile(combinations, nil, nil, "chapters.json"))
+}
+
+func TestBuildChaptersJSON(t *testing.T) {
+	assertGolden(t, "chapters.json", BuildChaptersJSON([]ffmpeg.Chapter{
+		{Title: "Opening", Start: 0, End: 95 * time.Second},
+		{Title: "The Heist", Start: 95 * time.Second, End: 5423456 * time.Millisecond},
+	}))
+	assert.Equal(t, "[]", BuildChaptersJSON(nil))
+}
+
+func TestBuildIFramePlaylist(t *testing.T) {
+	assertGolden(t, "iframes.m3u8", BuildIFramePlaylist(testIFrameSegments()))
+}
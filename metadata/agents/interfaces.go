@@ -3,19 +3,127 @@ package agents
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
 
 import (
-	"github.com/ryanbradynd05/go-tmdb"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
 	"gitlab.com/olaris/olaris-server/metadata/db"
 )
 
-// MetadataRetrievalAgent can retrieve metadata for media items.
+// Names of the available agents, as used in the metadata.agents config option.
+const (
+	AgentTmdb = "tmdb"
+	AgentNfo  = "nfo"
+)
+
+// DefaultAgents is the default order in which agents are asked for metadata. Local sidecar files
+// take precedence over TMDB because they were usually curated by hand.
+var DefaultAgents = []string{AgentNfo, AgentTmdb}
+
+// Providers whose IDs are used to identify media items.
+const (
+	ProviderTmdb = "tmdb"
+	ProviderImdb = "imdb"
+)
+
+// ErrNoMetadata is returned by agents that don't have any metadata for the requested item, so
+// that the next agent can be tried.
+var ErrNoMetadata = errors.New("agent has no metadata for this item")
+
+// ExternalID identifies a media item in the database of a metadata provider.
+type ExternalID struct {
+	Provider string
+	ID       string
+}
+
+// TmdbID returns the ExternalID for the given TMDB ID.
+func TmdbID(id int) ExternalID {
+	return ExternalID{Provider: ProviderTmdb, ID: strconv.Itoa(id)}
+}
+
+// Int returns the ID as a number, which all TMDB IDs are.
+func (id ExternalID) Int() (int, error) {
+	return strconv.Atoi(id.ID)
+}
+
+func (id ExternalID) String() string {
+	return fmt.Sprintf("%s:%s", id.Provider, id.ID)
+}
+
+// MovieQuery describes a movie to search for.
+type MovieQuery struct {
+	Title string
+	// Year is 0 if unknown.
+	Year int
+	// FilePath is the file locator of a file of the movie, if known. Agents that read local metadata
+	// use it to find the sidecar files.
+	FilePath string
+}
+
+// SeriesQuery describes a series to search for.
+type SeriesQuery struct {
+	Name string
+	// FirstAirYear is 0 if unknown.
+	FirstAirYear int
+	// FilePath is the file locator of an episode file of the series, if known.
+	FilePath string
+}
+
+// MovieSearchResult is a movie that matched a MovieQuery.
+type MovieSearchResult struct {
+	ID           ExternalID
+	Title        string
+	ReleaseDate  string
+	Overview     string
+	PosterPath   string
+	BackdropPath string
+}
+
+// SeriesSearchResult is a series that matched a SeriesQuery.
+type SeriesSearchResult struct {
+	ID           ExternalID
+	Name         string
+	FirstAirDate string
+	Overview     string
+	PosterPath   string
+	BackdropPath string
+}
+
+// MetadataRetrievalAgent can retrieve metadata for media items. Items are looked up by the ID
+// they have at a metadata provider, agents return an error for providers they don't know.
+//
 //counterfeiter:generate . MetadataRetrievalAgent
 type MetadataRetrievalAgent interface {
-	UpdateMovieMD(movie *db.Movie, tmdbID int) error
-	UpdateSeasonMD(season *db.Season, seriesTmdbID int, seasonNum int) error
-	UpdateEpisodeMD(episode *db.Episode, seriesTmdbID int, seasonNum int, episodeNum int) error
-	UpdateSeriesMD(series *db.Series, tmdbID int) error
-	// TODO(Leon Handreke): This totally breaks the abstraction, but we need the interface
-	//  to be able to fake it.
-	TmdbSearchMovie(name string, options map[string]string) (*tmdb.MovieSearchResults, error)
-	TmdbSearchTv(name string, options map[string]string) (*tmdb.TvSearchResults, error)
+	// Name returns the name of the agent, one of the Agent* constants.
+	Name() string
+	SearchMovie(query MovieQuery) ([]MovieSearchResult, error)
+	SearchSeries(query SeriesQuery) ([]SeriesSearchResult, error)
+	UpdateMovieMD(movie *db.Movie, id ExternalID) error
+	UpdateSeriesMD(series *db.Series, id ExternalID) error
+	UpdateSeasonMD(season *db.Season, seriesID ExternalID, seasonNum int) error
+	UpdateEpisodeMD(episode *db.Episode, seriesID ExternalID, seasonNum int, episodeNum int) error
+}
+
+// NewAgent returns the agent with the given name.
+func NewAgent(name string) (MetadataRetrievalAgent, error) {
+	switch name {
+	case AgentTmdb:
+		return NewTmdbAgent(), nil
+	case AgentNfo:
+		return NewNfoAgent(), nil
+	}
+	return nil, fmt.Errorf("unknown metadata agent: %s", name)
+}
+
+// NewAgents returns the agents with the given names, in the same order.
+func NewAgents(names []string) ([]MetadataRetrievalAgent, error) {
+	var agents []MetadataRetrievalAgent
+	for _, name := range names {
+		a, err := NewAgent(name)
+		if err != nil {
+			return nil, err
+		}
+		agents = append(agents, a)
+	}
+	return agents, nil
 }
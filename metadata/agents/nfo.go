@@ -0,0 +1,306 @@
+package agents
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/metadata/nfo"
+)
+
+// tmdbImageURLPrefix is the prefix of full URLs of TMDB images. We only store the image path.
+const tmdbImageURLPrefix = "https://image.tmdb.org/t/p/"
+
+// NfoAgent reads metadata from Kodi-style .nfo files next to local media files. It doesn't need
+// network access, but only knows about items that have sidecar files.
+type NfoAgent struct {
+	// Paths of the sidecar files found so far, keyed by nfoKey. This allows filling in items that
+	// haven't been linked to their files yet.
+	sidecars sync.Map
+}
+
+// NewNfoAgent creates a new agent that reads .nfo files.
+func NewNfoAgent() *NfoAgent {
+	return &NfoAgent{}
+}
+
+// Name returns the name of the agent.
+func (a *NfoAgent) Name() string {
+	return AgentNfo
+}
+
+func nfoKey(kind string, id ExternalID, numbers ...int) string {
+	key := fmt.Sprintf("%s/%s", kind, id)
+	for _, n := range numbers {
+		key += fmt.Sprintf("/%d", n)
+	}
+	return key
+}
+
+// NfoID returns the ID of an item described in a .nfo file, preferring TMDB IDs.
+func NfoID(tmdbID string, imdbID string) (ExternalID, bool) {
+	if tmdbID != "" {
+		return ExternalID{Provider: ProviderTmdb, ID: tmdbID}, true
+	}
+	if imdbID != "" {
+		return ExternalID{Provider: ProviderImdb, ID: imdbID}, true
+	}
+	return ExternalID{}, false
+}
+
+// tmdbImagePath returns the TMDB image path for the first thumb that is a TMDB image URL.
+func tmdbImagePath(thumbs []nfo.Thumb, aspect string) string {
+	for _, t := range thumbs {
+		if aspect != "" && t.Aspect != "" && t.Aspect != aspect {
+			continue
+		}
+		u := strings.TrimSpace(t.URL)
+		if !strings.HasPrefix(u, tmdbImageURLPrefix) {
+			continue
+		}
+		// Strip the size, e.g. https://image.tmdb.org/t/p/original/abc.jpg becomes /abc.jpg
+		parts := strings.SplitN(strings.TrimPrefix(u, tmdbImageURLPrefix), "/", 2)
+		if len(parts) == 2 {
+			return "/" + parts[1]
+		}
+	}
+	return ""
+}
+
+func fanartPath(fanart *nfo.Fanart) string {
+	if fanart == nil {
+		return ""
+	}
+	return tmdbImagePath(fanart.Thumbs, "")
+}
+
+func findMovieSidecar(filePath string) (*nfo.Movie, string, bool) {
+	if p, ok := nfo.LocalPath(filePath); ok {
+		return nfo.FindMovie(p)
+	}
+	return nil, "", false
+}
+
+func findTVShowSidecar(filePath string) (*nfo.TVShow, string, bool) {
+	if p, ok := nfo.LocalPath(filePath); ok {
+		return nfo.FindTVShow(p)
+	}
+	return nil, "", false
+}
+
+func findEpisodeSidecar(filePath string) (*nfo.Episode, string, bool) {
+	if p, ok := nfo.LocalPath(filePath); ok {
+		return nfo.FindEpisode(p)
+	}
+	return nil, "", false
+}
+
+// SearchMovie returns the movie described by the sidecar of the file in the query, if any.
+func (a *NfoAgent) SearchMovie(query MovieQuery) ([]MovieSearchResult, error) {
+	m, sidecar, ok := findMovieSidecar(query.FilePath)
+	if !ok {
+		return nil, nil
+	}
+	id, ok := NfoID(m.ID(nfo.IDTypeTmdb), m.ID(nfo.IDTypeImdb))
+	if !ok {
+		log.WithField("path", sidecar).Debugln("Ignoring .nfo file without IDs.")
+		return nil, nil
+	}
+	a.sidecars.Store(nfoKey("movie", id), sidecar)
+
+	return []MovieSearchResult{{
+		ID:           id,
+		Title:        m.Title,
+		ReleaseDate:  m.Premiered,
+		Overview:     m.Plot,
+		PosterPath:   tmdbImagePath(m.Thumbs, "poster"),
+		BackdropPath: fanartPath(m.Fanart),
+	}}, nil
+}
+
+// SearchSeries returns the series described by the tvshow.nfo of the episode file in the query, if any.
+func (a *NfoAgent) SearchSeries(query SeriesQuery) ([]SeriesSearchResult, error) {
+	s, sidecar, ok := findTVShowSidecar(query.FilePath)
+	if !ok {
+		return nil, nil
+	}
+	id, ok := NfoID(s.ID(nfo.IDTypeTmdb), s.ID(nfo.IDTypeImdb))
+	if !ok {
+		log.WithField("path", sidecar).Debugln("Ignoring .nfo file without IDs.")
+		return nil, nil
+	}
+	a.sidecars.Store(nfoKey("series", id), sidecar)
+
+	// Remember the episode's sidecar too so that we can fill in the episode once it's created.
+	if e, episodeSidecar, ok := findEpisodeSidecar(query.FilePath); ok {
+		a.sidecars.Store(nfoKey("episode", id, e.Season, e.Episode), episodeSidecar)
+	}
+
+	return []SeriesSearchResult{{
+		ID:           id,
+		Name:         s.Title,
+		FirstAirDate: s.Premiered,
+		Overview:     s.Plot,
+		PosterPath:   tmdbImagePath(s.Thumbs, "poster"),
+		BackdropPath: fanartPath(s.Fanart),
+	}}, nil
+}
+
+// sidecar returns the path of the sidecar for the item with the given key. If we haven't seen it
+// yet, the files returned by filePaths are checked with find.
+func (a *NfoAgent) sidecar(key string, filePaths func() []string, find func(string) (string, bool)) (string, error) {
+	if v, ok := a.sidecars.Load(key); ok {
+		return v.(string), nil
+	}
+	for _, p := range filePaths() {
+		if sidecar, ok := find(p); ok {
+			a.sidecars.Store(key, sidecar)
+			return sidecar, nil
+		}
+	}
+	return "", errors.Wrapf(ErrNoMetadata, "no .nfo file for %s", key)
+}
+
+// UpdateMovieMD updates the movie with the metadata from its .nfo file.
+func (a *NfoAgent) UpdateMovieMD(movie *db.Movie, id ExternalID) error {
+	sidecar, err := a.sidecar(nfoKey("movie", id),
+		func() (paths []string) {
+			files, _ := db.FindMovieFilesByMovieID(movie.ID)
+			for _, f := range files {
+				paths = append(paths, f.FilePath)
+			}
+			return paths
+		},
+		func(filePath string) (string, bool) {
+			m, sidecar, ok := findMovieSidecar(filePath)
+			return sidecar, ok && m.ID(id.Provider) == id.ID
+		})
+	if err != nil {
+		return err
+	}
+
+	m, err := nfo.ReadMovie(sidecar)
+	if err != nil {
+		return err
+	}
+
+	if tmdbID, err := strconv.Atoi(m.ID(nfo.IDTypeTmdb)); err == nil {
+		movie.TmdbID = tmdbID
+	}
+	movie.Title = m.Title
+	movie.OriginalTitle = m.OriginalTitle
+	if movie.OriginalTitle == "" {
+		movie.OriginalTitle = m.Title
+	}
+	movie.ReleaseDate = m.Premiered
+	movie.Year = uint64(m.Year)
+	if releaseDate, err := ParseTmdbDate(m.Premiered); err == nil && m.Year == 0 {
+		movie.Year = uint64(releaseDate.Year())
+	}
+	movie.Overview = m.Plot
+	movie.ImdbID = m.ID(nfo.IDTypeImdb)
+	setIfNotEmpty(&movie.PosterPath, tmdbImagePath(m.Thumbs, "poster"))
+	setIfNotEmpty(&movie.BackdropPath, fanartPath(m.Fanart))
+
+	return nil
+}
+
+// UpdateSeriesMD updates the series with the metadata from its tvshow.nfo.
+func (a *NfoAgent) UpdateSeriesMD(series *db.Series, id ExternalID) error {
+	sidecar, err := a.sidecar(nfoKey("series", id),
+		func() []string { return episodeFilePathsForSeries(series.ID) },
+		func(filePath string) (string, bool) {
+			s, sidecar, ok := findTVShowSidecar(filePath)
+			return sidecar, ok && s.ID(id.Provider) == id.ID
+		})
+	if err != nil {
+		return err
+	}
+
+	s, err := nfo.ReadTVShow(sidecar)
+	if err != nil {
+		return err
+	}
+
+	if tmdbID, err := strconv.Atoi(s.ID(nfo.IDTypeTmdb)); err == nil {
+		series.TmdbID = tmdbID
+	}
+	series.Name = s.Title
+	series.OriginalName = s.OriginalTitle
+	if series.OriginalName == "" {
+		series.OriginalName = s.Title
+	}
+	series.FirstAirDate = s.Premiered
+	series.FirstAirYear = uint64(s.Year)
+	if firstAirDate, err := ParseTmdbDate(s.Premiered); err == nil && s.Year == 0 {
+		series.FirstAirYear = uint64(firstAirDate.Year())
+	}
+	series.Overview = s.Plot
+	series.Status = s.Status
+	setIfNotEmpty(&series.PosterPath, tmdbImagePath(s.Thumbs, "poster"))
+	setIfNotEmpty(&series.BackdropPath, fanartPath(s.Fanart))
+
+	return nil
+}
+
+// UpdateSeasonMD is not supported, there are no season .nfo files.
+func (a *NfoAgent) UpdateSeasonMD(season *db.Season, seriesID ExternalID, seasonNum int) error {
+	return errors.Wrap(ErrNoMetadata, "no .nfo files for seasons")
+}
+
+// UpdateEpisodeMD updates the episode with the metadata from its .nfo file.
+func (a *NfoAgent) UpdateEpisodeMD(
+	episode *db.Episode, seriesID ExternalID, seasonNum int, episodeNum int) error {
+
+	sidecar, err := a.sidecar(nfoKey("episode", seriesID, seasonNum, episodeNum),
+		func() (paths []string) {
+			for _, f := range db.FindEpisodeFilesByEpisodeID(episode.ID) {
+				paths = append(paths, f.FilePath)
+			}
+			return paths
+		},
+		func(filePath string) (string, bool) {
+			e, sidecar, ok := findEpisodeSidecar(filePath)
+			return sidecar, ok && e.Season == seasonNum && e.Episode == episodeNum
+		})
+	if err != nil {
+		return err
+	}
+
+	e, err := nfo.ReadEpisode(sidecar)
+	if err != nil {
+		return err
+	}
+
+	if tmdbID, err := strconv.Atoi(e.ID(nfo.IDTypeTmdb)); err == nil {
+		episode.TmdbID = tmdbID
+	}
+	episode.Name = e.Title
+	episode.AirDate = e.Aired
+	episode.Overview = e.Plot
+	setIfNotEmpty(&episode.StillPath, tmdbImagePath(e.Thumbs, ""))
+
+	return nil
+}
+
+func episodeFilePathsForSeries(seriesID uint) (paths []string) {
+	for _, season := range db.FindSeasonsForSeries(seriesID) {
+		for _, episode := range db.FindEpisodesForSeason(season.ID) {
+			for _, f := range db.FindEpisodeFilesByEpisodeID(episode.ID) {
+				paths = append(paths, f.FilePath)
+			}
+		}
+	}
+	return paths
+}
+
+// setIfNotEmpty keeps the art we already have if the .nfo doesn't reference TMDB images.
+func setIfNotEmpty(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
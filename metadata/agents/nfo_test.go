@@ -0,0 +1,123 @@
+package agents_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+const testMovieNfo = `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>
+<movie>
+    <title>Mad Max: Fury Road</title>
+    <originaltitle>Mad Max: Fury Road</originaltitle>
+    <year>2015</year>
+    <premiered>2015-05-13</premiered>
+    <plot>An apocalyptic story set in the furthest reaches of our planet.</plot>
+    <uniqueid type="imdb">tt1392190</uniqueid>
+    <uniqueid type="tmdb" default="true">76341</uniqueid>
+    <thumb aspect="poster">https://image.tmdb.org/t/p/original/8tZYtuWezp8JbcsvHYO0O46tFbo.jpg</thumb>
+    <fanart>
+        <thumb>https://image.tmdb.org/t/p/original/phszHPFVhPHhMZgo0fWTKBDQsJA.jpg</thumb>
+    </fanart>
+</movie>
+https://www.themoviedb.org/movie/76341
+`
+
+const testTVShowNfo = `<tvshow>
+    <title>The Walking Dead</title>
+    <premiered>2010-10-31</premiered>
+    <status>Ended</status>
+    <tmdbid>1402</tmdbid>
+</tvshow>`
+
+const testEpisodeNfo = `<episodedetails>
+    <title>Days Gone Bye</title>
+    <season>1</season>
+    <episode>1</episode>
+    <aired>2010-10-31</aired>
+    <uniqueid type="tmdb">62085</uniqueid>
+</episodedetails>`
+
+func writeTestFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestNfoAgent_Movie(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	moviePath := filepath.Join(dir, "Mad Max Fury Road (2015)", "Mad Max Fury Road (2015).mkv")
+	writeTestFile(t, moviePath, "")
+	writeTestFile(t, filepath.Join(filepath.Dir(moviePath), "movie.nfo"), testMovieNfo)
+
+	a := agents.NewNfoAgent()
+	results, err := a.SearchMovie(agents.MovieQuery{Title: "Mad Max Fury Road", FilePath: "local#" + moviePath})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, agents.TmdbID(76341), results[0].ID)
+	assert.Equal(t, "Mad Max: Fury Road", results[0].Title)
+
+	movie := db.Movie{}
+	require.NoError(t, a.UpdateMovieMD(&movie, results[0].ID))
+	assert.EqualValues(t, 76341, movie.TmdbID)
+	assert.Equal(t, "Mad Max: Fury Road", movie.Title)
+	assert.EqualValues(t, 2015, movie.Year)
+	assert.Equal(t, "tt1392190", movie.ImdbID)
+	assert.Equal(t, "/8tZYtuWezp8JbcsvHYO0O46tFbo.jpg", movie.PosterPath)
+	assert.Equal(t, "/phszHPFVhPHhMZgo0fWTKBDQsJA.jpg", movie.BackdropPath)
+}
+
+func TestNfoAgent_NoSidecar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := agents.NewNfoAgent()
+	results, err := a.SearchMovie(agents.MovieQuery{FilePath: "local#" + filepath.Join(dir, "Movie.mkv")})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	db.NewInMemoryDBForTests(false)
+	err = a.UpdateMovieMD(&db.Movie{}, agents.TmdbID(76341))
+	assert.True(t, errors.Is(err, agents.ErrNoMetadata))
+}
+
+func TestNfoAgent_Episode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	episodePath := filepath.Join(dir, "The Walking Dead", "Season 1", "The Walking Dead S01E01.mkv")
+	writeTestFile(t, episodePath, "")
+	writeTestFile(t, filepath.Join(dir, "The Walking Dead", "tvshow.nfo"), testTVShowNfo)
+	writeTestFile(t, filepath.Join(dir, "The Walking Dead", "Season 1", "The Walking Dead S01E01.nfo"), testEpisodeNfo)
+
+	a := agents.NewNfoAgent()
+	results, err := a.SearchSeries(agents.SeriesQuery{Name: "The Walking Dead", FilePath: "local#" + episodePath})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, agents.TmdbID(1402), results[0].ID)
+
+	series := db.Series{}
+	require.NoError(t, a.UpdateSeriesMD(&series, results[0].ID))
+	assert.Equal(t, "The Walking Dead", series.Name)
+	assert.Equal(t, "Ended", series.Status)
+	assert.EqualValues(t, 2010, series.FirstAirYear)
+
+	episode := db.Episode{}
+	require.NoError(t, a.UpdateEpisodeMD(&episode, results[0].ID, 1, 1))
+	assert.EqualValues(t, 62085, episode.TmdbID)
+	assert.Equal(t, "Days Gone Bye", episode.Name)
+
+	err = a.UpdateSeasonMD(&db.Season{}, results[0].ID, 1)
+	assert.True(t, errors.Is(err, agents.ErrNoMetadata))
+}
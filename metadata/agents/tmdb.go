@@ -1,27 +1,44 @@
 package agents
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/ryanbradynd05/go-tmdb"
 	log "github.com/sirupsen/logrus"
 	"gitlab.com/olaris/olaris-server/metadata/db"
-	"time"
 )
 
 const tmdbAPIKey = "0cdacd9ab172ac6ff69c8d84b2c938a8"
 
+// TmdbAPIURL is the base URL of the TMDB v3 API.
+const TmdbAPIURL = "https://api.themoviedb.org/3"
+
 // TmdbAgent is a wrapper around themoviedb
 type TmdbAgent struct {
-	Tmdb *tmdb.TMDb
+	apiKey  string
+	baseURL string
+	client  *http.Client
 }
 
 // NewTmdbAgent creates a new themoviedb agent.
 func NewTmdbAgent() *TmdbAgent {
-	return &TmdbAgent{tmdb.Init(tmdb.Config{
-		APIKey:   tmdbAPIKey,
-		Proxies:  nil,
-		UseProxy: false,
-	})}
+	return NewTmdbAgentWithURL(TmdbAPIURL)
+}
+
+// NewTmdbAgentWithURL creates a themoviedb agent that uses the API at the given URL,
+// e.g. a local stand-in for tests.
+func NewTmdbAgentWithURL(baseURL string) *TmdbAgent {
+	return &TmdbAgent{
+		apiKey:  tmdbAPIKey,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
 }
 
 // ParseTmdbDate parses a date string returned from the TMDB API
@@ -29,12 +46,80 @@ func ParseTmdbDate(tmdbDate string) (time.Time, error) {
 	return time.Parse("2006-01-02", tmdbDate)
 }
 
+// Name returns the name of the agent.
+func (a *TmdbAgent) Name() string {
+	return AgentTmdb
+}
+
+// get requests the given API path and decodes the JSON response into result.
+func (a *TmdbAgent) get(path string, params url.Values, result interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("api_key", a.apiKey)
+
+	res, err := a.client.Get(a.baseURL + path + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var status struct {
+			Code    int    `json:"status_code"`
+			Message string `json:"status_message"`
+		}
+		json.NewDecoder(res.Body).Decode(&status)
+		if res.StatusCode == http.StatusNotFound {
+			return errors.Wrapf(ErrNoMetadata, "TMDB returned %s", status.Message)
+		}
+		return fmt.Errorf("TMDB returned HTTP %d: %s", res.StatusCode, status.Message)
+	}
+
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// Kinds of items for tmdbID.
+const (
+	tmdbKindMovie = "movie"
+	tmdbKindTv    = "tv"
+)
+
+// tmdbID returns the TMDB ID of the item of the given kind with the given ID. IMDB IDs are looked
+// up on TMDB.
+func (a *TmdbAgent) tmdbID(id ExternalID, kind string) (int, error) {
+	switch id.Provider {
+	case ProviderTmdb:
+		return id.Int()
+	case ProviderImdb:
+		var res tmdb.FindResults
+		params := url.Values{"external_source": {"imdb_id"}}
+		if err := a.get("/find/"+url.PathEscape(id.ID), params, &res); err != nil {
+			return 0, errors.Wrapf(err, "Failed to find %s on TMDB", id)
+		}
+		if kind == tmdbKindMovie && len(res.MovieResults) > 0 {
+			return res.MovieResults[0].ID, nil
+		}
+		if kind == tmdbKindTv && len(res.TvResults) > 0 {
+			return res.TvResults[0].ID, nil
+		}
+		return 0, errors.Wrapf(ErrNoMetadata, "no %s on TMDB for %s", kind, id)
+	}
+	return 0, errors.Wrapf(ErrNoMetadata, "can't look up %s IDs on TMDB", id.Provider)
+}
+
 // UpdateEpisodeMD updates the metadata information for the given episode.
 func (a *TmdbAgent) UpdateEpisodeMD(
-	episode *db.Episode, seriesTmdbID int, seasonNum int, episodeNum int,
+	episode *db.Episode, seriesID ExternalID, seasonNum int, episodeNum int,
 ) error {
-	fullEpisode, err := a.Tmdb.GetTvEpisodeInfo(
-		seriesTmdbID, seasonNum, episodeNum, nil)
+	seriesTmdbID, err := a.tmdbID(seriesID, tmdbKindTv)
+	if err != nil {
+		return err
+	}
+
+	var fullEpisode tmdb.TvEpisode
+	err = a.get(fmt.Sprintf("/tv/%d/season/%d/episode/%d", seriesTmdbID, seasonNum, episodeNum),
+		nil, &fullEpisode)
 	if err != nil {
 		return errors.Wrap(err, "Could not retrieve episode data from TMDB")
 	}
@@ -52,14 +137,20 @@ func (a *TmdbAgent) UpdateEpisodeMD(
 }
 
 // UpdateSeasonMD updates the metadata information for the given season
-func (a *TmdbAgent) UpdateSeasonMD(season *db.Season, seriesTmdbID int, seasonNum int) error {
+func (a *TmdbAgent) UpdateSeasonMD(season *db.Season, seriesID ExternalID, seasonNum int) error {
 	log.
 		WithFields(log.Fields{
 			"seasonNumber": seasonNum,
-			"seriesTmdbID": seriesTmdbID}).
+			"seriesID":     seriesID}).
 		Debugln("Looking for season metadata.")
 
-	fullSeason, err := a.Tmdb.GetTvSeasonInfo(seriesTmdbID, seasonNum, nil)
+	seriesTmdbID, err := a.tmdbID(seriesID, tmdbKindTv)
+	if err != nil {
+		return err
+	}
+
+	var fullSeason tmdb.TvSeason
+	err = a.get(fmt.Sprintf("/tv/%d/season/%d", seriesTmdbID, seasonNum), nil, &fullSeason)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Warnln("Could not grab season information.")
 		return err
@@ -76,10 +167,14 @@ func (a *TmdbAgent) UpdateSeasonMD(season *db.Season, seriesTmdbID int, seasonNu
 }
 
 // UpdateSeriesMD updates the metadata information for the given series.
-func (a *TmdbAgent) UpdateSeriesMD(series *db.Series, tmdbID int) error {
-	fullTv, err := a.Tmdb.GetTvInfo(tmdbID, nil)
-
+func (a *TmdbAgent) UpdateSeriesMD(series *db.Series, id ExternalID) error {
+	tmdbID, err := a.tmdbID(id, tmdbKindTv)
 	if err != nil {
+		return err
+	}
+
+	var fullTv tmdb.TV
+	if err := a.get(fmt.Sprintf("/tv/%d", tmdbID), nil, &fullTv); err != nil {
 		log.
 			WithFields(log.Fields{
 				"tmdbID": tmdbID,
@@ -90,6 +185,7 @@ func (a *TmdbAgent) UpdateSeriesMD(series *db.Series, tmdbID int) error {
 
 	firstAirDate, _ := ParseTmdbDate(fullTv.FirstAirDate)
 
+	series.TmdbID = fullTv.ID
 	series.Name = fullTv.Name
 	series.OriginalName = fullTv.OriginalName
 	series.FirstAirDate = fullTv.FirstAirDate
@@ -102,11 +198,15 @@ func (a *TmdbAgent) UpdateSeriesMD(series *db.Series, tmdbID int) error {
 	return nil
 }
 
-// refreshAndSaveMovieMetadata updates
-func (a *TmdbAgent) UpdateMovieMD(movie *db.Movie, tmdbID int) error {
-	r, err := a.Tmdb.GetMovieInfo(tmdbID, nil)
-
+// UpdateMovieMD updates the metadata information for the given movie.
+func (a *TmdbAgent) UpdateMovieMD(movie *db.Movie, id ExternalID) error {
+	tmdbID, err := a.tmdbID(id, tmdbKindMovie)
 	if err != nil {
+		return err
+	}
+
+	var r tmdb.Movie
+	if err := a.get(fmt.Sprintf("/movie/%d", tmdbID), nil, &r); err != nil {
 		return errors.Wrap(err, "Failed to query TMDB for movie metadata")
 	}
 
@@ -125,18 +225,57 @@ func (a *TmdbAgent) UpdateMovieMD(movie *db.Movie, tmdbID int) error {
 	return nil
 }
 
-// TmdbSearchMovie directly exposes the TMDb search interface
-func (a *TmdbAgent) TmdbSearchMovie(
-	name string,
-	options map[string]string,
-) (*tmdb.MovieSearchResults, error) {
-	return a.Tmdb.SearchMovie(name, options)
+// SearchMovie searches TMDB for movies with the given title.
+func (a *TmdbAgent) SearchMovie(query MovieQuery) ([]MovieSearchResult, error) {
+	params := url.Values{"query": {query.Title}}
+	if query.Year > 0 {
+		params.Set("year", strconv.Itoa(query.Year))
+	}
+
+	var searchRes tmdb.MovieSearchResults
+	if err := a.get("/search/movie", params, &searchRes); err != nil {
+		return nil, errors.Wrap(err, "Failed to search TMDB for movie")
+	}
+
+	var results []MovieSearchResult
+	for _, r := range searchRes.Results {
+		results = append(results, MovieSearchResult{
+			ID:           TmdbID(r.ID),
+			Title:        r.Title,
+			ReleaseDate:  r.ReleaseDate,
+			Overview:     r.Overview,
+			PosterPath:   r.PosterPath,
+			BackdropPath: r.BackdropPath,
+		})
+	}
+	return results, nil
 }
 
-// TmdbSearchTv directly exposes the TMDb search interface
-func (a *TmdbAgent) TmdbSearchTv(
-	name string,
-	options map[string]string,
-) (*tmdb.TvSearchResults, error) {
-	return a.Tmdb.SearchTv(name, options)
+// SearchSeries searches TMDB for series with the given name.
+func (a *TmdbAgent) SearchSeries(query SeriesQuery) ([]SeriesSearchResult, error) {
+	params := url.Values{"query": {query.Name}}
+	if query.FirstAirYear > 0 {
+		params.Set("first_air_date_year", strconv.Itoa(query.FirstAirYear))
+	}
+
+	// The result type in the tmdb package lacks the overview.
+	var searchRes struct {
+		Results []tmdb.TvShort
+	}
+	if err := a.get("/search/tv", params, &searchRes); err != nil {
+		return nil, errors.Wrap(err, "Failed to search TMDB for series")
+	}
+
+	var results []SeriesSearchResult
+	for _, r := range searchRes.Results {
+		results = append(results, SeriesSearchResult{
+			ID:           TmdbID(r.ID),
+			Name:         r.Name,
+			FirstAirDate: r.FirstAirDate,
+			Overview:     r.Overview,
+			PosterPath:   r.PosterPath,
+			BackdropPath: r.BackdropPath,
+		})
+	}
+	return results, nil
 }
@@ -1,29 +1,134 @@
 package agents_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gitlab.com/olaris/olaris-server/metadata/agents"
 	"gitlab.com/olaris/olaris-server/metadata/db"
-	"testing"
 )
 
+// newTestTmdbServer stands in for the TMDB API, serving the given JSON responses by path.
+func newTestTmdbServer(t *testing.T, responses map[string]string) (*httptest.Server, *agents.TmdbAgent) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, r.URL.Query().Get("api_key"))
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status_code": 34, "status_message": "The resource you requested could not be found."}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	return server, agents.NewTmdbAgentWithURL(server.URL)
+}
+
 func TestSeasonLookup(t *testing.T) {
 	const testSeasonTmdbID = 2426
-	var season db.Season
-	a := agents.NewTmdbAgent()
+	server, a := newTestTmdbServer(t, map[string]string{
+		"/tv/2426/season/1": `{"id": 7625, "name": "Season 1", "season_number": 1, "air_date": "2008-01-20"}`,
+	})
+	defer server.Close()
 
-	a.UpdateSeasonMD(&season, testSeasonTmdbID, 1)
+	var season db.Season
+	err := a.UpdateSeasonMD(&season, agents.TmdbID(testSeasonTmdbID), 1)
+	require.NoError(t, err)
 
 	assert.EqualValues(t, 7625, season.TmdbID)
+	assert.Equal(t, "Season 1", season.Name)
+	assert.Equal(t, "2008-01-20", season.AirDate)
 }
 
 func TestTmdbMovieLookup(t *testing.T) {
-	movie := db.Movie{}
-	a := agents.NewTmdbAgent()
+	server, a := newTestTmdbServer(t, map[string]string{
+		"/movie/76341": `{
+			"id": 76341,
+			"imdb_id": "tt1392190",
+			"title": "Mad Max: Fury Road",
+			"original_title": "Mad Max: Fury Road",
+			"release_date": "2015-05-13",
+			"poster_path": "/8tZYtuWezp8JbcsvHYO0O46tFbo.jpg"
+		}`,
+	})
+	defer server.Close()
 
-	err := a.UpdateMovieMD(&movie, 76341)
+	movie := db.Movie{}
+	err := a.UpdateMovieMD(&movie, agents.TmdbID(76341))
 	assert.NoError(t, err)
 
 	assert.Equal(t, "Mad Max: Fury Road", movie.OriginalTitle)
 	assert.EqualValues(t, 76341, movie.TmdbID)
+	assert.EqualValues(t, 2015, movie.Year)
+	assert.Equal(t, "tt1392190", movie.ImdbID)
+	assert.Equal(t, "/8tZYtuWezp8JbcsvHYO0O46tFbo.jpg", movie.PosterPath)
+}
+
+func TestTmdbMovieLookup_ImdbID(t *testing.T) {
+	server, a := newTestTmdbServer(t, map[string]string{
+		"/find/tt1392190": `{"movie_results": [{"id": 76341, "title": "Mad Max: Fury Road"}]}`,
+		"/movie/76341":    `{"id": 76341, "title": "Mad Max: Fury Road"}`,
+	})
+	defer server.Close()
+
+	movie := db.Movie{}
+	err := a.UpdateMovieMD(&movie, agents.ExternalID{Provider: agents.ProviderImdb, ID: "tt1392190"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 76341, movie.TmdbID)
+}
+
+func TestTmdbMovieLookup_NotFound(t *testing.T) {
+	server, a := newTestTmdbServer(t, nil)
+	defer server.Close()
+
+	err := a.UpdateMovieMD(&db.Movie{}, agents.TmdbID(1))
+	assert.True(t, errors.Is(err, agents.ErrNoMetadata))
+}
+
+func TestTmdbMovieLookup_UnsupportedProvider(t *testing.T) {
+	server, a := newTestTmdbServer(t, nil)
+	defer server.Close()
+
+	err := a.UpdateMovieMD(&db.Movie{}, agents.ExternalID{Provider: "tvdb", ID: "81189"})
+	assert.True(t, errors.Is(err, agents.ErrNoMetadata))
+}
+
+func TestTmdbSearchMovie(t *testing.T) {
+	var query, year string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search/movie", r.URL.Path)
+		query = r.URL.Query().Get("query")
+		year = r.URL.Query().Get("year")
+		fmt.Fprint(w, `{"results": [{"id": 76341, "title": "Mad Max: Fury Road", "release_date": "2015-05-13"}]}`)
+	}))
+	defer server.Close()
+	a := agents.NewTmdbAgentWithURL(server.URL)
+
+	results, err := a.SearchMovie(agents.MovieQuery{Title: "Mad Max Fury Road", Year: 2015})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Mad Max Fury Road", query)
+	assert.Equal(t, "2015", year)
+	require.Len(t, results, 1)
+	assert.Equal(t, agents.TmdbID(76341), results[0].ID)
+	assert.Equal(t, "Mad Max: Fury Road", results[0].Title)
+}
+
+func TestTmdbSearchSeries(t *testing.T) {
+	server, a := newTestTmdbServer(t, map[string]string{
+		"/search/tv": `{"results": [{"id": 1402, "name": "The Walking Dead", "first_air_date": "2010-10-31"}]}`,
+	})
+	defer server.Close()
+
+	results, err := a.SearchSeries(agents.SeriesQuery{Name: "The Walking Dead"})
+	require.NoError(t, err)
+
+	require.Len(t, results, 1)
+	assert.Equal(t, agents.TmdbID(1402), results[0].ID)
+	assert.Equal(t, "2010-10-31", results[0].FirstAirDate)
 }
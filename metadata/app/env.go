@@ -21,8 +21,7 @@ type MetadataContext struct {
 	Db      *gorm.DB
 	Watcher *fsnotify.Watcher
 
-	MetadataRetrievalAgent agents.MetadataRetrievalAgent
-	MetadataManager        *metadata.MetadataManager
+	MetadataManager *metadata.MetadataManager
 
 	// Currently unused
 	ExitChan chan bool
@@ -43,11 +42,21 @@ func NewDefaultMDContext() *MetadataContext {
 	dbDir := viper.GetString("sqliteDir")
 	helpers.EnsurePath(dbDir)
 
+	agentNames := viper.GetStringSlice("metadata.agents")
+	if len(agentNames) == 0 {
+		agentNames = agents.DefaultAgents
+	}
+	metadataAgents, err := agents.NewAgents(agentNames)
+	if err != nil {
+		log.WithError(err).Warnln("Invalid metadata agents configured, only using TMDB.")
+		metadataAgents = []agents.MetadataRetrievalAgent{agents.NewTmdbAgent()}
+	}
+
 	dbPath := path.Join(dbDir, "metadata.db")
 	return NewMDContext(db.DatabaseOptions{
 		Connection: fmt.Sprintf("sqlite3://%s", dbPath),
 		LogMode:    false,
-	}, agents.NewTmdbAgent())
+	}, metadataAgents...)
 }
 
 // NewTestingMDContext creates a new MetadataContext for testing
@@ -64,10 +73,11 @@ func NewTestingMDContext(agent agents.MetadataRetrievalAgent) *MetadataContext {
 	}, a)
 }
 
-// NewMDContext lets you create a more custom environment.
+// NewMDContext lets you create a more custom environment. The agents are asked for metadata in
+// the given order.
 func NewMDContext(
 	databaseOptions db.DatabaseOptions,
-	agent agents.MetadataRetrievalAgent) *MetadataContext {
+	metadataAgents ...agents.MetadataRetrievalAgent) *MetadataContext {
 	rand.Seed(time.Now().UTC().UnixNano())
 
 	helpers.InitLoggers(log.InfoLevel)
@@ -80,10 +90,9 @@ func NewMDContext(
 	exitChan := make(chan bool)
 
 	env = &MetadataContext{
-		Db:                     database,
-		ExitChan:               exitChan,
-		MetadataRetrievalAgent: agent,
-		MetadataManager:        metadata.NewMetadataManager(agent),
+		Db:              database,
+		ExitChan:        exitChan,
+		MetadataManager: metadata.NewMetadataManager(metadataAgents...),
 	}
 
 	metadataRefreshTicker := time.NewTicker(2 * time.Hour)
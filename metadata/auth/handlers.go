@@ -10,7 +10,12 @@ import (
 	"time"
 )
 
-const DefaultLoginTokenValidity = 24 * time.Hour
+// AccessTokenValidity is how long a JWT returned by the auth endpoints can be used. Clients are expected to
+// obtain a new one with their refresh token before it expires.
+const AccessTokenValidity = 15 * time.Minute
+
+// RefreshTokenValidity is how long a session stays valid without being refreshed.
+const RefreshTokenValidity = 30 * 24 * time.Hour
 
 type userRequest struct {
 	Username string `json:"username"`
@@ -22,8 +27,15 @@ type userRequestRes struct {
 	Message  string `json:"message"`
 }
 
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type tokenResponse struct {
-	JWT string `json:"jwt"`
+	JWT          string `json:"jwt"`
+	RefreshToken string `json:"refresh_token"`
+	// Seconds until the JWT expires
+	ExpiresIn int `json:"expires_in"`
 }
 
 // ReadyForSetup checks whether the metadata has been through it's initial setup
@@ -64,23 +76,74 @@ func UserHandler(w http.ResponseWriter, r *http.Request) {
 	u := db.User{Username: ur.Username}
 
 	if u.ValidPassword(ur.Password) == true {
-		token, err := CreateMetadataJWT(&u, DefaultLoginTokenValidity)
+		session, refreshToken, err := db.CreateSession(u.ID, r.UserAgent(), RefreshTokenValidity)
 		if err != nil {
-			writeError(err.Error(), w, http.StatusUnauthorized)
-		} else {
-			tokenRes := tokenResponse{JWT: token}
-			jtoken, err := json.Marshal(tokenRes)
-			if err != nil {
-				log.Warnln("Could not marshall JWT token:", err)
-			}
-			w.Header().Add("Content-Type", "application/json")
-			w.Write(jtoken)
+			log.WithError(err).Errorln("Could not create session")
+			writeError("Could not create session", w, http.StatusInternalServerError)
+			return
 		}
+		writeTokens(&u, &session, refreshToken, w)
 	} else {
 		writeError("Invalid username or password", w, http.StatusUnauthorized)
 	}
 }
 
+// RefreshHandler exchanges a refresh token for a new JWT and a new refresh token.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	rr := refreshRequest{}
+	b, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		log.Warnln("Could not read incoming request body.")
+		return
+	}
+
+	if err := json.Unmarshal(b, &rr); err != nil {
+		writeError("Could not parse JSON object", w, http.StatusBadRequest)
+		return
+	}
+
+	if rr.RefreshToken == "" {
+		writeError("No refresh token supplied", w, http.StatusBadRequest)
+		return
+	}
+
+	session, refreshToken, err := db.RefreshSession(rr.RefreshToken, RefreshTokenValidity)
+	if err != nil {
+		writeError(err.Error(), w, http.StatusUnauthorized)
+		return
+	}
+
+	// Look the user up again in case e.g. the admin status changed since the last refresh.
+	user, err := db.FindUser(session.UserID)
+	if err != nil {
+		writeError(err.Error(), w, http.StatusUnauthorized)
+		return
+	}
+
+	writeTokens(user, &session, refreshToken, w)
+}
+
+func writeTokens(user *db.User, session *db.Session, refreshToken string, w http.ResponseWriter) {
+	token, err := CreateMetadataJWT(user, session, AccessTokenValidity)
+	if err != nil {
+		writeError(err.Error(), w, http.StatusUnauthorized)
+		return
+	}
+
+	tokenRes := tokenResponse{
+		JWT:          token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenValidity.Seconds()),
+	}
+	jtoken, err := json.Marshal(tokenRes)
+	if err != nil {
+		log.Warnln("Could not marshall JWT token:", err)
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(jtoken)
+}
+
 // CreateUserHandler handles the creation of users, either via invite code or the first admin user.
 func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	ur := userRequest{}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func postJSON(handler http.HandlerFunc, body string) (*httptest.ResponseRecorder, tokenResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	rw := httptest.NewRecorder()
+	handler(rw, req)
+
+	res := tokenResponse{}
+	json.Unmarshal(rw.Body.Bytes(), &res)
+	return rw, res
+}
+
+func TestUserHandler(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	db.CreateUser("test", "testtest", false)
+
+	rw, res := postJSON(UserHandler, `{"username": "test", "password": "wrongpassword"}`)
+	assert.EqualValues(t, http.StatusUnauthorized, rw.Result().StatusCode)
+
+	rw, res = postJSON(UserHandler, `{"username": "test", "password": "testtest"}`)
+	assert.EqualValues(t, http.StatusOK, rw.Result().StatusCode)
+	assert.NotEmpty(t, res.JWT)
+	assert.NotEmpty(t, res.RefreshToken)
+	assert.Equal(t, int(AccessTokenValidity.Seconds()), res.ExpiresIn)
+
+	rw, fakeHandler := serveWithMiddleWare(res.JWT)
+	assert.EqualValues(t, http.StatusOK, rw.Result().StatusCode)
+	assert.True(t, fakeHandler.Called())
+}
+
+func TestRefreshHandler(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	db.CreateUser("test", "testtest", false)
+
+	_, login := postJSON(UserHandler, `{"username": "test", "password": "testtest"}`)
+
+	rw, refreshed := postJSON(RefreshHandler, `{"refresh_token": "`+login.RefreshToken+`"}`)
+	assert.EqualValues(t, http.StatusOK, rw.Result().StatusCode)
+	assert.NotEmpty(t, refreshed.JWT)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+	// Refresh tokens can only be used once.
+	rw, _ = postJSON(RefreshHandler, `{"refresh_token": "`+login.RefreshToken+`"}`)
+	assert.EqualValues(t, http.StatusUnauthorized, rw.Result().StatusCode)
+
+	rw, fakeHandler := serveWithMiddleWare(refreshed.JWT)
+	assert.EqualValues(t, http.StatusOK, rw.Result().StatusCode)
+	assert.True(t, fakeHandler.Called())
+}
+
+func TestRefreshHandler_SessionRevoked(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	user, _ := db.CreateUser("test", "testtest", false)
+
+	_, login := postJSON(UserHandler, `{"username": "test", "password": "testtest"}`)
+	db.RevokeSessionsForUser(user.ID)
+
+	rw, _ := postJSON(RefreshHandler, `{"refresh_token": "`+login.RefreshToken+`"}`)
+	assert.EqualValues(t, http.StatusUnauthorized, rw.Result().StatusCode)
+}
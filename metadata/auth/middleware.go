@@ -22,8 +22,9 @@ func (c contextKey) String() string {
 }
 
 var (
-	contextKeyUserID  = contextKey("user_id")
-	ContextKeyIsAdmin = contextKey("is_admin")
+	contextKeyUserID    = contextKey("user_id")
+	contextKeySessionID = contextKey("session_id")
+	ContextKeyIsAdmin   = contextKey("is_admin")
 )
 
 // UserClaims defines our custom JWT.
@@ -31,6 +32,8 @@ type UserClaims struct {
 	Username string `json:"username"`
 	UserID   uint   `json:"user_id"`
 	Admin    bool   `json:"admin"`
+	// UUID of the db.Session this token belongs to. The token is rejected once the session is revoked.
+	SessionID string `json:"session_id"`
 	jwt.StandardClaims
 }
 
@@ -45,6 +48,12 @@ func ContextWithUserID(ctx context.Context, userID uint) context.Context {
 	return context.WithValue(ctx, contextKeyUserID, userID)
 }
 
+// SessionID extracts the UUID of the session the request was authenticated with from context.
+func SessionID(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(contextKeySessionID).(string)
+	return sessionID, ok
+}
+
 // UserAdmin checks whether the JWT is authorised as admin.
 func UserAdmin(ctx context.Context) (bool, bool) {
 	isAdmin, ok := ctx.Value(ContextKeyIsAdmin).(bool)
@@ -89,15 +98,25 @@ func MiddleWare(h http.Handler) http.Handler {
 					return
 				}
 
+				// Check if the session is still valid, this also catches tokens issued before a
+				// password change.
+				session, err := db.FindSessionByUUID(claims.SessionID)
+				if err != nil || session.UserID != claims.UserID || !session.Active() {
+					writeError("Unauthorized: session expired or revoked", w, http.StatusUnauthorized)
+					return
+				}
+
 				log.WithFields(
 					log.Fields{
 						"username":  claims.Username,
 						"userID":    claims.UserID,
+						"sessionID": claims.SessionID,
 						"expiresAt": claims.StandardClaims.ExpiresAt,
 					},
 				).Debugln("Authenticated with valid JWT")
 				ctx := r.Context()
 				ctx = context.WithValue(ctx, contextKeyUserID, claims.UserID)
+				ctx = context.WithValue(ctx, contextKeySessionID, claims.SessionID)
 				ctx = context.WithValue(ctx, ContextKeyIsAdmin, claims.Admin)
 				h.ServeHTTP(w, r.WithContext(ctx))
 				return
@@ -129,15 +148,15 @@ func tokenSecret() (string, error) {
 	return secret, err
 }
 
-// CreateMetadataJWT returns a string login JWT.
-// TODO Maran: Consider setting the jti if we want to increase security.
-func CreateMetadataJWT(user *db.User, validFor time.Duration) (string, error) {
+// CreateMetadataJWT returns a string login JWT for the given session.
+func CreateMetadataJWT(user *db.User, session *db.Session, validFor time.Duration) (string, error) {
 	expiresAt := time.Now().Add(validFor).Unix()
 
 	claims := UserClaims{
 		user.Username,
 		user.ID,
 		user.Admin,
+		session.UUID,
 		jwt.StandardClaims{ExpiresAt: expiresAt, Issuer: "bss"},
 	}
 
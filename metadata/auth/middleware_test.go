@@ -24,6 +24,24 @@ func (th *TestHandler) Called() bool {
 	return th.called
 }
 
+func createTestJWT(user *db.User) (string, db.Session) {
+	session, _, _ := db.CreateSession(user.ID, "test", RefreshTokenValidity)
+	tokenStr, _ := CreateMetadataJWT(user, &session, AccessTokenValidity)
+	return tokenStr, session
+}
+
+func serveWithMiddleWare(tokenStr string) (*httptest.ResponseRecorder, *TestHandler) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokenStr))
+
+	fakeHandler := TestHandler{}
+	handler := MiddleWare(fakeHandler.HandlerFunc())
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	return rw, &fakeHandler
+}
+
 func TestMiddleWare_InvalidToken(t *testing.T) {
 	// TODO(Leon Handreke): We need this to fill the database singleton
 	app.NewTestingMDContext(nil)
@@ -64,7 +82,7 @@ func TestMiddleWare_UserDeleted(t *testing.T) {
 	app.NewTestingMDContext(nil)
 	user, _ := db.CreateUser("test", "testtest", false)
 
-	tokenStr, _ := CreateMetadataJWT(&user, DefaultLoginTokenValidity)
+	tokenStr, _ := createTestJWT(&user)
 
 	db.DeleteUser(user.ID)
 
@@ -86,7 +104,7 @@ func TestMiddleWare(t *testing.T) {
 	app.NewTestingMDContext(nil)
 	user, _ := db.CreateUser("test", "testtest", false)
 
-	tokenStr, _ := CreateMetadataJWT(&user, DefaultLoginTokenValidity)
+	tokenStr, _ := createTestJWT(&user)
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokenStr))
 
@@ -99,3 +117,42 @@ func TestMiddleWare(t *testing.T) {
 	assert.EqualValues(t, http.StatusOK, rw.Result().StatusCode)
 	assert.True(t, fakeHandler.Called())
 }
+
+func TestMiddleWare_SessionRevoked(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	user, _ := db.CreateUser("test", "testtest", false)
+
+	tokenStr, session := createTestJWT(&user)
+	db.RevokeSession(&session)
+
+	rw, fakeHandler := serveWithMiddleWare(tokenStr)
+	assert.EqualValues(t, http.StatusUnauthorized, rw.Result().StatusCode)
+	assert.False(t, fakeHandler.Called())
+}
+
+func TestMiddleWare_PasswordChanged(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	user, _ := db.CreateUser("test", "testtest", false)
+
+	tokenStr, _ := createTestJWT(&user)
+	otherTokenStr, _ := createTestJWT(&user)
+	assert.NoError(t, db.ChangePassword(&user, "newpassword"))
+
+	for _, token := range []string{tokenStr, otherTokenStr} {
+		rw, fakeHandler := serveWithMiddleWare(token)
+		assert.EqualValues(t, http.StatusUnauthorized, rw.Result().StatusCode)
+		assert.False(t, fakeHandler.Called())
+	}
+}
+
+func TestMiddleWare_NoSession(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	user, _ := db.CreateUser("test", "testtest", false)
+
+	// Tokens issued before sessions were introduced don't carry a session ID.
+	tokenStr, _ := CreateMetadataJWT(&user, &db.Session{}, AccessTokenValidity)
+
+	rw, fakeHandler := serveWithMiddleWare(tokenStr)
+	assert.EqualValues(t, http.StatusUnauthorized, rw.Result().StatusCode)
+	assert.False(t, fakeHandler.Called())
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/metadata/db"
 	"time"
 )
 
@@ -11,16 +12,32 @@ import (
 type StreamingClaims struct {
 	UserID   uint
 	FilePath string
+	// The user's db.User.TokenGeneration when the ticket was issued. Tickets without a user are
+	// issued by the server for itself and not revoked.
+	TokenGeneration uint
 	jwt.StandardClaims
 }
 
+// StreamingTicketLifetime is how long a streaming ticket allows access to its file.
+const StreamingTicketLifetime = 8 * time.Hour
+
 // CreateStreamingJWT creates a new JWT that will give permission to stream certain media for a certain timespan.
 func CreateStreamingJWT(userID uint, fileLocator string) (string, error) {
-	expiresAt := time.Now().Add(time.Hour * 8).Unix()
+	expiresAt := time.Now().Add(StreamingTicketLifetime).Unix()
+
+	var tokenGeneration uint
+	if userID != 0 {
+		user, err := db.FindUser(userID)
+		if err != nil {
+			return "", fmt.Errorf("no user with ID %d", userID)
+		}
+		tokenGeneration = user.TokenGeneration
+	}
 
 	claims := StreamingClaims{
 		userID,
 		fileLocator,
+		tokenGeneration,
 		jwt.StandardClaims{ExpiresAt: expiresAt, Issuer: "bss"},
 	}
 
@@ -46,6 +63,14 @@ func ValidateStreamingJWT(tokenStr string) (*StreamingClaims, error) {
 	}
 
 	if claims, ok := token.Claims.(*StreamingClaims); ok && token.Valid {
+		// Deleting a user or revoking their sessions, e.g. by changing the password, revokes
+		// their tickets, too.
+		if claims.UserID != 0 {
+			user, err := db.FindUser(claims.UserID)
+			if err != nil || user.TokenGeneration != claims.TokenGeneration {
+				return nil, fmt.Errorf("ticket has been revoked")
+			}
+		}
 		log.WithFields(log.Fields{"user": claims.UserID, "file": claims.FilePath, "expires": claims.ExpiresAt}).Debugf("Validate streaming ticket")
 		return claims, nil
 	}
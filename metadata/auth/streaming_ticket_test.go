@@ -3,16 +3,25 @@ package auth
 import (
 	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/db"
 )
 
 func TestStreamingTicket(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	user, err := db.CreateUser("test", "testtest", false)
+	require.NoError(t, err)
+
 	path := "/users/maran/does/not/exist.mkv"
 	secret, err := tokenSecret()
 	if err != nil {
 		t.Errorf("No secret could be generated: %s", err)
 	}
 	fmt.Println("Secret:", secret)
-	token, err := CreateStreamingJWT(1, path)
+	token, err := CreateStreamingJWT(user.ID, path)
 	if err != nil {
 		t.Errorf("Expected error to be nil, got error instead: %s", err)
 	}
@@ -32,8 +41,39 @@ func TestStreamingTicket(t *testing.T) {
 		t.Errorf("Filepath was not correct in token. Expected %s but got %s", path, claim.FilePath)
 	}
 
-	if claim.UserID != 1 {
-		t.Errorf("User was not valid expected %d got %d", 1, claim.UserID)
+	if claim.UserID != user.ID {
+		t.Errorf("User was not valid expected %d got %d", user.ID, claim.UserID)
 	}
 
 }
+
+func TestStreamingTicket_Revoked(t *testing.T) {
+	app.NewTestingMDContext(nil)
+	user, err := db.CreateUser("test", "testtest", false)
+	require.NoError(t, err)
+	path := "/does/not/exist.mkv"
+
+	token, err := CreateStreamingJWT(user.ID, path)
+	require.NoError(t, err)
+	require.NoError(t, db.ChangePassword(&user, "newpassword"))
+	_, err = ValidateStreamingJWT(token)
+	assert.Error(t, err, "Changing the password revokes tickets")
+
+	token, err = CreateStreamingJWT(user.ID, path)
+	require.NoError(t, err)
+	_, err = ValidateStreamingJWT(token)
+	assert.NoError(t, err, "Tickets issued after the password change are valid")
+
+	_, err = db.DeleteUser(user.ID)
+	require.NoError(t, err)
+	_, err = ValidateStreamingJWT(token)
+	assert.Error(t, err, "Deleting the user revokes tickets")
+
+	_, err = CreateStreamingJWT(user.ID, path)
+	assert.Error(t, err, "No tickets are issued for deleted users")
+
+	token, err = CreateStreamingJWT(0, path)
+	require.NoError(t, err)
+	_, err = ValidateStreamingJWT(token)
+	assert.NoError(t, err, "Tickets the server issues for itself aren't revoked")
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"time"
+)
+
+// Chapter is a named part of a MovieFile or EpisodeFile as stored in the file's container.
+type Chapter struct {
+	CommonModelFields
+	OwnerID   uint   `gorm:"not null;index"`
+	OwnerType string `gorm:"not null"`
+	Title     string
+	Start     time.Duration `gorm:"column:start_time"`
+	End       time.Duration `gorm:"column:end_time"`
+}
+
+// Owner types of Chapters, the tables of the files they belong to.
+const (
+	ChapterOwnerMovieFile   = "movie_files"
+	ChapterOwnerEpisodeFile = "episode_files"
+)
+
+// ReplaceChaptersForFilePath replaces all chapters of the MovieFile or EpisodeFile with the given
+// file locator. Nothing happens if there is no such file.
+func ReplaceChaptersForFilePath(filePath string, chapters []Chapter) error {
+	var movieFile MovieFile
+	if err := db.Where("file_path = ?", filePath).First(&movieFile).Error; err == nil {
+		return replaceChapters(movieFile.ID, ChapterOwnerMovieFile, chapters)
+	}
+	var episodeFile EpisodeFile
+	if err := db.Where("file_path = ?", filePath).First(&episodeFile).Error; err == nil {
+		return replaceChapters(episodeFile.ID, ChapterOwnerEpisodeFile, chapters)
+	}
+	return nil
+}
+
+func replaceChapters(ownerID uint, ownerType string, chapters []Chapter) error {
+	tx := db.Begin()
+	if err := tx.Unscoped().Delete(Chapter{}, "owner_id = ? AND owner_type = ?", ownerID, ownerType).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, c := range chapters {
+		c.ID = 0
+		c.OwnerID = ownerID
+		c.OwnerType = ownerType
+		if err := tx.Create(&c).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// FindChaptersForMovieFile returns the chapters of the given MovieFile, in order.
+func FindChaptersForMovieFile(movieFileID uint) []Chapter {
+	return findChapters(movieFileID, ChapterOwnerMovieFile)
+}
+
+// FindChaptersForEpisodeFile returns the chapters of the given EpisodeFile, in order.
+func FindChaptersForEpisodeFile(episodeFileID uint) []Chapter {
+	return findChapters(episodeFileID, ChapterOwnerEpisodeFile)
+}
+
+func findChapters(ownerID uint, ownerType string) (chapters []Chapter) {
+	db.Where("owner_id = ? AND owner_type = ?", ownerID, ownerType).Order("start_time").Find(&chapters)
+	return chapters
+}
+
+func deleteChapters(ownerID uint, ownerType string) {
+	db.Unscoped().Delete(Chapter{}, "owner_id = ? AND owner_type = ?", ownerID, ownerType)
+}
@@ -108,7 +108,9 @@ func NewDb(options DatabaseOptions) *gorm.DB {
 
 var allModels = []interface{}{
 	&Movie{}, &MovieFile{}, &Library{}, &Series{}, &Season{}, &Episode{},
-	&EpisodeFile{}, &User{}, &Invite{}, &PlayState{}, &Stream{},
+	&EpisodeFile{}, &User{}, &Invite{}, &PlayState{}, &Stream{}, &Session{},
+	&LibraryGrant{}, &Marker{}, &WatchEvent{}, &SyncJob{}, &ProbeCacheEntry{},
+	&Chapter{},
 }
 
 func initSchema(tx *gorm.DB) error {
@@ -162,6 +164,62 @@ func migrateSchema(db *gorm.DB) error {
 			Migrate: func(tx *gorm.DB) error {
 				return db.Exec("DELETE FROM movies WHERE tmdb_id = 0;").Error
 			},
+		}, {
+			// Password hashes are now prefixed with the algorithm used to create them. Fold the
+			// salt of the existing salted SHA-256 hashes into the hash so that they can still be
+			// verified, they are replaced on the next successful login.
+			ID: "2026-10-17-password-hash-algorithm",
+			Migrate: func(tx *gorm.DB) error {
+				type User struct {
+					ID           uint
+					PasswordHash string
+					Salt         string
+				}
+				var users []User
+				if err := tx.Find(&users).Error; err != nil {
+					return err
+				}
+				for _, u := range users {
+					if strings.Contains(u.PasswordHash, "$") {
+						continue
+					}
+					hash := encodePasswordHash(PasswordHashLegacySHA256, u.Salt+"$"+u.PasswordHash)
+					err := tx.Model(&u).Updates(map[string]interface{}{"password_hash": hash, "salt": ""}).Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}, {
+			// Non-admin users now need to be granted access to libraries. Keep existing users'
+			// access to the existing libraries so that nobody loses access on upgrade.
+			ID: "2026-10-17-library-grants",
+			Migrate: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&LibraryGrant{}).Error; err != nil {
+					return err
+				}
+				var userIDs, libraryIDs []uint
+				tx.Table("users").Where("admin = ?", false).Pluck("id", &userIDs)
+				tx.Table("libraries").Where("deleted_at IS NULL").Pluck("id", &libraryIDs)
+				for _, userID := range userIDs {
+					for _, libraryID := range libraryIDs {
+						grant := LibraryGrant{UserID: userID, LibraryID: libraryID}
+						if err := tx.Create(&grant).Error; err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+		}, {
+			// Modification times of probed files are now stored with nanosecond precision. The
+			// stored ones were truncated by MySQL and Postgres, so every file would look changed
+			// and have its trickplay thumbnails and I-frames deleted. The files are probed again.
+			ID: "2026-10-17-probe-cache-mod-time-nanoseconds",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.DropTableIfExists("probe_cache_entries").Error
+			},
 		},
 	})
 
@@ -69,6 +69,7 @@ func FindLibrary(id int) Library {
 
 // DeleteLibrary deletes a library from the database.
 func DeleteLibraryByID(libraryID uint) error {
+	db.Unscoped().Where("library_id = ?", libraryID).Delete(LibraryGrant{})
 	return db.Unscoped().Delete(Library{}, "id = ?", libraryID).Error
 }
 
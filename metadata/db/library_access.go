@@ -0,0 +1,144 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// LibraryGrant gives a (non-admin) user access to a library. Admins can always access all libraries.
+type LibraryGrant struct {
+	CommonModelFields
+	UserID    uint `gorm:"not null;unique_index:idx_library_grant"`
+	LibraryID uint `gorm:"not null;unique_index:idx_library_grant"`
+}
+
+// LibraryAccess describes which libraries a user can access. The zero value grants access to nothing.
+type LibraryAccess struct {
+	// All is true for admins and internal callers that should see everything.
+	All        bool
+	LibraryIDs []uint
+}
+
+// FullLibraryAccess grants access to all libraries.
+var FullLibraryAccess = LibraryAccess{All: true}
+
+// LibraryAccessForUser returns the libraries the given user can access.
+func LibraryAccessForUser(userID uint, admin bool) LibraryAccess {
+	if admin {
+		return FullLibraryAccess
+	}
+
+	access := LibraryAccess{}
+	db.Model(&LibraryGrant{}).Where("user_id = ?", userID).Pluck("library_id", &access.LibraryIDs)
+	return access
+}
+
+// AllowsLibrary returns whether the library with the given ID can be accessed.
+func (a LibraryAccess) AllowsLibrary(libraryID uint) bool {
+	if a.All {
+		return true
+	}
+	for _, id := range a.LibraryIDs {
+		if id == libraryID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsMovie returns whether the movie has at least one file in an accessible library.
+func (a LibraryAccess) AllowsMovie(movieID uint) bool {
+	return a.allows(&Movie{}, a.moviesScope, "movies.id = ?", movieID)
+}
+
+// AllowsSeries returns whether the series has at least one episode in an accessible library.
+func (a LibraryAccess) AllowsSeries(seriesID uint) bool {
+	return a.allows(&Series{}, a.seriesScope, "series.id = ?", seriesID)
+}
+
+// AllowsSeason returns whether the season has at least one episode in an accessible library.
+func (a LibraryAccess) AllowsSeason(seasonID uint) bool {
+	return a.allows(&Season{}, a.seasonsScope, "seasons.id = ?", seasonID)
+}
+
+// AllowsEpisode returns whether the episode has at least one file in an accessible library.
+func (a LibraryAccess) AllowsEpisode(episodeID uint) bool {
+	return a.allows(&Episode{}, a.episodesScope, "episodes.id = ?", episodeID)
+}
+
+func (a LibraryAccess) allows(model interface{}, scope func(*gorm.DB) *gorm.DB, where string, id uint) bool {
+	if a.All {
+		return true
+	}
+	count := 0
+	db.Model(model).Scopes(scope).Where(where, id).Count(&count)
+	return count > 0
+}
+
+// restrict adds the condition, which takes the accessible library IDs as its only argument, to the query.
+func (a LibraryAccess) restrict(q *gorm.DB, condition string) *gorm.DB {
+	if a.All {
+		return q
+	}
+	if len(a.LibraryIDs) == 0 {
+		// IN () is invalid SQL, so just make sure nothing matches.
+		return q.Where("1 = 0")
+	}
+	return q.Where(condition, a.LibraryIDs)
+}
+
+// filesScope restricts a query on movie_files or episode_files.
+func (a LibraryAccess) filesScope(q *gorm.DB) *gorm.DB {
+	return a.restrict(q, "library_id IN (?)")
+}
+
+func (a LibraryAccess) moviesScope(q *gorm.DB) *gorm.DB {
+	return a.restrict(q, "movies.id IN (SELECT movie_id FROM movie_files WHERE library_id IN (?))")
+}
+
+func (a LibraryAccess) episodesScope(q *gorm.DB) *gorm.DB {
+	return a.restrict(q, "episodes.id IN (SELECT episode_id FROM episode_files WHERE library_id IN (?))")
+}
+
+func (a LibraryAccess) seasonsScope(q *gorm.DB) *gorm.DB {
+	return a.restrict(q, "seasons.id IN (SELECT episodes.season_id FROM episodes "+
+		"INNER JOIN episode_files ON episode_files.episode_id = episodes.id "+
+		"WHERE episode_files.library_id IN (?))")
+}
+
+func (a LibraryAccess) seriesScope(q *gorm.DB) *gorm.DB {
+	return a.restrict(q, "series.id IN (SELECT seasons.series_id FROM seasons "+
+		"INNER JOIN episodes ON episodes.season_id = seasons.id "+
+		"INNER JOIN episode_files ON episode_files.episode_id = episodes.id "+
+		"WHERE episode_files.library_id IN (?))")
+}
+
+// preloadSeriesContents preloads the accessible seasons, episodes and files of series.
+func (a LibraryAccess) preloadSeriesContents(q *gorm.DB) *gorm.DB {
+	return q.Preload("Seasons", a.seasonsScope).
+		Preload("Seasons.Episodes", a.episodesScope).
+		Preload("Seasons.Episodes.EpisodeFiles", a.filesScope).
+		Preload("Seasons.Episodes.EpisodeFiles.Streams")
+}
+
+// GrantLibraryAccess gives the user access to the library.
+func GrantLibraryAccess(userID uint, libraryID uint) error {
+	grant := LibraryGrant{UserID: userID, LibraryID: libraryID}
+	if err := db.FirstOrCreate(&grant, grant).Error; err != nil {
+		return errors.Wrap(err, "Failed to grant library access")
+	}
+	return nil
+}
+
+// RevokeLibraryAccess takes away the user's access to the library.
+func RevokeLibraryAccess(userID uint, libraryID uint) error {
+	return db.Unscoped().Delete(LibraryGrant{}, "user_id = ? AND library_id = ?", userID, libraryID).Error
+}
+
+// GrantedLibraries returns the libraries the user has been granted access to.
+func GrantedLibraries(userID uint) (libraries []Library) {
+	db.Joins("INNER JOIN library_grants ON library_grants.library_id = libraries.id").
+		Where("library_grants.user_id = ?", userID).
+		Find(&libraries)
+	return libraries
+}
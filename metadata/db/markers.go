@@ -0,0 +1,53 @@
+package db
+
+import (
+	"time"
+)
+
+// Kinds of Markers.
+const (
+	MarkerKindIntro   = "intro"
+	MarkerKindCredits = "credits"
+)
+
+// Marker is a part of an EpisodeFile that players can offer to skip, like the intro or the credits.
+// Markers belong to files rather than episodes because their timing differs between releases.
+type Marker struct {
+	CommonModelFields
+	EpisodeFileID uint          `gorm:"not null;index"`
+	Kind          string        `gorm:"not null"`
+	Start         time.Duration `gorm:"column:start_time"`
+	End           time.Duration `gorm:"column:end_time"`
+}
+
+// ReplaceMarkers replaces all markers of the given EpisodeFile.
+func ReplaceMarkers(episodeFileID uint, markers []Marker) error {
+	tx := db.Begin()
+	if err := tx.Unscoped().Delete(Marker{}, "episode_file_id = ?", episodeFileID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, m := range markers {
+		m.EpisodeFileID = episodeFileID
+		if err := tx.Create(&m).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// FindMarkersForEpisodeFile returns the markers of the given EpisodeFile, in order.
+func FindMarkersForEpisodeFile(episodeFileID uint) (markers []Marker) {
+	db.Where("episode_file_id = ?", episodeFileID).Order("start_time").Find(&markers)
+	return markers
+}
+
+// FindMarkersForFilePath returns the markers of the EpisodeFile with the given file locator, in order.
+func FindMarkersForFilePath(filePath string) (markers []Marker) {
+	db.Joins("JOIN episode_files ON episode_files.id = markers.episode_file_id").
+		Where("episode_files.file_path = ? AND episode_files.deleted_at IS NULL", filePath).
+		Order("markers.start_time").
+		Find(&markers)
+	return markers
+}
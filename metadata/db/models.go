@@ -76,13 +76,13 @@ func FindContentByUUID(uuid string) MediaFile {
 }
 
 // RecentlyAddedMovies returns a list of the latest 10 movies added to the database.
-func RecentlyAddedMovies(userID uint) (movies []*Movie) {
-	db.Select("movies.*,play_states.*").Preload("MovieFiles.Streams").Joins("LEFT JOIN play_states ON play_states.media_uuid = movies.uuid").Where("play_states.user_id = ? OR play_states.user_id IS NULL", userID).Where("tmdb_id != 0").Order("movies.created_at DESC").Limit(10).Find(&movies)
+func RecentlyAddedMovies(userID uint, access LibraryAccess) (movies []*Movie) {
+	db.Scopes(access.moviesScope).Select("movies.*,play_states.*").Preload("MovieFiles.Streams").Joins("LEFT JOIN play_states ON play_states.media_uuid = movies.uuid").Where("play_states.user_id = ? OR play_states.user_id IS NULL", userID).Where("tmdb_id != 0").Order("movies.created_at DESC").Limit(10).Find(&movies)
 	return movies
 }
 
 // RecentlyAddedEpisodes returns a list of the latest 10 episodes added to the database.
-func RecentlyAddedEpisodes(userID uint) (eps []*Episode) {
-	db.Select("episodes.*, play_states.*").Preload("EpisodeFiles.Streams").Joins("LEFT JOIN play_states ON play_states.media_uuid = episodes.uuid").Where("play_states.user_id = ? OR play_states.user_id IS NULL", userID).Where("tmdb_id != 0").Order("episodes.created_at DESC").Limit(10).Find(&eps)
+func RecentlyAddedEpisodes(userID uint, access LibraryAccess) (eps []*Episode) {
+	db.Scopes(access.episodesScope).Select("episodes.*, play_states.*").Preload("EpisodeFiles.Streams").Joins("LEFT JOIN play_states ON play_states.media_uuid = episodes.uuid").Where("play_states.user_id = ? OR play_states.user_id IS NULL", userID).Where("tmdb_id != 0").Order("episodes.created_at DESC").Limit(10).Find(&eps)
 	return eps
 }
@@ -14,9 +14,10 @@ import (
 type MovieFile struct {
 	gorm.Model
 	MediaItem
-	Movie   Movie
-	MovieID uint
-	Streams []Stream `gorm:"polymorphic:Owner;"`
+	Movie    Movie
+	MovieID  uint
+	Streams  []Stream  `gorm:"polymorphic:Owner;"`
+	Chapters []Chapter `gorm:"polymorphic:Owner;"`
 }
 
 // Movie is used to store movie metadata information.
@@ -76,6 +77,7 @@ func (file MovieFile) DeleteWithStreams() {
 
 	// Delete all stream information since it's only for this file
 	db.Unscoped().Delete(Stream{}, "owner_id = ? AND owner_type = 'movies'", &file.ID)
+	deleteChapters(file.ID, ChapterOwnerMovieFile)
 	// Delete all file information
 	db.Unscoped().Delete(&file)
 
@@ -149,10 +151,10 @@ func FindAllUnidentifiedMovieFilesInLibrary(libraryID uint) ([]*MovieFile, error
 }
 
 // FindAllUnidentifiedMovieFiles find all MovieFiles without an associated Movie
-func FindAllUnidentifiedMovieFiles(qd QueryDetails) ([]MovieFile, error) {
+func FindAllUnidentifiedMovieFiles(qd QueryDetails, access LibraryAccess) ([]MovieFile, error) {
 	var movieFiles []MovieFile
 
-	query := db.
+	query := db.Scopes(access.filesScope).
 		Find(&movieFiles, "movie_id = 0").
 		Offset(qd.Offset).Limit(qd.Limit)
 	if err := query.Error; err != nil {
@@ -169,8 +171,8 @@ func FindMoviesForMDRefresh() (movies []Movie) {
 }
 
 // FindAllMovies finds all identified movies including all associated information like streams and files.
-func FindAllMovies(qd *QueryDetails) (movies []Movie) {
-	q := db
+func FindAllMovies(qd *QueryDetails, access LibraryAccess) (movies []Movie) {
+	q := db.Scopes(access.moviesScope)
 
 	if qd != nil && qd.SortColumn != "" {
 		q = q.Order(fmt.Sprintf("%s %s", qd.SortColumn, qd.SortDirection))
@@ -213,9 +215,9 @@ func findMovie(where ...interface{}) (*Movie, error) {
 }
 
 // SearchMovieByTitle search movies by title.
-func SearchMovieByTitle(name string) (movies []Movie) {
-	db.Where("LOWER(original_title) LIKE LOWER(?)", "%"+name+"%").
-		Or("LOWER(title) LIKE LOWER(?)", "%"+name+"%").
+func SearchMovieByTitle(name string, access LibraryAccess) (movies []Movie) {
+	db.Scopes(access.moviesScope).
+		Where("LOWER(original_title) LIKE LOWER(?) OR LOWER(title) LIKE LOWER(?)", "%"+name+"%", "%"+name+"%").
 		Find(&movies)
 
 	for _, movie := range movies {
@@ -234,6 +236,14 @@ func FindMoviesInLibrary(libraryID uint) (movies []Movie) {
 	return movies
 }
 
+// FindMovieFilesWithMoviesInLibrary finds all movie files in the given library along with their
+// movies and streams.
+func FindMovieFilesWithMoviesInLibrary(libraryID uint) ([]MovieFile, error) {
+	var files []MovieFile
+	err := db.Preload("Movie").Preload("Streams").Where("library_id = ?", libraryID).Find(&files).Error
+	return files, err
+}
+
 func FindMovieFilesByMovieID(movieID uint) ([]*MovieFile, error) {
 	var movieFiles []*MovieFile
 	err := db.Where("movie_id = ?", movieID).Find(&movieFiles).Error
@@ -326,9 +336,9 @@ func FindStreamsForMovieFileUUID(uuid string) (streams []*Stream) {
 	return streams
 }
 
-// GetMovieCount returns the number of movies in the database
-func GetMovieCount() (int32, error) {
+// GetMovieCount returns the number of accessible movies in the database
+func GetMovieCount(access LibraryAccess) (int32, error) {
 	count := 0
-	err := db.Model(&Movie{}).Count(&count).Error
+	err := db.Model(&Movie{}).Scopes(access.moviesScope).Count(&count).Error
 	return int32(count), err
 }
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm identifiers as stored in front of User.PasswordHash, e.g. "bcrypt$$2a$10$...".
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+	// Salted SHA-256 as used before proper password hashing was introduced. It's only ever used
+	// to verify existing hashes, which are replaced on the next successful login.
+	PasswordHashLegacySHA256 = "sha256"
+)
+
+// PasswordHasher hashes passwords for storage and verifies passwords against stored hashes.
+type PasswordHasher interface {
+	// Algorithm returns the identifier that is stored in front of the hash.
+	Algorithm() string
+	Hash(password string) (string, error)
+	Verify(password string, hash string) bool
+}
+
+var passwordHashers = map[string]PasswordHasher{
+	PasswordHashBcrypt:       bcryptHasher{cost: bcrypt.DefaultCost},
+	PasswordHashArgon2id:     argon2idHasher{time: 1, memory: 64 * 1024, threads: 4, keyLength: 32},
+	PasswordHashLegacySHA256: legacySHA256Hasher{},
+}
+
+// DefaultPasswordHasher is used for all new passwords. Hashes created by any other hasher are
+// replaced with one from this hasher on the next successful login.
+var DefaultPasswordHasher = passwordHashers[PasswordHashBcrypt]
+
+// GetPasswordHasher returns the hasher for the given algorithm identifier.
+func GetPasswordHasher(algorithm string) (PasswordHasher, error) {
+	hasher, ok := passwordHashers[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown password hash algorithm \"%s\"", algorithm)
+	}
+	return hasher, nil
+}
+
+// encodePasswordHash prefixes the hash with the algorithm used to create it.
+func encodePasswordHash(algorithm string, hash string) string {
+	return algorithm + "$" + hash
+}
+
+// decodePasswordHash splits a stored hash into the algorithm and the hash itself.
+func decodePasswordHash(stored string) (algorithm string, hash string) {
+	parts := strings.SplitN(stored, "$", 2)
+	if len(parts) != 2 {
+		return "", stored
+	}
+	return parts[0], parts[1]
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (h bcryptHasher) Algorithm() string {
+	return PasswordHashBcrypt
+}
+
+func (h bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h bcryptHasher) Verify(password string, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// argon2idHasher stores hashes in the PHC string format without the leading "$argon2id", e.g.
+// "v=19$m=65536,t=1,p=4$<salt>$<key>".
+type argon2idHasher struct {
+	time      uint32
+	memory    uint32
+	threads   uint8
+	keyLength uint32
+}
+
+func (h argon2idHasher) Algorithm() string {
+	return PasswordHashArgon2id
+}
+
+func (h argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, h.keyLength)
+
+	return fmt.Sprintf("v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h argon2idHasher) Verify(password string, hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false
+	}
+
+	// Use the parameters stored with the hash so that changing them doesn't lock out users.
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, otherKey) == 1
+}
+
+// legacySHA256Hasher verifies hashes in the format "<salt>$<hex sha256(salt + password)>".
+type legacySHA256Hasher struct{}
+
+func (h legacySHA256Hasher) Algorithm() string {
+	return PasswordHashLegacySHA256
+}
+
+func (h legacySHA256Hasher) Hash(password string) (string, error) {
+	return "", fmt.Errorf("salted SHA-256 is only supported to verify existing passwords")
+}
+
+func (h legacySHA256Hasher) Verify(password string, hash string) bool {
+	parts := strings.SplitN(hash, "$", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(parts[0] + password))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(parts[1])) == 1
+}
@@ -31,8 +31,8 @@ type uniqueSeries struct {
 }
 
 // UpNextMovies returns a list of movies that are recently added and not watched yet.
-func UpNextMovies(userID uint) (movies []*Movie) {
-	db.Select("movies.*, play_states.*").
+func UpNextMovies(userID uint, access LibraryAccess) (movies []*Movie) {
+	db.Scopes(access.moviesScope).Select("movies.*, play_states.*").
 		Order("play_states.updated_at DESC").
 		Joins("JOIN play_states ON play_states.media_uuid = movies.uuid").
 		Where("play_states.finished = false").
@@ -45,7 +45,7 @@ func UpNextMovies(userID uint) (movies []*Movie) {
 }
 
 // UpNextEpisodes returns a list of episodes that are up for viewing next. If you recently finished episode 5 of series Y and episode 6 is unwatched it should return this episode.
-func UpNextEpisodes(userID uint) []*Episode {
+func UpNextEpisodes(userID uint, access LibraryAccess) []*Episode {
 	result := []latestEpResult{}
 	res := []uniqueSeries{}
 	eps := []*Episode{}
@@ -97,10 +97,15 @@ func UpNextEpisodes(userID uint) []*Episode {
 			}
 		}
 	}
+	accessibleEps := []*Episode{}
 	for i := range eps {
+		if !access.AllowsEpisode(eps[i].ID) {
+			continue
+		}
 		db.Model(eps[i]).Preload("Streams").Association("EpisodeFiles").Find(&eps[i].EpisodeFiles)
+		accessibleEps = append(accessibleEps, eps[i])
 	}
-	return eps
+	return accessibleEps
 }
 
 // LatestPlayStates returns playstates for content recently played for the given user.
@@ -92,7 +92,7 @@ func TestContinueMovie(t *testing.T) {
 	defer setupTest(t)()
 	createMovieData()
 
-	movies := db.UpNextMovies(1)
+	movies := db.UpNextMovies(1, db.FullLibraryAccess)
 	if movies[0].Title != "Test" {
 		t.Error("Got the wrong movie expected Test but got:", movies[0].Title)
 	}
@@ -104,7 +104,7 @@ func TestContinuePlayResume(t *testing.T) {
 	createSeries2()
 	createData()
 
-	episodes := db.UpNextEpisodes(1)
+	episodes := db.UpNextEpisodes(1, db.FullLibraryAccess)
 	if len(episodes) != 3 {
 		t.Errorf("exepected %v episodes got %v instead", 3, len(episodes))
 	} else {
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ProbeCacheEntry is what ffprobe found in a file, so that files don't have to be probed again on
+// every playback. It's only valid as long as the file has the same size and modification time.
+type ProbeCacheEntry struct {
+	CommonModelFields
+	// File locator of the probed file
+	FilePath string `gorm:"not null;unique_index"`
+	Size     int64
+	// Modification time in Unix nanoseconds. A time column would lose the sub-second part in
+	// MySQL and the nanoseconds in Postgres, making every file look changed.
+	ModTimeUnixNano int64
+	// The ffprobe output as JSON
+	Container string `gorm:"type:text"`
+	// Keyframe timestamps in nanoseconds as a JSON array, empty if they weren't probed yet.
+	Keyframes string `gorm:"type:text"`
+}
+
+// FindProbeCacheEntry returns the entry for the file with the given file locator, nil if there is none.
+func FindProbeCacheEntry(filePath string) (*ProbeCacheEntry, error) {
+	var entry ProbeCacheEntry
+	res := db.Where("file_path = ?", filePath).Take(&entry)
+	if res.RecordNotFound() {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, errors.Wrap(res.Error, "failed to find probe cache entry")
+	}
+	return &entry, nil
+}
+
+// SaveProbeCacheEntry stores the entry, replacing any previous entry for the same file.
+func SaveProbeCacheEntry(entry *ProbeCacheEntry) error {
+	tx := db.Begin()
+	if err := tx.Unscoped().Delete(ProbeCacheEntry{}, "file_path = ?", entry.FilePath).Error; err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "failed to replace probe cache entry")
+	}
+	entry.ID = 0
+	if err := tx.Create(entry).Error; err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "failed to save probe cache entry")
+	}
+	return tx.Commit().Error
+}
+
+// DeleteProbeCacheEntry deletes the entry for the file with the given file locator, if any.
+func DeleteProbeCacheEntry(filePath string) error {
+	return db.Unscoped().Delete(ProbeCacheEntry{}, "file_path = ?", filePath).Error
+}
@@ -86,7 +86,8 @@ type EpisodeFile struct {
 	MediaItem
 	EpisodeID uint
 	Episode   *Episode
-	Streams   []Stream `gorm:"polymorphic:Owner;"`
+	Streams   []Stream  `gorm:"polymorphic:Owner;"`
+	Chapters  []Chapter `gorm:"polymorphic:Owner;"`
 }
 
 // GetStreams returns all streams for this file
@@ -129,6 +130,9 @@ func (file EpisodeFile) DeleteWithStreams() {
 
 	// Delete all stream information
 	db.Unscoped().Delete(Stream{}, "owner_id = ? AND owner_type = 'episode_files'", &file.ID)
+	// Delete intro and credits markers
+	db.Unscoped().Delete(Marker{}, "episode_file_id = ?", &file.ID)
+	deleteChapters(file.ID, ChapterOwnerEpisodeFile)
 	// Delete all file information
 	db.Unscoped().Delete(&file)
 
@@ -162,9 +166,9 @@ func FindSeriesForMDRefresh() (series []Series) {
 }
 
 // FindAllSeries retrieves all identified series from the db.
-func FindAllSeries(qd *QueryDetails) ([]*Series, error) {
+func FindAllSeries(qd *QueryDetails, access LibraryAccess) ([]*Series, error) {
 	var series []*Series
-	q := db
+	q := db.Scopes(access.seriesScope)
 
 	if qd != nil && qd.SortColumn != "" {
 		q = q.Order(fmt.Sprintf("%s %s", qd.SortColumn, qd.SortDirection))
@@ -175,7 +179,7 @@ func FindAllSeries(qd *QueryDetails) ([]*Series, error) {
 	}
 
 	if err := q.
-		Preload("Seasons.Episodes.EpisodeFiles.Streams").
+		Scopes(access.preloadSeriesContents).
 		Find(&series).
 		Error; err != nil {
 		return nil, err
@@ -184,10 +188,9 @@ func FindAllSeries(qd *QueryDetails) ([]*Series, error) {
 }
 
 // SearchSeriesByTitle searches for series based on their name.
-func SearchSeriesByTitle(name string) (series []Series) {
-	db.Preload("Seasons.Episodes.EpisodeFiles.Streams").
-		Where("LOWER(original_name) LIKE LOWER(?)", "%"+name+"%").
-		Or("LOWER(name) LIKE LOWER(?)", "%"+name+"%").
+func SearchSeriesByTitle(name string, access LibraryAccess) (series []Series) {
+	db.Scopes(access.seriesScope, access.preloadSeriesContents).
+		Where("LOWER(original_name) LIKE LOWER(?) OR LOWER(name) LIKE LOWER(?)", "%"+name+"%", "%"+name+"%").
 		Find(&series)
 	return series
 }
@@ -236,7 +239,7 @@ func FindEpisodesForSeason(seasonID uint) (episodes []Episode) {
 
 // FindSeriesInLibrary finds all series belonging to an EpisodeFile in a given library.
 func FindSeriesInLibrary(libraryID uint) (series []Series) {
-	db.Raw("SELECT series.* FROM episode_files JOIN episodes ON episodes.id = episode_files.id JOIN seasons ON seasons.id = episodes.season_id JOIN series ON series.id = seasons.series_id WHERE library_id = ? GROUP BY series.tmdb_id", libraryID).Scan(&series)
+	db.Raw("SELECT series.* FROM episode_files JOIN episodes ON episodes.id = episode_files.episode_id JOIN seasons ON seasons.id = episodes.season_id JOIN series ON series.id = seasons.series_id WHERE library_id = ? GROUP BY series.id", libraryID).Scan(&series)
 	return series
 }
 
@@ -279,6 +282,12 @@ func FindEpisodesInLibrary(libraryID uint) (episodes []Episode) {
 	return episodes
 }
 
+// FindEpisodeFilesByEpisodeID returns all files of the given episode.
+func FindEpisodeFilesByEpisodeID(episodeID uint) (files []EpisodeFile) {
+	db.Where("episode_id = ?", episodeID).Find(&files)
+	return files
+}
+
 // FindEpisodeFileByUUID finds an EpisodeFile by UUID
 func FindEpisodeFileByUUID(uuid string) (*EpisodeFile, error) {
 	return findEpisodeFile("uuid = ?", uuid)
@@ -469,10 +478,10 @@ func ItemsWithMissingMetadata() []string {
 }
 
 // FindAllUnidentifiedEpisodeFiles find all EpisodeFiles without an associated Episode
-func FindAllUnidentifiedEpisodeFiles(qd *QueryDetails) ([]EpisodeFile, error) {
+func FindAllUnidentifiedEpisodeFiles(qd *QueryDetails, access LibraryAccess) ([]EpisodeFile, error) {
 	var episodeFiles []EpisodeFile
 
-	query := db
+	query := db.Scopes(access.filesScope)
 	if qd != nil {
 		query = query.Offset(qd.Offset).Limit(qd.Limit)
 	}
@@ -499,34 +508,35 @@ func FindAllUnidentifiedEpisodeFilesInLibrary(libraryID uint) ([]*EpisodeFile, e
 	return episodeFiles, nil
 }
 
-// GetSeriesCount returns the number of series in the database
-func GetSeriesCount() (int32, error) {
+// GetSeriesCount returns the number of accessible series in the database
+func GetSeriesCount(access LibraryAccess) (int32, error) {
 	count := 0
-	err := db.Model(&Series{}).Count(&count).Error
+	err := db.Model(&Series{}).Scopes(access.seriesScope).Count(&count).Error
 	return int32(count), err
 }
 
-// GetSeasonCount returns the number of seasons in the database
-func GetSeasonCount() (int32, error) {
+// GetSeasonCount returns the number of accessible seasons in the database
+func GetSeasonCount(access LibraryAccess) (int32, error) {
 	count := 0
-	err := db.Model(&Season{}).Count(&count).Error
+	err := db.Model(&Season{}).Scopes(access.seasonsScope).Count(&count).Error
 	return int32(count), err
 }
 
-// GetEpisodeCount returns the number of episodes in the database
-func GetEpisodeCount() (int32, error) {
+// GetEpisodeCount returns the number of accessible episodes in the database
+func GetEpisodeCount(access LibraryAccess) (int32, error) {
 	count := 0
-	err := db.Model(&Episode{}).Count(&count).Error
+	err := db.Model(&Episode{}).Scopes(access.episodesScope).Count(&count).Error
 	return int32(count), err
 }
 
 // GetNextEpisodes returns the next n episodes after the episode with the
 // provided UUID
-func GetNextEpisodes(episodeUuid string, limit int32) ([]Episode, error) {
+func GetNextEpisodes(episodeUuid string, limit int32, access LibraryAccess) ([]Episode, error) {
 	var episodes []Episode
 
 	q := db.Preload("Season").
 		Model(&Episode{}).
+		Scopes(access.episodesScope).
 		Joins("CROSS JOIN episodes target_episode").
 		Joins("INNER JOIN seasons ON seasons.id = episodes.season_id").
 		Joins("INNER JOIN seasons target_season ON target_episode.season_id = target_season.id").
@@ -543,11 +553,12 @@ func GetNextEpisodes(episodeUuid string, limit int32) ([]Episode, error) {
 
 // GetPreviousEpisodes returns the next n episodes after the episode with the
 // provided UUID
-func GetPreviousEpisodes(episodeUuid string, limit int32) ([]Episode, error) {
+func GetPreviousEpisodes(episodeUuid string, limit int32, access LibraryAccess) ([]Episode, error) {
 	var episodes []Episode
 
 	q := db.Preload("Season").
 		Model(&Episode{}).
+		Scopes(access.episodesScope).
 		Joins("CROSS JOIN episodes target_episode").
 		Joins("INNER JOIN seasons ON seasons.id = episodes.season_id").
 		Joins("INNER JOIN seasons target_season ON target_episode.season_id = target_season.id").
@@ -0,0 +1,84 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func createTestEpisodes(t *testing.T, seriesName string, count int) []*db.Episode {
+	series := db.Series{Name: seriesName}
+	require.NoError(t, db.SaveSeries(&series))
+	season := db.Season{SeriesID: series.ID, SeasonNumber: 1}
+	require.NoError(t, db.SaveSeason(&season))
+
+	var episodes []*db.Episode
+	for i := 1; i <= count; i++ {
+		episode := db.Episode{SeasonID: season.ID, SeasonNum: 1, EpisodeNum: i}
+		require.NoError(t, db.SaveEpisode(&episode))
+		episodes = append(episodes, &episode)
+	}
+	return episodes
+}
+
+func createTestEpisodeFile(t *testing.T, episode *db.Episode, libraryID uint) {
+	file := db.EpisodeFile{
+		MediaItem: db.MediaItem{FilePath: "local#/tmp/episode.mkv", LibraryID: libraryID},
+		EpisodeID: episode.ID,
+	}
+	require.NoError(t, db.SaveEpisodeFile(&file))
+}
+
+func TestFindSeriesInLibrary(t *testing.T) {
+	defer setupTest(t)()
+
+	// None of the series were matched on themoviedb.org, so they share TmdbID 0. The IDs of the
+	// files don't line up with the IDs of their episodes either.
+	first := createTestEpisodes(t, "First", 2)
+	second := createTestEpisodes(t, "Second", 1)
+	other := createTestEpisodes(t, "Other library", 1)
+	createTestEpisodeFile(t, second[0], 1)
+	createTestEpisodeFile(t, first[1], 1)
+	createTestEpisodeFile(t, first[0], 1)
+	createTestEpisodeFile(t, other[0], 2)
+
+	var names []string
+	for _, series := range db.FindSeriesInLibrary(1) {
+		names = append(names, series.Name)
+	}
+	assert.ElementsMatch(t, []string{"First", "Second"}, names)
+}
+
+func TestSearchSeriesByTitle_LibraryAccess(t *testing.T) {
+	defer setupTest(t)()
+
+	// The second season only has episodes in the other library.
+	episodes := createTestEpisodes(t, "Shared", 2)
+	createTestEpisodeFile(t, episodes[0], 1)
+	createTestEpisodeFile(t, episodes[1], 2)
+	season := db.Season{SeriesID: episodes[0].GetSeries().ID, SeasonNumber: 2}
+	require.NoError(t, db.SaveSeason(&season))
+	other := db.Episode{SeasonID: season.ID, SeasonNum: 2, EpisodeNum: 1}
+	require.NoError(t, db.SaveEpisode(&other))
+	createTestEpisodeFile(t, &other, 2)
+
+	access := db.LibraryAccess{LibraryIDs: []uint{1}}
+	series := db.SearchSeriesByTitle("shared", access)
+	require.Len(t, series, 1)
+	require.Len(t, series[0].Seasons, 1)
+	require.Len(t, series[0].Seasons[0].Episodes, 1)
+	assert.Equal(t, episodes[0].ID, series[0].Seasons[0].Episodes[0].ID)
+	require.Len(t, series[0].Seasons[0].Episodes[0].EpisodeFiles, 1)
+	assert.Equal(t, uint(1), series[0].Seasons[0].Episodes[0].EpisodeFiles[0].LibraryID)
+
+	allSeries, err := db.FindAllSeries(nil, access)
+	require.NoError(t, err)
+	require.Len(t, allSeries, 1)
+	assert.Len(t, allSeries[0].Seasons, 1)
+
+	series = db.SearchSeriesByTitle("shared", db.FullLibraryAccess)
+	require.Len(t, series, 1)
+	assert.Len(t, series[0].Seasons, 2)
+}
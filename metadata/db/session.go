@@ -0,0 +1,125 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"gitlab.com/olaris/olaris-server/helpers"
+)
+
+// Session is a login of a user on one device. Access tokens are only valid as long as their session
+// is, and new access tokens can be obtained with the session's refresh token.
+type Session struct {
+	CommonModelFields
+	UUIDable
+	UserID uint `gorm:"not null;index"`
+	// SHA-256 of the current refresh token. The token itself is only ever given to the client.
+	RefreshTokenHash string `gorm:"not null;unique_index"`
+	ExpiresAt        time.Time
+	LastUsedAt       time.Time
+	// Nil unless the session has been revoked, either explicitly or by a password change.
+	RevokedAt *time.Time
+	UserAgent string
+}
+
+// Active returns whether tokens belonging to this session may still be used.
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a new session for the given user that is valid for validFor unless it's refreshed.
+// It returns the session and the refresh token for it.
+func CreateSession(userID uint, userAgent string, validFor time.Duration) (Session, string, error) {
+	refreshToken := helpers.RandAlphaString(48)
+	now := time.Now()
+	session := Session{
+		UserID:           userID,
+		RefreshTokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt:        now.Add(validFor),
+		LastUsedAt:       now,
+		UserAgent:        userAgent,
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return Session{}, "", errors.Wrap(err, "Failed to create session")
+	}
+	return session, refreshToken, nil
+}
+
+// RefreshSession replaces the given refresh token with a new one and extends the session by validFor.
+// Each refresh token can only be used once.
+func RefreshSession(refreshToken string, validFor time.Duration) (Session, string, error) {
+	var session Session
+	if err := db.Take(&session, "refresh_token_hash = ?", hashRefreshToken(refreshToken)).Error; err != nil {
+		return Session{}, "", fmt.Errorf("invalid refresh token")
+	}
+	if !session.Active() {
+		return Session{}, "", fmt.Errorf("session expired or revoked")
+	}
+
+	newRefreshToken := helpers.RandAlphaString(48)
+	now := time.Now()
+	// Only replace the token if nobody else did since it was read, so that concurrent refreshes
+	// with the same token don't both succeed.
+	res := db.Model(&Session{}).
+		Where("id = ? AND refresh_token_hash = ?", session.ID, session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": hashRefreshToken(newRefreshToken),
+			"expires_at":         now.Add(validFor),
+			"last_used_at":       now,
+		})
+	if res.Error != nil {
+		return Session{}, "", errors.Wrap(res.Error, "Failed to refresh session")
+	}
+	if res.RowsAffected == 0 {
+		return Session{}, "", fmt.Errorf("invalid refresh token")
+	}
+	session.RefreshTokenHash = hashRefreshToken(newRefreshToken)
+	session.ExpiresAt = now.Add(validFor)
+	session.LastUsedAt = now
+	return session, newRefreshToken, nil
+}
+
+// FindSessionByUUID returns a specific session.
+func FindSessionByUUID(uuid string) (*Session, error) {
+	var session Session
+	if err := db.Take(&session, "uuid = ?", uuid).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ActiveSessionsForUser returns all sessions of the given user that have neither expired nor been revoked.
+func ActiveSessionsForUser(userID uint) (sessions []Session) {
+	db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions)
+	return sessions
+}
+
+// RevokeSession revokes the given session, tokens belonging to it can no longer be used.
+func RevokeSession(session *Session) error {
+	now := time.Now()
+	session.RevokedAt = &now
+	return db.Model(session).Update("revoked_at", now).Error
+}
+
+// RevokeSessionsForUser revokes all sessions and streaming tickets of the given user.
+func RevokeSessionsForUser(userID uint) error {
+	err := db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&User{}).Where("id = ?", userID).
+		UpdateColumn("token_generation", gorm.Expr("token_generation + ?", 1)).Error
+}
@@ -0,0 +1,46 @@
+package db_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestRefreshSession(t *testing.T) {
+	defer setupTest(t)()
+	user, err := db.CreateUser("user", "password", false)
+	require.NoError(t, err)
+	session, refreshToken, err := db.CreateSession(user.ID, "test", time.Hour)
+	require.NoError(t, err)
+
+	refreshed, newRefreshToken, err := db.RefreshSession(refreshToken, 2*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, refreshed.ID)
+	assert.NotEqual(t, refreshToken, newRefreshToken)
+	assert.True(t, refreshed.ExpiresAt.After(session.ExpiresAt))
+
+	_, _, err = db.RefreshSession(refreshToken, time.Hour)
+	assert.Error(t, err, "Refresh tokens can only be used once")
+
+	// Of concurrent refreshes with the same token, only one may succeed.
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	succeeded := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := db.RefreshSession(newRefreshToken, time.Hour); err == nil {
+				mtx.Lock()
+				succeeded++
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, succeeded, 1)
+}
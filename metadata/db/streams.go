@@ -47,6 +47,12 @@ type Stream struct {
 	// User-visible string for this audio or subtitle track
 	Title            string
 	EnabledByDefault bool
+	// Only relevant for audio
+	Channels      int
+	ChannelLayout string
+	// Only relevant for subtitles
+	Forced          bool
+	HearingImpaired bool
 }
 
 // UpdateAllStreams updates all streams for all mediaItems
@@ -10,7 +10,7 @@ import (
 func TestBeforeCreate(t *testing.T) {
 	app.NewMDContext(db.DatabaseOptions{
 		Connection: db.InMemory,
-	}, nil)
+	})
 	stream := db.Stream{Codecs: "test"}
 	db.CreateStream(&stream)
 	if stream.UUID == "" {
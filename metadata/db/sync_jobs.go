@@ -0,0 +1,125 @@
+package db
+
+import (
+	"github.com/pkg/errors"
+)
+
+// States of a SyncJob.
+const (
+	SyncJobQueued    = "queued"
+	SyncJobRunning   = "running"
+	SyncJobDone      = "done"
+	SyncJobFailed    = "failed"
+	SyncJobCancelled = "cancelled"
+)
+
+// SyncJob transcodes a file into a single MP4 file that a user can download to watch offline.
+type SyncJob struct {
+	CommonModelFields
+	UUIDable
+	UserID uint `gorm:"not null;index"`
+	// UUID of the Movie or Episode
+	MediaUUID string
+	// File locator of the source file
+	FilePath string `gorm:"not null"`
+	// Name of the video encoder preset, e.g. "720-5000k-video"
+	Preset string `gorm:"not null"`
+	State  string `gorm:"not null;index"`
+	// Between 0 and 1
+	Progress float64
+	// Why the job failed
+	Error string
+	// Where the finished file is stored and its size in bytes
+	OutputPath string
+	Size       int64
+}
+
+// CreateSyncJob queues a new sync job.
+func CreateSyncJob(job *SyncJob) error {
+	job.State = SyncJobQueued
+	if err := db.Create(job).Error; err != nil {
+		return errors.Wrap(err, "Failed to create sync job")
+	}
+	return nil
+}
+
+// FindSyncJobByUUID returns the sync job with the given UUID.
+func FindSyncJobByUUID(uuid string) (*SyncJob, error) {
+	var job SyncJob
+	if err := db.Where("uuid = ?", uuid).Take(&job).Error; err != nil {
+		return nil, errors.Wrap(err, "Failed to find sync job")
+	}
+	return &job, nil
+}
+
+// FindSyncJobsForUser returns the sync jobs of the given user, newest first.
+func FindSyncJobsForUser(userID uint) (jobs []SyncJob) {
+	db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&jobs)
+	return jobs
+}
+
+// NextQueuedSyncJob returns the sync job that has been waiting the longest, or nil if none is queued.
+func NextQueuedSyncJob() *SyncJob {
+	var jobs []SyncJob
+	db.Where("state = ?", SyncJobQueued).Order("created_at ASC, id ASC").Limit(1).Find(&jobs)
+	if len(jobs) == 0 {
+		return nil
+	}
+	return &jobs[0]
+}
+
+// StartSyncJob marks a queued job as running and stores where its output goes. It returns false
+// if the job isn't queued anymore, e.g. because it was cancelled in the meantime.
+func StartSyncJob(job *SyncJob) bool {
+	res := db.Model(&SyncJob{}).Where("id = ? AND state = ?", job.ID, SyncJobQueued).
+		Updates(map[string]interface{}{"state": SyncJobRunning, "output_path": job.OutputPath})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false
+	}
+	job.State = SyncJobRunning
+	return true
+}
+
+// RequeueRunningSyncJobs queues the jobs again that were interrupted, e.g. by a restart.
+func RequeueRunningSyncJobs() error {
+	return db.Model(&SyncJob{}).Where("state = ?", SyncJobRunning).
+		Updates(map[string]interface{}{"state": SyncJobQueued, "progress": 0}).Error
+}
+
+// FinishSyncJob saves the final state, progress, error and size of a running job. Like the other
+// state changes, it only applies if the job wasn't cancelled or deleted in the meantime.
+func FinishSyncJob(job *SyncJob) error {
+	return db.Model(&SyncJob{}).Where("id = ? AND state = ?", job.ID, SyncJobRunning).
+		Updates(map[string]interface{}{
+			"state":    job.State,
+			"progress": job.Progress,
+			"error":    job.Error,
+			"size":     job.Size,
+		}).Error
+}
+
+// CancelSyncJob marks a queued or running job as cancelled. It returns false if the job has already
+// finished.
+func CancelSyncJob(job *SyncJob) (bool, error) {
+	res := db.Model(&SyncJob{}).Where("id = ? AND state IN (?)", job.ID, []string{SyncJobQueued, SyncJobRunning}).
+		Update("state", SyncJobCancelled)
+	if res.Error != nil {
+		return false, errors.Wrap(res.Error, "Failed to cancel sync job")
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	job.State = SyncJobCancelled
+	return true, nil
+}
+
+// UpdateSyncJobProgress saves the progress of a running job.
+func UpdateSyncJobProgress(id uint, progress float64) error {
+	return db.Model(&SyncJob{}).Where("id = ? AND state = ?", id, SyncJobRunning).
+		Update("progress", progress).Error
+}
+
+// DeleteSyncJob removes the given job from the database.
+func DeleteSyncJob(job *SyncJob) error {
+	return db.Unscoped().Delete(job).Error
+}
@@ -1,10 +1,9 @@
 package db
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"gitlab.com/olaris/olaris-server/helpers"
 	"time"
@@ -25,7 +24,11 @@ type User struct {
 	Username     string `gorm:"not null;unique" json:"username"`
 	Admin        bool   `gorm:"not null" json:"admin"`
 	PasswordHash string `gorm:"not null" json:"-"`
-	Salt         string `gorm:"not null" json:"-"`
+	// Deprecated: The salt is now part of PasswordHash. Only kept because the column is NOT NULL.
+	Salt string `gorm:"not null" json:"-"`
+	// Streaming tickets are only valid for the generation they were issued for. Only changed by
+	// RevokeSessionsForUser.
+	TokenGeneration uint `gorm:"not null;default:0" json:"-"`
 }
 
 // Invite is a model used to invite users to your server.
@@ -50,29 +53,49 @@ func AllInvites() (invites []Invite) {
 	return invites
 }
 
-// ValidPassword checks if the given password is valid for the user.
+// ValidPassword checks if the given password is valid for the user. Passwords hashed with anything
+// but the DefaultPasswordHasher are rehashed and saved when they are valid.
 func (user *User) ValidPassword(password string) bool {
 	db.Where("username = ?", user.Username).Find(user)
-	if user.hashPassword(password, user.Salt) == user.PasswordHash {
-		return true
+
+	algorithm, hash := decodePasswordHash(user.PasswordHash)
+	hasher, ok := passwordHashers[algorithm]
+	if !ok {
+		log.WithFields(log.Fields{"username": user.Username, "algorithm": algorithm}).
+			Warnln("Unknown password hash algorithm")
+		return false
+	}
+	if !hasher.Verify(password, hash) {
+		return false
 	}
-	return false
-}
 
-// SetPassword sets a (new) password for the given user.
-func (user *User) SetPassword(password string, salt string) string {
-	user.Salt = salt
-	user.PasswordHash = user.hashPassword(password, user.Salt)
+	if algorithm != DefaultPasswordHasher.Algorithm() {
+		log.WithFields(log.Fields{"username": user.Username, "algorithm": algorithm}).
+			Infoln("Rehashing password with the default algorithm")
+		if err := user.SetPassword(password); err != nil {
+			log.WithError(err).Errorln("Failed to rehash password")
+		} else if err := db.Model(user).Updates(map[string]interface{}{
+			"password_hash": user.PasswordHash,
+			"salt":          user.Salt,
+		}).Error; err != nil {
+			log.WithError(err).Errorln("Failed to save rehashed password")
+		}
+	}
 
-	return user.PasswordHash
+	return true
 }
 
-func (user *User) hashPassword(password string, salt string) string {
-	h := sha256.New()
-	h.Write([]byte(salt))
-	h.Write([]byte(password))
-	hashedStr := hex.EncodeToString(h.Sum(nil))
-	return hashedStr
+// SetPassword sets a (new) password for the given user, hashed with the DefaultPasswordHasher.
+// It doesn't save the user.
+func (user *User) SetPassword(password string) error {
+	hash, err := DefaultPasswordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = encodePasswordHash(DefaultPasswordHasher.Algorithm(), hash)
+	user.Salt = ""
+
+	return nil
 }
 
 // CreateUserWithCode creates a new user. The invite code will be ignored if no other users exist yet.
@@ -118,7 +141,9 @@ func CreateUser(username string, password string, admin bool) (User, error) {
 	}
 
 	user := User{Username: username, Admin: admin}
-	user.SetPassword(password, helpers.RandAlphaString(24))
+	if err := user.SetPassword(password); err != nil {
+		return User{}, err
+	}
 	dbobj := db.Create(&user)
 
 	return user, dbobj.Error
@@ -155,6 +180,29 @@ func UserCount() int {
 	return count
 }
 
+// SaveUser updates a user in the database.
+func SaveUser(user *User) error {
+	// The token generation may have changed since the user was read, don't undo that.
+	if err := db.Omit("token_generation").Save(user).Error; err != nil {
+		return errors.Wrapf(err, "Failed to save user %s", user.Username)
+	}
+	return nil
+}
+
+// ChangePassword sets a new password for the given user and revokes all of the user's sessions.
+func ChangePassword(user *User, password string) error {
+	if len(password) < 8 {
+		return fmt.Errorf("password should be at least 8 characters")
+	}
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	if err := SaveUser(user); err != nil {
+		return err
+	}
+	return RevokeSessionsForUser(user.ID)
+}
+
 // DeleteUser deletes the given user.
 func DeleteUser(id uint) (User, error) {
 	user := User{}
@@ -162,6 +210,8 @@ func DeleteUser(id uint) (User, error) {
 
 	if user.ID != 0 {
 		db.Unscoped().Where("user_id = ?", user.ID).Delete(Invite{})
+		db.Unscoped().Where("user_id = ?", user.ID).Delete(Session{})
+		db.Unscoped().Where("user_id = ?", user.ID).Delete(LibraryGrant{})
 		obj := db.Unscoped().Delete(&user)
 		return user, obj.Error
 	}
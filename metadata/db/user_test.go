@@ -1,17 +1,73 @@
 package db_test
 
 import (
-	"gitlab.com/olaris/olaris-server/metadata/db"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/db"
 )
 
 func TestSetPassword(t *testing.T) {
 	user := db.User{Username: "animazing", Admin: true}
-	r := user.SetPassword("test", "test")
-	if r != "37268335dd6931045bdcdf92623ff819a64244b53d0e746d438797349d4da578" {
-		t.Errorf("Expected salted password to be 37268335dd6931045bdcdf92623ff819a64244b53d0e746d438797349d4da578 got %s instead", r)
-	}
-	if user.PasswordHash == "" {
-		t.Errorf("Password hash is not set on user")
+	err := user.SetPassword("test")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.PasswordHash, db.PasswordHashBcrypt+"$"),
+		"Expected bcrypt hash, got %s", user.PasswordHash)
+
+	other := db.User{Username: "animazing", Admin: true}
+	other.SetPassword("test")
+	assert.NotEqual(t, user.PasswordHash, other.PasswordHash, "Expected hashes to be salted")
+}
+
+func TestValidPassword(t *testing.T) {
+	defer setupTest(t)()
+
+	_, err := db.CreateUser("animazing", "supersecret", true)
+	assert.NoError(t, err)
+
+	user := db.User{Username: "animazing"}
+	assert.True(t, user.ValidPassword("supersecret"))
+	assert.False(t, user.ValidPassword("wrongpassword"))
+}
+
+func TestValidPassword_RehashesLegacyHash(t *testing.T) {
+	defer setupTest(t)()
+
+	user, err := db.CreateUser("animazing", "supersecret", true)
+	assert.NoError(t, err)
+
+	// sha256("test" + "test"), as created by older versions with the salt "test"
+	user.PasswordHash = "sha256$test$37268335dd6931045bdcdf92623ff819a64244b53d0e746d438797349d4da578"
+	assert.NoError(t, db.SaveUser(&user))
+
+	login := db.User{Username: "animazing"}
+	assert.False(t, login.ValidPassword("supersecret"))
+	assert.True(t, login.ValidPassword("test"))
+
+	stored, err := db.FindUserByUsername("animazing")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.PasswordHash, db.PasswordHashBcrypt+"$"),
+		"Expected legacy hash to be replaced, got %s", stored.PasswordHash)
+	assert.True(t, stored.ValidPassword("test"))
+}
+
+func TestPasswordHashers(t *testing.T) {
+	for _, algorithm := range []string{db.PasswordHashBcrypt, db.PasswordHashArgon2id} {
+		hasher, err := db.GetPasswordHasher(algorithm)
+		assert.NoError(t, err)
+
+		hash, err := hasher.Hash("supersecret")
+		assert.NoError(t, err)
+		assert.True(t, hasher.Verify("supersecret", hash), algorithm)
+		assert.False(t, hasher.Verify("wrongpassword", hash), algorithm)
 	}
+
+	legacy, err := db.GetPasswordHasher(db.PasswordHashLegacySHA256)
+	assert.NoError(t, err)
+	_, err = legacy.Hash("test")
+	assert.Error(t, err)
+
+	_, err = db.GetPasswordHasher("md5")
+	assert.Error(t, err)
 }
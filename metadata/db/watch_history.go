@@ -0,0 +1,145 @@
+package db
+
+import (
+	"time"
+)
+
+// Kinds of WatchEvents.
+const (
+	// A client reported the playback position, see PlayState.
+	WatchEventProgress = "progress"
+	// A user started streaming a file.
+	WatchEventPlaybackStarted = "playbackStarted"
+	// A user stopped streaming a file, either explicitly or by not requesting anything for a while.
+	WatchEventPlaybackStopped = "playbackStopped"
+)
+
+// WatchEvent is an entry in the watch history. Unlike PlayStates, which only hold the latest state
+// of a media item, WatchEvents are never updated or deleted.
+type WatchEvent struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"index"`
+	UserID    uint      `gorm:"not null;index"`
+	Kind      string    `gorm:"not null"`
+	// UUID of the Movie or Episode
+	MediaUUID string `gorm:"index"`
+	// Playback position in seconds
+	Playtime float64
+	Finished bool
+	// For WatchEventPlaybackStopped, how long the user streamed in seconds.
+	WatchedSeconds float64
+}
+
+// CreateWatchEvent appends an event to the watch history.
+func CreateWatchEvent(event *WatchEvent) error {
+	return db.Create(event).Error
+}
+
+// WatchHistoryForUser returns the watch history of the given user, newest first. A userID of 0
+// returns the history of all users.
+func WatchHistoryForUser(userID uint, offset int, limit int) (events []WatchEvent) {
+	q := db.Order("created_at DESC, id DESC").Offset(offset)
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	q.Find(&events)
+	return events
+}
+
+// DailyWatchTotal is the time a user spent watching on a day.
+type DailyWatchTotal struct {
+	// Midnight in the server's time zone
+	Day            time.Time
+	WatchedSeconds float64
+	Plays          int
+}
+
+// DailyWatchTotals returns the time the given user (or all users, for 0) spent watching on each of
+// the days since the given time, oldest first. Days without any playback are included.
+func DailyWatchTotals(userID uint, since time.Time) []DailyWatchTotal {
+	var events []WatchEvent
+	q := db.Where("kind = ? AND created_at >= ?", WatchEventPlaybackStopped, since)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	q.Find(&events)
+
+	// Group in Go rather than SQL because the date functions differ between the databases we support.
+	var totals []DailyWatchTotal
+	index := map[time.Time]int{}
+	for day := startOfDay(since); !day.After(time.Now()); day = day.AddDate(0, 0, 1) {
+		index[day] = len(totals)
+		totals = append(totals, DailyWatchTotal{Day: day})
+	}
+	for _, e := range events {
+		if i, ok := index[startOfDay(e.CreatedAt)]; ok {
+			totals[i].WatchedSeconds += e.WatchedSeconds
+			totals[i].Plays++
+		}
+	}
+	return totals
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// MostWatched is a movie or series and how much it has been watched.
+type MostWatched struct {
+	ID             uint
+	WatchedSeconds float64
+	Plays          int
+}
+
+// MostWatchedMovies returns the accessible movies the given user (or all users, for 0) spent the
+// most time watching.
+func MostWatchedMovies(userID uint, access LibraryAccess, limit int) (movies []MostWatched) {
+	q := db.Table("watch_events").Scopes(access.moviesScope).
+		Select("movies.id AS id, SUM(watch_events.watched_seconds) AS watched_seconds, COUNT(*) AS plays").
+		Joins("JOIN movies ON movies.uuid = watch_events.media_uuid").
+		Where("watch_events.kind = ? AND movies.deleted_at IS NULL", WatchEventPlaybackStopped)
+	if userID != 0 {
+		q = q.Where("watch_events.user_id = ?", userID)
+	}
+	q.Group("movies.id").Order("watched_seconds DESC").Limit(limit).Scan(&movies)
+	return movies
+}
+
+// MostWatchedSeries returns the series the given user (or all users, for 0) spent the most time
+// watching accessible episodes of.
+func MostWatchedSeries(userID uint, access LibraryAccess, limit int) (series []MostWatched) {
+	q := db.Table("watch_events").Scopes(access.episodesScope).
+		Select("seasons.series_id AS id, SUM(watch_events.watched_seconds) AS watched_seconds, COUNT(*) AS plays").
+		Joins("JOIN episodes ON episodes.uuid = watch_events.media_uuid").
+		Joins("JOIN seasons ON seasons.id = episodes.season_id").
+		Where("watch_events.kind = ? AND episodes.deleted_at IS NULL", WatchEventPlaybackStopped)
+	if userID != 0 {
+		q = q.Where("watch_events.user_id = ?", userID)
+	}
+	q.Group("seasons.series_id").Order("watched_seconds DESC").Limit(limit).Scan(&series)
+	return series
+}
+
+// FindMediaUUIDForFilePath returns the UUID of the Movie or Episode that the file with the given
+// file locator belongs to, or an empty string if it isn't identified.
+func FindMediaUUIDForFilePath(filePath string) string {
+	var uuids []string
+	db.Table("movie_files").
+		Joins("JOIN movies ON movies.id = movie_files.movie_id").
+		Where("movie_files.file_path = ? AND movie_files.deleted_at IS NULL", filePath).
+		Pluck("movies.uuid", &uuids)
+	if len(uuids) == 0 {
+		db.Table("episode_files").
+			Joins("JOIN episodes ON episodes.id = episode_files.episode_id").
+			Where("episode_files.file_path = ? AND episode_files.deleted_at IS NULL", filePath).
+			Pluck("episodes.uuid", &uuids)
+	}
+	if len(uuids) == 0 {
+		return ""
+	}
+	return uuids[0]
+}
@@ -0,0 +1,105 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestWatchHistory(t *testing.T) {
+	defer setupTest(t)()
+
+	movie := db.Movie{Title: "Mad Max: Fury Road"}
+	require.NoError(t, db.SaveMovie(&movie))
+	movieFile := db.MovieFile{MediaItem: db.MediaItem{FilePath: "local#/movies/Mad Max.mkv"}, MovieID: movie.ID}
+	db.SaveMovieFile(&movieFile)
+
+	episode := &db.Episode{SeasonNum: 1, EpisodeNum: 1}
+	series := db.Series{Name: "The Walking Dead", Seasons: []*db.Season{{SeasonNumber: 1, Episodes: []*db.Episode{episode}}}}
+	db.CreateSeries(&series)
+
+	assert.Equal(t, movie.UUID, db.FindMediaUUIDForFilePath(movieFile.FilePath))
+	assert.Equal(t, "", db.FindMediaUUIDForFilePath("local#/movies/Unknown.mkv"))
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	for _, e := range []db.WatchEvent{
+		{UserID: 1, Kind: db.WatchEventPlaybackStopped, MediaUUID: movie.UUID, WatchedSeconds: 600, CreatedAt: yesterday},
+		{UserID: 1, Kind: db.WatchEventPlaybackStopped, MediaUUID: episode.UUID, WatchedSeconds: 1200},
+		{UserID: 1, Kind: db.WatchEventPlaybackStopped, MediaUUID: episode.UUID, WatchedSeconds: 300},
+		{UserID: 1, Kind: db.WatchEventProgress, MediaUUID: episode.UUID, Playtime: 1500},
+		{UserID: 2, Kind: db.WatchEventPlaybackStopped, MediaUUID: movie.UUID, WatchedSeconds: 6000},
+	} {
+		require.NoError(t, db.CreateWatchEvent(&e))
+	}
+
+	history := db.WatchHistoryForUser(1, 0, 10)
+	require.Len(t, history, 4)
+	assert.Equal(t, db.WatchEventProgress, history[0].Kind)
+	assert.Len(t, db.WatchHistoryForUser(0, 0, 10), 5)
+	assert.Len(t, db.WatchHistoryForUser(1, 1, 2), 2)
+
+	totals := db.DailyWatchTotals(1, yesterday)
+	require.Len(t, totals, 2)
+	assert.Equal(t, 600.0, totals[0].WatchedSeconds)
+	assert.Equal(t, 1, totals[0].Plays)
+	assert.Equal(t, 1500.0, totals[1].WatchedSeconds)
+	assert.Equal(t, 2, totals[1].Plays)
+
+	movies := db.MostWatchedMovies(0, db.FullLibraryAccess, 10)
+	require.Len(t, movies, 1)
+	assert.Equal(t, movie.ID, movies[0].ID)
+	assert.Equal(t, 6600.0, movies[0].WatchedSeconds)
+
+	mostWatchedSeries := db.MostWatchedSeries(1, db.FullLibraryAccess, 10)
+	require.Len(t, mostWatchedSeries, 1)
+	assert.Equal(t, series.ID, mostWatchedSeries[0].ID)
+	assert.Equal(t, 2, mostWatchedSeries[0].Plays)
+	assert.Empty(t, db.MostWatchedSeries(2, db.FullLibraryAccess, 10))
+}
+
+func TestMostWatched_LibraryAccess(t *testing.T) {
+	defer setupTest(t)()
+
+	var movies []db.Movie
+	for i, title := range []string{"Accessible", "Other library"} {
+		movie := db.Movie{Title: title}
+		require.NoError(t, db.SaveMovie(&movie))
+		movieFile := db.MovieFile{
+			MediaItem: db.MediaItem{FilePath: "local#/movies/" + title + ".mkv", LibraryID: uint(i + 1)},
+			MovieID:   movie.ID,
+		}
+		db.SaveMovieFile(&movieFile)
+		movies = append(movies, movie)
+	}
+	accessible := createTestEpisodes(t, "Accessible", 1)
+	other := createTestEpisodes(t, "Other library", 1)
+	createTestEpisodeFile(t, accessible[0], 1)
+	createTestEpisodeFile(t, other[0], 2)
+
+	// The media in the other library was watched the most.
+	for _, e := range []db.WatchEvent{
+		{UserID: 1, Kind: db.WatchEventPlaybackStopped, MediaUUID: movies[0].UUID, WatchedSeconds: 600},
+		{UserID: 1, Kind: db.WatchEventPlaybackStopped, MediaUUID: movies[1].UUID, WatchedSeconds: 6000},
+		{UserID: 1, Kind: db.WatchEventPlaybackStopped, MediaUUID: accessible[0].UUID, WatchedSeconds: 600},
+		{UserID: 1, Kind: db.WatchEventPlaybackStopped, MediaUUID: other[0].UUID, WatchedSeconds: 6000},
+	} {
+		require.NoError(t, db.CreateWatchEvent(&e))
+	}
+
+	access := db.LibraryAccess{LibraryIDs: []uint{1}}
+	mostWatchedMovies := db.MostWatchedMovies(1, access, 1)
+	require.Len(t, mostWatchedMovies, 1)
+	assert.Equal(t, movies[0].ID, mostWatchedMovies[0].ID)
+
+	mostWatchedSeries := db.MostWatchedSeries(1, access, 1)
+	require.Len(t, mostWatchedSeries, 1)
+	series, err := db.FindSeries(mostWatchedSeries[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Accessible", series.Name)
+
+	assert.Empty(t, db.MostWatchedMovies(1, db.LibraryAccess{}, 10))
+	assert.Empty(t, db.MostWatchedSeries(1, db.LibraryAccess{}, 10))
+}
@@ -21,6 +21,7 @@ func RegisterRoutes(menv *app.MetadataContext, r *mux.Router) {
 	r.Handle("/query", auth.MiddleWare(graphqlws.NewHandlerFunc(schema, handler)))
 
 	r.HandleFunc("/v1/auth", auth.UserHandler).Methods("POST")
+	r.HandleFunc("/v1/auth/refresh", auth.RefreshHandler).Methods("POST")
 
 	r.HandleFunc("/v1/version", versionHandler).Methods("GET")
 
@@ -136,11 +136,13 @@ loop:
 					log.WithField("path", event.Name).Debugf("deleting movie")
 					movieID := movieFile.MovieID
 					movieFile.DeleteWithStreams()
+					deleteCachedFileData(movieFile.FilePath)
 					man.metadataManager.GarbageCollectMovieIfRequired(movieID)
 				} else if episodeFile, err := db.FindEpisodeFileByPath(n); err == nil {
 					log.WithField("path", event.Name).Debugf("deleting episode")
 					episodeID := episodeFile.EpisodeID
 					episodeFile.DeleteWithStreams()
+					deleteCachedFileData(episodeFile.FilePath)
 					man.metadataManager.GarbageCollectEpisodeIfRequired(episodeID)
 				} else {
 					// if there was no movie or episode in the database,
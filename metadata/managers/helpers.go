@@ -26,6 +26,10 @@ func FfmpegStreamFromDatabaseStream(s db.Stream) ffmpeg.Stream {
 		Language:         s.Language,
 		Title:            s.Title,
 		EnabledByDefault: s.EnabledByDefault,
+		Channels:         s.Channels,
+		ChannelLayout:    s.ChannelLayout,
+		Forced:           s.Forced,
+		HearingImpaired:  s.HearingImpaired,
 	}
 }
 
@@ -50,5 +54,9 @@ func DatabaseStreamFromFfmpegStream(s ffmpeg.Stream) db.Stream {
 		Language:         s.Language,
 		Title:            s.Title,
 		EnabledByDefault: s.EnabledByDefault,
+		Channels:         s.Channels,
+		ChannelLayout:    s.ChannelLayout,
+		Forced:           s.Forced,
+		HearingImpaired:  s.HearingImpaired,
 	}
 }
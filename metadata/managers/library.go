@@ -36,6 +36,15 @@ type probeJob struct {
 	man  *LibraryManager
 }
 
+// probeCacheJob probes a file that is already in the library, so that playback doesn't have to.
+type probeCacheJob struct {
+	fileLocator filesystem.FileLocator
+}
+
+type trickplayJob struct {
+	fileLocator filesystem.FileLocator
+}
+
 // LibraryManager manages all active libraries.
 type LibraryManager struct {
 	metadataManager *metadata.MetadataManager
@@ -84,6 +93,7 @@ func (man *LibraryManager) DeleteLibrary() error {
 		movieFiles, _ := db.FindMovieFilesInLibrary(man.Library.ID)
 		for _, movieFile := range movieFiles {
 			movieID := movieFile.MovieID
+			deleteCachedFileData(movieFile.FilePath)
 			movieFile.DeleteWithStreams()
 			man.metadataManager.GarbageCollectMovieIfRequired(movieID)
 		}
@@ -91,6 +101,7 @@ func (man *LibraryManager) DeleteLibrary() error {
 		episodeFiles, _ := db.FindEpisodeFilesInLibrary(man.Library.ID)
 		for _, episodeFile := range episodeFiles {
 			episodeID := episodeFile.EpisodeID
+			deleteCachedFileData(episodeFile.FilePath)
 			episodeFile.DeleteWithStreams()
 			man.metadataManager.GarbageCollectEpisodeIfRequired(episodeID)
 		}
@@ -161,16 +172,41 @@ func (man *LibraryManager) checkAndAddProbeJob(node filesystem.Node) {
 	if (library.Kind == db.MediaTypeSeries && !db.EpisodeFileExists(node.FileLocator().String())) ||
 		(library.Kind == db.MediaTypeMovie && !db.MovieFileExists(node.FileLocator().String())) {
 
-		// This is really annoying however when a tunny job is added to a closed pool it will throw a panic
-		// Right now a job can still be running when we delete a library this recover catches the fact that the pool is closed but we are still queuing up
-		// TODO: Somebody smarter than me figure out a better way of doing this
-		go func(p *probeJob) {
-			defer checkPanic()
-			man.Pool.probePool.Process(p)
-		}(&probeJob{man: man, node: node})
+		man.Pool.queueProbe(&probeJob{man: man, node: node})
 	} else {
 		log.WithFields(log.Fields{"path": node.Path()}).
 			Debugln("File already exists in library, not adding again.")
+		man.checkAndAddProbeCacheJob(node)
+		man.checkAndAddTrickplayJob(node.FileLocator())
+	}
+}
+
+// checkAndAddProbeCacheJob queues probing the given file if there is no probe result for it or the
+// file changed since it was probed. Data derived from the old file is removed first.
+func (man *LibraryManager) checkAndAddProbeCacheJob(node filesystem.Node) {
+	if ffmpeg.HasCurrentProbeResult(node) {
+		return
+	}
+	if ffmpeg.HasStaleProbeResult(node) {
+		log.WithFields(log.Fields{"path": node.Path()}).
+			Infoln("File changed since it was probed, removing cached data.")
+		deleteCachedFileData(node.FileLocator().String())
+	}
+
+	man.Pool.queueProbe(&probeCacheJob{fileLocator: node.FileLocator()})
+}
+
+// checkAndAddTrickplayJob queues generating trickplay thumbnails and finding the keyframes for I-frame
+// playlists for the given file if they are enabled and weren't done yet.
+func (man *LibraryManager) checkAndAddTrickplayJob(fileLocator filesystem.FileLocator) {
+	if !viper.GetBool("metadata.trickplay") ||
+		(ffmpeg.HasTrickplay(fileLocator) && ffmpeg.HasKeyframes(fileLocator)) {
+		return
+	}
+
+	if !man.Pool.queueTrickplay(fileLocator) {
+		log.WithField("fileLocator", fileLocator).
+			Debugln("Trickplay queue is full, leaving the file for the next scan.")
 	}
 }
 
@@ -307,6 +343,12 @@ func (man *LibraryManager) ProbeFile(n filesystem.Node) error {
 		return nil
 	}
 
+	chapters, err := ffmpeg.GetChapters(n.FileLocator())
+	if err != nil {
+		log.WithError(err).WithField("filePath", n.FileLocator().String()).
+			Warnln("Failed to read chapters")
+	}
+
 	switch kind := library.Kind; kind {
 	case db.MediaTypeSeries:
 		episodeFile := db.EpisodeFile{
@@ -316,7 +358,8 @@ func (man *LibraryManager) ProbeFile(n filesystem.Node) error {
 				Size:      n.Size(),
 				LibraryID: library.ID,
 			},
-			Streams: collectStreams(streams),
+			Streams:  collectStreams(streams),
+			Chapters: collectChapters(chapters),
 		}
 
 		db.SaveEpisodeFile(&episodeFile)
@@ -335,7 +378,8 @@ func (man *LibraryManager) ProbeFile(n filesystem.Node) error {
 				Size:      n.Size(),
 				LibraryID: library.ID,
 			},
-			Streams: collectStreams(streams),
+			Streams:  collectStreams(streams),
+			Chapters: collectChapters(chapters),
 		}
 		db.SaveMovieFile(&movieFile)
 
@@ -346,6 +390,8 @@ func (man *LibraryManager) ProbeFile(n filesystem.Node) error {
 		}
 	}
 
+	man.checkAndAddTrickplayJob(n.FileLocator())
+
 	dur := time.Since(st)
 	log.WithFields(log.Fields{"duration": dur.Seconds(), "path": n.Path()}).Printf("done scanning file")
 	return nil
@@ -424,6 +470,7 @@ func (man *LibraryManager) RemoveMissingFiles(locator filesystem.FileLocator) {
 	for _, movieFile := range db.FindMovieFilesInLibraryByLocator(man.Library.ID, locator) {
 		if FileMissing(movieFile) {
 			movieID := movieFile.MovieID
+			deleteCachedFileData(movieFile.FilePath)
 			movieFile.DeleteWithStreams()
 			man.metadataManager.GarbageCollectMovieIfRequired(movieID)
 		}
@@ -432,6 +479,7 @@ func (man *LibraryManager) RemoveMissingFiles(locator filesystem.FileLocator) {
 	for _, episodeFile := range db.FindEpisodeFilesInLibraryByLocator(man.Library.ID, locator) {
 		if FileMissing(episodeFile) {
 			episodeID := episodeFile.EpisodeID
+			deleteCachedFileData(episodeFile.FilePath)
 			episodeFile.DeleteWithStreams()
 			man.metadataManager.GarbageCollectEpisodeIfRequired(episodeID)
 		}
@@ -454,6 +502,27 @@ func (man *LibraryManager) RefreshAll() {
 	man.IdentifyUnidentifiedFiles()
 }
 
+// deleteCachedFileData removes the probe result, I-frames, trickplay thumbnails and transcoded
+// segments of a file.
+func deleteCachedFileData(filePath string) {
+	fileLocator, err := filesystem.ParseFileLocator(filePath)
+	if err != nil {
+		return
+	}
+	if err := ffmpeg.InvalidateProbeResult(fileLocator); err != nil {
+		log.WithError(err).WithField("filePath", filePath).Warnln("Failed to delete probe result")
+	}
+	if err := ffmpeg.DeleteIFrames(fileLocator); err != nil {
+		log.WithError(err).WithField("filePath", filePath).Warnln("Failed to delete I-frames")
+	}
+	if err := ffmpeg.DeleteTrickplay(fileLocator); err != nil {
+		log.WithError(err).WithField("filePath", filePath).Warnln("Failed to delete trickplay thumbnails")
+	}
+	if err := ffmpeg.GetSegmentCache().DeleteFile(fileLocator); err != nil {
+		log.WithError(err).WithField("filePath", filePath).Warnln("Failed to delete cached segments")
+	}
+}
+
 func checkPanic() {
 	if r := recover(); r != nil {
 		log.WithFields(log.Fields{"recover": r}).Debugln("Recovered from panic in pool processing.")
@@ -477,3 +546,11 @@ func collectStreams(s *ffmpeg.Streams) []db.Stream {
 
 	return streams
 }
+
+func collectChapters(chapters []ffmpeg.Chapter) []db.Chapter {
+	var res []db.Chapter
+	for _, c := range chapters {
+		res = append(res, db.Chapter{Title: c.Title, Start: c.Start, End: c.End})
+	}
+	return res
+}
@@ -0,0 +1,155 @@
+package managers
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+const (
+	// How much of the beginning of each episode is searched for the intro.
+	introSearchDuration = 10 * time.Minute
+	minIntroDuration    = 15 * time.Second
+	// Anything longer is more likely a recap or the same episode in another file.
+	maxIntroDuration = 2 * time.Minute
+	// How much of the end of each episode is searched for the credits.
+	creditsSearchDuration = 5 * time.Minute
+)
+
+// These are variables so that tests can do without ffmpeg.
+var audioFingerprint = ffmpeg.AudioFingerprint
+var detectBlackAndSilence = ffmpeg.DetectBlackAndSilence
+
+type markerAnalysisJob struct {
+	seasonID uint
+}
+
+// QueueMarkerAnalysis queues finding the intro and credits markers of the episodes of the given season.
+func (man *LibraryManager) QueueMarkerAnalysis(seasonID uint) {
+	// See WorkerPool.queueProbe for why we recover here
+	go func(j *markerAnalysisJob) {
+		defer checkPanic()
+		man.Pool.analysisPool.Process(j)
+	}(&markerAnalysisJob{seasonID: seasonID})
+}
+
+type analysedEpisodeFile struct {
+	file        db.EpisodeFile
+	episodeNum  int
+	locator     filesystem.FileLocator
+	duration    time.Duration
+	fingerprint []uint32
+}
+
+// AnalyzeSeasonMarkers finds the intro and credits of all episode files in the given season.
+// Intros are found by looking for audio that an episode shares with the episode before or after
+// it, credits by looking for a fade to black and silence near the end.
+func AnalyzeSeasonMarkers(seasonID uint) {
+	logger := log.WithField("seasonID", seasonID)
+	logger.Infoln("Analysing season for intro and credits markers")
+
+	var files []*analysedEpisodeFile
+	for _, episode := range db.FindEpisodesForSeason(seasonID) {
+		for _, file := range episode.EpisodeFiles {
+			locator, err := filesystem.ParseFileLocator(file.FilePath)
+			if err != nil {
+				logger.WithError(err).Warnln("Failed to parse file locator")
+				continue
+			}
+			f := &analysedEpisodeFile{
+				file:       file,
+				episodeNum: episode.EpisodeNum,
+				locator:    locator,
+				duration:   videoDuration(file.Streams),
+			}
+
+			searchDuration := introSearchDuration
+			if f.duration > 0 && f.duration/3 < searchDuration {
+				searchDuration = f.duration / 3
+			}
+			f.fingerprint, err = audioFingerprint(locator, searchDuration)
+			if err != nil {
+				logger.WithError(err).WithField("filePath", file.FilePath).
+					Warnln("Failed to fingerprint audio")
+			}
+			files = append(files, f)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].episodeNum < files[j].episodeNum })
+
+	for i, f := range files {
+		var markers []db.Marker
+		if intro, ok := findIntro(f, neighbourEpisodeFiles(files, i)); ok {
+			markers = append(markers, db.Marker{Kind: db.MarkerKindIntro, Start: intro.Start, End: intro.End})
+		}
+		if credits, ok := findCredits(f); ok {
+			markers = append(markers, db.Marker{Kind: db.MarkerKindCredits, Start: credits.Start, End: credits.End})
+		}
+
+		if err := db.ReplaceMarkers(f.file.ID, markers); err != nil {
+			logger.WithError(err).Warnln("Failed to save markers")
+		}
+	}
+	logger.WithField("files", len(files)).Infoln("Done analysing season")
+}
+
+// neighbourEpisodeFiles returns the first file of the episodes before and after the one of files[i].
+// Other files of the same episode are skipped because they share all of their audio.
+func neighbourEpisodeFiles(files []*analysedEpisodeFile, i int) (neighbours []*analysedEpisodeFile) {
+	for j := i - 1; j >= 0; j-- {
+		if files[j].episodeNum != files[i].episodeNum {
+			neighbours = append(neighbours, files[j])
+			break
+		}
+	}
+	for j := i + 1; j < len(files); j++ {
+		if files[j].episodeNum != files[i].episodeNum {
+			neighbours = append(neighbours, files[j])
+			break
+		}
+	}
+	return neighbours
+}
+
+func findIntro(f *analysedEpisodeFile, neighbours []*analysedEpisodeFile) (ffmpeg.TimeRange, bool) {
+	var best ffmpeg.TimeRange
+	for _, n := range neighbours {
+		intro, _, ok := ffmpeg.FindCommonSegment(f.fingerprint, n.fingerprint, minIntroDuration)
+		if ok && intro.Duration() <= maxIntroDuration && intro.Duration() > best.Duration() {
+			best = intro
+		}
+	}
+	return best, best.Duration() > 0
+}
+
+func findCredits(f *analysedEpisodeFile) (ffmpeg.TimeRange, bool) {
+	if f.duration <= 0 {
+		return ffmpeg.TimeRange{}, false
+	}
+	searchStart := f.duration - creditsSearchDuration
+	if searchStart < f.duration/2 {
+		searchStart = f.duration / 2
+	}
+
+	black, silence, err := detectBlackAndSilence(f.locator, searchStart, f.duration)
+	if err != nil {
+		log.WithError(err).WithField("filePath", f.file.FilePath).
+			Warnln("Failed to detect black frames and silence")
+		return ffmpeg.TimeRange{}, false
+	}
+	start, ok := ffmpeg.FindCreditsStart(black, silence, f.duration)
+	return ffmpeg.TimeRange{Start: start, End: f.duration}, ok
+}
+
+func videoDuration(streams []db.Stream) time.Duration {
+	for _, s := range streams {
+		if s.StreamType == "video" {
+			return s.TotalDuration
+		}
+	}
+	return 0
+}
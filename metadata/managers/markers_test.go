@@ -0,0 +1,82 @@
+package managers
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func testFingerprint(seconds int, seed int64) []uint32 {
+	r := rand.New(rand.NewSource(seed))
+	fp := make([]uint32, time.Duration(seconds)*time.Second/ffmpeg.FingerprintFrameDuration)
+	for i := range fp {
+		fp[i] = r.Uint32() | 1
+	}
+	return fp
+}
+
+func TestAnalyzeSeasonMarkers(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+
+	season := db.Season{SeasonNumber: 1}
+	require.NoError(t, db.SaveSeason(&season))
+	var files []db.EpisodeFile
+	for i := 1; i <= 3; i++ {
+		episode := db.Episode{SeasonID: season.ID, EpisodeNum: i}
+		require.NoError(t, db.SaveEpisode(&episode))
+		file := db.EpisodeFile{
+			MediaItem: db.MediaItem{FilePath: fmt.Sprintf("local#/series/S01E%02d.mkv", i)},
+			EpisodeID: episode.ID,
+			Streams:   []db.Stream{{StreamType: "video", TotalDuration: 40 * time.Minute}},
+		}
+		db.SaveEpisodeFile(&file)
+		files = append(files, file)
+	}
+
+	// The intro is at a different position in every episode.
+	intro := testFingerprint(30, 0)
+	fingerprints := map[string][]uint32{}
+	for i, f := range files {
+		fp := append(testFingerprint(10*(i+1), int64(i+1)), intro...)
+		fingerprints[f.FilePath] = append(fp, testFingerprint(60, int64(i+10))...)
+	}
+
+	audioFingerprint = func(l filesystem.FileLocator, _ time.Duration) ([]uint32, error) {
+		return fingerprints[l.String()], nil
+	}
+	detectBlackAndSilence = func(
+		l filesystem.FileLocator, start time.Duration, total time.Duration) ([]ffmpeg.TimeRange, []ffmpeg.TimeRange, error) {
+		transition := []ffmpeg.TimeRange{{Start: 38 * time.Minute, End: 38*time.Minute + time.Second}}
+		return transition, transition, nil
+	}
+	defer func() {
+		audioFingerprint = ffmpeg.AudioFingerprint
+		detectBlackAndSilence = ffmpeg.DetectBlackAndSilence
+	}()
+
+	AnalyzeSeasonMarkers(season.ID)
+
+	for i, f := range files {
+		markers := db.FindMarkersForEpisodeFile(f.ID)
+		require.Len(t, markers, 2)
+
+		assert.Equal(t, db.MarkerKindIntro, markers[0].Kind)
+		assert.InDelta(t, 10*(i+1), markers[0].Start.Seconds(), 0.5)
+		assert.InDelta(t, 10*(i+1)+30, markers[0].End.Seconds(), 0.5)
+
+		assert.Equal(t, db.MarkerKindCredits, markers[1].Kind)
+		assert.Equal(t, 38*time.Minute, markers[1].Start)
+		assert.Equal(t, 40*time.Minute, markers[1].End)
+	}
+
+	// Analysing again replaces the markers.
+	AnalyzeSeasonMarkers(season.ID)
+	assert.Len(t, db.FindMarkersForFilePath(files[0].FilePath), 2)
+}
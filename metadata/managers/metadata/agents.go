@@ -0,0 +1,118 @@
+package metadata
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
+)
+
+// updateFromAgents calls update with each agent in order on a copy of item, a pointer to a
+// metadata struct. The result of the first agent that succeeds is used, fields it left empty
+// are filled in from the agents after it. Each agent gets the result of the ones before it, e.g.
+// to look up an item by an ID another agent found.
+func (m *MetadataManager) updateFromAgents(
+	item interface{},
+	update func(a agents.MetadataRetrievalAgent, item interface{}) error) error {
+
+	if len(m.agents) == 0 {
+		return errors.New("No metadata agents configured")
+	}
+
+	target := reflect.ValueOf(item).Elem()
+	var merged reflect.Value
+	var agentErrors []string
+	for _, a := range m.agents {
+		candidate := reflect.New(target.Type())
+		if merged.IsValid() {
+			candidate.Elem().Set(merged)
+		} else {
+			candidate.Elem().Set(target)
+		}
+		if err := update(a, candidate.Interface()); err != nil {
+			log.WithError(err).WithField("agent", a.Name()).
+				Debugln("Agent could not provide metadata, trying the next one.")
+			agentErrors = append(agentErrors, fmt.Sprintf("%s: %s", a.Name(), err))
+			continue
+		}
+		if !merged.IsValid() {
+			merged = candidate.Elem()
+		} else {
+			fillEmptyFields(merged, candidate.Elem())
+		}
+	}
+	if !merged.IsValid() {
+		return fmt.Errorf("No agent could provide metadata (%s)", strings.Join(agentErrors, "; "))
+	}
+	target.Set(merged)
+	return nil
+}
+
+// fillEmptyFields sets the fields of the struct dst that have their zero value to the ones of
+// src, descending into embedded structs.
+func fillEmptyFields(dst reflect.Value, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		if dst.Type().Field(i).Anonymous && field.Kind() == reflect.Struct {
+			fillEmptyFields(field, src.Field(i))
+		} else if field.IsZero() {
+			field.Set(src.Field(i))
+		}
+	}
+}
+
+// SearchMovies returns the movies matching the query from the first agent that finds any.
+// Results without a TMDB ID are skipped because we identify movies by their TMDB ID.
+func (m *MetadataManager) SearchMovies(query agents.MovieQuery) ([]agents.MovieSearchResult, error) {
+	var lastErr error
+	for _, a := range m.agents {
+		results, err := a.SearchMovie(query)
+		if err != nil {
+			log.WithError(err).WithField("agent", a.Name()).Warnln("Failed to search for movie.")
+			lastErr = err
+			continue
+		}
+
+		var tmdbResults []agents.MovieSearchResult
+		for _, r := range results {
+			if r.ID.Provider == agents.ProviderTmdb {
+				tmdbResults = append(tmdbResults, r)
+			}
+		}
+		if len(tmdbResults) > 0 {
+			return tmdbResults, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// SearchSeries returns the series matching the query from the first agent that finds any.
+// Results without a TMDB ID are skipped because we identify series by their TMDB ID.
+func (m *MetadataManager) SearchSeries(query agents.SeriesQuery) ([]agents.SeriesSearchResult, error) {
+	var lastErr error
+	for _, a := range m.agents {
+		results, err := a.SearchSeries(query)
+		if err != nil {
+			log.WithError(err).WithField("agent", a.Name()).Warnln("Failed to search for series.")
+			lastErr = err
+			continue
+		}
+
+		var tmdbResults []agents.SeriesSearchResult
+		for _, r := range results {
+			if r.ID.Provider == agents.ProviderTmdb {
+				tmdbResults = append(tmdbResults, r)
+			}
+		}
+		if len(tmdbResults) > 0 {
+			return tmdbResults, nil
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,76 @@
+package metadata
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
+	"gitlab.com/olaris/olaris-server/metadata/agents/agentsfakes"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestRefreshMovieMetadata_FallsBackToNextAgent(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	nfoAgent := agentsfakes.FakeMetadataRetrievalAgent{}
+	nfoAgent.NameReturns(agents.AgentNfo)
+	nfoAgent.UpdateMovieMDReturns(agents.ErrNoMetadata)
+	tmdbAgent := agentsfakes.FakeMetadataRetrievalAgent{}
+	tmdbAgent.NameReturns(agents.AgentTmdb)
+	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, id agents.ExternalID) error {
+		movie.Title = "North of the Sun"
+		return nil
+	}
+	m := NewMetadataManager(&nfoAgent, &tmdbAgent)
+
+	movie := db.Movie{BaseItem: db.BaseItem{TmdbID: 1234}}
+	assert.NoError(t, m.RefreshMovieMetadata(&movie))
+
+	assert.Equal(t, "North of the Sun", movie.Title)
+	assert.Equal(t, 1, nfoAgent.UpdateMovieMDCallCount())
+	_, id := tmdbAgent.UpdateMovieMDArgsForCall(0)
+	assert.Equal(t, agents.TmdbID(1234), id)
+}
+
+func TestRefreshMovieMetadata_AllAgentsFail(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	agent := agentsfakes.FakeMetadataRetrievalAgent{}
+	agent.UpdateMovieMDReturns(errors.New("Not found"))
+	m := NewMetadataManager(&agent)
+
+	movie := db.Movie{BaseItem: db.BaseItem{TmdbID: 1234}}
+	assert.Error(t, m.RefreshMovieMetadata(&movie))
+}
+
+func TestSearchMovies_SkipsResultsWithoutTmdbID(t *testing.T) {
+	nfoAgent := agentsfakes.FakeMetadataRetrievalAgent{}
+	nfoAgent.SearchMovieReturns([]agents.MovieSearchResult{
+		{Title: "Mad Max: Fury Road", ID: agents.ExternalID{Provider: agents.ProviderImdb, ID: "tt1392190"}},
+	}, nil)
+	tmdbAgent := agentsfakes.FakeMetadataRetrievalAgent{}
+	tmdbAgent.SearchMovieReturns([]agents.MovieSearchResult{
+		{Title: "Mad Max: Fury Road", ID: agents.TmdbID(76341)},
+	}, nil)
+	m := NewMetadataManager(&nfoAgent, &tmdbAgent)
+
+	results, err := m.SearchMovies(agents.MovieQuery{Title: "Mad Max Fury Road"})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, agents.TmdbID(76341), results[0].ID)
+	}
+}
+
+func TestSearchMovies_StopsAtFirstAgentWithResults(t *testing.T) {
+	nfoAgent := agentsfakes.FakeMetadataRetrievalAgent{}
+	nfoAgent.SearchMovieReturns([]agents.MovieSearchResult{
+		{Title: "Mad Max: Fury Road", ID: agents.TmdbID(76341)},
+	}, nil)
+	tmdbAgent := agentsfakes.FakeMetadataRetrievalAgent{}
+	m := NewMetadataManager(&nfoAgent, &tmdbAgent)
+
+	results, err := m.SearchMovies(agents.MovieQuery{Title: "Mad Max Fury Road", FilePath: "local#/movies/Mad Max.mkv"})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "local#/movies/Mad Max.mkv", nfoAgent.SearchMovieArgsForCall(0).FilePath)
+	assert.Equal(t, 0, tmdbAgent.SearchMovieCallCount())
+}
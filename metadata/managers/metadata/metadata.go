@@ -23,15 +23,17 @@ type MetadataManager struct {
 	seasonLock  sync.Map
 	seriesLock  sync.Map
 
-	agent agents.MetadataRetrievalAgent
+	// Agents to retrieve metadata from, in order of preference.
+	agents []agents.MetadataRetrievalAgent
 
 	eventBroker *metadataEventBroker
 }
 
-// NewMetadataManager creates a new MetadataManager
-func NewMetadataManager(agent agents.MetadataRetrievalAgent) *MetadataManager {
+// NewMetadataManager creates a new MetadataManager that asks the given agents for metadata,
+// filling in what an agent can't provide from the next one.
+func NewMetadataManager(metadataAgents ...agents.MetadataRetrievalAgent) *MetadataManager {
 	return &MetadataManager{
-		agent:       agent,
+		agents:      metadataAgents,
 		eventBroker: newMetadataEventBroker(),
 	}
 }
@@ -3,16 +3,15 @@ package metadata
 import (
 	"fmt"
 	errors "github.com/pkg/errors"
-	"github.com/ryanbradynd05/go-tmdb"
 	log "github.com/sirupsen/logrus"
 	"gitlab.com/olaris/olaris-server/filesystem"
 	"gitlab.com/olaris/olaris-server/helpers"
 	"gitlab.com/olaris/olaris-server/helpers/levenshtein"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
 	"gitlab.com/olaris/olaris-server/metadata/db"
 	"gitlab.com/olaris/olaris-server/metadata/parsers"
 	"math"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
@@ -20,7 +19,7 @@ const xattrNameMovieTMDBID = "user.olaris.v1.movies.tmdb.id"
 
 // RefreshAllMovieMetadata refreshes all metadata for all movies
 func (m *MetadataManager) RefreshAllMovieMetadata() {
-	for _, movie := range db.FindAllMovies(nil) {
+	for _, movie := range db.FindAllMovies(nil, db.FullLibraryAccess) {
 		m.RefreshMovieMetadata(&movie)
 	}
 }
@@ -47,7 +46,11 @@ func (m *MetadataManager) RefreshMovieMetadata(movie *db.Movie) error {
 // refreshMovieMetadataFromAgent updates the given struct with the latest metadata from the agent
 // but does not save the database record.
 func (m *MetadataManager) refreshMovieMetadataFromAgent(movie *db.Movie) error {
-	if err := m.agent.UpdateMovieMD(movie, movie.TmdbID); err != nil {
+	err := m.updateFromAgents(movie, func(a agents.MetadataRetrievalAgent, item interface{}) error {
+		movie := item.(*db.Movie)
+		return a.UpdateMovieMD(movie, agents.TmdbID(movie.TmdbID))
+	})
+	if err != nil {
 		return errors.Wrapf(err,
 			"Failed to refresh metadata from agent for movie %s", movie.UUID)
 	}
@@ -86,17 +89,16 @@ func (m *MetadataManager) getMovieTMDBIDFromFilename(
 	name := strings.TrimSuffix(movieFile.FileName, filepath.Ext(movieFile.FileName))
 	parsedInfo := parsers.ParseMovieName(name)
 
-	var options = make(map[string]string)
-	if parsedInfo.Year > 0 {
-		options["year"] = strconv.FormatUint(parsedInfo.Year, 10)
-	}
-
-	searchRes, err := m.agent.TmdbSearchMovie(parsedInfo.Title, options)
+	searchRes, err := m.SearchMovies(agents.MovieQuery{
+		Title:    parsedInfo.Title,
+		Year:     int(parsedInfo.Year),
+		FilePath: movieFile.FilePath,
+	})
 	if err != nil {
 		return 0, false, err
 	}
 
-	if len(searchRes.Results) == 0 {
+	if len(searchRes) == 0 {
 		log.WithFields(log.Fields{
 			"title": parsedInfo.Title,
 			"year":  parsedInfo.Year,
@@ -108,8 +110,8 @@ func (m *MetadataManager) getMovieTMDBIDFromFilename(
 	log.Debugln("Found movie that matches, using first result from search and requesting more movie details.")
 
 	var bestDistance = math.MaxInt32
-	var bestResult tmdb.MovieShort
-	for _, r := range searchRes.Results {
+	var bestResult agents.MovieSearchResult
+	for _, r := range searchRes {
 		d := levenshtein.ComputeDistance(parsedInfo.Title, r.Title)
 		if d < bestDistance {
 			bestDistance = d
@@ -117,10 +119,27 @@ func (m *MetadataManager) getMovieTMDBIDFromFilename(
 		}
 	}
 
-	return bestResult.ID, true, nil
+	tmdbID, err = bestResult.ID.Int()
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "Invalid TMDB ID %s", bestResult.ID)
+	}
+	return tmdbID, true, nil
 }
 
 func (m *MetadataManager) getMovieTMDBID(movieFile *db.MovieFile) (int, bool, error) {
+	tmdbID, nfoFound, err := m.getMovieTMDBIDFromNfo(movieFile)
+	if err != nil {
+		// A broken .nfo file shouldn't keep us from identifying the movie some other way.
+		log.WithError(err).WithField("filename", movieFile.FileName).
+			Warnln("Failed to identify movie from .nfo file")
+	} else if nfoFound {
+		log.Debugln(
+			"Read TMDB ID", tmdbID,
+			"from .nfo file for", movieFile.FileName,
+			"- skipping xattr and filename parse")
+		return tmdbID, nfoFound, nil
+	}
+
 	tmdbID, xattrInfoFound, err := m.getMovieTMDBIDFromXattr(movieFile)
 	if err != nil {
 		return 0, false, err
@@ -137,8 +156,8 @@ func (m *MetadataManager) getMovieTMDBID(movieFile *db.MovieFile) (int, bool, er
 
 }
 
-// GetOrCreateMovieForMovieFile tries to create a Movie object by reading the TMDB ID stored
-// in the filesystem extended attributes for the file, and then by parsing the filename of the
+// GetOrCreateMovieForMovieFile tries to create a Movie object by reading the TMDB ID from a .nfo
+// file next to it, from the filesystem extended attributes for the file, and then by parsing the filename of the
 // given MovieFile and looking it up in TMDB. It associates the MovieFile with the new Model.
 // If no matching movie can be found in TMDB, it returns an error.
 func (m *MetadataManager) GetOrCreateMovieForMovieFile(
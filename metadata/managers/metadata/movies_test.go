@@ -1,8 +1,8 @@
 package metadata
 
 import (
-	"github.com/ryanbradynd05/go-tmdb"
 	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
 	"gitlab.com/olaris/olaris-server/metadata/agents/agentsfakes"
 	"gitlab.com/olaris/olaris-server/metadata/db"
 	"testing"
@@ -21,19 +21,14 @@ func TestGetOrCreateMovieForMovieFile_SearchByStringDistance(t *testing.T) {
 		},
 	}
 	// This is what TMDB really does and why we have the string distance search feature
-	agent.TmdbSearchMovieStub = func(name string, options map[string]string) (
-		*tmdb.MovieSearchResults, error) {
-		return &tmdb.MovieSearchResults{
-			Results: []tmdb.MovieShort{
-				{Title: "Fear the Walking Dead", ID: 1},
-				{Title: "The Walking Dead", ID: 2},
-			},
-		}, nil
-	}
-	agent.UpdateMovieMDStub = func(movie *db.Movie, tmdbID int) error {
-		if tmdbID == 1 {
+	agent.SearchMovieReturns([]agents.MovieSearchResult{
+		{Title: "Fear the Walking Dead", ID: agents.TmdbID(1)},
+		{Title: "The Walking Dead", ID: agents.TmdbID(2)},
+	}, nil)
+	agent.UpdateMovieMDStub = func(movie *db.Movie, id agents.ExternalID) error {
+		if id == agents.TmdbID(1) {
 			movie.Title = "Fear the Walking Dead"
-		} else if tmdbID == 2 {
+		} else if id == agents.TmdbID(2) {
 			movie.Title = "The Walking Dead"
 		}
 		return nil
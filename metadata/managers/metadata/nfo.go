@@ -0,0 +1,120 @@
+package metadata
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/metadata/nfo"
+	"gitlab.com/olaris/olaris-server/metadata/parsers"
+)
+
+// resolveMovieTmdbID returns the TMDB ID of the movie with the given ID, asking the agents
+// if it's not a TMDB ID.
+func (m *MetadataManager) resolveMovieTmdbID(id agents.ExternalID) (int, error) {
+	return m.resolveTmdbID("movie", id, func(a agents.MetadataRetrievalAgent) (int, error) {
+		var movie db.Movie
+		err := a.UpdateMovieMD(&movie, id)
+		return movie.TmdbID, err
+	})
+}
+
+// resolveSeriesTmdbID returns the TMDB ID of the series with the given ID, asking the agents
+// if it's not a TMDB ID.
+func (m *MetadataManager) resolveSeriesTmdbID(id agents.ExternalID) (int, error) {
+	return m.resolveTmdbID("series", id, func(a agents.MetadataRetrievalAgent) (int, error) {
+		var series db.Series
+		err := a.UpdateSeriesMD(&series, id)
+		return series.TmdbID, err
+	})
+}
+
+// resolveTmdbID asks the agents in order for the TMDB ID of the item with the given ID. Agents
+// that know the item but not its TMDB ID don't count, e.g. the NFO agent for a .nfo file with
+// only an IMDB ID, so that the next agent can look it up.
+func (m *MetadataManager) resolveTmdbID(
+	kind string, id agents.ExternalID, lookup func(a agents.MetadataRetrievalAgent) (int, error)) (int, error) {
+
+	if id.Provider == agents.ProviderTmdb {
+		return id.Int()
+	}
+	for _, a := range m.agents {
+		tmdbID, err := lookup(a)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"agent": a.Name(), "id": id}).
+				Debugln("Agent could not resolve the TMDB ID, trying the next one.")
+			continue
+		}
+		if tmdbID != 0 {
+			return tmdbID, nil
+		}
+	}
+	return 0, errors.Errorf("No TMDB ID for %s %s", kind, id)
+}
+
+// Take a MovieFile object and try to read the TMDB ID from a .nfo file next to it
+func (m *MetadataManager) getMovieTMDBIDFromNfo(
+	movieFile *db.MovieFile) (tmdbID int, nfoFound bool, err error) {
+
+	p, ok := nfo.LocalPath(movieFile.GetFilePath())
+	if !ok {
+		return 0, false, nil
+	}
+	movieNfo, sidecar, ok := nfo.FindMovie(p)
+	if !ok {
+		return 0, false, nil
+	}
+	id, ok := agents.NfoID(movieNfo.ID(nfo.IDTypeTmdb), movieNfo.ID(nfo.IDTypeImdb))
+	if !ok {
+		log.WithField("path", sidecar).Debugln("Ignoring .nfo file without IDs.")
+		return 0, false, nil
+	}
+
+	tmdbID, err = m.resolveMovieTmdbID(id)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "Failed to resolve ID from %s", sidecar)
+	}
+	return tmdbID, true, nil
+}
+
+// Attempt to read the series ID from the tvshow.nfo and the season/episode numbers from the
+// episode's .nfo file, or the filename if there is none.
+// The bool return value indicates whether .nfo information was present for the file
+func (m *MetadataManager) getEpisodeKeyFromNfo(
+	episodeFile *db.EpisodeFile) (*TmdbEpisodeKey, bool, error) {
+
+	p, ok := nfo.LocalPath(episodeFile.GetFilePath())
+	if !ok {
+		return nil, false, nil
+	}
+	showNfo, sidecar, ok := nfo.FindTVShow(p)
+	if !ok {
+		return nil, false, nil
+	}
+	id, ok := agents.NfoID(showNfo.ID(nfo.IDTypeTmdb), showNfo.ID(nfo.IDTypeImdb))
+	if !ok {
+		log.WithField("path", sidecar).Debugln("Ignoring .nfo file without IDs.")
+		return nil, false, nil
+	}
+
+	key := &TmdbEpisodeKey{}
+	if episodeNfo, _, ok := nfo.FindEpisode(p); ok {
+		key.SeasonNumber = episodeNfo.Season
+		key.EpisodeNumber = episodeNfo.Episode
+	} else {
+		parsedInfo := parsers.ParseSeriesName(episodeFile.FilePath)
+		key.SeasonNumber = parsedInfo.SeasonNum
+		key.EpisodeNumber = parsedInfo.EpisodeNum
+	}
+	if key.EpisodeNumber == 0 {
+		log.WithField("path", p).Debugln("Found tvshow.nfo but no episode number.")
+		return nil, false, nil
+	}
+
+	seriesTmdbID, err := m.resolveSeriesTmdbID(id)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Failed to resolve ID from %s", sidecar)
+	}
+	key.TmdbSeriesID = seriesTmdbID
+	return key, true, nil
+}
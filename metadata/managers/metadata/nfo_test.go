@@ -0,0 +1,189 @@
+package metadata
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
+	"gitlab.com/olaris/olaris-server/metadata/agents/agentsfakes"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestGetOrCreateMovieForMovieFile_Nfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db.NewInMemoryDBForTests(false)
+	agent := agentsfakes.FakeMetadataRetrievalAgent{}
+	m := NewMetadataManager(&agent)
+
+	// The filename would match a different movie
+	moviePath := filepath.Join(dir, "Fury.mkv")
+	writeTestFile(t, moviePath, "")
+	writeTestFile(t, filepath.Join(dir, "Fury.nfo"),
+		`<movie><title>Mad Max: Fury Road</title><uniqueid type="tmdb">76341</uniqueid></movie>`)
+
+	movieFile := db.MovieFile{
+		MediaItem: db.MediaItem{FileName: "Fury.mkv", FilePath: "local#" + moviePath},
+	}
+	movie, err := m.GetOrCreateMovieForMovieFile(&movieFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, 76341, movie.TmdbID)
+	assert.Equal(t, 0, agent.SearchMovieCallCount())
+}
+
+func TestGetOrCreateMovieForMovieFile_NfoImdbID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db.NewInMemoryDBForTests(false)
+	agent := agentsfakes.FakeMetadataRetrievalAgent{}
+	agent.UpdateMovieMDStub = func(movie *db.Movie, id agents.ExternalID) error {
+		if id == (agents.ExternalID{Provider: agents.ProviderImdb, ID: "tt1392190"}) || id == agents.TmdbID(76341) {
+			movie.TmdbID = 76341
+			movie.Title = "Mad Max: Fury Road"
+			return nil
+		}
+		return agents.ErrNoMetadata
+	}
+	m := NewMetadataManager(&agent)
+
+	moviePath := filepath.Join(dir, "Mad Max", "Fury.mkv")
+	writeTestFile(t, moviePath, "")
+	writeTestFile(t, filepath.Join(dir, "Mad Max", "movie.nfo"),
+		`<movie><title>Mad Max: Fury Road</title><uniqueid type="imdb">tt1392190</uniqueid></movie>`)
+
+	movieFile := db.MovieFile{
+		MediaItem: db.MediaItem{FileName: "Fury.mkv", FilePath: "local#" + moviePath},
+	}
+	movie, err := m.GetOrCreateMovieForMovieFile(&movieFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, 76341, movie.TmdbID)
+	assert.Equal(t, 0, agent.SearchMovieCallCount())
+}
+
+// newTestTmdbAgent returns a TMDB agent whose API serves the given JSON responses by path.
+func newTestTmdbAgent(responses map[string]string) (*httptest.Server, *agents.TmdbAgent) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status_code": 34, "status_message": "The resource you requested could not be found."}`)
+			return
+		}
+		fmt.Fprint(w, response)
+	}))
+	return server, agents.NewTmdbAgentWithURL(server.URL)
+}
+
+// The NFO agent finds the .nfo file but can't tell the TMDB ID, so TMDB has to look it up.
+func TestGetOrCreateMovieForMovieFile_NfoImdbIDWithTmdb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server, tmdbAgent := newTestTmdbAgent(map[string]string{
+		"/find/tt1392190": `{"movie_results": [{"id": 76341, "title": "Mad Max: Fury Road"}]}`,
+		"/movie/76341":    `{"id": 76341, "title": "Mad Max: Fury Road", "release_date": "2015-05-13", "imdb_id": "tt1392190"}`,
+	})
+	defer server.Close()
+
+	db.NewInMemoryDBForTests(false)
+	m := NewMetadataManager(agents.NewNfoAgent(), tmdbAgent)
+
+	moviePath := filepath.Join(dir, "Mad Max", "Fury.mkv")
+	writeTestFile(t, moviePath, "")
+	writeTestFile(t, filepath.Join(dir, "Mad Max", "movie.nfo"),
+		`<movie><title>Mad Max: Fury Road</title><uniqueid type="imdb">tt1392190</uniqueid></movie>`)
+
+	movieFile := db.MovieFile{
+		MediaItem: db.MediaItem{FileName: "Fury.mkv", FilePath: "local#" + moviePath},
+	}
+	db.SaveMovieFile(&movieFile)
+	movie, err := m.GetOrCreateMovieForMovieFile(&movieFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, 76341, movie.TmdbID)
+	assert.Equal(t, "Mad Max: Fury Road", movie.Title)
+}
+
+// A .nfo file with only a title overrides the title, everything else comes from TMDB.
+func TestGetOrCreateMovieForMovieFile_NfoTitleOnlyWithTmdbArt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server, tmdbAgent := newTestTmdbAgent(map[string]string{
+		"/movie/76341": `{"id": 76341, "title": "Mad Max: Fury Road", "release_date": "2015-05-13",
+			"overview": "An apocalyptic story.", "poster_path": "/poster.jpg", "backdrop_path": "/backdrop.jpg"}`,
+	})
+	defer server.Close()
+
+	db.NewInMemoryDBForTests(false)
+	m := NewMetadataManager(agents.NewNfoAgent(), tmdbAgent)
+
+	moviePath := filepath.Join(dir, "Fury.mkv")
+	writeTestFile(t, moviePath, "")
+	writeTestFile(t, filepath.Join(dir, "Fury.nfo"),
+		`<movie><title>Fury Road: Black and Chrome</title><uniqueid type="tmdb">76341</uniqueid></movie>`)
+
+	movieFile := db.MovieFile{
+		MediaItem: db.MediaItem{FileName: "Fury.mkv", FilePath: "local#" + moviePath},
+	}
+	db.SaveMovieFile(&movieFile)
+	movie, err := m.GetOrCreateMovieForMovieFile(&movieFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Fury Road: Black and Chrome", movie.Title)
+	assert.Equal(t, "An apocalyptic story.", movie.Overview)
+	assert.Equal(t, "/poster.jpg", movie.PosterPath)
+	assert.Equal(t, "/backdrop.jpg", movie.BackdropPath)
+	assert.EqualValues(t, 2015, movie.Year)
+}
+
+func TestGetOrCreateEpisodeForEpisodeFile_Nfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db.NewInMemoryDBForTests(false)
+	agent := agentsfakes.FakeMetadataRetrievalAgent{}
+	m := NewMetadataManager(&agent)
+
+	// Neither the filename nor the directory names say which episode this is.
+	episodePath := filepath.Join(dir, "The Walking Dead", "Season 1", "pilot.mkv")
+	writeTestFile(t, episodePath, "")
+	writeTestFile(t, filepath.Join(dir, "The Walking Dead", "tvshow.nfo"),
+		`<tvshow><title>The Walking Dead</title><uniqueid type="tmdb">1402</uniqueid></tvshow>`)
+	writeTestFile(t, filepath.Join(dir, "The Walking Dead", "Season 1", "pilot.nfo"),
+		`<episodedetails><title>Days Gone Bye</title><season>1</season><episode>1</episode></episodedetails>`)
+
+	episodeFile := db.EpisodeFile{
+		MediaItem: db.MediaItem{FileName: "pilot.mkv", FilePath: "local#" + episodePath},
+	}
+	episode, err := m.GetOrCreateEpisodeForEpisodeFile(&episodeFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, episode.EpisodeNum)
+	assert.Equal(t, 0, agent.SearchSeriesCallCount())
+	_, seriesID, seasonNum, episodeNum := agent.UpdateEpisodeMDArgsForCall(0)
+	assert.Equal(t, agents.TmdbID(1402), seriesID)
+	assert.Equal(t, 1, seasonNum)
+	assert.Equal(t, 1, episodeNum)
+}
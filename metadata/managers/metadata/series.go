@@ -6,9 +6,11 @@ import (
 	"gitlab.com/olaris/olaris-server/filesystem"
 	"gitlab.com/olaris/olaris-server/helpers"
 	"gitlab.com/olaris/olaris-server/helpers/levenshtein"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
 	"gitlab.com/olaris/olaris-server/metadata/db"
 	"gitlab.com/olaris/olaris-server/metadata/parsers"
 	"math"
+	"strconv"
 	"sync"
 )
 
@@ -40,7 +42,7 @@ func (m *MetadataManager) getSeriesLock(seriesID uint) *sync.RWMutex {
 // RefreshAllSeriesMetadata refreshes all data from the agent and updates the database record.
 // TODO(Leon Handreke): Queue these updates async
 func (m *MetadataManager) RefreshAllSeriesMetadata() {
-	series, err := db.FindAllSeries(nil)
+	series, err := db.FindAllSeries(nil, db.FullLibraryAccess)
 	if err != nil {
 
 		log.WithField("error", err.Error()).
@@ -78,7 +80,10 @@ func (m *MetadataManager) RefreshSeriesMetadata(series *db.Series) error {
 
 // refreshSeriesMetadataFromAgent refreshes metadata but does not save.
 func (m *MetadataManager) refreshSeriesMetadataFromAgent(series *db.Series) error {
-	return m.agent.UpdateSeriesMD(series, series.TmdbID)
+	return m.updateFromAgents(series, func(a agents.MetadataRetrievalAgent, item interface{}) error {
+		series := item.(*db.Series)
+		return a.UpdateSeriesMD(series, agents.TmdbID(series.TmdbID))
+	})
 }
 
 func (m *MetadataManager) RefreshEpisodeMetadata(ep *db.Episode) error {
@@ -98,8 +103,11 @@ func (m *MetadataManager) RefreshEpisodeMetadata(ep *db.Episode) error {
 
 // refreshEpisodeMetadataFromAgent updates the database record with the latest data from the agent
 func (m *MetadataManager) refreshEpisodeMetadataFromAgent(ep *db.Episode) error {
-	return m.agent.UpdateEpisodeMD(ep,
-		ep.GetSeries().TmdbID, ep.GetSeason().SeasonNumber, ep.EpisodeNum)
+	seriesID := agents.TmdbID(ep.GetSeries().TmdbID)
+	seasonNum := ep.GetSeason().SeasonNumber
+	return m.updateFromAgents(ep, func(a agents.MetadataRetrievalAgent, item interface{}) error {
+		return a.UpdateEpisodeMD(item.(*db.Episode), seriesID, seasonNum, ep.EpisodeNum)
+	})
 }
 
 // RefreshSeasonMetadata refreshes and saves season metadata
@@ -115,8 +123,11 @@ func (m *MetadataManager) RefreshSeasonMetadata(season *db.Season) error {
 
 // refreshSeasonMetadataFromAgent refreshes metadata from the agent but does not save
 func (m *MetadataManager) refreshSeasonMetadataFromAgent(season *db.Season) error {
-	if err := m.agent.UpdateSeasonMD(
-		season, season.GetSeries().TmdbID, season.SeasonNumber); err != nil {
+	seriesID := agents.TmdbID(season.GetSeries().TmdbID)
+	err := m.updateFromAgents(season, func(a agents.MetadataRetrievalAgent, item interface{}) error {
+		return a.UpdateSeasonMD(item.(*db.Season), seriesID, season.SeasonNumber)
+	})
+	if err != nil {
 		return errors.Wrapf(err,
 			"Failed to refresh metadata from agent for Season %s", season.UUID)
 	}
@@ -131,15 +142,16 @@ func (m *MetadataManager) getEpisodeKeyFromFilename(
 	parsedInfo := parsers.ParseSeriesName(episodeFile.FilePath)
 
 	// Find a series for this Episode
-	var options = make(map[string]string)
-	if parsedInfo.Year != "" {
-		options["first_air_date_year"] = parsedInfo.Year
-	}
-	searchRes, err := m.agent.TmdbSearchTv(parsedInfo.Title, options)
+	firstAirYear, _ := strconv.Atoi(parsedInfo.Year)
+	searchRes, err := m.SearchSeries(agents.SeriesQuery{
+		Name:         parsedInfo.Title,
+		FirstAirYear: firstAirYear,
+		FilePath:     episodeFile.FilePath,
+	})
 	if err != nil {
 		return nil, err
 	}
-	if len(searchRes.Results) == 0 {
+	if len(searchRes) == 0 {
 		log.WithFields(log.Fields{
 			"title": parsedInfo.Title,
 			"year":  parsedInfo.Year,
@@ -149,18 +161,20 @@ func (m *MetadataManager) getEpisodeKeyFromFilename(
 	}
 
 	var bestDistance = math.MaxInt32
-	// We use the index here because the type is really long.
-	var bestResultIdx int
-	for i, r := range searchRes.Results {
+	var seriesInfo agents.SeriesSearchResult
+	for _, r := range searchRes {
 		d := levenshtein.ComputeDistance(parsedInfo.Title, r.Name)
 		if d < bestDistance {
 			bestDistance = d
-			bestResultIdx = i
+			seriesInfo = r
 		}
 	}
-	seriesInfo := searchRes.Results[bestResultIdx]
+	seriesTmdbID, err := seriesInfo.ID.Int()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid TMDB ID %s", seriesInfo.ID)
+	}
 
-	return &TmdbEpisodeKey{TmdbSeriesID: seriesInfo.ID, SeasonNumber: parsedInfo.SeasonNum, EpisodeNumber: parsedInfo.EpisodeNum}, nil
+	return &TmdbEpisodeKey{TmdbSeriesID: seriesTmdbID, SeasonNumber: parsedInfo.SeasonNum, EpisodeNumber: parsedInfo.EpisodeNum}, nil
 
 }
 
@@ -189,6 +203,20 @@ func (m *MetadataManager) getEpisodeKeyFromXattr(
 }
 
 func (m *MetadataManager) getEpisodeKey(episodeFile *db.EpisodeFile) (*TmdbEpisodeKey, error) {
+	episodeKey, nfoFound, err := m.getEpisodeKeyFromNfo(episodeFile)
+	if err != nil {
+		// A broken .nfo file shouldn't keep us from identifying the episode some other way.
+		log.WithError(err).WithField("filename", episodeFile.FileName).
+			Warnln("Failed to identify episode from .nfo file")
+	} else if nfoFound {
+		log.Debugln(
+			"read .nfo for TMDB series ID", episodeKey.TmdbSeriesID,
+			"season", episodeKey.SeasonNumber,
+			"episode", episodeKey.EpisodeNumber,
+			"from filename", episodeFile.FileName)
+		return episodeKey, nil
+	}
+
 	episodeKey, xattrInfoFound, err := m.getEpisodeKeyFromXattr(episodeFile)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,81 @@
+package managers
+
+import (
+	"encoding/json"
+	"time"
+
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// DatabaseProbeStore persists ffprobe results in the database.
+type DatabaseProbeStore struct{}
+
+// LoadProbeResult returns the stored result for the given file, nil if there is none.
+func (DatabaseProbeStore) LoadProbeResult(fileLocator filesystem.FileLocator) (*ffmpeg.ProbeResult, error) {
+	entry, err := db.FindProbeCacheEntry(fileLocator.String())
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	result := &ffmpeg.ProbeResult{
+		FileLocator: fileLocator,
+		Size:        entry.Size,
+		ModTime:     time.Unix(0, entry.ModTimeUnixNano),
+	}
+	if err := json.Unmarshal([]byte(entry.Container), &result.Container); err != nil {
+		return nil, err
+	}
+	if entry.Keyframes != "" {
+		if err := json.Unmarshal([]byte(entry.Keyframes), &result.Keyframes); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// SaveProbeResult stores the result, replacing any previous result for the file.
+func (DatabaseProbeStore) SaveProbeResult(result *ffmpeg.ProbeResult) error {
+	container := result.Container
+	container.Streams = make([]ffmpeg.ProbeStream, len(result.Container.Streams))
+	for i, s := range result.Container.Streams {
+		// The extradata of attachments is the attached file itself, e.g. a font, which we never need.
+		if s.CodecType == "attachment" {
+			s.Extradata = ""
+		}
+		container.Streams[i] = s
+	}
+	containerJSON, err := json.Marshal(container)
+	if err != nil {
+		return err
+	}
+
+	entry := db.ProbeCacheEntry{
+		FilePath:        result.FileLocator.String(),
+		Size:            result.Size,
+		ModTimeUnixNano: result.ModTime.UnixNano(),
+		Container:       string(containerJSON),
+	}
+	if result.Keyframes != nil {
+		keyframesJSON, err := json.Marshal(result.Keyframes)
+		if err != nil {
+			return err
+		}
+		entry.Keyframes = string(keyframesJSON)
+	}
+	if err := db.SaveProbeCacheEntry(&entry); err != nil {
+		return err
+	}
+
+	// Files that were added before their chapters were probed get them when they are probed again.
+	if result.Container.Chapters == nil {
+		return nil
+	}
+	return db.ReplaceChaptersForFilePath(result.FileLocator.String(), collectChapters(result.Container.ParseChapters()))
+}
+
+// DeleteProbeResult deletes the stored result for the given file.
+func (DatabaseProbeStore) DeleteProbeResult(fileLocator filesystem.FileLocator) error {
+	return db.DeleteProbeCacheEntry(fileLocator.String())
+}
@@ -0,0 +1,117 @@
+package managers
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestDatabaseProbeStore(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	store := DatabaseProbeStore{}
+	fileLocator := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/movies/movie.mkv"}
+
+	result, err := store.LoadProbeResult(fileLocator)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	// Filesystems have modification times with nanoseconds, which must survive the database.
+	modTime := time.Date(2026, 10, 17, 12, 0, 0, 123456789, time.UTC)
+	saved := &ffmpeg.ProbeResult{
+		FileLocator: fileLocator,
+		Size:        1234,
+		ModTime:     modTime,
+		Container: ffmpeg.ProbeContainer{
+			Streams: []ffmpeg.ProbeStream{
+				{Index: 0, CodecType: "video", CodecName: "h264", Extradata: "00000000: 0164 001f"},
+				{Index: 1, CodecType: "attachment", CodecName: "ttf", Extradata: "00000000: 0001 0000"},
+			},
+		},
+	}
+	require.NoError(t, store.SaveProbeResult(saved))
+
+	result, err = store.LoadProbeResult(fileLocator)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.EqualValues(t, 1234, result.Size)
+	assert.True(t, modTime.Equal(result.ModTime), "%s != %s", modTime, result.ModTime)
+	assert.Equal(t, "00000000: 0164 001f", result.Container.Streams[0].Extradata)
+	assert.Empty(t, result.Container.Streams[1].Extradata)
+	assert.Nil(t, result.Keyframes)
+
+	// Saving again replaces the result, e.g. once the keyframes are known.
+	saved.Keyframes = []time.Duration{0, 2 * time.Second}
+	require.NoError(t, store.SaveProbeResult(saved))
+	result, err = store.LoadProbeResult(fileLocator)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{0, 2 * time.Second}, result.Keyframes)
+
+	require.NoError(t, store.DeleteProbeResult(fileLocator))
+	result, err = store.LoadProbeResult(fileLocator)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestDatabaseProbeStore_Chapters(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	store := DatabaseProbeStore{}
+	fileLocator := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/movies/movie.mkv"}
+	movieFile := db.MovieFile{MediaItem: db.MediaItem{FilePath: fileLocator.String()}}
+	db.SaveMovieFile(&movieFile)
+
+	result := &ffmpeg.ProbeResult{FileLocator: fileLocator}
+	require.NoError(t, store.SaveProbeResult(result))
+	assert.Empty(t, db.FindChaptersForMovieFile(movieFile.ID))
+
+	result.Container.Chapters = []ffmpeg.ProbeChapter{
+		{ID: 1, StartTimeSeconds: 300, EndTimeSeconds: 600, Tags: map[string]string{"title": "The Heist"}},
+		{ID: 0, StartTimeSeconds: 0, EndTimeSeconds: 300, Tags: map[string]string{"title": "Opening"}},
+	}
+	require.NoError(t, store.SaveProbeResult(result))
+	// Saving again, e.g. once the keyframes are known, doesn't duplicate them.
+	require.NoError(t, store.SaveProbeResult(result))
+
+	chapters := db.FindChaptersForMovieFile(movieFile.ID)
+	if assert.Len(t, chapters, 2) {
+		assert.Equal(t, "Opening", chapters[0].Title)
+		assert.Equal(t, 300*time.Second, chapters[0].End)
+		assert.Equal(t, "The Heist", chapters[1].Title)
+		assert.Equal(t, 300*time.Second, chapters[1].Start)
+	}
+
+	movieFile.DeleteWithStreams()
+	assert.Empty(t, db.FindChaptersForMovieFile(movieFile.ID))
+}
+
+func TestDatabaseProbeStore_CurrentAfterRestart(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	ffmpeg.SetProbeStore(DatabaseProbeStore{})
+	defer ffmpeg.SetProbeStore(nil)
+
+	file := path.Join(t.TempDir(), "movie.mkv")
+	require.NoError(t, ioutil.WriteFile(file, []byte("not a movie"), 0644))
+	modTime := time.Date(2026, 10, 17, 12, 0, 0, 123456789, time.UTC)
+	require.NoError(t, os.Chtimes(file, modTime, modTime))
+	node, err := filesystem.LocalNodeFromPath(file)
+	require.NoError(t, err)
+
+	require.NoError(t, DatabaseProbeStore{}.SaveProbeResult(&ffmpeg.ProbeResult{
+		FileLocator: node.FileLocator(),
+		Size:        node.Size(),
+		ModTime:     node.ModTime(),
+		Container:   ffmpeg.ProbeContainer{Chapters: []ffmpeg.ProbeChapter{}},
+	}))
+
+	// Only the database has the result after a restart.
+	ffmpeg.SetProbeStore(DatabaseProbeStore{})
+	assert.True(t, ffmpeg.HasCurrentProbeResult(node))
+	assert.False(t, ffmpeg.HasStaleProbeResult(node))
+}
@@ -0,0 +1,186 @@
+package managers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/metadata/subtitles"
+)
+
+// How long search results are remembered. Downloading needs the language and markers of a result,
+// which providers only return when searching.
+const subtitleResultTTL = time.Hour
+
+type cachedSubtitleResult struct {
+	result  subtitles.Result
+	expires time.Time
+}
+
+// SubtitleManager searches the configured providers for subtitles of media files and stores the
+// downloaded ones as extra streams of the files.
+type SubtitleManager struct {
+	providers []subtitles.Provider
+
+	mtx     sync.Mutex
+	results map[string]cachedSubtitleResult
+}
+
+// NewSubtitleManager creates a manager that uses the given providers, in order.
+func NewSubtitleManager(providers ...subtitles.Provider) *SubtitleManager {
+	return &SubtitleManager{
+		providers: providers,
+		results:   map[string]cachedSubtitleResult{},
+	}
+}
+
+// HasProviders returns whether any subtitle providers are configured.
+func (man *SubtitleManager) HasProviders() bool {
+	return len(man.providers) > 0
+}
+
+// Search asks all providers for subtitles of the given file in the given languages.
+func (man *SubtitleManager) Search(file db.MediaFile, languages []string) ([]subtitles.Result, error) {
+	if !man.HasProviders() {
+		return nil, fmt.Errorf("no subtitle providers are configured")
+	}
+	query, err := subtitleQueryForFile(file)
+	if err != nil {
+		return nil, err
+	}
+	query.Languages = languages
+
+	results := []subtitles.Result{}
+	var lastErr error
+	for _, p := range man.providers {
+		res, err := p.Search(query)
+		if err != nil {
+			log.WithError(err).WithField("provider", p.Name()).Warnln("Failed to search for subtitles")
+			lastErr = err
+			continue
+		}
+		results = append(results, res...)
+	}
+	if len(results) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	man.mtx.Lock()
+	defer man.mtx.Unlock()
+	now := time.Now()
+	for key, cached := range man.results {
+		if now.After(cached.expires) {
+			delete(man.results, key)
+		}
+	}
+	for _, r := range results {
+		man.results[subtitleResultKey(file, r.Provider, r.ID)] = cachedSubtitleResult{result: r, expires: now.Add(subtitleResultTTL)}
+	}
+	return results, nil
+}
+
+// Download fetches a subtitle found by Search for the given file, saves it in the cache directory
+// and adds it to the streams of the file.
+func (man *SubtitleManager) Download(file db.MediaFile, provider string, id string) (*db.Stream, error) {
+	man.mtx.Lock()
+	cached, ok := man.results[subtitleResultKey(file, provider, id)]
+	man.mtx.Unlock()
+	if !ok || time.Now().After(cached.expires) {
+		return nil, fmt.Errorf("unknown subtitle, search for subtitles of this file again")
+	}
+
+	var p subtitles.Provider
+	for _, candidate := range man.providers {
+		if candidate.Name() == provider {
+			p = candidate
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf("no subtitle provider \"%s\"", provider)
+	}
+
+	fileLocator, err := filesystem.ParseFileLocator(file.GetFilePath())
+	if err != nil {
+		return nil, err
+	}
+	fileName, data, err := p.Download(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := ffmpeg.SaveDownloadedSubtitle(fileLocator, ffmpeg.DownloadedSubtitle{
+		ID:              provider + "-" + id,
+		FileName:        fileName,
+		Language:        cached.result.Language,
+		Forced:          cached.result.Forced,
+		HearingImpaired: cached.result.HearingImpaired,
+		Data:            data,
+	}, videoDuration(file.GetStreams()))
+	if err != nil {
+		return nil, err
+	}
+
+	dbStream := DatabaseStreamFromFfmpegStream(stream)
+	switch f := file.(type) {
+	case db.MovieFile:
+		dbStream.OwnerID = f.ID
+		dbStream.OwnerType = "movie_files"
+	case db.EpisodeFile:
+		dbStream.OwnerID = f.ID
+		dbStream.OwnerType = "episode_files"
+	}
+	db.CreateStream(&dbStream)
+	return &dbStream, nil
+}
+
+// subtitleResultKey identifies a search result for a file, so that the subtitles found for one
+// file can't be downloaded for another.
+func subtitleResultKey(file db.MediaFile, provider string, id string) string {
+	return fmt.Sprintf("%s|%s:%s", file.GetFilePath(), provider, id)
+}
+
+// subtitleQueryForFile describes the given file to the providers.
+func subtitleQueryForFile(file db.MediaFile) (subtitles.Query, error) {
+	query := subtitles.Query{}
+
+	fileLocator, err := filesystem.ParseFileLocator(file.GetFilePath())
+	if err != nil {
+		return query, err
+	}
+	if hash, err := subtitles.FileHash(fileLocator); err == nil {
+		query.Hash = hash
+	} else {
+		log.WithError(err).WithField("filePath", file.GetFilePath()).Debugln("Failed to hash file")
+	}
+
+	switch f := file.(type) {
+	case db.MovieFile:
+		movie, err := db.FindMovieForMovieFile(&f)
+		if err != nil {
+			return query, err
+		}
+		query.TmdbID = movie.TmdbID
+		query.ImdbID = movie.ImdbID
+	case db.EpisodeFile:
+		episode, err := db.FindEpisodeByID(f.EpisodeID)
+		if err != nil {
+			return query, err
+		}
+		season, err := db.FindSeason(episode.SeasonID)
+		if err != nil {
+			return query, err
+		}
+		series, err := db.FindSeries(season.SeriesID)
+		if err != nil {
+			return query, err
+		}
+		query.SeriesTmdbID = series.TmdbID
+		query.SeasonNum = episode.SeasonNum
+		query.EpisodeNum = episode.EpisodeNum
+	}
+	return query, nil
+}
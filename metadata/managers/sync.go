@@ -0,0 +1,194 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/helpers"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// This is a variable so that tests can do without ffmpeg.
+var syncTranscode = ffmpeg.SyncTranscode
+
+// How much the progress of a sync job has to change before it's saved.
+const syncProgressStep = 0.01
+
+// SyncManager runs the sync jobs that create offline copies of files, one at a time because
+// transcoding a whole file takes all the CPU it can get. The queue is kept in the database, so
+// jobs survive restarts.
+type SyncManager struct {
+	outputDir string
+	wake      chan struct{}
+
+	mtx sync.Mutex
+	// The running job and how to stop it
+	runningID uint
+	cancel    context.CancelFunc
+}
+
+var syncManager *SyncManager
+var syncManagerOnce sync.Once
+
+// GetSyncManager returns the sync manager that stores offline copies in the configured sync
+// directory. It's started by the server, see Start.
+func GetSyncManager() *SyncManager {
+	syncManagerOnce.Do(func() {
+		syncManager = NewSyncManager(viper.GetString("server.syncDir"))
+	})
+	return syncManager
+}
+
+// NewSyncManager creates a sync manager, jobs are queued but not processed until it's started.
+// Finished files are stored in outputDir, which defaults to a directory in the config directory.
+func NewSyncManager(outputDir string) *SyncManager {
+	if outputDir == "" {
+		outputDir = path.Join(helpers.BaseConfigDir(), "sync")
+	}
+	return &SyncManager{
+		outputDir: outputDir,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Start starts processing the queued sync jobs, including the ones interrupted by a restart.
+func (man *SyncManager) Start() {
+	if err := db.RequeueRunningSyncJobs(); err != nil {
+		log.WithError(err).Warnln("Failed to requeue interrupted sync jobs")
+	}
+	go man.run()
+}
+
+// Queue adds a job to the queue.
+func (man *SyncManager) Queue(job *db.SyncJob) error {
+	if err := db.CreateSyncJob(job); err != nil {
+		return err
+	}
+	select {
+	case man.wake <- struct{}{}:
+	default:
+		// Already woken up
+	}
+	return nil
+}
+
+func (man *SyncManager) run() {
+	for {
+		job := db.NextQueuedSyncJob()
+		if job == nil {
+			<-man.wake
+			continue
+		}
+		man.process(job)
+	}
+}
+
+func (man *SyncManager) process(job *db.SyncJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	man.mtx.Lock()
+	man.runningID = job.ID
+	man.cancel = cancel
+	man.mtx.Unlock()
+	defer func() {
+		man.mtx.Lock()
+		man.runningID = 0
+		man.cancel = nil
+		man.mtx.Unlock()
+	}()
+
+	job.OutputPath = path.Join(man.outputDir, job.UUID+".mp4")
+	if !db.StartSyncJob(job) {
+		return
+	}
+	logger := log.WithFields(log.Fields{"syncJob": job.UUID, "filePath": job.FilePath, "preset": job.Preset})
+	logger.Infoln("Starting sync job")
+
+	err := man.transcode(ctx, job)
+	switch {
+	case ctx.Err() != nil:
+		// Cancelled or deleted, see Cancel
+		logger.Infoln("Sync job cancelled")
+		return
+	case err != nil:
+		logger.WithError(err).Warnln("Sync job failed")
+		job.State = db.SyncJobFailed
+		job.Error = err.Error()
+	default:
+		logger.Infoln("Sync job done")
+		job.State = db.SyncJobDone
+		job.Progress = 1
+		if stat, err := os.Stat(job.OutputPath); err == nil {
+			job.Size = stat.Size()
+		}
+	}
+	if err := db.FinishSyncJob(job); err != nil {
+		logger.WithError(err).Warnln("Failed to save sync job")
+	}
+}
+
+func (man *SyncManager) transcode(ctx context.Context, job *db.SyncJob) error {
+	fileLocator, err := filesystem.ParseFileLocator(job.FilePath)
+	if err != nil {
+		return err
+	}
+	if err := helpers.EnsurePath(man.outputDir); err != nil {
+		return err
+	}
+
+	// Transcode to a temporary file so that a half-finished file is never downloaded.
+	tmpPath := job.OutputPath + ".tmp"
+	defer os.Remove(tmpPath)
+
+	var savedProgress float64
+	err = syncTranscode(ctx, fileLocator, job.Preset, tmpPath, func(progress float64) {
+		if progress-savedProgress >= syncProgressStep {
+			savedProgress = progress
+			db.UpdateSyncJobProgress(job.ID, progress)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, job.OutputPath)
+}
+
+// Cancel stops the given job if it's still queued or running.
+func (man *SyncManager) Cancel(job *db.SyncJob) error {
+	cancelled, err := db.CancelSyncJob(job)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return fmt.Errorf("sync job has already finished")
+	}
+	man.stop(job)
+	return nil
+}
+
+// Delete cancels the given job and removes it along with its output.
+func (man *SyncManager) Delete(job *db.SyncJob) error {
+	man.stop(job)
+	if job.OutputPath != "" {
+		if err := os.Remove(job.OutputPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return db.DeleteSyncJob(job)
+}
+
+// stop stops ffmpeg if the given job is running.
+func (man *SyncManager) stop(job *db.SyncJob) {
+	man.mtx.Lock()
+	defer man.mtx.Unlock()
+	if man.runningID == job.ID && man.cancel != nil {
+		man.cancel()
+	}
+}
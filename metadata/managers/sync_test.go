@@ -0,0 +1,90 @@
+package managers
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func waitForSyncJobState(t *testing.T, job *db.SyncJob, state string) *db.SyncJob {
+	var found *db.SyncJob
+	require.Eventually(t, func() bool {
+		var err error
+		found, err = db.FindSyncJobByUUID(job.UUID)
+		return err == nil && found.State == state
+	}, 5*time.Second, 10*time.Millisecond)
+	return found
+}
+
+func TestSyncManager(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	dir := t.TempDir()
+
+	started := make(chan struct{})
+	syncTranscode = func(ctx context.Context, l filesystem.FileLocator, preset string, out string, progress func(float64)) error {
+		if preset == "blocking" {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		progress(0.5)
+		return os.WriteFile(out, []byte(l.String()), 0644)
+	}
+	defer func() { syncTranscode = ffmpeg.SyncTranscode }()
+
+	man := NewSyncManager(dir)
+	man.Start()
+
+	job := &db.SyncJob{UserID: 1, FilePath: "local#/movies/movie.mkv", Preset: "720-5000k-video"}
+	require.NoError(t, man.Queue(job))
+	done := waitForSyncJobState(t, job, db.SyncJobDone)
+	assert.Equal(t, 1.0, done.Progress)
+	assert.Equal(t, path.Join(dir, job.UUID+".mp4"), done.OutputPath)
+	assert.EqualValues(t, len("local#/movies/movie.mkv"), done.Size)
+	assert.Error(t, man.Cancel(done), "finished jobs can't be cancelled")
+
+	require.NoError(t, man.Delete(done))
+	_, err := os.Stat(done.OutputPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = db.FindSyncJobByUUID(job.UUID)
+	assert.Error(t, err)
+
+	blocking := &db.SyncJob{UserID: 1, FilePath: "local#/movies/movie.mkv", Preset: "blocking"}
+	require.NoError(t, man.Queue(blocking))
+	<-started
+	require.NoError(t, man.Cancel(blocking))
+	waitForSyncJobState(t, blocking, db.SyncJobCancelled)
+
+	// The manager keeps going after a cancelled job.
+	next := &db.SyncJob{UserID: 1, FilePath: "local#/movies/other.mkv", Preset: "720-5000k-video"}
+	require.NoError(t, man.Queue(next))
+	waitForSyncJobState(t, next, db.SyncJobDone)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "only the finished file should be left, no temporary files")
+}
+
+func TestSyncManagerFailure(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+
+	syncTranscode = func(context.Context, filesystem.FileLocator, string, string, func(float64)) error {
+		return os.ErrPermission
+	}
+	defer func() { syncTranscode = ffmpeg.SyncTranscode }()
+
+	man := NewSyncManager(t.TempDir())
+	man.Start()
+	job := &db.SyncJob{UserID: 1, FilePath: "local#/movies/movie.mkv", Preset: "720-5000k-video"}
+	require.NoError(t, man.Queue(job))
+	failed := waitForSyncJobState(t, job, db.SyncJobFailed)
+	assert.Equal(t, os.ErrPermission.Error(), failed.Error)
+}
@@ -1,35 +1,185 @@
 package managers
 
 import (
+	"sync"
+
 	"github.com/Jeffail/tunny"
 	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
 )
 
+// At most this many files wait for trickplay thumbnails, more are left for the next library scan.
+const trickplayQueueSize = 4096
+
+// These are variables so that tests can do without ffmpeg.
+var generateTrickplay = ffmpeg.GenerateTrickplay
+var probeKeyframes = ffmpeg.ProbeKeyframes
+
 // WorkerPool is a container for the various workers that a library needs
 type WorkerPool struct {
-	probePool *tunny.Pool
+	probePool    *tunny.Pool
+	analysisPool *tunny.Pool
+
+	// Files waiting for trickplay thumbnails and keyframes. One worker handles them, generating
+	// thumbnails decodes the whole file.
+	trickplayQueue chan *trickplayJob
+
+	mtx sync.Mutex
+	// Files in trickplayQueue or being worked on, so that rescans don't queue them again.
+	queuedTrickplay map[string]bool
+	// Number of probe jobs queued or running. probingDone is signalled when it drops to 0.
+	probing     int
+	probingDone *sync.Cond
+	closed      bool
+	done        chan struct{}
 }
 
 // Shutdown properly shuts down the WP
 func (p *WorkerPool) Shutdown() {
 	log.Debugln("Shutting down worker pool")
 	p.probePool.Close()
+	p.analysisPool.Close()
+
+	p.mtx.Lock()
+	p.closed = true
+	p.probingDone.Broadcast()
+	close(p.done)
+	p.mtx.Unlock()
 	log.Debugln("Pool shut down")
 }
 
 // NewDefaultWorkerPool needs a description
 func NewDefaultWorkerPool() *WorkerPool {
-	p := &WorkerPool{}
+	return newWorkerPool(trickplayQueueSize)
+}
+
+func newWorkerPool(trickplayQueueSize int) *WorkerPool {
+	p := &WorkerPool{
+		trickplayQueue:  make(chan *trickplayJob, trickplayQueueSize),
+		queuedTrickplay: map[string]bool{},
+		done:            make(chan struct{}),
+	}
+	p.probingDone = sync.NewCond(&p.mtx)
 
 	p.probePool = tunny.NewFunc(4, func(payload interface{}) interface{} {
 		log.Debugln("current probe queue length:", p.probePool.QueueLength())
-		if job, ok := payload.(*probeJob); ok {
+		switch job := payload.(type) {
+		case *probeJob:
 			job.man.ProbeFile(job.node)
-		} else {
+		case *probeCacheJob:
+			if _, err := ffmpeg.Probe(job.fileLocator); err != nil {
+				log.WithError(err).WithField("fileLocator", job.fileLocator).
+					Debugln("Failed to probe file")
+			}
+		default:
 			log.Warnln("Got a ProbeJob that couldn't be cast as such, refreshing library might fail.")
 		}
 		return nil
 	})
 
+	p.analysisPool = tunny.NewFunc(1, func(payload interface{}) interface{} {
+		p.waitForProbing()
+
+		if job, ok := payload.(*markerAnalysisJob); ok {
+			AnalyzeSeasonMarkers(job.seasonID)
+		} else {
+			log.Warnln("Got a MarkerAnalysisJob that couldn't be cast as such.")
+		}
+		return nil
+	})
+
+	go p.runTrickplayJobs()
+
 	return p
 }
+
+// queueProbe probes a file in the probe pool. Files waiting to be probed hold back trickplay and
+// marker analysis, see waitForProbing.
+func (p *WorkerPool) queueProbe(job interface{}) {
+	p.mtx.Lock()
+	p.probing++
+	p.mtx.Unlock()
+
+	// This is really annoying however when a tunny job is added to a closed pool it will throw a panic
+	// Right now a job can still be running when we delete a library this recover catches the fact that the pool is closed but we are still queuing up
+	// TODO: Somebody smarter than me figure out a better way of doing this
+	go func() {
+		defer checkPanic()
+		defer p.probeFinished()
+		p.probePool.Process(job)
+	}()
+}
+
+func (p *WorkerPool) probeFinished() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.probing--
+	if p.probing == 0 {
+		p.probingDone.Broadcast()
+	}
+}
+
+// waitForProbing blocks until no more files are waiting to be probed or the pool is shut down.
+func (p *WorkerPool) waitForProbing() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for p.probing > 0 && !p.closed {
+		p.probingDone.Wait()
+	}
+}
+
+// queueTrickplay queues generating trickplay thumbnails and finding the keyframes of a file. It
+// returns false if the file wasn't queued because the queue is full.
+func (p *WorkerPool) queueTrickplay(fileLocator filesystem.FileLocator) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.closed || p.queuedTrickplay[fileLocator.String()] {
+		return true
+	}
+
+	select {
+	case p.trickplayQueue <- &trickplayJob{fileLocator: fileLocator}:
+		p.queuedTrickplay[fileLocator.String()] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// runTrickplayJobs works through the trickplay queue, letting probing go first.
+func (p *WorkerPool) runTrickplayJobs() {
+	for {
+		select {
+		case job := <-p.trickplayQueue:
+			p.waitForProbing()
+			select {
+			case <-p.done:
+				return
+			default:
+			}
+
+			log.Debugln("current trickplay queue length:", len(p.trickplayQueue))
+			processTrickplayJob(job)
+
+			p.mtx.Lock()
+			delete(p.queuedTrickplay, job.fileLocator.String())
+			p.mtx.Unlock()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func processTrickplayJob(job *trickplayJob) {
+	if !ffmpeg.HasTrickplay(job.fileLocator) {
+		if err := generateTrickplay(job.fileLocator); err != nil {
+			log.WithError(err).WithField("fileLocator", job.fileLocator).
+				Warnln("Failed to generate trickplay thumbnails")
+		}
+	}
+	if _, err := probeKeyframes(job.fileLocator); err != nil {
+		log.WithError(err).WithField("fileLocator", job.fileLocator).
+			Warnln("Failed to find keyframes")
+	}
+}
@@ -0,0 +1,53 @@
+package managers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+func TestTrickplayQueue(t *testing.T) {
+	generated := make(chan string, 10)
+	generateTrickplay = func(l filesystem.FileLocator) error {
+		generated <- l.Path
+		return nil
+	}
+	probeKeyframes = func(l filesystem.FileLocator) ([]time.Duration, error) {
+		return nil, nil
+	}
+	defer func() {
+		generateTrickplay = ffmpeg.GenerateTrickplay
+		probeKeyframes = ffmpeg.ProbeKeyframes
+	}()
+
+	p := newWorkerPool(1)
+	defer p.Shutdown()
+	first := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/trickplay/first.mkv"}
+	second := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/trickplay/second.mkv"}
+	third := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/trickplay/third.mkv"}
+
+	// A file waiting to be probed holds back trickplay.
+	p.mtx.Lock()
+	p.probing++
+	p.mtx.Unlock()
+	require.True(t, p.queueTrickplay(first))
+	require.Eventually(t, func() bool { return len(p.trickplayQueue) == 0 }, time.Second, time.Millisecond)
+
+	assert.True(t, p.queueTrickplay(first), "files that are already queued aren't queued again")
+	assert.True(t, p.queueTrickplay(second))
+	assert.False(t, p.queueTrickplay(third), "the queue is full")
+	select {
+	case path := <-generated:
+		t.Fatalf("generated thumbnails for %s while probing", path)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.probeFinished()
+	assert.Equal(t, first.Path, <-generated)
+	assert.Equal(t, second.Path, <-generated)
+	assert.Empty(t, generated)
+}
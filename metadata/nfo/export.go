@@ -0,0 +1,225 @@
+package nfo
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// tmdbImageURL is prepended to the TMDB image paths we store to get a URL that other tools can use.
+const tmdbImageURL = "https://image.tmdb.org/t/p/original"
+
+var seasonDirRe = regexp.MustCompile(`(?i)^(season[ ._-]*\d+|s\d+|specials)$`)
+
+func tmdbUniqueIDs(tmdbID int, imdbID string) (ids UniqueIDs) {
+	if tmdbID != 0 {
+		ids = append(ids, UniqueID{Type: IDTypeTmdb, Default: true, Value: strconv.Itoa(tmdbID)})
+	}
+	if imdbID != "" {
+		ids = append(ids, UniqueID{Type: IDTypeImdb, Value: imdbID})
+	}
+	return ids
+}
+
+func thumbs(aspect string, imagePath string) []Thumb {
+	if imagePath == "" {
+		return nil
+	}
+	return []Thumb{{Aspect: aspect, URL: tmdbImageURL + imagePath}}
+}
+
+func fanart(imagePath string) *Fanart {
+	if imagePath == "" {
+		return nil
+	}
+	return &Fanart{Thumbs: thumbs("", imagePath)}
+}
+
+// MovieFromDB returns the .nfo representation of the movie.
+func MovieFromDB(movie *db.Movie) *Movie {
+	return &Movie{
+		Title:         movie.Title,
+		OriginalTitle: movie.OriginalTitle,
+		Year:          int(movie.Year),
+		Premiered:     movie.ReleaseDate,
+		Plot:          movie.Overview,
+		UniqueIDs:     tmdbUniqueIDs(movie.TmdbID, movie.ImdbID),
+		Thumbs:        thumbs("poster", movie.PosterPath),
+		Fanart:        fanart(movie.BackdropPath),
+	}
+}
+
+// TVShowFromDB returns the .nfo representation of the series.
+func TVShowFromDB(series *db.Series) *TVShow {
+	return &TVShow{
+		Title:         series.Name,
+		OriginalTitle: series.OriginalName,
+		Year:          int(series.FirstAirYear),
+		Premiered:     series.FirstAirDate,
+		Plot:          series.Overview,
+		Status:        series.Status,
+		UniqueIDs:     tmdbUniqueIDs(series.TmdbID, ""),
+		Thumbs:        thumbs("poster", series.PosterPath),
+		Fanart:        fanart(series.BackdropPath),
+	}
+}
+
+// EpisodeFromDB returns the .nfo representation of the episode in the given season.
+func EpisodeFromDB(episode *db.Episode, season *db.Season) *Episode {
+	return &Episode{
+		Title:     episode.Name,
+		Season:    season.SeasonNumber,
+		Episode:   episode.EpisodeNum,
+		Aired:     episode.AirDate,
+		Plot:      episode.Overview,
+		UniqueIDs: tmdbUniqueIDs(episode.TmdbID, ""),
+		Thumbs:    thumbs("", episode.StillPath),
+	}
+}
+
+// TVShowExportPath returns where the tvshow.nfo for the series of the given episode file should be
+// written: the series directory, which is the parent if the episode is in a season directory.
+func TVShowExportPath(filePath string) string {
+	dir := filepath.Dir(filePath)
+	if seasonDirRe.MatchString(filepath.Base(dir)) {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Join(dir, "tvshow.nfo")
+}
+
+// Write writes v as a .nfo file to path. Existing files are only replaced if overwrite is set,
+// the returned bool indicates whether the file was written.
+func Write(path string, v interface{}, overwrite bool) (bool, error) {
+	if !overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return false, nil
+		}
+	}
+
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to encode .nfo")
+	}
+	data = append([]byte(xml.Header), data...)
+	data = append(data, '\n')
+
+	// Write to a temporary file first so that readers never see a partially written file.
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return false, errors.Wrapf(err, "Failed to write %s", path)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return false, errors.Wrapf(err, "Failed to write %s", path)
+	}
+	return true, nil
+}
+
+// ExportResult counts the .nfo files handled by Export.
+type ExportResult struct {
+	Written int
+	// Skipped counts existing files that weren't overwritten and files on remotes.
+	Skipped int
+	Failed  int
+}
+
+func (r *ExportResult) add(written bool, err error) {
+	switch {
+	case err != nil:
+		log.WithError(err).Warnln("Failed to export .nfo file")
+		r.Failed++
+	case written:
+		r.Written++
+	default:
+		r.Skipped++
+	}
+}
+
+// LocalPath returns the path of the file with the given file locator if it's on a local disk.
+// .nfo files are only read and written next to local files because every access to a remote is
+// a network round trip.
+func LocalPath(fileLocator string) (string, bool) {
+	l, err := filesystem.ParseFileLocator(fileLocator)
+	if err != nil || l.Backend != filesystem.BackendLocal {
+		return "", false
+	}
+	return l.Path, true
+}
+
+// ExportMovieFile writes a .nfo file with the metadata of the movie next to the movie file.
+func ExportMovieFile(movieFile *db.MovieFile, overwrite bool) (bool, error) {
+	p, ok := LocalPath(movieFile.FilePath)
+	if !ok || movieFile.MovieID == 0 {
+		return false, nil
+	}
+	movie, err := db.FindMovieByID(movieFile.MovieID)
+	if err != nil {
+		return false, errors.Wrapf(err, "Failed to find movie for %s", movieFile.FilePath)
+	}
+	return Write(MovieSidecarPaths(p)[0], MovieFromDB(movie), overwrite)
+}
+
+// ExportEpisodeFile writes a .nfo file with the metadata of the episode next to the episode file,
+// and a tvshow.nfo for its series.
+func ExportEpisodeFile(episodeFile *db.EpisodeFile, overwrite bool) (episodeWritten bool, showWritten bool, err error) {
+	return exportEpisodeFile(episodeFile, overwrite, overwrite)
+}
+
+func exportEpisodeFile(episodeFile *db.EpisodeFile, overwrite bool, overwriteShow bool) (episodeWritten bool, showWritten bool, err error) {
+	p, ok := LocalPath(episodeFile.FilePath)
+	if !ok || episodeFile.EpisodeID == 0 {
+		return false, false, nil
+	}
+	episode, err := db.FindEpisodeByID(episodeFile.EpisodeID)
+	if err != nil {
+		return false, false, errors.Wrapf(err, "Failed to find episode for %s", episodeFile.FilePath)
+	}
+	season, err := db.FindSeason(episode.SeasonID)
+	if err != nil {
+		return false, false, errors.Wrapf(err, "Failed to find season for %s", episodeFile.FilePath)
+	}
+
+	episodeWritten, err = Write(EpisodeSidecarPath(p), EpisodeFromDB(episode, season), overwrite)
+	if err != nil {
+		return false, false, err
+	}
+	if season.Series == nil {
+		return episodeWritten, false, nil
+	}
+	showWritten, err = Write(TVShowExportPath(p), TVShowFromDB(season.Series), overwriteShow)
+	return episodeWritten, showWritten, err
+}
+
+// Export writes .nfo files for all identified movie and episode files in local libraries.
+func Export(overwrite bool) ExportResult {
+	var result ExportResult
+
+	for _, movieFile := range db.FindAllMovieFiles() {
+		result.add(ExportMovieFile(&movieFile, overwrite))
+	}
+
+	// Episodes of a series share the tvshow.nfo, only write it once.
+	exportedShows := map[string]bool{}
+	for _, episodeFile := range db.FindAllEpisodeFiles() {
+		// Don't overwrite the tvshow.nfo we just wrote for another episode.
+		p, _ := LocalPath(episodeFile.FilePath)
+		overwriteShow := overwrite && !exportedShows[TVShowExportPath(p)]
+
+		episodeWritten, showWritten, err := exportEpisodeFile(&episodeFile, overwrite, overwriteShow)
+		result.add(episodeWritten, err)
+		if showWritten {
+			result.Written++
+			exportedShows[TVShowExportPath(p)] = true
+		}
+	}
+
+	return result
+}
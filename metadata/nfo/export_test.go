@@ -0,0 +1,90 @@
+package nfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestWriteMovie_RoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	movie := db.Movie{
+		BaseItem: db.BaseItem{
+			TmdbID:     76341,
+			Overview:   "An apocalyptic story.",
+			PosterPath: "/8tZYtuWezp8JbcsvHYO0O46tFbo.jpg",
+		},
+		Title:       "Mad Max: Fury Road",
+		Year:        2015,
+		ReleaseDate: "2015-05-13",
+		ImdbID:      "tt1392190",
+	}
+	path := filepath.Join(dir, "movie.nfo")
+	written, err := Write(path, MovieFromDB(&movie), false)
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	m, err := ReadMovie(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Mad Max: Fury Road", m.Title)
+	assert.Equal(t, 2015, m.Year)
+	assert.Equal(t, "76341", m.ID(IDTypeTmdb))
+	assert.Equal(t, "tt1392190", m.ID(IDTypeImdb))
+	assert.Equal(t, "https://image.tmdb.org/t/p/original/8tZYtuWezp8JbcsvHYO0O46tFbo.jpg", m.Thumbs[0].URL)
+	assert.Nil(t, m.Fanart)
+}
+
+func TestWrite_Overwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tvshow.nfo")
+	require.NoError(t, ioutil.WriteFile(path, []byte("<tvshow><title>Curated</title></tvshow>"), 0644))
+
+	written, err := Write(path, &TVShow{Title: "Exported"}, false)
+	require.NoError(t, err)
+	assert.False(t, written)
+	s, err := ReadTVShow(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Curated", s.Title)
+
+	written, err = Write(path, &TVShow{Title: "Exported"}, true)
+	require.NoError(t, err)
+	assert.True(t, written)
+	s, err = ReadTVShow(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Exported", s.Title)
+}
+
+func TestReadMovie_LegacyIDsAndTrailingURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olaris-nfo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "movie.nfo")
+	content := "<movie><title>Heat</title><tmdbid>949</tmdbid><imdbid>tt0113277</imdbid></movie>\nhttps://www.themoviedb.org/movie/949\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	m, err := ReadMovie(path)
+	require.NoError(t, err)
+	assert.Equal(t, "949", m.ID(IDTypeTmdb))
+	assert.Equal(t, "tt0113277", m.ID(IDTypeImdb))
+
+	_, err = ReadTVShow(path)
+	assert.Error(t, err)
+}
+
+func TestTVShowExportPath(t *testing.T) {
+	assert.Equal(t, "/tv/Lost/tvshow.nfo", TVShowExportPath("/tv/Lost/Season 1/Lost S01E01.mkv"))
+	assert.Equal(t, "/tv/Lost/tvshow.nfo", TVShowExportPath("/tv/Lost/S02/Lost S02E01.mkv"))
+	assert.Equal(t, "/tv/Lost/tvshow.nfo", TVShowExportPath("/tv/Lost/Lost S01E01.mkv"))
+}
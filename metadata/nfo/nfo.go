@@ -0,0 +1,215 @@
+// Package nfo reads and writes Kodi-style .nfo sidecar files that describe the media files next to them.
+package nfo
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Types of the IDs in UniqueID elements.
+const (
+	IDTypeTmdb = "tmdb"
+	IDTypeImdb = "imdb"
+)
+
+// UniqueID is the ID of the item in the database of a metadata provider.
+type UniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+// UniqueIDs is a list of IDs of an item.
+type UniqueIDs []UniqueID
+
+// Get returns the ID of the given type, or an empty string if there is none.
+func (ids UniqueIDs) Get(idType string) string {
+	for _, id := range ids {
+		if strings.EqualFold(id.Type, idType) {
+			return strings.TrimSpace(id.Value)
+		}
+	}
+	return ""
+}
+
+// Thumb is an image of the item, usually a URL.
+type Thumb struct {
+	Aspect string `xml:"aspect,attr,omitempty"`
+	URL    string `xml:",chardata"`
+}
+
+// Fanart holds the backdrop images of the item.
+type Fanart struct {
+	Thumbs []Thumb `xml:"thumb"`
+}
+
+// Movie is the content of a movie .nfo file.
+type Movie struct {
+	XMLName       xml.Name  `xml:"movie"`
+	Title         string    `xml:"title"`
+	OriginalTitle string    `xml:"originaltitle,omitempty"`
+	Year          int       `xml:"year,omitempty"`
+	Premiered     string    `xml:"premiered,omitempty"`
+	Plot          string    `xml:"plot,omitempty"`
+	UniqueIDs     UniqueIDs `xml:"uniqueid"`
+	// Older versions of Kodi wrote the IDs into their own elements.
+	TmdbID string  `xml:"tmdbid,omitempty"`
+	ImdbID string  `xml:"imdbid,omitempty"`
+	Thumbs []Thumb `xml:"thumb"`
+	Fanart *Fanart `xml:"fanart,omitempty"`
+}
+
+// ID returns the ID of the given type.
+func (m *Movie) ID(idType string) string {
+	return id(m.UniqueIDs, idType, m.TmdbID, m.ImdbID)
+}
+
+// TVShow is the content of a tvshow.nfo file.
+type TVShow struct {
+	XMLName       xml.Name  `xml:"tvshow"`
+	Title         string    `xml:"title"`
+	OriginalTitle string    `xml:"originaltitle,omitempty"`
+	Year          int       `xml:"year,omitempty"`
+	Premiered     string    `xml:"premiered,omitempty"`
+	Plot          string    `xml:"plot,omitempty"`
+	Status        string    `xml:"status,omitempty"`
+	UniqueIDs     UniqueIDs `xml:"uniqueid"`
+	TmdbID        string    `xml:"tmdbid,omitempty"`
+	ImdbID        string    `xml:"imdbid,omitempty"`
+	Thumbs        []Thumb   `xml:"thumb"`
+	Fanart        *Fanart   `xml:"fanart,omitempty"`
+}
+
+// ID returns the ID of the given type.
+func (s *TVShow) ID(idType string) string {
+	return id(s.UniqueIDs, idType, s.TmdbID, s.ImdbID)
+}
+
+// Episode is the content of an episode .nfo file.
+type Episode struct {
+	XMLName   xml.Name  `xml:"episodedetails"`
+	Title     string    `xml:"title"`
+	Season    int       `xml:"season"`
+	Episode   int       `xml:"episode"`
+	Aired     string    `xml:"aired,omitempty"`
+	Plot      string    `xml:"plot,omitempty"`
+	UniqueIDs UniqueIDs `xml:"uniqueid"`
+	Thumbs    []Thumb   `xml:"thumb"`
+}
+
+// ID returns the ID of the given type.
+func (e *Episode) ID(idType string) string {
+	return e.UniqueIDs.Get(idType)
+}
+
+func id(ids UniqueIDs, idType string, legacyTmdbID string, legacyImdbID string) string {
+	if v := ids.Get(idType); v != "" {
+		return v
+	}
+	switch idType {
+	case IDTypeTmdb:
+		return strings.TrimSpace(legacyTmdbID)
+	case IDTypeImdb:
+		return strings.TrimSpace(legacyImdbID)
+	}
+	return ""
+}
+
+// MovieSidecarPaths returns the paths a .nfo file for the given movie file may have, in order of preference.
+func MovieSidecarPaths(filePath string) []string {
+	return []string{
+		strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".nfo",
+		filepath.Join(filepath.Dir(filePath), "movie.nfo"),
+	}
+}
+
+// EpisodeSidecarPath returns the path of the .nfo file for the given episode file.
+func EpisodeSidecarPath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".nfo"
+}
+
+// TVShowSidecarPaths returns the paths the tvshow.nfo of the series of the given episode file may
+// have. Episodes are usually either in the series directory or in a season directory below it.
+func TVShowSidecarPaths(filePath string) []string {
+	dir := filepath.Dir(filePath)
+	return []string{
+		filepath.Join(dir, "tvshow.nfo"),
+		filepath.Join(filepath.Dir(dir), "tvshow.nfo"),
+	}
+}
+
+// FindMovie reads the first .nfo file that exists for the given movie file.
+func FindMovie(filePath string) (*Movie, string, bool) {
+	for _, sidecar := range MovieSidecarPaths(filePath) {
+		if m, err := ReadMovie(sidecar); err == nil {
+			return m, sidecar, true
+		}
+	}
+	return nil, "", false
+}
+
+// FindTVShow reads the tvshow.nfo of the series of the given episode file.
+func FindTVShow(filePath string) (*TVShow, string, bool) {
+	for _, sidecar := range TVShowSidecarPaths(filePath) {
+		if s, err := ReadTVShow(sidecar); err == nil {
+			return s, sidecar, true
+		}
+	}
+	return nil, "", false
+}
+
+// FindEpisode reads the .nfo file of the given episode file.
+func FindEpisode(filePath string) (*Episode, string, bool) {
+	sidecar := EpisodeSidecarPath(filePath)
+	e, err := ReadEpisode(sidecar)
+	if err != nil {
+		return nil, "", false
+	}
+	return e, sidecar, true
+}
+
+// ReadMovie reads a movie .nfo file.
+func ReadMovie(path string) (*Movie, error) {
+	var m Movie
+	if err := read(path, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ReadTVShow reads a tvshow.nfo file.
+func ReadTVShow(path string) (*TVShow, error) {
+	var s TVShow
+	if err := read(path, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ReadEpisode reads an episode .nfo file.
+func ReadEpisode(path string) (*Episode, error) {
+	var e Episode
+	if err := read(path, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func read(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Decode only reads the first element, so we don't trip over the scraper URLs that some tools
+	// append after the XML.
+	if err := xml.NewDecoder(f).Decode(v); err != nil {
+		return errors.Wrapf(err, "Failed to parse %s", path)
+	}
+	return nil
+}
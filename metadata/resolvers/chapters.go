@@ -0,0 +1,85 @@
+package resolvers
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// ChapterResolver resolves a chapter of a file.
+type ChapterResolver struct {
+	r         ffmpeg.Chapter
+	trickplay *ffmpeg.Trickplay
+}
+
+// Title returns the title of the chapter.
+func (r *ChapterResolver) Title() string {
+	return r.r.Title
+}
+
+// Start returns the start of the chapter in seconds.
+func (r *ChapterResolver) Start() float64 {
+	return r.r.Start.Seconds()
+}
+
+// End returns the end of the chapter in seconds.
+func (r *ChapterResolver) End() float64 {
+	return r.r.End.Seconds()
+}
+
+// Generated returns whether the chapter was generated because the file has none.
+func (r *ChapterResolver) Generated() bool {
+	return r.r.Generated
+}
+
+// Thumbnail returns the trickplay thumbnail at the start of the chapter.
+func (r *ChapterResolver) Thumbnail() *string {
+	if r.trickplay == nil {
+		return nil
+	}
+	thumbnail := r.trickplay.ThumbnailAt(r.r.Start)
+	return &thumbnail
+}
+
+// newChapterResolvers resolves the stored chapters of a file, or generated ones for a file of the
+// given duration if it has none.
+func newChapterResolvers(filePath string, chapters []db.Chapter, totalDuration *float64) []*ChapterResolver {
+	var duration time.Duration
+	if totalDuration != nil {
+		duration = time.Duration(*totalDuration * float64(time.Second))
+	}
+	var ffmpegChapters []ffmpeg.Chapter
+	for _, c := range chapters {
+		ffmpegChapters = append(ffmpegChapters, ffmpeg.Chapter{Title: c.Title, Start: c.Start, End: c.End})
+	}
+	ffmpegChapters = ffmpeg.ChaptersOrGenerated(ffmpegChapters, duration)
+
+	var trickplay *ffmpeg.Trickplay
+	if len(ffmpegChapters) > 0 {
+		if fileLocator, err := filesystem.ParseFileLocator(filePath); err == nil {
+			trickplay, err = ffmpeg.GetTrickplay(fileLocator)
+			if err != nil {
+				log.WithError(err).WithField("filePath", filePath).Warnln("Failed to read trickplay info")
+			}
+		}
+	}
+
+	resolvers := []*ChapterResolver{}
+	for _, c := range ffmpegChapters {
+		resolvers = append(resolvers, &ChapterResolver{r: c, trickplay: trickplay})
+	}
+	return resolvers
+}
+
+// Chapters returns the chapters of the file.
+func (r *MovieFileResolver) Chapters() []*ChapterResolver {
+	return newChapterResolvers(r.r.FilePath, db.FindChaptersForMovieFile(r.r.ID), r.TotalDuration())
+}
+
+// Chapters returns the chapters of the file.
+func (r *EpisodeFileResolver) Chapters() []*ChapterResolver {
+	return newChapterResolvers(r.r.FilePath, db.FindChaptersForEpisodeFile(r.r.ID), r.TotalDuration())
+}
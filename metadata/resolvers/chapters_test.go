@@ -0,0 +1,56 @@
+package resolvers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestMovieFileChapters(t *testing.T) {
+	NewResolver(app.NewTestingMDContext(nil))
+
+	mf := db.MovieFile{
+		MediaItem: db.MediaItem{FilePath: "local#/tmp/chapters.mkv"},
+		Streams:   []db.Stream{{StreamType: "video", TotalDuration: 25 * time.Minute}},
+		Chapters: []db.Chapter{
+			{Title: "The Heist", Start: 5 * time.Minute, End: 25 * time.Minute},
+			{Title: "Opening", Start: 0, End: 5 * time.Minute},
+		},
+	}
+	db.SaveMovieFile(&mf)
+	r := &MovieFileResolver{r: mf}
+
+	chapters := r.Chapters()
+	if assert.Len(t, chapters, 2) {
+		assert.Equal(t, "Opening", chapters[0].Title())
+		assert.Equal(t, "The Heist", chapters[1].Title())
+		assert.EqualValues(t, 300, chapters[1].Start())
+		assert.EqualValues(t, 1500, chapters[1].End())
+		assert.False(t, chapters[1].Generated())
+		// No trickplay thumbnails were generated.
+		assert.Nil(t, chapters[1].Thumbnail())
+	}
+
+	// Files without chapters get evenly spaced ones if that's enabled.
+	mf = db.MovieFile{
+		MediaItem: db.MediaItem{FilePath: "local#/tmp/no-chapters.mkv"},
+		Streams:   []db.Stream{{StreamType: "video", TotalDuration: 25 * time.Minute}},
+	}
+	db.SaveMovieFile(&mf)
+	r = &MovieFileResolver{r: mf}
+	assert.Empty(t, r.Chapters())
+
+	viper.Set("metadata.chapterInterval", "10m")
+	defer viper.Set("metadata.chapterInterval", "0s")
+	chapters = r.Chapters()
+	if assert.Len(t, chapters, 3) {
+		assert.Equal(t, "Chapter 3", chapters[2].Title())
+		assert.EqualValues(t, 1200, chapters[2].Start())
+		assert.EqualValues(t, 1500, chapters[2].End())
+		assert.True(t, chapters[2].Generated())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
 )
 
 // CreateNoAuthorisationError returns a standard error for unauthorised requests.
@@ -18,3 +19,10 @@ func ifAdmin(ctx context.Context) error {
 	}
 	return CreateNoAuthorisationError()
 }
+
+// libraryAccess returns the libraries the user making the request can access.
+func libraryAccess(ctx context.Context) db.LibraryAccess {
+	userID, _ := auth.UserID(ctx)
+	admin, _ := auth.UserAdmin(ctx)
+	return db.LibraryAccessForUser(userID, admin)
+}
@@ -305,8 +305,12 @@ type LibraryResponse struct {
 // Libraries return all libraries.
 func (r *Resolver) Libraries(ctx context.Context) []*LibraryResolver {
 	var l []*LibraryResolver
+	access := libraryAccess(ctx)
 	libraries := db.AllLibraries()
 	for _, library := range libraries {
+		if !access.AllowsLibrary(library.ID) {
+			continue
+		}
 		list := Library{library, nil, nil}
 		lib := LibraryResolver{r: list}
 		l = append(l, &lib)
@@ -0,0 +1,66 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// Libraries returns the libraries the user has been granted access to.
+func (r *UserResolver) Libraries(ctx context.Context) []*LibraryResolver {
+	var l []*LibraryResolver
+
+	userID, _ := auth.UserID(ctx)
+	if ifAdmin(ctx) != nil && userID != r.r.ID {
+		return l
+	}
+
+	for _, library := range db.GrantedLibraries(r.r.ID) {
+		l = append(l, &LibraryResolver{r: Library{library, nil, nil}})
+	}
+	return l
+}
+
+type libraryAccessArgs struct {
+	UserID    int32
+	LibraryID int32
+}
+
+// GrantLibraryAccess gives a user access to a library.
+func (r *Resolver) GrantLibraryAccess(ctx context.Context, args *libraryAccessArgs) *UserResponseResolver {
+	return updateLibraryAccess(ctx, args, db.GrantLibraryAccess)
+}
+
+// RevokeLibraryAccess takes away a user's access to a library.
+func (r *Resolver) RevokeLibraryAccess(ctx context.Context, args *libraryAccessArgs) *UserResponseResolver {
+	return updateLibraryAccess(ctx, args, db.RevokeLibraryAccess)
+}
+
+func updateLibraryAccess(
+	ctx context.Context,
+	args *libraryAccessArgs,
+	update func(userID uint, libraryID uint) error) *UserResponseResolver {
+
+	err := ifAdmin(ctx)
+	if err != nil {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(err)}}
+	}
+
+	user, err := db.FindUser(uint(args.UserID))
+	if err != nil {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(err)}}
+	}
+
+	library := db.FindLibrary(int(args.LibraryID))
+	if library.ID == 0 {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(fmt.Errorf("library not found"))}}
+	}
+
+	if err := update(user.ID, library.ID); err != nil {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(err)}}
+	}
+
+	return &UserResponseResolver{&UserResponse{User: &UserResolver{*user}}}
+}
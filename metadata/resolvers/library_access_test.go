@@ -0,0 +1,77 @@
+package resolvers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// adminContext returns a context for an admin, who can access all libraries.
+func adminContext() context.Context {
+	return context.WithValue(context.Background(), auth.ContextKeyIsAdmin, true)
+}
+
+func createMovieInLibrary(library *db.Library, title string) db.Movie {
+	movie := db.Movie{
+		BaseItem: db.BaseItem{TmdbID: 1},
+		Title:    title,
+		MovieFiles: []db.MovieFile{{
+			MediaItem: db.MediaItem{FilePath: "local#/tmp/" + title + ".mkv", LibraryID: library.ID},
+		}},
+	}
+	db.SaveMovie(&movie)
+	return movie
+}
+
+func TestLibraryAccess(t *testing.T) {
+	metadataCtx := app.NewTestingMDContext(nil)
+	r := NewResolver(metadataCtx)
+
+	kids := db.Library{Name: "Kids", FilePath: "/tmp/kids"}
+	adults := db.Library{Name: "Adults", FilePath: "/tmp/adults"}
+	metadataCtx.Db.Create(&kids)
+	metadataCtx.Db.Create(&adults)
+
+	createMovieInLibrary(&kids, "Cartoon")
+	adultMovie := createMovieInLibrary(&adults, "Horror")
+
+	user, _ := db.CreateUser("kid", "kidkidkid", false)
+	ctx := auth.ContextWithUserID(context.Background(), user.ID)
+	assert.Len(t, r.Movies(ctx, &movieQueryArgs{}), 0, "Users can't access any library by default")
+
+	grantArgs := &libraryAccessArgs{UserID: int32(user.ID), LibraryID: int32(kids.ID)}
+	res := r.GrantLibraryAccess(ctx, grantArgs)
+	assert.NotNil(t, res.Error(), "Only admins can grant access")
+
+	res = r.GrantLibraryAccess(adminContext(), grantArgs)
+	assert.Nil(t, res.Error())
+	assert.Len(t, res.User().Libraries(adminContext()), 1)
+
+	movies := r.Movies(ctx, &movieQueryArgs{})
+	assert.Len(t, movies, 1)
+	assert.Equal(t, "Cartoon", movies[0].Title())
+	assert.Len(t, r.Movies(adminContext(), &movieQueryArgs{}), 2)
+
+	adultUUID := adultMovie.UUID
+	assert.Len(t, r.Movies(ctx, &movieQueryArgs{queryArgs: queryArgs{UUID: &adultUUID}}), 0)
+	assert.Len(t, *r.Search(ctx, &searchArgs{Name: "o"}), 1)
+	assert.Len(t, *r.RecentlyAdded(ctx), 1)
+
+	movieCount, _ := r.MediaStats(ctx).MovieCount()
+	assert.EqualValues(t, 1, movieCount)
+
+	libraries := r.Libraries(ctx)
+	assert.Len(t, libraries, 1)
+	assert.Equal(t, "Kids", libraries[0].Name())
+
+	ticket := r.CreateStreamingTicket(ctx, &struct{ UUID string }{adultMovie.MovieFiles[0].UUID})
+	assert.NotNil(t, ticket.Error(), "Files from inaccessible libraries can't be streamed")
+
+	res = r.RevokeLibraryAccess(adminContext(), grantArgs)
+	assert.Nil(t, res.Error())
+	assert.Len(t, r.Movies(ctx, &movieQueryArgs{}), 0)
+}
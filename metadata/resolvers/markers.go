@@ -0,0 +1,70 @@
+package resolvers
+
+import (
+	"context"
+
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// MarkerResolver resolves an intro or credits marker.
+type MarkerResolver struct {
+	r        db.Marker
+	fileUUID string
+}
+
+// Kind returns the kind of the marker.
+func (r *MarkerResolver) Kind() string {
+	return r.r.Kind
+}
+
+// Start returns the start of the marker in seconds.
+func (r *MarkerResolver) Start() float64 {
+	return r.r.Start.Seconds()
+}
+
+// End returns the end of the marker in seconds.
+func (r *MarkerResolver) End() float64 {
+	return r.r.End.Seconds()
+}
+
+// FileUUID returns the UUID of the file the marker belongs to.
+func (r *MarkerResolver) FileUUID() string {
+	return r.fileUUID
+}
+
+// Markers returns the markers of all files of the episode.
+func (r *EpisodeResolver) Markers(ctx context.Context) (markers []*MarkerResolver) {
+	access := libraryAccess(ctx)
+	for _, file := range r.r.EpisodeFiles {
+		if !access.AllowsLibrary(file.LibraryID) {
+			continue
+		}
+		for _, m := range db.FindMarkersForEpisodeFile(file.ID) {
+			markers = append(markers, &MarkerResolver{r: m, fileUUID: file.UUID})
+		}
+	}
+	return markers
+}
+
+// AnalyzeSeasonMarkers queues finding the intros and credits of a season.
+func (r *Resolver) AnalyzeSeasonMarkers(ctx context.Context, args struct{ UUID string }) bool {
+	err := ifAdmin(ctx)
+	if err != nil {
+		return false
+	}
+
+	season, err := db.FindSeasonByUUID(args.UUID)
+	if err != nil {
+		return false
+	}
+
+	for _, episode := range db.FindEpisodesForSeason(season.ID) {
+		for _, file := range episode.EpisodeFiles {
+			if man, ok := r.libs[file.LibraryID]; ok {
+				man.QueueMarkerAnalysis(season.ID)
+				return true
+			}
+		}
+	}
+	return false
+}
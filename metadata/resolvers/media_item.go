@@ -1,5 +1,7 @@
 package resolvers
 
+import "gitlab.com/olaris/olaris-server/metadata/db"
+
 // MediaItemResolver is a resolver around media types.
 type MediaItemResolver struct {
 	r interface{}
@@ -16,3 +18,23 @@ func (r *MediaItemResolver) ToEpisode() (*EpisodeResolver, bool) {
 	res, ok := r.r.(*EpisodeResolver)
 	return res, ok
 }
+
+// findMediaItem returns the movie or episode with the given UUID if it exists and is accessible.
+func findMediaItem(uuid string, access db.LibraryAccess) *MediaItemResolver {
+	if uuid == "" {
+		return nil
+	}
+	if movie, err := db.FindMovieByUUID(uuid); err == nil {
+		if !access.AllowsMovie(movie.ID) {
+			return nil
+		}
+		return &MediaItemResolver{r: &MovieResolver{r: *movie}}
+	}
+	if episode, err := db.FindEpisodeByUUID(uuid); err == nil {
+		if !access.AllowsEpisode(episode.ID) {
+			return nil
+		}
+		return &MediaItemResolver{r: &EpisodeResolver{r: *episode}}
+	}
+	return nil
+}
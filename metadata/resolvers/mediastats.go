@@ -7,23 +7,25 @@ import (
 
 // MediaStats returns some stats about the media in your server
 func (r *Resolver) MediaStats(ctx context.Context) *MediaStatsResolver {
-	return &MediaStatsResolver{}
+	return &MediaStatsResolver{access: libraryAccess(ctx)}
 }
 
-type MediaStatsResolver struct{}
+type MediaStatsResolver struct {
+	access db.LibraryAccess
+}
 
 func (r *MediaStatsResolver) MovieCount() (int32, error) {
-	return db.GetMovieCount()
+	return db.GetMovieCount(r.access)
 }
 
 func (r *MediaStatsResolver) SeriesCount() (int32, error) {
-	return db.GetSeriesCount()
+	return db.GetSeriesCount(r.access)
 }
 
 func (r *MediaStatsResolver) SeasonCount() (int32, error) {
-	return db.GetSeasonCount()
+	return db.GetSeasonCount(r.access)
 }
 
 func (r *MediaStatsResolver) EpisodeCount() (int32, error) {
-	return db.GetEpisodeCount()
+	return db.GetEpisodeCount(r.access)
 }
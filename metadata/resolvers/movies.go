@@ -34,11 +34,14 @@ func (r *Resolver) Movies(ctx context.Context, args *movieQueryArgs) []*MovieRes
 	var l []*MovieResolver
 	var movies []db.Movie
 	qd := args.asQueryDetails()
+	access := libraryAccess(ctx)
 	if args.UUID != nil {
-		movie, _ := db.FindMovieByUUID(*args.UUID)
-		movies = []db.Movie{*movie}
+		movie, err := db.FindMovieByUUID(*args.UUID)
+		if err == nil && access.AllowsMovie(movie.ID) {
+			movies = []db.Movie{*movie}
+		}
 	} else {
-		movies = db.FindAllMovies(qd)
+		movies = db.FindAllMovies(qd, access)
 	}
 	for _, movie := range movies {
 		mov := MovieResolver{r: movie}
@@ -53,8 +56,12 @@ type MovieResolver struct {
 }
 
 // Files return files for movie.
-func (r *MovieResolver) Files() (res []*MovieFileResolver) {
+func (r *MovieResolver) Files(ctx context.Context) (res []*MovieFileResolver) {
+	access := libraryAccess(ctx)
 	for _, file := range db.FindFilesForMovieUUID(r.r.UUID) {
+		if !access.AllowsLibrary(file.LibraryID) {
+			continue
+		}
 		resolver := MovieFileResolver{r: *file}
 		res = append(res, &resolver)
 	}
@@ -186,6 +193,11 @@ func (r *MovieFileResolver) TotalDuration() *float64 {
 	return nil
 }
 
+// Trickplay returns the seek-preview thumbnails of the file.
+func (r *MovieFileResolver) Trickplay() *TrickplayResolver {
+	return newTrickplayResolver(r.r.FilePath)
+}
+
 // Streams return all streams
 func (r *MovieFileResolver) Streams() (streams []*StreamResolver) {
 	for _, stream := range db.FindStreamsForMovieFileUUID(r.r.UUID) {
@@ -15,20 +15,21 @@ type NearbyEpisodesQueryArgs struct {
 
 // NearbyEpisodes returns the next "x" episodes before and after the episode
 // identified by the provided UUID.
-func (r *Resolver) NearbyEpisodes(_ context.Context, args *NearbyEpisodesQueryArgs) *NearbyEpisodesResolver {
-	return &NearbyEpisodesResolver{args: args}
+func (r *Resolver) NearbyEpisodes(ctx context.Context, args *NearbyEpisodesQueryArgs) *NearbyEpisodesResolver {
+	return &NearbyEpisodesResolver{args: args, access: libraryAccess(ctx)}
 }
 
 // NearbyEpisodesResolver resolves the episodes directly before and after any
 // given episode, identified by its UUID.
 type NearbyEpisodesResolver struct {
-	args *NearbyEpisodesQueryArgs
+	args   *NearbyEpisodesQueryArgs
+	access db.LibraryAccess
 }
 
 // Previous returns the previous n episodes before the one identified by the
 // given UUID.
 func (r *NearbyEpisodesResolver) Previous() ([]*EpisodeResolver, error) {
-	episodes, err := db.GetPreviousEpisodes(r.args.Uuid, r.args.PreviousLimit)
+	episodes, err := db.GetPreviousEpisodes(r.args.Uuid, r.args.PreviousLimit, r.access)
 
 	episodeResolvers := make([]*EpisodeResolver, len(episodes))
 	for i, episode := range episodes {
@@ -40,7 +41,7 @@ func (r *NearbyEpisodesResolver) Previous() ([]*EpisodeResolver, error) {
 
 // Next returns the next n episodes before the one identified by the given UUID.
 func (r *NearbyEpisodesResolver) Next() ([]*EpisodeResolver, error) {
-	episodes, err := db.GetNextEpisodes(r.args.Uuid, r.args.NextLimit)
+	episodes, err := db.GetNextEpisodes(r.args.Uuid, r.args.NextLimit, r.access)
 
 	episodeResolvers := make([]*EpisodeResolver, len(episodes))
 	for i, episode := range episodes {
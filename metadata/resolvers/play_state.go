@@ -54,6 +54,13 @@ func (r *Resolver) CreatePlayState(ctx context.Context, args *playStateArgs) *Pl
 	} else {
 		fmt.Printf("%+v\n", ps)
 		db.SavePlayState(&ps)
+		db.CreateWatchEvent(&db.WatchEvent{
+			UserID:    userID,
+			Kind:      db.WatchEventProgress,
+			MediaUUID: args.UUID,
+			Playtime:  args.Playtime,
+			Finished:  args.Finished,
+		})
 	}
 
 	// Supply simple struct with true or false only for now
@@ -0,0 +1,214 @@
+package resolvers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/streaming"
+)
+
+// How often playbackSessionsChanged sends the current playback sessions.
+var playbackSessionsInterval = 5 * time.Second
+
+// PlaybackSessionResolver resolves a stream that is currently being served to a client.
+type PlaybackSessionResolver struct {
+	r      streaming.PlaybackSessionInfo
+	access db.LibraryAccess
+}
+
+// ID returns the ID of the playback session.
+func (r *PlaybackSessionResolver) ID() string {
+	return r.r.ID
+}
+
+// User returns the user who is watching.
+func (r *PlaybackSessionResolver) User() *UserResolver {
+	return findUser(r.r.UserID)
+}
+
+// Item returns the movie or episode that is being played.
+func (r *PlaybackSessionResolver) Item() *MediaItemResolver {
+	return findMediaItem(db.FindMediaUUIDForFilePath(r.r.FileLocator.String()), r.access)
+}
+
+// FilePath returns the file locator of the file that is being played.
+func (r *PlaybackSessionResolver) FilePath() string {
+	return r.r.FileLocator.String()
+}
+
+// StreamID returns the ffmpeg stream ID of the stream that is being played.
+func (r *PlaybackSessionResolver) StreamID() int32 {
+	return int32(r.r.StreamID)
+}
+
+// StreamType returns whether this is a video, audio or subtitle stream.
+func (r *PlaybackSessionResolver) StreamType() string {
+	return r.r.StreamType
+}
+
+// RepresentationID returns the representation that is served.
+func (r *PlaybackSessionResolver) RepresentationID() string {
+	return r.r.RepresentationID
+}
+
+// Mode returns how the representation is produced.
+func (r *PlaybackSessionResolver) Mode() string {
+	return r.r.Mode
+}
+
+// ProgressPercent returns how much of the file ffmpeg has processed.
+func (r *PlaybackSessionResolver) ProgressPercent() float64 {
+	return float64(r.r.ProgressPercent)
+}
+
+// Throttled returns whether ffmpeg is slowed down because it is far enough ahead of the client.
+func (r *PlaybackSessionResolver) Throttled() bool {
+	return r.r.Throttled
+}
+
+// Terminated returns whether ffmpeg has exited.
+func (r *PlaybackSessionResolver) Terminated() bool {
+	return r.r.Terminated
+}
+
+// BitRate returns the approximate rate at which the stream is served in bits per second.
+func (r *PlaybackSessionResolver) BitRate() int32 {
+	return int32(r.r.BitRate)
+}
+
+// CreatedAt returns when the session was started.
+func (r *PlaybackSessionResolver) CreatedAt() string {
+	return r.r.CreatedAt.Format(time.RFC3339)
+}
+
+// LastAccessedAt returns when the client last requested a segment.
+func (r *PlaybackSessionResolver) LastAccessedAt() string {
+	return r.r.LastAccessed.Format(time.RFC3339)
+}
+
+func findUser(userID uint) *UserResolver {
+	user, err := db.FindUser(userID)
+	if err != nil {
+		return nil
+	}
+	return &UserResolver{r: *user}
+}
+
+func playbackSessionResolvers(access db.LibraryAccess) []*PlaybackSessionResolver {
+	sessions := []*PlaybackSessionResolver{}
+	for _, info := range streaming.PBSManager.PlaybackSessionInfos() {
+		sessions = append(sessions, &PlaybackSessionResolver{r: info, access: access})
+	}
+	return sessions
+}
+
+// PlaybackSessions returns the active playback sessions of all users.
+func (r *Resolver) PlaybackSessions(ctx context.Context) []*PlaybackSessionResolver {
+	if err := ifAdmin(ctx); err != nil {
+		return []*PlaybackSessionResolver{}
+	}
+	return playbackSessionResolvers(libraryAccess(ctx))
+}
+
+// PlaybackSessionsChanged sends the active playback sessions of all users periodically.
+func (r *Resolver) PlaybackSessionsChanged(ctx context.Context) (<-chan []*PlaybackSessionResolver, error) {
+	if err := ifAdmin(ctx); err != nil {
+		return nil, err
+	}
+	log.Debugln("Adding subscription to PlaybackSessions")
+
+	access := libraryAccess(ctx)
+	publishCh := make(chan []*PlaybackSessionResolver, 1)
+	go func() {
+		ticker := time.NewTicker(playbackSessionsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case publishCh <- playbackSessionResolvers(access):
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return publishCh, nil
+}
+
+// KillPlaybackSession stops a playback session and its ffmpeg process.
+func (r *Resolver) KillPlaybackSession(ctx context.Context, args struct{ ID string }) *BoolResponseResolver {
+	if err := ifAdmin(ctx); err != nil {
+		return &BoolResponseResolver{success: false}
+	}
+	if err := streaming.PBSManager.KillPlaybackSession(args.ID); err != nil {
+		log.WithError(err).Warnln("Failed to kill playback session")
+		return &BoolResponseResolver{success: false}
+	}
+	return &BoolResponseResolver{success: true}
+}
+
+// StreamingUtilisationResolver resolves how close the server is to its streaming limits.
+type StreamingUtilisationResolver struct {
+	r streaming.StreamingUtilisation
+}
+
+// Transcodes returns the number of running transcoding processes.
+func (r *StreamingUtilisationResolver) Transcodes() int32 {
+	return int32(r.r.Transcodes)
+}
+
+// MaxTranscodes returns the maximum number of transcoding processes, 0 if unlimited.
+func (r *StreamingUtilisationResolver) MaxTranscodes() int32 {
+	return int32(r.r.Limits.MaxTranscodes)
+}
+
+// MaxPlaybacksPerUser returns how many files a user may play at once, 0 if unlimited.
+func (r *StreamingUtilisationResolver) MaxPlaybacksPerUser() int32 {
+	return int32(r.r.Limits.MaxPlaybacksPerUser)
+}
+
+// LimitPolicy returns what happens with streams beyond the transcode limit.
+func (r *StreamingUtilisationResolver) LimitPolicy() string {
+	return r.r.Limits.Policy
+}
+
+// Users returns how many files each user is playing.
+func (r *StreamingUtilisationResolver) Users() []*UserPlaybacksResolver {
+	users := []*UserPlaybacksResolver{}
+	for userID, playbacks := range r.r.Playbacks {
+		users = append(users, &UserPlaybacksResolver{userID: userID, playbacks: playbacks})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].userID < users[j].userID })
+	return users
+}
+
+// UserPlaybacksResolver resolves how many files a user is playing.
+type UserPlaybacksResolver struct {
+	userID    uint
+	playbacks int
+}
+
+// User returns the user.
+func (r *UserPlaybacksResolver) User() *UserResolver {
+	return findUser(r.userID)
+}
+
+// Playbacks returns the number of files the user is playing.
+func (r *UserPlaybacksResolver) Playbacks() int32 {
+	return int32(r.playbacks)
+}
+
+// StreamingUtilisation returns how close the server is to its streaming limits.
+func (r *Resolver) StreamingUtilisation(ctx context.Context) (*StreamingUtilisationResolver, error) {
+	if err := ifAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return &StreamingUtilisationResolver{r: streaming.PBSManager.Utilisation()}, nil
+}
@@ -0,0 +1,52 @@
+package resolvers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+)
+
+func TestPlaybackSessions_AdminOnly(t *testing.T) {
+	r := NewResolver(app.NewTestingMDContext(nil))
+	ctx := auth.ContextWithUserID(context.Background(), 2)
+
+	assert.Empty(t, r.PlaybackSessions(ctx))
+	_, err := r.PlaybackSessionsChanged(ctx)
+	assert.Error(t, err)
+	assert.False(t, r.KillPlaybackSession(ctx, struct{ ID string }{"unknown"}).Success())
+	_, err = r.StreamingUtilisation(ctx)
+	assert.Error(t, err)
+}
+
+func TestStreamingUtilisation(t *testing.T) {
+	r := NewResolver(app.NewTestingMDContext(nil))
+
+	u, err := r.StreamingUtilisation(adminContext())
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 0, u.Transcodes())
+		assert.Empty(t, u.Users())
+	}
+}
+
+func TestPlaybackSessionsChanged(t *testing.T) {
+	r := NewResolver(app.NewTestingMDContext(nil))
+	ctx, cancel := context.WithCancel(adminContext())
+	defer cancel()
+
+	ch, err := r.PlaybackSessionsChanged(ctx)
+	assert.NoError(t, err)
+
+	select {
+	case sessions := <-ch:
+		assert.NotNil(t, sessions)
+		assert.Empty(t, sessions)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Timeout waiting for playback sessions")
+	}
+
+	assert.False(t, r.KillPlaybackSession(ctx, struct{ ID string }{"unknown"}).Success())
+}
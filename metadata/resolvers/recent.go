@@ -31,13 +31,14 @@ func (a ByUpdatedAt) Less(i, j int) bool {
 // RecentlyAdded returns recently added media content.
 func (r *Resolver) RecentlyAdded(ctx context.Context) *[]*MediaItemResolver {
 	userID, _ := auth.UserID(ctx)
+	access := libraryAccess(ctx)
 	sortables := []sortable{}
 
-	for _, movie := range db.RecentlyAddedMovies(userID) {
+	for _, movie := range db.RecentlyAddedMovies(userID, access) {
 		sortables = append(sortables, movie)
 	}
 
-	for _, ep := range db.RecentlyAddedEpisodes(userID) {
+	for _, ep := range db.RecentlyAddedEpisodes(userID, access) {
 		sortables = append(sortables, ep)
 
 	}
@@ -3,9 +3,11 @@ package resolvers
 import (
 	"github.com/graph-gophers/graphql-go"
 	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/spf13/viper"
 	"gitlab.com/olaris/olaris-server/metadata/app"
 	"gitlab.com/olaris/olaris-server/metadata/db"
 	"gitlab.com/olaris/olaris-server/metadata/managers"
+	"gitlab.com/olaris/olaris-server/metadata/subtitles"
 	"net/http"
 )
 
@@ -13,6 +15,9 @@ import (
 type Resolver struct {
 	env  *app.MetadataContext
 	libs map[uint]*managers.LibraryManager
+	sync *managers.SyncManager
+
+	subtitles *managers.SubtitleManager
 }
 
 // NewResolver creates a new resolver
@@ -20,6 +25,12 @@ func NewResolver(env *app.MetadataContext) *Resolver {
 	r := &Resolver{
 		env:  env,
 		libs: map[uint]*managers.LibraryManager{},
+		sync: managers.GetSyncManager(),
+		subtitles: managers.NewSubtitleManager(subtitles.NewProviders(subtitles.ProviderOptions{
+			OpenSubtitlesAPIKey:   viper.GetString("subtitles.opensubtitles.apiKey"),
+			OpenSubtitlesUsername: viper.GetString("subtitles.opensubtitles.username"),
+			OpenSubtitlesPassword: viper.GetString("subtitles.opensubtitles.password"),
+		})...),
 	}
 
 	libs := db.AllLibraries()
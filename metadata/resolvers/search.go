@@ -1,6 +1,8 @@
 package resolvers
 
 import (
+	"context"
+
 	"gitlab.com/olaris/olaris-server/metadata/db"
 )
 
@@ -26,13 +28,14 @@ type searchArgs struct {
 }
 
 // Search searches for media content.
-func (r *Resolver) Search(args *searchArgs) *[]*SearchItemResolver {
+func (r *Resolver) Search(ctx context.Context, args *searchArgs) *[]*SearchItemResolver {
 	var l []*SearchItemResolver
+	access := libraryAccess(ctx)
 
-	for _, movie := range db.SearchMovieByTitle(args.Name) {
+	for _, movie := range db.SearchMovieByTitle(args.Name, access) {
 		l = append(l, &SearchItemResolver{r: &MovieResolver{r: movie}})
 	}
-	for _, serie := range db.SearchSeriesByTitle(args.Name) {
+	for _, serie := range db.SearchSeriesByTitle(args.Name, access) {
 		l = append(l, &SearchItemResolver{r: &SeriesResolver{serie}})
 	}
 
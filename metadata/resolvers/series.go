@@ -32,7 +32,7 @@ func (m *seriesQueryArgs) asQueryDetails() *db.QueryDetails {
 func (r *Resolver) Episode(ctx context.Context, args *mustUUIDArgs) *EpisodeResolver {
 	episode, err := db.FindEpisodeByUUID(*args.UUID)
 	// TODO(Maran): return an actual error to the client, not just an empty dict
-	if err == nil {
+	if err == nil && libraryAccess(ctx).AllowsEpisode(episode.ID) {
 		return &EpisodeResolver{r: *episode}
 	}
 	return &EpisodeResolver{r: db.Episode{}}
@@ -41,24 +41,28 @@ func (r *Resolver) Episode(ctx context.Context, args *mustUUIDArgs) *EpisodeReso
 
 // Season returns season.
 func (r *Resolver) Season(ctx context.Context, args *mustUUIDArgs) *SeasonResolver {
-	season, _ := db.FindSeasonByUUID(*args.UUID)
-	return &SeasonResolver{r: *season}
+	season, err := db.FindSeasonByUUID(*args.UUID)
+	if err == nil && libraryAccess(ctx).AllowsSeason(season.ID) {
+		return &SeasonResolver{r: *season}
+	}
+	return &SeasonResolver{r: db.Season{}}
 }
 
 // Series return series.
 func (r *Resolver) Series(ctx context.Context, args *seriesQueryArgs) []*SeriesResolver {
 	var series []*db.Series
+	access := libraryAccess(ctx)
 
 	if args.UUID != nil {
 		serie, err := db.FindSeriesByUUID(*args.UUID)
-		if err != nil {
+		if err != nil || !access.AllowsSeries(serie.ID) {
 			series = []*db.Series{}
 		} else {
 			series = []*db.Series{serie}
 		}
 	} else {
 		qd := args.asQueryDetails()
-		series, _ = db.FindAllSeries(qd)
+		series, _ = db.FindAllSeries(qd, access)
 	}
 
 	var resolvers []*SeriesResolver
@@ -132,10 +136,14 @@ func (r *SeriesResolver) UnwatchedEpisodesCount(ctx context.Context) int32 {
 }
 
 // Seasons returns all seasons.
-func (r *SeriesResolver) Seasons() []*SeasonResolver {
+func (r *SeriesResolver) Seasons(ctx context.Context) []*SeasonResolver {
 	var seasons []*SeasonResolver
+	access := libraryAccess(ctx)
 
 	for _, season := range db.FindSeasonsForSeries(r.r.ID) {
+		if !access.AllowsSeason(season.ID) {
+			continue
+		}
 		seasons = append(seasons, &SeasonResolver{r: season})
 	}
 
@@ -195,9 +203,13 @@ func (r *SeasonResolver) Series() *SeriesResolver {
 }
 
 // Episodes returns seasonal episodes.
-func (r *SeasonResolver) Episodes() []*EpisodeResolver {
+func (r *SeasonResolver) Episodes(ctx context.Context) []*EpisodeResolver {
 	var res []*EpisodeResolver
+	access := libraryAccess(ctx)
 	for _, episode := range db.FindEpisodesForSeason(r.r.ID) {
+		if !access.AllowsEpisode(episode.ID) {
+			continue
+		}
 		res = append(res, &EpisodeResolver{r: episode})
 	}
 	return res
@@ -209,8 +221,12 @@ type EpisodeResolver struct {
 }
 
 // Files return all files for this episode.
-func (r *EpisodeResolver) Files() (files []*EpisodeFileResolver) {
+func (r *EpisodeResolver) Files(ctx context.Context) (files []*EpisodeFileResolver) {
+	access := libraryAccess(ctx)
 	for _, episode := range r.r.EpisodeFiles {
+		if !access.AllowsLibrary(episode.LibraryID) {
+			continue
+		}
 		files = append(files, &EpisodeFileResolver{r: episode})
 	}
 	return files
@@ -333,6 +349,11 @@ func (r *EpisodeFileResolver) TotalDuration() *float64 {
 	return nil
 }
 
+// Trickplay returns the seek-preview thumbnails of the file.
+func (r *EpisodeFileResolver) Trickplay() *TrickplayResolver {
+	return newTrickplayResolver(r.r.FilePath)
+}
+
 // Streams return stream information.
 func (r *EpisodeFileResolver) Streams() (streams []*StreamResolver) {
 	for _, stream := range r.r.Streams {
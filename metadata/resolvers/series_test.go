@@ -1,7 +1,6 @@
 package resolvers
 
 import (
-	"context"
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/olaris/olaris-server/metadata/app"
 	"gitlab.com/olaris/olaris-server/metadata/auth"
@@ -12,7 +11,8 @@ import (
 func TestEpisodePlayState(t *testing.T) {
 	const testUserID = 1
 
-	ctx := auth.ContextWithUserID(context.Background(), testUserID)
+	// The episode file isn't in any library, so only admins can see it.
+	ctx := auth.ContextWithUserID(adminContext(), testUserID)
 	r := NewResolver(app.NewTestingMDContext(nil))
 
 	mi := db.MediaItem{FilePath: "/tmp/test.mkv"}
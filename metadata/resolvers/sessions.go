@@ -0,0 +1,133 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// SessionResolver resolves a session.
+type SessionResolver struct {
+	r       db.Session
+	current bool
+}
+
+func newSessionResolver(ctx context.Context, session db.Session) *SessionResolver {
+	sessionID, _ := auth.SessionID(ctx)
+	return &SessionResolver{r: session, current: session.UUID == sessionID}
+}
+
+// UUID returns the session's UUID.
+func (r *SessionResolver) UUID() string {
+	return r.r.UUID
+}
+
+// UserID returns the ID of the user the session belongs to.
+func (r *SessionResolver) UserID() int32 {
+	return int32(r.r.UserID)
+}
+
+// UserAgent returns the user agent of the client that created the session.
+func (r *SessionResolver) UserAgent() string {
+	return r.r.UserAgent
+}
+
+// CreatedAt returns when the user logged in.
+func (r *SessionResolver) CreatedAt() string {
+	return r.r.CreatedAt.Format(time.RFC3339)
+}
+
+// LastUsedAt returns when the session was last refreshed.
+func (r *SessionResolver) LastUsedAt() string {
+	return r.r.LastUsedAt.Format(time.RFC3339)
+}
+
+// ExpiresAt returns when the session expires unless it's refreshed.
+func (r *SessionResolver) ExpiresAt() string {
+	return r.r.ExpiresAt.Format(time.RFC3339)
+}
+
+// Current returns whether the request was made with this session.
+func (r *SessionResolver) Current() bool {
+	return r.current
+}
+
+// SessionResponse holds session information and error if needed.
+type SessionResponse struct {
+	Error   *ErrorResolver
+	Session *SessionResolver
+}
+
+// SessionResponseResolver resolves SessionResponse.
+type SessionResponseResolver struct {
+	r *SessionResponse
+}
+
+// Error returns error.
+func (r *SessionResponseResolver) Error() *ErrorResolver {
+	return r.r.Error
+}
+
+// Session returns session.
+func (r *SessionResponseResolver) Session() *SessionResolver {
+	return r.r.Session
+}
+
+// targetUserID returns the requested user ID if the current user may access that user's data,
+// defaulting to the current user.
+func targetUserID(ctx context.Context, requestedUserID *int32) (uint, error) {
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return 0, CreateNoAuthorisationError()
+	}
+	if requestedUserID == nil || uint(*requestedUserID) == userID {
+		return userID, nil
+	}
+	if err := ifAdmin(ctx); err != nil {
+		return 0, err
+	}
+	return uint(*requestedUserID), nil
+}
+
+// Sessions returns the active sessions of a user.
+func (r *Resolver) Sessions(ctx context.Context, args struct{ UserID *int32 }) (sessions []*SessionResolver) {
+	userID, err := targetUserID(ctx, args.UserID)
+	if err != nil {
+		return sessions
+	}
+	for _, session := range db.ActiveSessionsForUser(userID) {
+		sessions = append(sessions, newSessionResolver(ctx, session))
+	}
+	return sessions
+}
+
+// RevokeSession revokes a single session.
+func (r *Resolver) RevokeSession(ctx context.Context, args struct{ UUID string }) *SessionResponseResolver {
+	session, err := db.FindSessionByUUID(args.UUID)
+	if err != nil {
+		return &SessionResponseResolver{&SessionResponse{Error: CreateErrResolver(fmt.Errorf("session not found"))}}
+	}
+
+	userID := int32(session.UserID)
+	if _, err := targetUserID(ctx, &userID); err != nil {
+		// Don't tell other users whether the session exists.
+		return &SessionResponseResolver{&SessionResponse{Error: CreateErrResolver(fmt.Errorf("session not found"))}}
+	}
+
+	if err := db.RevokeSession(session); err != nil {
+		return &SessionResponseResolver{&SessionResponse{Error: CreateErrResolver(err)}}
+	}
+	return &SessionResponseResolver{&SessionResponse{Session: newSessionResolver(ctx, *session)}}
+}
+
+// RevokeSessions revokes all sessions of a user.
+func (r *Resolver) RevokeSessions(ctx context.Context, args struct{ UserID *int32 }) *BoolResponseResolver {
+	userID, err := targetUserID(ctx, args.UserID)
+	if err != nil {
+		return &BoolResponseResolver{success: false}
+	}
+	return &BoolResponseResolver{success: db.RevokeSessionsForUser(userID) == nil}
+}
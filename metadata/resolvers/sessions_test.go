@@ -0,0 +1,63 @@
+package resolvers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestSessions(t *testing.T) {
+	r := NewResolver(app.NewTestingMDContext(nil))
+	alice, _ := db.CreateUser("alice", "alicealice", false)
+	bob, _ := db.CreateUser("bob", "bobbobbob", false)
+
+	aliceSession, _, _ := db.CreateSession(alice.ID, "test", auth.RefreshTokenValidity)
+	db.CreateSession(alice.ID, "test", auth.RefreshTokenValidity)
+	bobSession, _, _ := db.CreateSession(bob.ID, "test", auth.RefreshTokenValidity)
+
+	ctx := auth.ContextWithUserID(context.Background(), alice.ID)
+	sessions := r.Sessions(ctx, struct{ UserID *int32 }{})
+	assert.Len(t, sessions, 2)
+
+	bobID := int32(bob.ID)
+	assert.Len(t, r.Sessions(ctx, struct{ UserID *int32 }{&bobID}), 0, "Users can't list other users' sessions")
+
+	res := r.RevokeSession(ctx, struct{ UUID string }{bobSession.UUID})
+	assert.NotNil(t, res.Error(), "Users can't revoke other users' sessions")
+
+	res = r.RevokeSession(ctx, struct{ UUID string }{aliceSession.UUID})
+	assert.Nil(t, res.Error())
+	assert.Len(t, r.Sessions(ctx, struct{ UserID *int32 }{}), 1)
+
+	adminCtx := context.WithValue(ctx, auth.ContextKeyIsAdmin, true)
+	assert.Len(t, r.Sessions(adminCtx, struct{ UserID *int32 }{&bobID}), 1)
+	assert.True(t, r.RevokeSessions(adminCtx, struct{ UserID *int32 }{&bobID}).Success())
+	assert.Len(t, r.Sessions(adminCtx, struct{ UserID *int32 }{&bobID}), 0)
+}
+
+func TestChangePassword(t *testing.T) {
+	r := NewResolver(app.NewTestingMDContext(nil))
+	user, _ := db.CreateUser("alice", "alicealice", false)
+	db.CreateSession(user.ID, "test", auth.RefreshTokenValidity)
+
+	ctx := auth.ContextWithUserID(context.Background(), user.ID)
+	res := r.ChangePassword(ctx, struct {
+		CurrentPassword string
+		NewPassword     string
+	}{"wrongpassword", "newpassword"})
+	assert.NotNil(t, res.Error())
+
+	res = r.ChangePassword(ctx, struct {
+		CurrentPassword string
+		NewPassword     string
+	}{"alicealice", "newpassword"})
+	assert.Nil(t, res.Error())
+	assert.Len(t, db.ActiveSessionsForUser(user.ID), 0)
+
+	login := db.User{Username: "alice"}
+	assert.True(t, login.ValidPassword("newpassword"))
+}
@@ -3,6 +3,8 @@ package resolvers
 import (
 	"context"
 	"fmt"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
 	"gitlab.com/olaris/olaris-server/helpers"
 	"gitlab.com/olaris/olaris-server/metadata/auth"
 	"gitlab.com/olaris/olaris-server/metadata/db"
@@ -14,6 +16,7 @@ type CreateSTResponse struct {
 	Error             *ErrorResolver
 	Jwt               string
 	MetadataPath      string
+	TrickplayPath     *string
 	DASHStreamingPath string
 	HLSStreamingPath  string
 	Streams           []*StreamResolver
@@ -29,6 +32,11 @@ func (r *CreateSTResponseResolver) MetadataPath() string {
 	return r.r.MetadataPath
 }
 
+// TrickplayPath returns URI to the WebVTT thumbnail track, if the file has trickplay thumbnails.
+func (r *CreateSTResponseResolver) TrickplayPath() *string {
+	return r.r.TrickplayPath
+}
+
 // HLSStreamingPath returns URI to HLS manifest.
 func (r *CreateSTResponseResolver) HLSStreamingPath() string {
 	return r.r.HLSStreamingPath
@@ -59,7 +67,10 @@ func (r *Resolver) CreateStreamingTicket(ctx context.Context, args *struct{ UUID
 	userID, _ := auth.UserID(ctx)
 	mr := db.FindContentByUUID(args.UUID)
 
-	filePath := mr.GetFilePath()
+	var filePath string
+	if mr != nil && libraryAccess(ctx).AllowsLibrary(mr.GetLibrary().ID) {
+		filePath = mr.GetFilePath()
+	}
 	var streamables []*StreamResolver
 
 	if filePath == "" {
@@ -77,6 +88,11 @@ func (r *Resolver) CreateStreamingTicket(ctx context.Context, args *struct{ UUID
 	basePath := fmt.Sprintf("/olaris/s/files/jwt/%s/", token)
 
 	metadataPath := path.Join(basePath, "metadata.json")
+	var trickplayPath *string
+	if fileLocator, err := filesystem.ParseFileLocator(filePath); err == nil && ffmpeg.HasTrickplay(fileLocator) {
+		p := path.Join(basePath, "trickplay", ffmpeg.TrickplayVTTFileName)
+		trickplayPath = &p
+	}
 
 	sessionID := helpers.RandAlphaString(16)
 	HLSStreamingPath := path.Join(
@@ -98,6 +114,7 @@ func (r *Resolver) CreateStreamingTicket(ctx context.Context, args *struct{ UUID
 		Error:             nil,
 		Jwt:               token,
 		MetadataPath:      metadataPath,
+		TrickplayPath:     trickplayPath,
 		HLSStreamingPath:  HLSStreamingPath,
 		DASHStreamingPath: DASHStreamingPath,
 		Streams:           streamables,
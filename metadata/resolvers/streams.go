@@ -68,6 +68,33 @@ func (r *StreamResolver) Title() *string {
 	return &r.r.Title
 }
 
+// Channels returns the number of audio channels.
+func (r *StreamResolver) Channels() *int32 {
+	if r.r.Channels == 0 {
+		return nil
+	}
+	c := int32(r.r.Channels)
+	return &c
+}
+
+// ChannelLayout returns the layout of the audio channels, e.g. "5.1".
+func (r *StreamResolver) ChannelLayout() *string {
+	if r.r.ChannelLayout == "" {
+		return nil
+	}
+	return &r.r.ChannelLayout
+}
+
+// Forced returns whether the subtitles only cover foreign-language parts.
+func (r *StreamResolver) Forced() bool {
+	return r.r.Forced
+}
+
+// HearingImpaired returns whether the subtitles are meant for the deaf and hard of hearing.
+func (r *StreamResolver) HearingImpaired() bool {
+	return r.r.HearingImpaired
+}
+
 // Resolution returns stream resolution if present.
 func (r *StreamResolver) Resolution() *string {
 	if r.r.Width != 0 {
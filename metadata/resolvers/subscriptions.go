@@ -13,6 +13,7 @@ type eventFilterFn = func(e *metadata.MetadataEvent) bool
 
 type metadataSubscription struct {
 	eventFilterFn eventFilterFn
+	access        db.LibraryAccess
 	metadataSubCh metadata.MetadataSubscriber
 
 	stopCh    <-chan struct{}
@@ -25,7 +26,7 @@ func (s *metadataSubscription) Start() {
 		case <-s.stopCh:
 			return
 		case e := <-s.metadataSubCh:
-			if s.eventFilterFn(e) {
+			if s.eventFilterFn(e) && eventAllowed(s.access, e) {
 				// TODO(Leon Handreke): Warn about dropped events
 				select {
 				case s.publishCh <- ToEventResolver(e):
@@ -38,6 +39,22 @@ func (s *metadataSubscription) Start() {
 	}
 }
 
+// eventAllowed returns whether the subscriber may see the item the event is about. Deletions are always
+// passed on because the item can no longer be looked up.
+func eventAllowed(access db.LibraryAccess, e *metadata.MetadataEvent) bool {
+	switch payload := e.Payload.(type) {
+	case *db.Movie:
+		return e.EventType == metadata.MetadataEventTypeMovieDeleted || access.AllowsMovie(payload.ID)
+	case *db.Episode:
+		return e.EventType == metadata.MetadataEventTypeEpisodeDeleted || access.AllowsEpisode(payload.ID)
+	case *db.Season:
+		return e.EventType == metadata.MetadataEventTypeSeasonDeleted || access.AllowsSeason(payload.ID)
+	case *db.Series:
+		return e.EventType == metadata.MetadataEventTypeSeriesDeleted || access.AllowsSeries(payload.ID)
+	}
+	return access.All
+}
+
 func ToEventResolver(e *metadata.MetadataEvent) *MetadataEventResolver {
 	var r interface{}
 
@@ -77,6 +94,7 @@ func (r *Resolver) startMetadataSubscription(
 	publishCh := make(chan *MetadataEventResolver, 10)
 	subscription := metadataSubscription{
 		eventFilterFn: eventFilterFn,
+		access:        libraryAccess(ctx),
 		metadataSubCh: r.env.MetadataManager.AddSubscriber(),
 		stopCh:        ctx.Done(),
 		publishCh:     publishCh,
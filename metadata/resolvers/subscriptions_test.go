@@ -3,6 +3,7 @@ package resolvers
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
 	"gitlab.com/olaris/olaris-server/metadata/agents/agentsfakes"
 	"gitlab.com/olaris/olaris-server/metadata/app"
 	"gitlab.com/olaris/olaris-server/metadata/db"
@@ -12,8 +13,8 @@ import (
 
 func TestResolver_MoviesChanged_CreateMovie(t *testing.T) {
 	tmdbAgent := agentsfakes.FakeMetadataRetrievalAgent{}
-	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, tmdbID int) error {
-		movie.TmdbID = tmdbID
+	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, id agents.ExternalID) error {
+		movie.TmdbID, _ = id.Int()
 		movie.Title = "North of the Sun"
 		return nil
 	}
@@ -21,7 +22,7 @@ func TestResolver_MoviesChanged_CreateMovie(t *testing.T) {
 	metadataCtx := app.NewTestingMDContext(&tmdbAgent)
 	r := NewResolver(metadataCtx)
 
-	subCh := r.MoviesChanged(context.Background())
+	subCh := r.MoviesChanged(adminContext())
 
 	metadataCtx.MetadataManager.GetOrCreateMovieByTmdbID(1234)
 
@@ -39,8 +40,8 @@ func TestResolver_MoviesChanged_CreateMovie(t *testing.T) {
 
 func TestResolver_MoviesChanged_RefreshMovieMetadata(t *testing.T) {
 	tmdbAgent := agentsfakes.FakeMetadataRetrievalAgent{}
-	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, tmdbID int) error {
-		movie.TmdbID = tmdbID
+	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, id agents.ExternalID) error {
+		movie.TmdbID, _ = id.Int()
 		movie.Title = "North of the Sun"
 		return nil
 	}
@@ -54,7 +55,7 @@ func TestResolver_MoviesChanged_RefreshMovieMetadata(t *testing.T) {
 	}
 	db.SaveMovie(&movie)
 
-	subCh := r.MoviesChanged(context.Background())
+	subCh := r.MoviesChanged(adminContext())
 
 	metadataCtx.MetadataManager.RefreshMovieMetadata(&movie)
 
@@ -78,7 +79,7 @@ func TestResolver_MoviesChanged_GarbageCollectMovie(t *testing.T) {
 	}
 	db.SaveMovie(&movie)
 
-	subCh := r.MoviesChanged(context.Background())
+	subCh := r.MoviesChanged(adminContext())
 
 	metadataCtx.MetadataManager.GarbageCollectMovieIfRequired(movie.ID)
 
@@ -0,0 +1,150 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/metadata/subtitles"
+)
+
+// SubtitleSearchResultResolver resolves a subtitle found in an online database.
+type SubtitleSearchResultResolver struct {
+	r subtitles.Result
+}
+
+// Provider returns the name of the online database.
+func (r *SubtitleSearchResultResolver) Provider() string {
+	return r.r.Provider
+}
+
+// ID returns the ID of the subtitle at the provider.
+func (r *SubtitleSearchResultResolver) ID() string {
+	return r.r.ID
+}
+
+// Language returns the language of the subtitle.
+func (r *SubtitleSearchResultResolver) Language() string {
+	return r.r.Language
+}
+
+// Release returns the name of the release the subtitle was made for.
+func (r *SubtitleSearchResultResolver) Release() string {
+	return r.r.Release
+}
+
+// Forced returns whether the subtitle only covers foreign-language parts.
+func (r *SubtitleSearchResultResolver) Forced() bool {
+	return r.r.Forced
+}
+
+// HearingImpaired returns whether the subtitle describes sounds as well.
+func (r *SubtitleSearchResultResolver) HearingImpaired() bool {
+	return r.r.HearingImpaired
+}
+
+// HashMatch returns whether the subtitle was made for exactly this file.
+func (r *SubtitleSearchResultResolver) HashMatch() bool {
+	return r.r.HashMatch
+}
+
+// DownloadCount returns how often the subtitle was downloaded.
+func (r *SubtitleSearchResultResolver) DownloadCount() int32 {
+	return int32(r.r.DownloadCount)
+}
+
+// SubtitleSearchResponse holds the found subtitles and error if needed.
+type SubtitleSearchResponse struct {
+	Error   *ErrorResolver
+	Results []*SubtitleSearchResultResolver
+}
+
+// SubtitleSearchResponseResolver resolves SubtitleSearchResponse.
+type SubtitleSearchResponseResolver struct {
+	r *SubtitleSearchResponse
+}
+
+// Error returns error.
+func (r *SubtitleSearchResponseResolver) Error() *ErrorResolver {
+	return r.r.Error
+}
+
+// Results returns the found subtitles.
+func (r *SubtitleSearchResponseResolver) Results() []*SubtitleSearchResultResolver {
+	return r.r.Results
+}
+
+// DownloadSubtitleResponse holds the stream of a downloaded subtitle and error if needed.
+type DownloadSubtitleResponse struct {
+	Error  *ErrorResolver
+	Stream *StreamResolver
+}
+
+// DownloadSubtitleResponseResolver resolves DownloadSubtitleResponse.
+type DownloadSubtitleResponseResolver struct {
+	r *DownloadSubtitleResponse
+}
+
+// Error returns error.
+func (r *DownloadSubtitleResponseResolver) Error() *ErrorResolver {
+	return r.r.Error
+}
+
+// Stream returns the subtitle stream.
+func (r *DownloadSubtitleResponseResolver) Stream() *StreamResolver {
+	return r.r.Stream
+}
+
+// findAccessibleMediaFile returns the movie or episode file with the given UUID if the current
+// user can access its library.
+func findAccessibleMediaFile(ctx context.Context, uuid string) (db.MediaFile, error) {
+	file := db.FindContentByUUID(uuid)
+	if file == nil || !libraryAccess(ctx).AllowsLibrary(file.GetLibrary().ID) {
+		return nil, fmt.Errorf("file not found")
+	}
+	return file, nil
+}
+
+// SearchSubtitles searches the configured providers for subtitles of a movie or episode file.
+func (r *Resolver) SearchSubtitles(ctx context.Context, args struct {
+	FileUUID  string
+	Languages *[]string
+}) *SubtitleSearchResponseResolver {
+	file, err := findAccessibleMediaFile(ctx, args.FileUUID)
+	if err != nil {
+		return &SubtitleSearchResponseResolver{&SubtitleSearchResponse{Error: CreateErrResolver(err)}}
+	}
+
+	var languages []string
+	if args.Languages != nil {
+		languages = *args.Languages
+	}
+	results, err := r.subtitles.Search(file, languages)
+	if err != nil {
+		return &SubtitleSearchResponseResolver{&SubtitleSearchResponse{Error: CreateErrResolver(err)}}
+	}
+
+	resolvers := []*SubtitleSearchResultResolver{}
+	for _, res := range results {
+		resolvers = append(resolvers, &SubtitleSearchResultResolver{r: res})
+	}
+	return &SubtitleSearchResponseResolver{&SubtitleSearchResponse{Results: resolvers}}
+}
+
+// DownloadSubtitle downloads a subtitle found by SearchSubtitles and adds it to the file's streams.
+func (r *Resolver) DownloadSubtitle(ctx context.Context, args struct {
+	FileUUID string
+	Provider string
+	ID       string
+}) *DownloadSubtitleResponseResolver {
+	file, err := findAccessibleMediaFile(ctx, args.FileUUID)
+	if err != nil {
+		return &DownloadSubtitleResponseResolver{&DownloadSubtitleResponse{Error: CreateErrResolver(err)}}
+	}
+
+	stream, err := r.subtitles.Download(file, args.Provider, args.ID)
+	if err != nil {
+		return &DownloadSubtitleResponseResolver{&DownloadSubtitleResponse{Error: CreateErrResolver(err)}}
+	}
+	return &DownloadSubtitleResponseResolver{&DownloadSubtitleResponse{Stream: &StreamResolver{r: *stream}}}
+}
@@ -0,0 +1,99 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+	"gitlab.com/olaris/olaris-server/metadata/managers"
+	"gitlab.com/olaris/olaris-server/metadata/subtitles"
+)
+
+type searchSubtitlesArgs = struct {
+	FileUUID  string
+	Languages *[]string
+}
+
+type downloadSubtitleArgs = struct {
+	FileUUID string
+	Provider string
+	ID       string
+}
+
+func TestSubtitleSearchAndDownload(t *testing.T) {
+	viper.Set("server.cacheDir", t.TempDir())
+	defer viper.Set("server.cacheDir", "")
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subtitles":
+			// The file doesn't exist, so it can only be found by its TMDB ID.
+			assert.Equal(t, "1", r.URL.Query().Get("tmdb_id"))
+			assert.Equal(t, "de", r.URL.Query().Get("languages"))
+			fmt.Fprint(w, `{"data": [{"id": "1", "attributes": {"language": "de", "release": "Holiday.2019",
+				"foreign_parts_only": true, "files": [{"file_id": 42, "file_name": "Holiday.2019.srt"}]}}]}`)
+		case "/download":
+			fmt.Fprintf(w, `{"link": "%s/file.srt", "file_name": "Holiday.2019.srt"}`, server.URL)
+		case "/file.srt":
+			fmt.Fprint(w, "1\n00:00:01,000 --> 00:00:02,000\nHallo\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	metadataCtx := app.NewTestingMDContext(nil)
+	r := NewResolver(metadataCtx)
+
+	library := db.Library{Name: "Movies", FilePath: "/tmp/movies"}
+	metadataCtx.Db.Create(&library)
+	movie := createMovieInLibrary(&library, "Holiday")
+	fileUUID := movie.MovieFiles[0].UUID
+
+	user, _ := db.CreateUser("user", "useruser", false)
+	userCtx := auth.ContextWithUserID(context.Background(), user.ID)
+	languages := []string{"ger"}
+
+	res := r.SearchSubtitles(adminContext(), searchSubtitlesArgs{FileUUID: fileUUID, Languages: &languages})
+	assert.NotNil(t, res.Error(), "no providers are configured")
+
+	r.subtitles = managers.NewSubtitleManager(
+		subtitles.NewOpenSubtitlesProviderWithURL(server.URL, "test-key", "", ""))
+
+	res = r.SearchSubtitles(userCtx, searchSubtitlesArgs{FileUUID: fileUUID, Languages: &languages})
+	assert.NotNil(t, res.Error(), "files in inaccessible libraries can't be searched")
+
+	res = r.SearchSubtitles(adminContext(), searchSubtitlesArgs{FileUUID: fileUUID, Languages: &languages})
+	require.Nil(t, res.Error())
+	require.Len(t, res.Results(), 1)
+	result := res.Results()[0]
+	assert.Equal(t, subtitles.ProviderOpenSubtitles, result.Provider())
+	assert.Equal(t, "42", result.ID())
+	assert.Equal(t, "ger", result.Language())
+	assert.True(t, result.Forced())
+
+	unknown := r.DownloadSubtitle(adminContext(), downloadSubtitleArgs{FileUUID: fileUUID, Provider: result.Provider(), ID: "43"})
+	assert.NotNil(t, unknown.Error(), "only subtitles that were found can be downloaded")
+
+	downloaded := r.DownloadSubtitle(adminContext(), downloadSubtitleArgs{FileUUID: fileUUID, Provider: result.Provider(), ID: result.ID()})
+	require.Nil(t, downloaded.Error())
+	assert.Equal(t, "ger", *downloaded.Stream().Language())
+	assert.True(t, downloaded.Stream().Forced())
+
+	streams := db.FindStreamsForMovieFileUUID(fileUUID)
+	require.Len(t, streams, 1)
+	assert.Equal(t, "subtitle", streams[0].StreamType)
+
+	again := r.DownloadSubtitle(adminContext(), downloadSubtitleArgs{FileUUID: fileUUID, Provider: result.Provider(), ID: result.ID()})
+	assert.NotNil(t, again.Error())
+	assert.Len(t, db.FindStreamsForMovieFileUUID(fileUUID), 1)
+}
@@ -0,0 +1,248 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// SyncJobResolver resolves a job that creates an offline copy of a file.
+type SyncJobResolver struct {
+	r      db.SyncJob
+	access db.LibraryAccess
+}
+
+// UUID returns the job's UUID.
+func (r *SyncJobResolver) UUID() string {
+	return r.r.UUID
+}
+
+// Item returns the movie or episode that is synced.
+func (r *SyncJobResolver) Item() *MediaItemResolver {
+	return findMediaItem(r.r.MediaUUID, r.access)
+}
+
+// Preset returns the name of the video preset the file is transcoded with.
+func (r *SyncJobResolver) Preset() string {
+	return r.r.Preset
+}
+
+// State returns whether the job is queued, running, done, failed or cancelled.
+func (r *SyncJobResolver) State() string {
+	return r.r.State
+}
+
+// Progress returns how much of the file has been transcoded, between 0 and 1.
+func (r *SyncJobResolver) Progress() float64 {
+	return r.r.Progress
+}
+
+// Error returns why the job failed.
+func (r *SyncJobResolver) Error() string {
+	return r.r.Error
+}
+
+// Size returns the size of the finished file in bytes.
+func (r *SyncJobResolver) Size() float64 {
+	return float64(r.r.Size)
+}
+
+// DownloadPath returns the path the finished file can be downloaded from.
+func (r *SyncJobResolver) DownloadPath() string {
+	return fmt.Sprintf("/olaris/s/sync/%s/download", r.r.UUID)
+}
+
+// CreatedAt returns when the job was created.
+func (r *SyncJobResolver) CreatedAt() string {
+	return r.r.CreatedAt.Format(time.RFC3339)
+}
+
+// SyncJobResponse holds a sync job and error if needed.
+type SyncJobResponse struct {
+	Error   *ErrorResolver
+	SyncJob *SyncJobResolver
+}
+
+// SyncJobResponseResolver resolves SyncJobResponse.
+type SyncJobResponseResolver struct {
+	r *SyncJobResponse
+}
+
+// Error returns error.
+func (r *SyncJobResponseResolver) Error() *ErrorResolver {
+	return r.r.Error
+}
+
+// SyncJob returns the sync job.
+func (r *SyncJobResponseResolver) SyncJob() *SyncJobResolver {
+	return r.r.SyncJob
+}
+
+// SyncJobsResponse holds the created sync jobs and error if needed.
+type SyncJobsResponse struct {
+	Error    *ErrorResolver
+	SyncJobs []*SyncJobResolver
+}
+
+// SyncJobsResponseResolver resolves SyncJobsResponse.
+type SyncJobsResponseResolver struct {
+	r *SyncJobsResponse
+}
+
+// Error returns error.
+func (r *SyncJobsResponseResolver) Error() *ErrorResolver {
+	return r.r.Error
+}
+
+// SyncJobs returns the sync jobs.
+func (r *SyncJobsResponseResolver) SyncJobs() []*SyncJobResolver {
+	return r.r.SyncJobs
+}
+
+// SyncJobs returns the sync jobs of a user, newest first.
+func (r *Resolver) SyncJobs(ctx context.Context, args struct{ UserID *int32 }) []*SyncJobResolver {
+	jobs := []*SyncJobResolver{}
+	userID, err := targetUserID(ctx, args.UserID)
+	if err != nil {
+		return jobs
+	}
+	access := libraryAccess(ctx)
+	for _, job := range db.FindSyncJobsForUser(userID) {
+		jobs = append(jobs, &SyncJobResolver{r: job, access: access})
+	}
+	return jobs
+}
+
+// SyncPresets returns the presets sync jobs can be created with.
+func (r *Resolver) SyncPresets() (presets []*string) {
+	names := ffmpeg.SyncPresets()
+	for i := range names {
+		presets = append(presets, &names[i])
+	}
+	return presets
+}
+
+// syncableFile is a file that can be synced together with the UUID of its movie or episode.
+type syncableFile struct {
+	mediaUUID string
+	filePath  string
+}
+
+// findSyncableFiles returns the files to sync for the movie, episode or season with the given
+// UUID. Only the first file of a movie or episode is synced.
+func findSyncableFiles(uuid string, access db.LibraryAccess) ([]syncableFile, error) {
+	if movie, err := db.FindMovieByUUID(uuid); err == nil {
+		if !access.AllowsMovie(movie.ID) {
+			return nil, fmt.Errorf("movie not found")
+		}
+		files := db.FindFilesForMovieUUID(uuid)
+		if len(files) == 0 {
+			return nil, fmt.Errorf("movie has no files")
+		}
+		return []syncableFile{{mediaUUID: uuid, filePath: files[0].FilePath}}, nil
+	}
+
+	var episodes []*db.Episode
+	if episode, err := db.FindEpisodeByUUID(uuid); err == nil {
+		episodes = []*db.Episode{episode}
+	} else if season, err := db.FindSeasonByUUID(uuid); err == nil {
+		episodes = season.Episodes
+	} else {
+		return nil, fmt.Errorf("no movie, episode or season with this UUID")
+	}
+
+	var files []syncableFile
+	for _, episode := range episodes {
+		if access.AllowsEpisode(episode.ID) && len(episode.EpisodeFiles) > 0 {
+			files = append(files, syncableFile{mediaUUID: episode.UUID, filePath: episode.EpisodeFiles[0].FilePath})
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no episode files found")
+	}
+	return files, nil
+}
+
+// CreateSyncJobs queues sync jobs for a movie, an episode or all episodes of a season.
+func (r *Resolver) CreateSyncJobs(ctx context.Context, args struct {
+	UUID   string
+	Preset string
+}) *SyncJobsResponseResolver {
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return &SyncJobsResponseResolver{&SyncJobsResponse{Error: CreateErrResolver(CreateNoAuthorisationError())}}
+	}
+
+	validPreset := false
+	for _, preset := range ffmpeg.SyncPresets() {
+		validPreset = validPreset || preset == args.Preset
+	}
+	if !validPreset {
+		return &SyncJobsResponseResolver{&SyncJobsResponse{
+			Error: CreateErrResolver(fmt.Errorf("no preset \"%s\"", args.Preset))}}
+	}
+
+	access := libraryAccess(ctx)
+	files, err := findSyncableFiles(args.UUID, access)
+	if err != nil {
+		return &SyncJobsResponseResolver{&SyncJobsResponse{Error: CreateErrResolver(err)}}
+	}
+
+	jobs := []*SyncJobResolver{}
+	for _, file := range files {
+		job := db.SyncJob{
+			UserID:    userID,
+			MediaUUID: file.mediaUUID,
+			FilePath:  file.filePath,
+			Preset:    args.Preset,
+		}
+		if err := r.sync.Queue(&job); err != nil {
+			return &SyncJobsResponseResolver{&SyncJobsResponse{Error: CreateErrResolver(err), SyncJobs: jobs}}
+		}
+		jobs = append(jobs, &SyncJobResolver{r: job, access: access})
+	}
+	return &SyncJobsResponseResolver{&SyncJobsResponse{SyncJobs: jobs}}
+}
+
+// findOwnSyncJob returns the sync job with the given UUID if the current user may manage it.
+func findOwnSyncJob(ctx context.Context, uuid string) (*db.SyncJob, error) {
+	job, err := db.FindSyncJobByUUID(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("sync job not found")
+	}
+	userID := int32(job.UserID)
+	if _, err := targetUserID(ctx, &userID); err != nil {
+		// Don't tell other users whether the job exists.
+		return nil, fmt.Errorf("sync job not found")
+	}
+	return job, nil
+}
+
+// CancelSyncJob stops a queued or running sync job. Users can cancel their own jobs, admins any job.
+func (r *Resolver) CancelSyncJob(ctx context.Context, args struct{ UUID string }) *SyncJobResponseResolver {
+	job, err := findOwnSyncJob(ctx, args.UUID)
+	if err != nil {
+		return &SyncJobResponseResolver{&SyncJobResponse{Error: CreateErrResolver(err)}}
+	}
+	if err := r.sync.Cancel(job); err != nil {
+		return &SyncJobResponseResolver{&SyncJobResponse{Error: CreateErrResolver(err)}}
+	}
+	return &SyncJobResponseResolver{&SyncJobResponse{SyncJob: &SyncJobResolver{r: *job, access: libraryAccess(ctx)}}}
+}
+
+// DeleteSyncJob cancels a sync job and removes it along with its file. Users can delete their own
+// jobs, admins any job.
+func (r *Resolver) DeleteSyncJob(ctx context.Context, args struct{ UUID string }) *SyncJobResponseResolver {
+	job, err := findOwnSyncJob(ctx, args.UUID)
+	if err != nil {
+		return &SyncJobResponseResolver{&SyncJobResponse{Error: CreateErrResolver(err)}}
+	}
+	if err := r.sync.Delete(job); err != nil {
+		return &SyncJobResponseResolver{&SyncJobResponse{Error: CreateErrResolver(err)}}
+	}
+	return &SyncJobResponseResolver{&SyncJobResponse{SyncJob: &SyncJobResolver{r: *job, access: libraryAccess(ctx)}}}
+}
@@ -0,0 +1,64 @@
+package resolvers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+type createSyncJobsArgs = struct {
+	UUID   string
+	Preset string
+}
+
+func TestSyncJobs(t *testing.T) {
+	metadataCtx := app.NewTestingMDContext(nil)
+	r := NewResolver(metadataCtx)
+
+	library := db.Library{Name: "Movies", FilePath: "/tmp/movies"}
+	metadataCtx.Db.Create(&library)
+	movie := createMovieInLibrary(&library, "Holiday")
+
+	admin, _ := db.CreateUser("admin", "adminadmin", true)
+	adminCtx := auth.ContextWithUserID(adminContext(), admin.ID)
+	user, _ := db.CreateUser("user", "useruser", false)
+	userCtx := auth.ContextWithUserID(context.Background(), user.ID)
+
+	presets := ffmpeg.SyncPresets()
+	require.NotEmpty(t, presets)
+	assert.Len(t, r.SyncPresets(), len(presets))
+
+	res := r.CreateSyncJobs(adminCtx, createSyncJobsArgs{UUID: movie.UUID, Preset: "no-such-preset"})
+	assert.NotNil(t, res.Error())
+	res = r.CreateSyncJobs(userCtx, createSyncJobsArgs{UUID: movie.UUID, Preset: presets[0]})
+	assert.NotNil(t, res.Error(), "Files from inaccessible libraries can't be synced")
+
+	res = r.CreateSyncJobs(adminCtx, createSyncJobsArgs{UUID: movie.UUID, Preset: presets[0]})
+	require.Nil(t, res.Error())
+	require.Len(t, res.SyncJobs(), 1)
+	job := res.SyncJobs()[0]
+	assert.Equal(t, presets[0], job.Preset())
+	assert.Equal(t, "Holiday", job.Item().r.(*MovieResolver).Title())
+	assert.Equal(t, "/olaris/s/sync/"+job.UUID()+"/download", job.DownloadPath())
+
+	assert.Len(t, r.SyncJobs(adminCtx, struct{ UserID *int32 }{}), 1)
+	assert.Len(t, r.SyncJobs(userCtx, struct{ UserID *int32 }{}), 0)
+	adminID := int32(admin.ID)
+	assert.Len(t, r.SyncJobs(userCtx, struct{ UserID *int32 }{&adminID}), 0,
+		"Users can't list the jobs of other users")
+
+	uuidArgs := struct{ UUID string }{job.UUID()}
+	assert.NotNil(t, r.CancelSyncJob(userCtx, uuidArgs).Error(), "Users can't cancel the jobs of other users")
+	assert.NotNil(t, r.DeleteSyncJob(userCtx, uuidArgs).Error(), "Users can't delete the jobs of other users")
+
+	deleted := r.DeleteSyncJob(adminCtx, uuidArgs)
+	assert.Nil(t, deleted.Error())
+	assert.Len(t, r.SyncJobs(adminCtx, struct{ UserID *int32 }{}), 0)
+	assert.NotNil(t, r.DeleteSyncJob(adminCtx, uuidArgs).Error())
+}
@@ -2,7 +2,6 @@ package resolvers
 
 import (
 	"context"
-	"github.com/ryanbradynd05/go-tmdb"
 	"gitlab.com/olaris/olaris-server/metadata/agents"
 )
 
@@ -13,20 +12,20 @@ type tmdbSearchMoviesArgs struct {
 func (r *Resolver) TmdbSearchMovies(ctx context.Context,
 	args *tmdbSearchMoviesArgs) ([]*TmdbMovieSearchItemResolver, error) {
 
-	searchRes, err := r.env.MetadataRetrievalAgent.TmdbSearchMovie(args.Query, nil)
+	searchRes, err := r.env.MetadataManager.SearchMovies(agents.MovieQuery{Title: args.Query})
 	if err != nil {
 		return nil, err
 	}
 
 	var res []*TmdbMovieSearchItemResolver
-	for _, movieResult := range searchRes.Results {
+	for _, movieResult := range searchRes {
 		res = append(res, &TmdbMovieSearchItemResolver{r: movieResult})
 	}
 	return res, nil
 }
 
 type TmdbMovieSearchItemResolver struct {
-	r tmdb.MovieShort
+	r agents.MovieSearchResult
 }
 
 func (r *TmdbMovieSearchItemResolver) Title() string {
@@ -51,7 +50,9 @@ func (r *TmdbMovieSearchItemResolver) Overview() string {
 }
 
 func (r *TmdbMovieSearchItemResolver) TmdbID() int32 {
-	return int32(r.r.ID)
+	// SearchMovies only returns results with TMDB IDs.
+	tmdbID, _ := r.r.ID.Int()
+	return int32(tmdbID)
 }
 
 func (r *TmdbMovieSearchItemResolver) BackdropPath() string {
@@ -69,33 +70,20 @@ type tmdbSearchSeriesArgs struct {
 func (r *Resolver) TmdbSearchSeries(ctx context.Context,
 	args *tmdbSearchSeriesArgs) ([]*TmdbSeriesSearchItemResolver, error) {
 
-	searchRes, err := r.env.MetadataRetrievalAgent.TmdbSearchTv(args.Query, nil)
+	searchRes, err := r.env.MetadataManager.SearchSeries(agents.SeriesQuery{Name: args.Query})
 	if err != nil {
 		return nil, err
 	}
 
 	var res []*TmdbSeriesSearchItemResolver
-	for _, seriesResult := range searchRes.Results {
+	for _, seriesResult := range searchRes {
 		res = append(res, &TmdbSeriesSearchItemResolver{r: seriesResult})
 	}
 	return res, nil
 }
 
 type TmdbSeriesSearchItemResolver struct {
-	// This struct is copied from tmdb.TvSearchResults, it doesn't have its own
-	// type name.
-	r struct {
-		BackdropPath  string `json:"backdrop_path"`
-		ID            int
-		OriginalName  string   `json:"original_name"`
-		FirstAirDate  string   `json:"first_air_date"`
-		OriginCountry []string `json:"origin_country"`
-		PosterPath    string   `json:"poster_path"`
-		Popularity    float32
-		Name          string
-		VoteAverage   float32 `json:"vote_average"`
-		VoteCount     uint32  `json:"vote_count"`
-	}
+	r agents.SeriesSearchResult
 }
 
 func (r *TmdbSeriesSearchItemResolver) Name() string {
@@ -115,7 +103,9 @@ func (r *TmdbSeriesSearchItemResolver) FirstAirYear() (*int32, error) {
 }
 
 func (r *TmdbSeriesSearchItemResolver) TmdbID() int32 {
-	return int32(r.r.ID)
+	// SearchSeries only returns results with TMDB IDs.
+	tmdbID, _ := r.r.ID.Int()
+	return int32(tmdbID)
 }
 
 func (r *TmdbSeriesSearchItemResolver) BackdropPath() string {
@@ -0,0 +1,58 @@
+package resolvers
+
+import (
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// TrickplayResolver resolves the seek-preview thumbnails of a file.
+type TrickplayResolver struct {
+	r ffmpeg.Trickplay
+}
+
+// Interval returns the seconds between two thumbnails.
+func (r *TrickplayResolver) Interval() float64 {
+	return r.r.Interval.Seconds()
+}
+
+// ThumbnailWidth returns the width of a thumbnail.
+func (r *TrickplayResolver) ThumbnailWidth() int32 {
+	return int32(r.r.ThumbnailWidth)
+}
+
+// ThumbnailHeight returns the height of a thumbnail.
+func (r *TrickplayResolver) ThumbnailHeight() int32 {
+	return int32(r.r.ThumbnailHeight)
+}
+
+// Columns returns the number of thumbnails per row of a sprite sheet.
+func (r *TrickplayResolver) Columns() int32 {
+	return int32(r.r.Columns)
+}
+
+// Rows returns the number of thumbnails per column of a sprite sheet.
+func (r *TrickplayResolver) Rows() int32 {
+	return int32(r.r.Rows)
+}
+
+// ThumbnailCount returns the total number of thumbnails.
+func (r *TrickplayResolver) ThumbnailCount() int32 {
+	return int32(r.r.ThumbnailCount)
+}
+
+func newTrickplayResolver(filePath string) *TrickplayResolver {
+	fileLocator, err := filesystem.ParseFileLocator(filePath)
+	if err != nil {
+		return nil
+	}
+	t, err := ffmpeg.GetTrickplay(fileLocator)
+	if err != nil {
+		log.WithError(err).WithField("filePath", filePath).Warnln("Failed to read trickplay info")
+		return nil
+	}
+	if t == nil {
+		return nil
+	}
+	return &TrickplayResolver{r: *t}
+}
@@ -1,6 +1,8 @@
 package resolvers
 
 import (
+	"context"
+
 	"gitlab.com/olaris/olaris-server/metadata/db"
 )
 
@@ -11,10 +13,11 @@ type unidentifiedEpisodeFilesArgs struct {
 
 // UnidentifiedEpisodeFiles returns unidentified episode files
 func (r *Resolver) UnidentifiedEpisodeFiles(
+	ctx context.Context,
 	args *unidentifiedEpisodeFilesArgs) []*EpisodeFileResolver {
 
 	qd := buildDatabaseQueryDetails(args.Offset, args.Limit)
-	episodeFiles, err := db.FindAllUnidentifiedEpisodeFiles(&qd)
+	episodeFiles, err := db.FindAllUnidentifiedEpisodeFiles(&qd, libraryAccess(ctx))
 	if err != nil {
 		return []*EpisodeFileResolver{}
 	}
@@ -27,7 +27,8 @@ func TestUnidentifiedEpisodeFiles(t *testing.T) {
 		},
 	})
 
-	response := r.UnidentifiedEpisodeFiles(&unidentifiedEpisodeFilesArgs{})
+	ctx := adminContext()
+	response := r.UnidentifiedEpisodeFiles(ctx, &unidentifiedEpisodeFilesArgs{})
 
 	assert.Len(t, response, 1)
 	filePath, _ := response[0].FilePath()
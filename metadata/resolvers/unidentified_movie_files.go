@@ -16,7 +16,7 @@ func (r *Resolver) UnidentifiedMovieFiles(
 	args *unidentifiedMovieFilesArgs) []*MovieFileResolver {
 
 	movieFiles, err := db.FindAllUnidentifiedMovieFiles(
-		buildDatabaseQueryDetails(args.Offset, args.Limit))
+		buildDatabaseQueryDetails(args.Offset, args.Limit), libraryAccess(ctx))
 	if err != nil {
 		return []*MovieFileResolver{}
 	}
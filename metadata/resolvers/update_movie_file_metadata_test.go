@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/agents"
 	"gitlab.com/olaris/olaris-server/metadata/agents/agentsfakes"
 	"gitlab.com/olaris/olaris-server/metadata/app"
 	"gitlab.com/olaris/olaris-server/metadata/auth"
@@ -30,8 +31,8 @@ func TestUpdateMovieFile(t *testing.T) {
 	}
 	db.SaveMovieFile(&movieFile)
 
-	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, tmdbID int) error {
-		movie.TmdbID = tmdbID
+	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, id agents.ExternalID) error {
+		movie.TmdbID, _ = id.Int()
 		movie.Title = "North of the Sun"
 		return nil
 	}
@@ -45,7 +46,7 @@ func TestUpdateMovieFile(t *testing.T) {
 		})
 
 	// Check that the Movie model was created
-	movies := db.FindAllMovies(nil)
+	movies := db.FindAllMovies(nil, db.FullLibraryAccess)
 	assert.Len(t, movies, 1)
 	assert.Equal(t, testTmdbID, movies[0].TmdbID)
 	assert.Equal(t, "North of the Sun", movies[0].Title)
@@ -57,9 +58,8 @@ func TestUpdateMovieFileUnknownTmdbID(t *testing.T) {
 
 	ctx := auth.ContextWithUserID(context.Background(), testUserID)
 
-	metadataCtx := app.NewTestingMDContext(nil)
 	tmdbAgent := agentsfakes.FakeMetadataRetrievalAgent{}
-	metadataCtx.MetadataRetrievalAgent = &tmdbAgent
+	metadataCtx := app.NewTestingMDContext(&tmdbAgent)
 	r := NewResolver(metadataCtx)
 
 	movieFile := db.MovieFile{
@@ -69,7 +69,7 @@ func TestUpdateMovieFileUnknownTmdbID(t *testing.T) {
 	}
 	db.SaveMovieFile(&movieFile)
 
-	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, tmdbID int) error {
+	tmdbAgent.UpdateMovieMDStub = func(movie *db.Movie, id agents.ExternalID) error {
 		// Don't modify for this test, the movie was not found in Tmdb.
 		return errors.New("Not found")
 	}
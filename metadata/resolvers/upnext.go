@@ -11,13 +11,14 @@ import (
 // UpNext returns episode/movie that could populate a dashboard.
 func (r *Resolver) UpNext(ctx context.Context) *[]*MediaItemResolver {
 	userID, _ := auth.UserID(ctx)
+	access := libraryAccess(ctx)
 	sortables := []sortable{}
 
-	for _, movie := range db.UpNextMovies(userID) {
+	for _, movie := range db.UpNextMovies(userID, access) {
 		sortables = append(sortables, movie)
 	}
 
-	for _, ep := range db.UpNextEpisodes(userID) {
+	for _, ep := range db.UpNextEpisodes(userID, access) {
 		sortables = append(sortables, ep)
 
 	}
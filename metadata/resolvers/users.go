@@ -2,6 +2,8 @@ package resolvers
 
 import (
 	"context"
+	"fmt"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
 	"gitlab.com/olaris/olaris-server/metadata/db"
 )
 
@@ -73,3 +75,29 @@ func (r *Resolver) DeleteUser(ctx context.Context, args struct{ ID int32 }) *Use
 	return &UserResponseResolver{&UserResponse{User: &UserResolver{user}}}
 
 }
+
+// ChangePassword changes the password of the current user.
+func (r *Resolver) ChangePassword(ctx context.Context, args struct {
+	CurrentPassword string
+	NewPassword     string
+}) *UserResponseResolver {
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(CreateNoAuthorisationError())}}
+	}
+
+	user, err := db.FindUser(userID)
+	if err != nil {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(err)}}
+	}
+
+	if !user.ValidPassword(args.CurrentPassword) {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(fmt.Errorf("invalid password"))}}
+	}
+
+	if err := db.ChangePassword(user, args.NewPassword); err != nil {
+		return &UserResponseResolver{&UserResponse{Error: CreateErrResolver(err)}}
+	}
+
+	return &UserResponseResolver{&UserResponse{User: &UserResolver{*user}}}
+}
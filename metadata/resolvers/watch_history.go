@@ -0,0 +1,213 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+type watchHistoryUserArgs struct {
+	UserID   *int32
+	AllUsers bool
+}
+
+// historyUserID returns the user whose history was requested, or 0 for all users.
+func historyUserID(ctx context.Context, args watchHistoryUserArgs) (uint, error) {
+	if args.AllUsers {
+		if err := ifAdmin(ctx); err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	return targetUserID(ctx, args.UserID)
+}
+
+// WatchEventResolver resolves an entry of the watch history.
+type WatchEventResolver struct {
+	r      db.WatchEvent
+	access db.LibraryAccess
+}
+
+// Kind returns what happened.
+func (r *WatchEventResolver) Kind() string {
+	return r.r.Kind
+}
+
+// UserID returns the ID of the user who watched.
+func (r *WatchEventResolver) UserID() int32 {
+	return int32(r.r.UserID)
+}
+
+// Item returns the movie or episode that was watched.
+func (r *WatchEventResolver) Item() *MediaItemResolver {
+	return findMediaItem(r.r.MediaUUID, r.access)
+}
+
+// Playtime returns the playback position in seconds.
+func (r *WatchEventResolver) Playtime() float64 {
+	return r.r.Playtime
+}
+
+// Finished returns whether the item was watched to the end.
+func (r *WatchEventResolver) Finished() bool {
+	return r.r.Finished
+}
+
+// WatchedSeconds returns how long the user streamed.
+func (r *WatchEventResolver) WatchedSeconds() float64 {
+	return r.r.WatchedSeconds
+}
+
+// CreatedAt returns when it happened.
+func (r *WatchEventResolver) CreatedAt() string {
+	return r.r.CreatedAt.Format(time.RFC3339)
+}
+
+// WatchHistory returns the watch history of a user or all users.
+func (r *Resolver) WatchHistory(ctx context.Context, args struct {
+	watchHistoryUserArgs
+	Offset *int32
+	Limit  *int32
+}) (events []*WatchEventResolver) {
+	userID, err := historyUserID(ctx, args.watchHistoryUserArgs)
+	if err != nil {
+		return events
+	}
+
+	qd := buildDatabaseQueryDetails(args.Offset, args.Limit)
+	access := libraryAccess(ctx)
+	for _, e := range db.WatchHistoryForUser(userID, qd.Offset, qd.Limit) {
+		events = append(events, &WatchEventResolver{r: e, access: access})
+	}
+	return events
+}
+
+// DailyWatchTotalResolver resolves the time spent watching on a day.
+type DailyWatchTotalResolver struct {
+	r db.DailyWatchTotal
+}
+
+// Day returns the date.
+func (r *DailyWatchTotalResolver) Day() string {
+	return r.r.Day.Format("2006-01-02")
+}
+
+// WatchedSeconds returns the time spent watching.
+func (r *DailyWatchTotalResolver) WatchedSeconds() float64 {
+	return r.r.WatchedSeconds
+}
+
+// Plays returns how often something was watched.
+func (r *DailyWatchTotalResolver) Plays() int32 {
+	return int32(r.r.Plays)
+}
+
+// maxDailyWatchTotalDays is the maximum number of days DailyWatchTotals returns.
+const maxDailyWatchTotalDays = 366
+
+// DailyWatchTotals returns the time spent watching per day, for at most maxDailyWatchTotalDays.
+func (r *Resolver) DailyWatchTotals(ctx context.Context, args struct {
+	watchHistoryUserArgs
+	Days int32
+}) (totals []*DailyWatchTotalResolver, err error) {
+	if args.Days < 1 {
+		return nil, fmt.Errorf("days must be at least 1")
+	}
+	if args.Days > maxDailyWatchTotalDays {
+		args.Days = maxDailyWatchTotalDays
+	}
+	userID, err := historyUserID(ctx, args.watchHistoryUserArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().AddDate(0, 0, -int(args.Days-1))
+	for _, t := range db.DailyWatchTotals(userID, since) {
+		totals = append(totals, &DailyWatchTotalResolver{r: t})
+	}
+	return totals, nil
+}
+
+// MostWatchedMovieResolver resolves a movie and how much it was watched.
+type MostWatchedMovieResolver struct {
+	r     db.MostWatched
+	movie db.Movie
+}
+
+// Movie returns the movie.
+func (r *MostWatchedMovieResolver) Movie() *MovieResolver {
+	return &MovieResolver{r: r.movie}
+}
+
+// WatchedSeconds returns the time spent watching the movie.
+func (r *MostWatchedMovieResolver) WatchedSeconds() float64 {
+	return r.r.WatchedSeconds
+}
+
+// Plays returns how often the movie was watched.
+func (r *MostWatchedMovieResolver) Plays() int32 {
+	return int32(r.r.Plays)
+}
+
+// MostWatchedMovies returns the movies that were watched the longest.
+func (r *Resolver) MostWatchedMovies(ctx context.Context, args struct {
+	watchHistoryUserArgs
+	Limit int32
+}) (movies []*MostWatchedMovieResolver) {
+	userID, err := historyUserID(ctx, args.watchHistoryUserArgs)
+	if err != nil {
+		return movies
+	}
+
+	for _, m := range db.MostWatchedMovies(userID, libraryAccess(ctx), int(args.Limit)) {
+		movie, err := db.FindMovieByID(m.ID)
+		if err != nil {
+			continue
+		}
+		movies = append(movies, &MostWatchedMovieResolver{r: m, movie: *movie})
+	}
+	return movies
+}
+
+// MostWatchedSeriesResolver resolves a series and how much it was watched.
+type MostWatchedSeriesResolver struct {
+	r      db.MostWatched
+	series db.Series
+}
+
+// Series returns the series.
+func (r *MostWatchedSeriesResolver) Series() *SeriesResolver {
+	return &SeriesResolver{r: r.series}
+}
+
+// WatchedSeconds returns the time spent watching episodes of the series.
+func (r *MostWatchedSeriesResolver) WatchedSeconds() float64 {
+	return r.r.WatchedSeconds
+}
+
+// Plays returns how often episodes of the series were watched.
+func (r *MostWatchedSeriesResolver) Plays() int32 {
+	return int32(r.r.Plays)
+}
+
+// MostWatchedSeries returns the series that were watched the longest.
+func (r *Resolver) MostWatchedSeries(ctx context.Context, args struct {
+	watchHistoryUserArgs
+	Limit int32
+}) (series []*MostWatchedSeriesResolver) {
+	userID, err := historyUserID(ctx, args.watchHistoryUserArgs)
+	if err != nil {
+		return series
+	}
+
+	for _, m := range db.MostWatchedSeries(userID, libraryAccess(ctx), int(args.Limit)) {
+		s, err := db.FindSeries(m.ID)
+		if err != nil {
+			continue
+		}
+		series = append(series, &MostWatchedSeriesResolver{r: m, series: *s})
+	}
+	return series
+}
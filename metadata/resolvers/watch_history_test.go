@@ -0,0 +1,72 @@
+package resolvers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/metadata/app"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+type watchHistoryArgs = struct {
+	watchHistoryUserArgs
+	Offset *int32
+	Limit  *int32
+}
+
+func TestWatchHistory(t *testing.T) {
+	r := NewResolver(app.NewTestingMDContext(nil))
+	alice, _ := db.CreateUser("alice", "alicealice", false)
+	bob, _ := db.CreateUser("bob", "bobbobbob", false)
+
+	ctx := auth.ContextWithUserID(context.Background(), alice.ID)
+	r.CreatePlayState(ctx, &playStateArgs{UUID: "movie-uuid", Playtime: 42})
+	r.CreatePlayState(ctx, &playStateArgs{UUID: "movie-uuid", Playtime: 84})
+	db.CreateWatchEvent(&db.WatchEvent{UserID: bob.ID, Kind: db.WatchEventPlaybackStopped, WatchedSeconds: 60})
+
+	history := r.WatchHistory(ctx, watchHistoryArgs{})
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, db.WatchEventProgress, history[0].Kind())
+		assert.Equal(t, 84.0, history[0].Playtime())
+		assert.Nil(t, history[0].Item(), "Unknown media")
+	}
+
+	bobID := int32(bob.ID)
+	assert.Empty(t, r.WatchHistory(ctx, watchHistoryArgs{watchHistoryUserArgs: watchHistoryUserArgs{UserID: &bobID}}),
+		"Users can't see other users' history")
+	assert.Empty(t, r.WatchHistory(ctx, watchHistoryArgs{watchHistoryUserArgs: watchHistoryUserArgs{AllUsers: true}}))
+
+	adminCtx := context.WithValue(ctx, auth.ContextKeyIsAdmin, true)
+	assert.Len(t, r.WatchHistory(adminCtx, watchHistoryArgs{watchHistoryUserArgs: watchHistoryUserArgs{UserID: &bobID}}), 1)
+	assert.Len(t, r.WatchHistory(adminCtx, watchHistoryArgs{watchHistoryUserArgs: watchHistoryUserArgs{AllUsers: true}}), 3)
+}
+
+type dailyWatchTotalsArgs = struct {
+	watchHistoryUserArgs
+	Days int32
+}
+
+func TestDailyWatchTotals(t *testing.T) {
+	r := NewResolver(app.NewTestingMDContext(nil))
+	alice, _ := db.CreateUser("alice", "alicealice", false)
+	db.CreateWatchEvent(&db.WatchEvent{UserID: alice.ID, Kind: db.WatchEventPlaybackStopped, WatchedSeconds: 60})
+	ctx := auth.ContextWithUserID(context.Background(), alice.ID)
+
+	totals, err := r.DailyWatchTotals(ctx, dailyWatchTotalsArgs{Days: 7})
+	assert.NoError(t, err)
+	if assert.Len(t, totals, 7) {
+		assert.Equal(t, 60.0, totals[6].WatchedSeconds())
+		assert.EqualValues(t, 1, totals[6].Plays())
+	}
+
+	totals, err = r.DailyWatchTotals(ctx, dailyWatchTotalsArgs{Days: 1 << 30})
+	assert.NoError(t, err)
+	assert.Len(t, totals, maxDailyWatchTotalDays)
+
+	for _, days := range []int32{0, -5} {
+		_, err = r.DailyWatchTotals(ctx, dailyWatchTotalsArgs{Days: days})
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,66 @@
+package subtitles
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rclone/rclone/vfs"
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// How much of the start and the end of a file goes into its hash.
+const hashChunkSize = 64 * 1024
+
+type readerAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// FileHash computes the hash that OpenSubtitles identifies media files by: the size of the file
+// plus the sum of the 64-bit words in its first and last 64 KiB.
+func FileHash(fileLocator filesystem.FileLocator) (string, error) {
+	node, err := filesystem.GetNodeFromFileLocator(fileLocator)
+	if err != nil {
+		return "", err
+	}
+	f, err := openNode(node)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f, node.Size())
+}
+
+func openNode(node filesystem.Node) (readerAtCloser, error) {
+	switch n := node.(type) {
+	case *filesystem.LocalNode:
+		return os.Open(n.Path())
+	case *filesystem.RcloneNode:
+		file, ok := n.Node.(*vfs.File)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a file", node.FileLocator())
+		}
+		return file.Open(os.O_RDONLY)
+	}
+	return nil, fmt.Errorf("can't open files of backend %d", node.BackendType())
+}
+
+func hashReader(r io.ReaderAt, size int64) (string, error) {
+	if size < hashChunkSize {
+		return "", fmt.Errorf("file is too small to be hashed")
+	}
+
+	hash := uint64(size)
+	buf := make([]byte, hashChunkSize)
+	for _, offset := range []int64{0, size - hashChunkSize} {
+		if _, err := r.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return "", err
+		}
+		for i := 0; i < hashChunkSize; i += 8 {
+			hash += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
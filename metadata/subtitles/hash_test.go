@@ -0,0 +1,34 @@
+package subtitles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashReader(t *testing.T) {
+	data := make([]byte, 3*hashChunkSize)
+	binary.LittleEndian.PutUint64(data, 1)
+	binary.LittleEndian.PutUint64(data[len(data)-8:], 2)
+	// Only the first and the last chunk count
+	binary.LittleEndian.PutUint64(data[hashChunkSize+8:], 1000)
+
+	hash, err := hashReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "0000000000030003", hash)
+
+	_, err = hashReader(bytes.NewReader(data[:100]), 100)
+	assert.Error(t, err)
+}
+
+func TestLanguageCodes(t *testing.T) {
+	assert.Equal(t, "en", toISO6391("eng"))
+	assert.Equal(t, "de", toISO6391("deu"))
+	assert.Equal(t, "en", toISO6391("en"))
+	assert.Equal(t, "eng", fromISO6391("en"))
+	assert.Equal(t, "por", fromISO6391("pt-BR"))
+	assert.Equal(t, "ko", fromISO6391("ko"))
+}
@@ -0,0 +1,63 @@
+package subtitles
+
+import "strings"
+
+// Two-letter ISO 639-1 codes, which OpenSubtitles uses, for the ISO 639-2 tags that ffprobe and
+// the rest of olaris use.
+var langTagToISO6391 = map[string]string{
+	"eng": "en",
+	"ger": "de",
+	"jpn": "ja",
+	"ita": "it",
+	"fre": "fr",
+	"spa": "es",
+	"dut": "nl",
+	"por": "pt",
+	"pol": "pl",
+	"rus": "ru",
+	"vie": "vi",
+	"hun": "hu",
+}
+
+// Tags that mean the same as one of the above, ffprobe reports both.
+var langTagAliases = map[string]string{
+	"deu": "ger",
+	"fra": "fre",
+	"nld": "dut",
+}
+
+var iso6391ToLangTag = func() map[string]string {
+	m := map[string]string{}
+	for tag, code := range langTagToISO6391 {
+		m[code] = tag
+	}
+	return m
+}()
+
+// toISO6391 returns the two-letter code for the given language tag, or the tag itself if it's
+// already a code or unknown.
+func toISO6391(tag string) string {
+	tag = strings.ToLower(tag)
+	if alias, ok := langTagAliases[tag]; ok {
+		tag = alias
+	}
+	if code, ok := langTagToISO6391[tag]; ok {
+		return code
+	}
+	return tag
+}
+
+// fromISO6391 returns the language tag for the given two-letter code. Regional variants like
+// "pt-BR" are mapped to the language.
+func fromISO6391(code string) string {
+	code = strings.ToLower(code)
+	if tag, ok := iso6391ToLangTag[code]; ok {
+		return tag
+	}
+	if base, _, ok := strings.Cut(code, "-"); ok {
+		if tag, ok := iso6391ToLangTag[base]; ok {
+			return tag
+		}
+	}
+	return code
+}
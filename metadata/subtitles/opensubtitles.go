@@ -0,0 +1,247 @@
+package subtitles
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/olaris/olaris-server/helpers"
+)
+
+// OpenSubtitlesAPIURL is the base URL of the OpenSubtitles REST API.
+const OpenSubtitlesAPIURL = "https://api.opensubtitles.com/api/v1"
+
+// Subtitle files are small, anything bigger is not a subtitle.
+const maxSubtitleSize = 10 * 1024 * 1024
+
+// OpenSubtitlesProvider finds subtitles on opensubtitles.com.
+type OpenSubtitlesProvider struct {
+	apiKey   string
+	username string
+	password string
+	baseURL  string
+	client   *http.Client
+
+	mtx sync.Mutex
+	// Token of the logged in user, downloads without one are severely limited.
+	token string
+}
+
+// NewOpenSubtitlesProvider creates a provider that uses the given API key. The username and
+// password of an opensubtitles.com account are optional.
+func NewOpenSubtitlesProvider(apiKey, username, password string) *OpenSubtitlesProvider {
+	return NewOpenSubtitlesProviderWithURL(OpenSubtitlesAPIURL, apiKey, username, password)
+}
+
+// NewOpenSubtitlesProviderWithURL creates a provider that uses the API at the given URL,
+// e.g. a local stand-in for tests.
+func NewOpenSubtitlesProviderWithURL(baseURL, apiKey, username, password string) *OpenSubtitlesProvider {
+	return &OpenSubtitlesProvider{
+		apiKey:   apiKey,
+		username: username,
+		password: password,
+		baseURL:  baseURL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name returns the name of the provider.
+func (p *OpenSubtitlesProvider) Name() string {
+	return ProviderOpenSubtitles
+}
+
+type openSubtitlesSearchResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Language         string `json:"language"`
+			Release          string `json:"release"`
+			DownloadCount    int    `json:"download_count"`
+			HearingImpaired  bool   `json:"hearing_impaired"`
+			ForeignPartsOnly bool   `json:"foreign_parts_only"`
+			MoviehashMatch   bool   `json:"moviehash_match"`
+			Files            []struct {
+				FileID   int    `json:"file_id"`
+				FileName string `json:"file_name"`
+			} `json:"files"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// Search finds subtitles by file hash and by TMDB or IMDB ID. Subtitles that match the hash
+// come first, then the most downloaded ones.
+func (p *OpenSubtitlesProvider) Search(query Query) ([]Result, error) {
+	params := url.Values{}
+	if query.Hash != "" {
+		params.Set("moviehash", query.Hash)
+	}
+	if query.SeriesTmdbID != 0 {
+		params.Set("parent_tmdb_id", strconv.Itoa(query.SeriesTmdbID))
+		params.Set("season_number", strconv.Itoa(query.SeasonNum))
+		params.Set("episode_number", strconv.Itoa(query.EpisodeNum))
+	} else if query.TmdbID != 0 {
+		params.Set("tmdb_id", strconv.Itoa(query.TmdbID))
+	} else if query.ImdbID != "" {
+		// The API wants the number without the "tt" prefix.
+		params.Set("imdb_id", strings.TrimLeft(strings.TrimPrefix(query.ImdbID, "tt"), "0"))
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("the file has neither a hash nor a TMDB or IMDB ID to search subtitles with")
+	}
+	if len(query.Languages) > 0 {
+		var languages []string
+		for _, l := range query.Languages {
+			languages = append(languages, toISO6391(l))
+		}
+		// The API redirects to the sorted list otherwise.
+		sort.Strings(languages)
+		params.Set("languages", strings.Join(languages, ","))
+	}
+
+	var res openSubtitlesSearchResponse
+	if err := p.request(http.MethodGet, "/subtitles?"+params.Encode(), nil, "", &res); err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, d := range res.Data {
+		// Subtitles split across several files for multi-disc releases can't be used.
+		if len(d.Attributes.Files) != 1 {
+			continue
+		}
+		results = append(results, Result{
+			Provider:        ProviderOpenSubtitles,
+			ID:              strconv.Itoa(d.Attributes.Files[0].FileID),
+			Language:        fromISO6391(d.Attributes.Language),
+			Release:         d.Attributes.Release,
+			Forced:          d.Attributes.ForeignPartsOnly,
+			HearingImpaired: d.Attributes.HearingImpaired,
+			HashMatch:       d.Attributes.MoviehashMatch,
+			DownloadCount:   d.Attributes.DownloadCount,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].HashMatch != results[j].HashMatch {
+			return results[i].HashMatch
+		}
+		return results[i].DownloadCount > results[j].DownloadCount
+	})
+	return results, nil
+}
+
+// Download returns the subtitle file with the given file ID.
+func (p *OpenSubtitlesProvider) Download(id string) (string, []byte, error) {
+	fileID, err := strconv.Atoi(id)
+	if err != nil {
+		return "", nil, errors.Wrap(ErrNotFound, "invalid OpenSubtitles file ID")
+	}
+	token, err := p.login()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var link struct {
+		Link     string `json:"link"`
+		FileName string `json:"file_name"`
+	}
+	if err := p.request(http.MethodPost, "/download", map[string]int{"file_id": fileID}, token, &link); err != nil {
+		return "", nil, err
+	}
+
+	res, err := p.client.Get(link.Link)
+	if err != nil {
+		return "", nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("OpenSubtitles returned HTTP %d for the subtitle file", res.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSubtitleSize))
+	if err != nil {
+		return "", nil, err
+	}
+	return link.FileName, data, nil
+}
+
+// login returns the token of the configured user, logging in if needed. It returns an empty token
+// if no user is configured.
+func (p *OpenSubtitlesProvider) login() (string, error) {
+	if p.username == "" {
+		return "", nil
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.token != "" {
+		return p.token, nil
+	}
+
+	var res struct {
+		Token string `json:"token"`
+	}
+	credentials := map[string]string{"username": p.username, "password": p.password}
+	if err := p.request(http.MethodPost, "/login", credentials, "", &res); err != nil {
+		return "", errors.Wrap(err, "failed to log in to OpenSubtitles")
+	}
+	p.token = res.Token
+	return p.token, nil
+}
+
+// request calls the API and decodes the JSON response into result. body is sent as JSON if not nil.
+func (p *OpenSubtitlesProvider) request(method, path string, body interface{}, token string, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, p.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Api-Key", p.apiKey)
+	req.Header.Set("User-Agent", "olaris-server v"+helpers.Version)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&status)
+		if res.StatusCode == http.StatusNotFound {
+			return errors.Wrapf(ErrNotFound, "OpenSubtitles returned %s", status.Message)
+		}
+		if res.StatusCode == http.StatusUnauthorized && token != "" {
+			// The token expired, log in again next time.
+			p.mtx.Lock()
+			p.token = ""
+			p.mtx.Unlock()
+		}
+		return fmt.Errorf("OpenSubtitles returned HTTP %d: %s", res.StatusCode, status.Message)
+	}
+
+	return json.NewDecoder(res.Body).Decode(result)
+}
@@ -0,0 +1,125 @@
+package subtitles_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/metadata/subtitles"
+)
+
+const testSearchResponse = `{
+	"total_count": 3,
+	"data": [
+		{"id": "1", "type": "subtitle", "attributes": {
+			"language": "en", "release": "Movie.2019.720p.WEB", "download_count": 500,
+			"hearing_impaired": false, "foreign_parts_only": false, "moviehash_match": false,
+			"files": [{"file_id": 101, "file_name": "Movie.2019.720p.WEB.srt"}]}},
+		{"id": "2", "type": "subtitle", "attributes": {
+			"language": "pt-BR", "release": "Movie.2019.1080p.BluRay", "download_count": 20,
+			"hearing_impaired": true, "foreign_parts_only": false, "moviehash_match": true,
+			"files": [{"file_id": 102, "file_name": "Movie.2019.1080p.BluRay.srt"}]}},
+		{"id": "3", "type": "subtitle", "attributes": {
+			"language": "en", "release": "Movie.2019.DVDRip", "download_count": 900,
+			"files": [{"file_id": 103, "file_name": "cd1.srt"}, {"file_id": 104, "file_name": "cd2.srt"}]}}
+	]
+}`
+
+// newTestOpenSubtitlesServer stands in for the OpenSubtitles API.
+func newTestOpenSubtitlesServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+			assert.Equal(t, "test-key", r.Header.Get("Api-Key"))
+			assert.NotEmpty(t, r.Header.Get("User-Agent"))
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/subtitles":
+			assert.Equal(t, "0123456789abcdef", r.URL.Query().Get("moviehash"))
+			assert.Equal(t, "603", r.URL.Query().Get("tmdb_id"))
+			assert.Equal(t, "en,pt", r.URL.Query().Get("languages"))
+			fmt.Fprint(w, testSearchResponse)
+		case "/api/v1/login":
+			var credentials map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&credentials))
+			if credentials["username"] != "user" || credentials["password"] != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"message": "Error, invalid username/password combination", "status": 401}`)
+				return
+			}
+			fmt.Fprint(w, `{"token": "test-token", "status": 200}`)
+		case "/api/v1/download":
+			assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+			var body map[string]int
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			if body["file_id"] != 101 {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "File not found", "status": 404}`)
+				return
+			}
+			fmt.Fprintf(w, `{"link": "%s/files/101.srt", "file_name": "Movie.2019.720p.WEB.srt", "remaining": 99}`, server.URL)
+		case "/files/101.srt":
+			// The download link is for a file server that doesn't need the API key
+			fmt.Fprint(w, "1\n00:00:01,000 --> 00:00:02,000\nHello\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestOpenSubtitlesSearch(t *testing.T) {
+	server := newTestOpenSubtitlesServer(t)
+	defer server.Close()
+	p := subtitles.NewOpenSubtitlesProviderWithURL(server.URL+"/api/v1", "test-key", "", "")
+
+	results, err := p.Search(subtitles.Query{
+		Hash:      "0123456789abcdef",
+		TmdbID:    603,
+		ImdbID:    "tt0133093",
+		Languages: []string{"por", "eng"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2, "multi-disc subtitles are skipped")
+
+	// Subtitles that match the hash come first
+	assert.Equal(t, subtitles.Result{
+		Provider:        subtitles.ProviderOpenSubtitles,
+		ID:              "102",
+		Language:        "por",
+		Release:         "Movie.2019.1080p.BluRay",
+		HearingImpaired: true,
+		HashMatch:       true,
+		DownloadCount:   20,
+	}, results[0])
+	assert.Equal(t, "101", results[1].ID)
+	assert.Equal(t, "eng", results[1].Language)
+
+	_, err = p.Search(subtitles.Query{})
+	assert.Error(t, err, "there is nothing to search with")
+}
+
+func TestOpenSubtitlesDownload(t *testing.T) {
+	server := newTestOpenSubtitlesServer(t)
+	defer server.Close()
+	p := subtitles.NewOpenSubtitlesProviderWithURL(server.URL+"/api/v1", "test-key", "user", "secret")
+
+	fileName, data, err := p.Download("101")
+	require.NoError(t, err)
+	assert.Equal(t, "Movie.2019.720p.WEB.srt", fileName)
+	assert.Contains(t, string(data), "Hello")
+
+	_, _, err = p.Download("999")
+	assert.True(t, errors.Is(err, subtitles.ErrNotFound))
+
+	wrongPassword := subtitles.NewOpenSubtitlesProviderWithURL(server.URL+"/api/v1", "test-key", "user", "wrong")
+	_, _, err = wrongPassword.Download("101")
+	assert.Error(t, err)
+}
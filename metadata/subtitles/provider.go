@@ -0,0 +1,74 @@
+// Package subtitles finds subtitles for media files in online databases.
+package subtitles
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Names of the available providers.
+const (
+	ProviderOpenSubtitles = "opensubtitles"
+)
+
+// ErrNotFound is returned for subtitles that the provider doesn't know (anymore).
+var ErrNotFound = errors.New("subtitle not found")
+
+// Query describes the media file to find subtitles for. Providers use whatever identifies the
+// file best, the hash first.
+type Query struct {
+	// Hash is the OpenSubtitles hash of the file, see FileHash. Empty if unknown.
+	Hash string
+	// TmdbID and ImdbID identify a movie. They are 0 and empty if unknown.
+	TmdbID int
+	ImdbID string
+	// SeriesTmdbID, SeasonNum and EpisodeNum identify an episode.
+	SeriesTmdbID int
+	SeasonNum    int
+	EpisodeNum   int
+	// Languages are ISO 639-2 tags like "eng". No languages means all of them.
+	Languages []string
+}
+
+// Result is a subtitle that matched a Query.
+type Result struct {
+	Provider string
+	// ID identifies the subtitle at the provider, it's what Download takes.
+	ID string
+	// Language is an ISO 639-2 tag if the provider's language is known, otherwise what it returned.
+	Language string
+	// Release is the name of the release that the subtitle was made for.
+	Release         string
+	Forced          bool
+	HearingImpaired bool
+	// HashMatch is true if the subtitle was made for exactly this file, so it's in sync.
+	HashMatch     bool
+	DownloadCount int
+}
+
+// Provider searches and downloads subtitles from an online database.
+type Provider interface {
+	// Name returns the name of the provider, one of the Provider* constants.
+	Name() string
+	Search(query Query) ([]Result, error)
+	// Download returns the name and the contents of the subtitle file with the given ID.
+	Download(id string) (fileName string, data []byte, err error)
+}
+
+// ProviderOptions configures the providers.
+type ProviderOptions struct {
+	OpenSubtitlesAPIKey   string
+	OpenSubtitlesUsername string
+	OpenSubtitlesPassword string
+}
+
+// NewProviders returns the providers that are configured. OpenSubtitles needs an API key.
+func NewProviders(options ProviderOptions) []Provider {
+	var providers []Provider
+	if options.OpenSubtitlesAPIKey != "" {
+		providers = append(providers, NewOpenSubtitlesProvider(
+			options.OpenSubtitlesAPIKey,
+			options.OpenSubtitlesUsername,
+			options.OpenSubtitlesPassword))
+	}
+	return providers
+}
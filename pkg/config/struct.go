@@ -22,6 +22,29 @@ type ServerConfig struct {
 	DBConn           string
 	DirectFileAccess bool
 	SystemFFMPEG     bool
+	Transcoder       TranscoderConfig
+}
+
+// TranscoderConfig is for video encoding settings
+type TranscoderConfig struct {
+	// One of "software" (default), "vaapi", "nvenc" or "qsv"
+	Backend string
+	// Backend-specific device, e.g. the VAAPI render node or the NVENC GPU index
+	Device string
+	Ladder LadderConfig
+}
+
+// LadderConfig is for the transcoding ladder, the lower quality versions offered for adaptive
+// streaming
+type LadderConfig struct {
+	// Heights of the rungs, rungs taller than the source are left out
+	Heights []int
+	// Add a rung at the source's height if it's between two rungs, e.g. 576 for a DVD
+	SourceRung bool
+	// Never encode at a higher bitrate than the source
+	CapAtSourceBitrate bool
+	// Bitrate multiplier for video with more than 30 frames per second
+	HighFrameRateFactor float64
 }
 
 // LibraryConfig is for library settings
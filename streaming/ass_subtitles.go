@@ -0,0 +1,58 @@
+package streaming
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+)
+
+// assSubtitleURI returns the URI that the given ASS subtitle stream can be downloaded from.
+func assSubtitleURI(s ffmpeg.Stream) (string, error) {
+	// The stream may be in an external file next to the video file, so use its own FileLocator.
+	jwt, err := auth.CreateStreamingJWT(0, s.FileLocator.String())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/olaris/s/files/jwt/%s/%d/subtitle.ass", jwt, s.StreamId), nil
+}
+
+// serveASSSubtitle serves an ASS/SSA subtitle stream as it is, styling included, for clients
+// that render the subtitles themselves. Other subtitle streams are only available as WebVTT.
+func serveASSSubtitle(w http.ResponseWriter, r *http.Request) {
+	fileLocator, statusErr := getFileLocatorOrFail(r)
+	if statusErr != nil {
+		http.Error(w, statusErr.Error(), statusErr.Status())
+		return
+	}
+	streamKey, err := getStreamKey(fileLocator, mux.Vars(r)["streamId"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	container, err := ffmpeg.Probe(fileLocator)
+	if err != nil {
+		http.Error(w, "Failed to probe file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	isASS := false
+	for _, s := range container.Streams {
+		if int64(s.Index) == streamKey.StreamId {
+			isASS = ffmpeg.Stream{StreamType: s.CodecType, CodecName: s.CodecName}.IsASSSubtitle()
+		}
+	}
+	if !isASS {
+		http.Error(w, "No ASS subtitle stream with this ID", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-ssa")
+	if err := ffmpeg.ExtractASSSubtitle(r.Context(), streamKey, w); err != nil {
+		// The headers are gone by now, all we can do is log.
+		log.WithError(err).WithField("fileLocator", fileLocator.String()).Warnln("Failed to serve ASS subtitles")
+	}
+}
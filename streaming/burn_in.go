@@ -0,0 +1,42 @@
+package streaming
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+)
+
+// getBurnInSubtitleStream returns the bitmap subtitle stream that the client asked to have burnt
+// into the video with the burnSubtitle query parameter, or nil if it didn't ask for one. Bitmap
+// subtitles can't be served as WebVTT tracks, so this is the only way to show them.
+func getBurnInSubtitleStream(r *http.Request, streams *ffmpeg.Streams) (*ffmpeg.Stream, error) {
+	streamIdStr := r.URL.Query().Get("burnSubtitle")
+	if streamIdStr == "" {
+		return nil, nil
+	}
+	streamId, err := strconv.ParseInt(streamIdStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid burnSubtitle %s", streamIdStr)
+	}
+	for _, s := range ffmpeg.GetBitmapSubtitleStreams(streams.SubtitleStreams) {
+		if s.StreamId == streamId {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("No bitmap subtitle stream %d", streamId)
+}
+
+// burnInSubtitles replaces the given video representations by ones with the subtitle stream
+// burnt in. Burning in requires transcoding, so transmuxed representations become transcoded.
+func burnInSubtitles(
+	representations []ffmpeg.StreamRepresentation,
+	subtitleStream ffmpeg.Stream) []ffmpeg.StreamRepresentation {
+
+	burnt := []ffmpeg.StreamRepresentation{}
+	for _, r := range representations {
+		burnt = append(burnt, ffmpeg.GetBurnInVideoRepresentation(r, subtitleStream))
+	}
+	return burnt
+}
@@ -0,0 +1,59 @@
+package streaming
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+)
+
+// getClientCapabilities reads what the client can play from the request parameters. Clients can
+// start from one of the built-in profiles with deviceProfile=<name> and extend or override it with
+// the other parameters.
+func getClientCapabilities(r *http.Request) (ffmpeg.ClientCodecCapabilities, error) {
+	query := r.URL.Query()
+
+	capabilities := ffmpeg.ClientCodecCapabilities{}
+	if name := query.Get("deviceProfile"); name != "" {
+		profile, err := ffmpeg.GetDeviceProfile(name)
+		if err != nil {
+			return capabilities, err
+		}
+		capabilities = profile
+	}
+
+	capabilities.PlayableCodecs = append(capabilities.PlayableCodecs, query["playableCodecs"]...)
+	capabilities.Containers = append(capabilities.Containers, query["containers"]...)
+	for _, s := range query["codecProfiles"] {
+		p, err := ffmpeg.ParseCodecProfile(s)
+		if err != nil {
+			return capabilities, err
+		}
+		capabilities.CodecProfiles = append(capabilities.CodecProfiles, p)
+	}
+
+	limits := map[string]*int{
+		"maxWidth":         &capabilities.MaxWidth,
+		"maxHeight":        &capabilities.MaxHeight,
+		"maxBitRate":       &capabilities.MaxBitRate,
+		"maxAudioChannels": &capabilities.MaxAudioChannels,
+	}
+	for name, limit := range limits {
+		if s := query.Get(name); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 {
+				return capabilities, fmt.Errorf("Invalid %s %s", name, s)
+			}
+			*limit = v
+		}
+	}
+	if s := query.Get("hdr"); s != "" {
+		hdr, err := strconv.ParseBool(s)
+		if err != nil {
+			return capabilities, fmt.Errorf("Invalid hdr %s", s)
+		}
+		capabilities.HDR = &hdr
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,37 @@
+package streaming
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+)
+
+func TestGetClientCapabilities(t *testing.T) {
+	r := httptest.NewRequest("GET",
+		"/metadata.json?deviceProfile=chromecast&playableCodecs=av01.0.08M.08&codecProfiles=hvc1:1:120&maxHeight=720&hdr=true", nil)
+	c, err := getClientCapabilities(r)
+	assert.NoError(t, err)
+
+	profile, _ := ffmpeg.GetDeviceProfile("chromecast")
+	assert.Equal(t, []string{"av01.0.08M.08"}, c.PlayableCodecs)
+	assert.Len(t, c.CodecProfiles, len(profile.CodecProfiles)+1)
+	assert.Equal(t, ffmpeg.CodecProfile{Family: "hvc1", Profiles: []string{"1"}, MaxLevel: 120},
+		c.CodecProfiles[len(c.CodecProfiles)-1])
+	assert.Equal(t, 720, c.MaxHeight)
+	assert.Equal(t, profile.MaxWidth, c.MaxWidth)
+	if assert.NotNil(t, c.HDR) {
+		assert.True(t, *c.HDR)
+	}
+
+	r = httptest.NewRequest("GET", "/metadata.json?playableCodecs=avc1.640028", nil)
+	c, err = getClientCapabilities(r)
+	assert.NoError(t, err)
+	assert.Equal(t, ffmpeg.ClientCodecCapabilities{PlayableCodecs: []string{"avc1.640028"}}, c)
+
+	for _, query := range []string{"deviceProfile=toaster", "maxHeight=big", "maxBitRate=-1", "hdr=maybe", "codecProfiles=:1"} {
+		_, err = getClientCapabilities(httptest.NewRequest("GET", "/metadata.json?"+query, nil))
+		assert.Error(t, err, query)
+	}
+}
@@ -0,0 +1,50 @@
+package streaming
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/hls"
+)
+
+// Relative to the master playlist, which is served from the same session directory.
+const chaptersJSONFileName = "chapters.json"
+
+// getChapters returns the chapters of the file, or generated ones if it has none and generating
+// them is enabled. Chapters are optional for playback, so failing to read them is only logged.
+func getChapters(fileLocator filesystem.FileLocator, streams *ffmpeg.Streams) []ffmpeg.Chapter {
+	chapters, err := ffmpeg.GetChapters(fileLocator)
+	if err != nil {
+		log.WithError(err).WithField("fileLocator", fileLocator).Warnln("Failed to read chapters")
+	}
+	return ffmpeg.ChaptersOrGenerated(chapters, streams.GetVideoStream().TotalDuration)
+}
+
+// chaptersURI returns the given file name if there are chapters, so that manifests only refer
+// to chapters if there are any.
+func chaptersURI(chapters []ffmpeg.Chapter, fileName string) string {
+	if len(chapters) == 0 {
+		return ""
+	}
+	return fileName
+}
+
+// serveChaptersJSON serves the chapters JSON file that the HLS master playlist refers to.
+func serveChaptersJSON(w http.ResponseWriter, r *http.Request) {
+	fileLocator, statusErr := getFileLocatorOrFail(r)
+	if statusErr != nil {
+		http.Error(w, statusErr.Error(), statusErr.Status())
+		return
+	}
+
+	streams, err := ffmpeg.GetStreams(fileLocator)
+	if err != nil {
+		http.Error(w, "Failed to get streams: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(hls.BuildChaptersJSON(getChapters(fileLocator, streams))))
+}
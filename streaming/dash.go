@@ -16,9 +16,10 @@ func serveDASHManifest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	playableCodecs := r.URL.Query()["playableCodecs"]
-	capabilities := ffmpeg.ClientCodecCapabilities{
-		PlayableCodecs: playableCodecs,
+	capabilities, err := getClientCapabilities(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	streams, err := ffmpeg.GetStreams(fileLocator)
@@ -27,17 +28,33 @@ func serveDASHManifest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	burnInSubtitleStream, err := getBurnInSubtitleStream(r, streams)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	videoStream := dash.StreamRepresentations{Stream: streams.GetVideoStream()}
 	// Get transmuxed or similar transcoded representation
 	fullQualityRepresentation, _ := ffmpeg.GetTransmuxedOrTranscodedRepresentation(streams.GetVideoStream(), capabilities)
+	if burnInSubtitleStream != nil {
+		fullQualityRepresentation = ffmpeg.GetBurnInVideoRepresentation(fullQualityRepresentation, *burnInSubtitleStream)
+	}
 	videoStream.Representations = append(videoStream.Representations, fullQualityRepresentation)
 
-	lowQualityRepresentations := ffmpeg.GetStandardPresetVideoRepresentations(streams.GetVideoStream())
+	lowQualityRepresentations := ffmpeg.GetPreferredPresetVideoRepresentations(
+		streams.GetVideoStream(), capabilities)
+	if burnInSubtitleStream != nil {
+		lowQualityRepresentations = burnInSubtitles(lowQualityRepresentations, *burnInSubtitleStream)
+	}
 	for _, r := range lowQualityRepresentations {
 		if r.Representation.BitRate < fullQualityRepresentation.Representation.BitRate {
 			videoStream.Representations = append(videoStream.Representations, r)
 		}
 	}
+	videoStream.Representations = capabilities.KeepHDR(videoStream.Representations)
+	limits := readStreamingLimits()
+	videoStream.Representations = PBSManager.limitRepresentations(videoStream.Representations, limits)
 
 	audioStreams := []dash.StreamRepresentations{}
 	for _, s := range streams.AudioStreams {
@@ -49,18 +66,17 @@ func serveDASHManifest(w http.ResponseWriter, r *http.Request) {
 		audioStreams = append(audioStreams,
 			dash.StreamRepresentations{
 				Stream:          s,
-				Representations: []ffmpeg.StreamRepresentation{r}})
+				Representations: PBSManager.limitRepresentations([]ffmpeg.StreamRepresentation{r}, limits)})
 
 	}
 
 	subtitleStreams := []dash.SubtitleStreamRepresentation{}
 	subtitleRepresentations := ffmpeg.GetSubtitleStreamRepresentations(streams.SubtitleStreams)
 	for _, s := range subtitleRepresentations {
-		// NOTE(Leon Handreke): Because we'd have to propagate the UserID here through
-		// context or something like that and it's not used anyway, just use 0 here.
 		// We need to use s.Stream.FileLocator here because the subtitle file may be external
-		// next to the video file.
-		jwt, err := auth.CreateStreamingJWT(0, s.Stream.FileLocator.String())
+		// next to the video file. Subtitle segments count towards the user's playback like the
+		// other streams.
+		jwt, err := auth.CreateStreamingJWT(streamingUserID(r), s.Stream.FileLocator.String())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -76,6 +92,14 @@ func serveDASHManifest(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	manifest := dash.BuildManifest(videoStream, audioStreams, subtitleStreams)
+	var trickMode *dash.TrickModeRepresentation
+	if segments := ffmpeg.GetCachedIFrameSegments(streams.GetVideoStream()); len(segments) > 0 {
+		trickMode = &dash.TrickModeRepresentation{
+			StreamRepresentation: ffmpeg.GetIFrameRepresentation(streams.GetVideoStream(), segments),
+			Segments:             segments,
+		}
+	}
+
+	manifest := dash.BuildManifest(videoStream, audioStreams, subtitleStreams, trickMode)
 	w.Write([]byte(manifest))
 }
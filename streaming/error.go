@@ -1,5 +1,7 @@
 package streaming
 
+import "net/http"
+
 // https://blog.questionable.services/article/http-handler-error-handling-revisited/
 
 // Error represents a handler error. It provides methods for a HTTP status
@@ -24,3 +26,11 @@ func (se StatusError) Error() string {
 func (se StatusError) Status() int {
 	return se.Code
 }
+
+// errorStatus returns the HTTP status code for err, http.StatusInternalServerError if it has none.
+func errorStatus(err error) int {
+	if e, ok := err.(Error); ok {
+		return e.Status()
+	}
+	return http.StatusInternalServerError
+}
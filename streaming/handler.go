@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
 )
 
 // For Apple devices to handle HLS properly, the m3u8 playlists must be sent with the correct Content-Type
@@ -19,18 +20,23 @@ func RegisterRoutes(router *mux.Router) {
 	router.Handle("/files/{fileLocator:.*}/{sessionID}/hls-transmuxing-manifest.m3u8", AddM3U8Header(http.HandlerFunc(serveHlsTransmuxingMasterPlaylist)))
 	router.Handle("/files/{fileLocator:.*}/{sessionID}/hls-transcoding-manifest.m3u8", AddM3U8Header(http.HandlerFunc(serveHlsTranscodingMasterPlaylist)))
 	router.HandleFunc("/files/{fileLocator:.*}/metadata.json", serveMetadata)
+	router.HandleFunc("/files/{fileLocator:.*}/trickplay/{fileName:thumbnails\\.vtt|sprite-[0-9]+\\.jpg}", serveTrickplay)
 	router.Handle("/files/{fileLocator:.*}/{sessionID}/hls-manifest.m3u8", AddM3U8Header(http.HandlerFunc(serveHlsMasterPlaylist)))
 	router.HandleFunc("/files/{fileLocator:.*}/{sessionID}/dash-manifest.mpd", serveDASHManifest)
+	router.HandleFunc("/files/{fileLocator:.*}/{sessionID}/chapters.json", serveChaptersJSON)
 	router.Handle("/files/{fileLocator:.*}/{sessionID}/{streamId}/{representationId}/media.m3u8", AddM3U8Header(http.HandlerFunc(serveHlsTranscodingMediaPlaylist)))
 	router.HandleFunc("/files/{fileLocator:.*}/{sessionID}/{streamId}/{representationId}/{segmentId:[0-9]+}.m4s", serveMediaSegment)
 	router.HandleFunc("/files/{fileLocator:.*}/{sessionID}/{streamId}/{representationId}/{segmentId:[0-9]+}.vtt", serveSubtitleSegment)
 	router.HandleFunc("/files/{fileLocator:.*}/{sessionID}/{streamId}/{representationId}/init.mp4", serveInit)
+	router.HandleFunc("/files/{fileLocator:.*}/{streamId:[0-9]+}/subtitle.ass", serveASSSubtitle)
 	router.HandleFunc("/ffmpeg/{playbackSessionID}/feedback", serveFFmpegFeedback)
 
 	// This handler just serves up the file for downloading. This is also used
 	// internally by ffmpeg to access rclone files.
 	router.HandleFunc("/files/{fileLocator:.*}", serveFile)
 
+	router.Handle("/sync/{uuid}/download", auth.MiddleWare(http.HandlerFunc(serveSyncJobDownload)))
+
 	router.HandleFunc("/debug/playbackSessions", servePlaybackSessionDebugPage)
 
 	//handler := cors.AllowAll().Handler(router)
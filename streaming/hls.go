@@ -8,6 +8,7 @@ import (
 	"gitlab.com/olaris/olaris-server/metadata/auth"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func serveHlsMasterPlaylist(w http.ResponseWriter, r *http.Request) {
@@ -17,9 +18,10 @@ func serveHlsMasterPlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	playableCodecs := r.URL.Query()["playableCodecs"]
-	capabilities := ffmpeg.ClientCodecCapabilities{
-		PlayableCodecs: playableCodecs,
+	capabilities, err := getClientCapabilities(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	streams, err := ffmpeg.GetStreams(fileLocator)
@@ -28,18 +30,30 @@ func serveHlsMasterPlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	burnInSubtitleStream, err := getBurnInSubtitleStream(r, streams)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get transmuxed or similar transcoded representation
 	fullQualityRepresentation, _ := ffmpeg.GetTransmuxedOrTranscodedRepresentation(streams.GetVideoStream(), capabilities)
+	if burnInSubtitleStream != nil {
+		fullQualityRepresentation = ffmpeg.GetBurnInVideoRepresentation(fullQualityRepresentation, *burnInSubtitleStream)
+	}
 	videoRepresentations := []ffmpeg.StreamRepresentation{fullQualityRepresentation}
 
 	// TODO(Leon Handreke): I've observed issues with switching from transmuxed representations to transcoded
 	// (garbled output). Therefore, serve alternative streams only for transcoded for now. See
 	// https://gitlab.com/olaris/olaris-server/issues/48
 	if fullQualityRepresentation.Representation.Transcoded {
-		// Build lower-quality transcoded versions
-		for _, preset := range []string{"preset:480-1000k-video", "preset:720-5000k-video", "preset:1080-10000k-video"} {
-			r, _ := ffmpeg.StreamRepresentationFromRepresentationId(
-				streams.GetVideoStream(), preset)
+		// Build lower-quality transcoded versions, in the most efficient codec that the client supports
+		lowQualityRepresentations := ffmpeg.GetPreferredPresetVideoRepresentations(
+			streams.GetVideoStream(), capabilities)
+		if burnInSubtitleStream != nil {
+			lowQualityRepresentations = burnInSubtitles(lowQualityRepresentations, *burnInSubtitleStream)
+		}
+		for _, r := range lowQualityRepresentations {
 			if r.Representation.BitRate < fullQualityRepresentation.Representation.BitRate {
 				videoRepresentations = append(videoRepresentations, r)
 			}
@@ -56,21 +70,27 @@ func serveHlsMasterPlaylist(w http.ResponseWriter, r *http.Request) {
 		audioStreamRepresentations = append(audioStreamRepresentations, r)
 	}
 
+	videoRepresentations = capabilities.KeepHDR(videoRepresentations)
+	limits := readStreamingLimits()
+	videoRepresentations = PBSManager.limitRepresentations(videoRepresentations, limits)
+	audioStreamRepresentations = PBSManager.limitRepresentations(audioStreamRepresentations, limits)
+
 	combinations := []hls.RepresentationCombination{}
 	for _, v := range videoRepresentations {
 		combinations = append(combinations, hls.RepresentationCombination{
 			VideoStream:    v,
 			AudioStreams:   audioStreamRepresentations,
 			AudioGroupName: "audio",
-			// TODO(Leon Handreke): Is just using the first one always correct?
-			AudioCodecs: audioStreamRepresentations[0].Representation.Codecs,
+			AudioCodecs:    joinAudioCodecs(audioStreamRepresentations),
 		})
 	}
 
 	subtitleRepresentations := ffmpeg.GetSubtitleStreamRepresentations(streams.SubtitleStreams)
-	subtitlePlaylistItems := buildSubtitlePlaylistItems(subtitleRepresentations, mux.Vars(r)["sessionID"])
+	subtitlePlaylistItems := buildSubtitlePlaylistItems(subtitleRepresentations, mux.Vars(r)["sessionID"], streamingUserID(r))
 
-	manifest := hls.BuildMasterPlaylistFromFile(combinations, subtitlePlaylistItems)
+	manifest := hls.BuildMasterPlaylistFromFile(combinations, subtitlePlaylistItems,
+		getIFrameRepresentations(streams.GetVideoStream()),
+		chaptersURI(getChapters(fileLocator, streams), chaptersJSONFileName))
 	w.Write([]byte(manifest))
 }
 
@@ -95,7 +115,7 @@ func serveHlsTransmuxingMasterPlaylist(w http.ResponseWriter, r *http.Request) {
 	}
 
 	subtitleRepresentations := ffmpeg.GetSubtitleStreamRepresentations(streams.SubtitleStreams)
-	subtitlePlaylistItems := buildSubtitlePlaylistItems(subtitleRepresentations, mux.Vars(r)["sessionID"])
+	subtitlePlaylistItems := buildSubtitlePlaylistItems(subtitleRepresentations, mux.Vars(r)["sessionID"], streamingUserID(r))
 
 	manifest := hls.BuildMasterPlaylistFromFile(
 		[]hls.RepresentationCombination{
@@ -103,11 +123,12 @@ func serveHlsTransmuxingMasterPlaylist(w http.ResponseWriter, r *http.Request) {
 				VideoStream:    transmuxedVideoStream,
 				AudioStreams:   audioStreamRepresentations,
 				AudioGroupName: "transmuxed",
-				// TODO(Leon Handreke): Fill this from the audio codecs.
-				AudioCodecs: "mp4a.40.2",
+				AudioCodecs:    joinAudioCodecs(audioStreamRepresentations),
 			},
 		},
-		subtitlePlaylistItems)
+		subtitlePlaylistItems,
+		getIFrameRepresentations(streams.GetVideoStream()),
+		chaptersURI(getChapters(fileLocator, streams), chaptersJSONFileName))
 	w.Write([]byte(manifest))
 }
 
@@ -155,14 +176,35 @@ func serveHlsTranscodingMasterPlaylist(w http.ResponseWriter, r *http.Request) {
 	}
 
 	subtitleRepresentations := ffmpeg.GetSubtitleStreamRepresentations(streams.SubtitleStreams)
-	subtitlePlaylistItems := buildSubtitlePlaylistItems(subtitleRepresentations, mux.Vars(r)["sessionID"])
+	subtitlePlaylistItems := buildSubtitlePlaylistItems(subtitleRepresentations, mux.Vars(r)["sessionID"], streamingUserID(r))
 
 	manifest := hls.BuildMasterPlaylistFromFile(
-		representationCombinations, subtitlePlaylistItems)
+		representationCombinations, subtitlePlaylistItems,
+		getIFrameRepresentations(streams.GetVideoStream()),
+		chaptersURI(getChapters(mediaFileURL, streams), chaptersJSONFileName))
 	w.Write([]byte(manifest))
 }
 
+// joinAudioCodecs returns the codecs of all the given audio representations for the CODECS
+// attribute. Clients must be able to decode all of them to switch between the audio streams.
+func joinAudioCodecs(audioStreamRepresentations []ffmpeg.StreamRepresentation) string {
+	codecs := []string{}
+	seen := map[string]bool{}
+	for _, r := range audioStreamRepresentations {
+		if !seen[r.Representation.Codecs] {
+			seen[r.Representation.Codecs] = true
+			codecs = append(codecs, r.Representation.Codecs)
+		}
+	}
+	return strings.Join(codecs, ",")
+}
+
 func serveHlsTranscodingMediaPlaylist(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["representationId"] == ffmpeg.IFrameRepresentationId {
+		serveIFramePlaylist(w, r)
+		return
+	}
+
 	fileLocator, statusErr := getFileLocatorOrFail(r)
 	if statusErr != nil {
 		http.Error(w, statusErr.Error(), statusErr.Status())
@@ -184,13 +226,16 @@ func serveHlsTranscodingMediaPlaylist(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(manifest))
 }
 
-func buildSubtitlePlaylistItems(representations []ffmpeg.StreamRepresentation, sessionID string) []hls.SubtitlePlaylistItem {
+func buildSubtitlePlaylistItems(
+	representations []ffmpeg.StreamRepresentation,
+	sessionID string,
+	userID uint) []hls.SubtitlePlaylistItem {
+
 	// Subtitles may be in another file, so we need to list their absolute URI.
 	subtitlePlaylistItems := []hls.SubtitlePlaylistItem{}
 	for _, s := range representations {
-		// NOTE(Leon Handreke): Because we'd have to propagate the UserID here through
-		// context or something like that and it's not used anyway, just use 0 here.
-		jwt, _ := auth.CreateStreamingJWT(0, s.Stream.FileLocator.String())
+		// Subtitle segments count towards the user's playback like the other streams.
+		jwt, _ := auth.CreateStreamingJWT(userID, s.Stream.FileLocator.String())
 		subtitlePlaylistItems = append(subtitlePlaylistItems,
 			hls.SubtitlePlaylistItem{
 				StreamRepresentation: s,
@@ -0,0 +1,99 @@
+package streaming
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/hls"
+)
+
+// getIFrameRepresentations returns the I-frame representation of the given video stream for the
+// master playlist, or none if its keyframes aren't known yet. Finding them reads the whole file,
+// so that happens in the background instead of delaying playback.
+func getIFrameRepresentations(videoStream ffmpeg.Stream) []ffmpeg.StreamRepresentation {
+	segments := ffmpeg.GetCachedIFrameSegments(videoStream)
+	if len(segments) == 0 {
+		return nil
+	}
+	return []ffmpeg.StreamRepresentation{ffmpeg.GetIFrameRepresentation(videoStream, segments)}
+}
+
+// getIFrameStream returns the video stream of the request with its I-frame representation and
+// segments, writing an error if there is none.
+func getIFrameStream(w http.ResponseWriter, r *http.Request) (ffmpeg.StreamRepresentation, []ffmpeg.IFrameSegment, bool) {
+	fileLocator, statusErr := getFileLocatorOrFail(r)
+	if statusErr != nil {
+		http.Error(w, statusErr.Error(), statusErr.Status())
+		return ffmpeg.StreamRepresentation{}, nil, false
+	}
+	streamKey, err := getStreamKey(fileLocator, mux.Vars(r)["streamId"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return ffmpeg.StreamRepresentation{}, nil, false
+	}
+	stream, err := ffmpeg.GetStream(streamKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return ffmpeg.StreamRepresentation{}, nil, false
+	}
+	if stream.StreamType != "video" {
+		http.Error(w, "Only video streams have I-frames", http.StatusBadRequest)
+		return ffmpeg.StreamRepresentation{}, nil, false
+	}
+
+	// Only the master playlist links the I-frames, and only once the keyframes are known. Don't
+	// read the whole file while the client waits if they were forgotten in the meantime.
+	segments := ffmpeg.GetCachedIFrameSegments(stream)
+	if len(segments) == 0 {
+		http.Error(w, "The I-frames of this stream aren't available yet", http.StatusNotFound)
+		return ffmpeg.StreamRepresentation{}, nil, false
+	}
+	return ffmpeg.GetIFrameRepresentation(stream, segments), segments, true
+}
+
+func serveIFramePlaylist(w http.ResponseWriter, r *http.Request) {
+	_, segments, ok := getIFrameStream(w, r)
+	if !ok {
+		return
+	}
+	w.Write([]byte(hls.BuildIFramePlaylist(segments)))
+}
+
+func serveIFrameInit(w http.ResponseWriter, r *http.Request) {
+	sr, segments, ok := getIFrameStream(w, r)
+	if !ok {
+		return
+	}
+	initPath, err := ffmpeg.GetIFrameInitPath(sr, segments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", videoMIMEType)
+	http.ServeFile(w, r, initPath)
+}
+
+func serveIFrameSegment(w http.ResponseWriter, r *http.Request) {
+	segmentIdx, err := strconv.Atoi(mux.Vars(r)["segmentId"])
+	if err != nil {
+		http.Error(w, "Invalid segmentId", http.StatusBadRequest)
+		return
+	}
+	sr, segments, ok := getIFrameStream(w, r)
+	if !ok {
+		return
+	}
+	if segmentIdx >= len(segments) {
+		http.Error(w, "No such I-frame", http.StatusNotFound)
+		return
+	}
+	segmentPath, err := ffmpeg.GetIFrameSegmentPath(sr, segments, segmentIdx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", videoMIMEType)
+	http.ServeFile(w, r, segmentPath)
+}
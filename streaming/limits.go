@@ -0,0 +1,214 @@
+package streaming
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+)
+
+// What happens when a new transcoding session would exceed the maximum number of transcodes.
+const (
+	// Refuse to serve the stream.
+	LimitPolicyReject = "reject"
+	// Offer only the cheapest preset of the same codec in new manifests. Transcodes with that preset
+	// exceed the limit, but with a considerably cheaper ffmpeg process.
+	LimitPolicyLowerQuality = "lower-quality"
+	// Offer the original stream without transcoding it in new manifests. The client may not be able
+	// to play it.
+	LimitPolicyTransmux = "transmux"
+)
+
+// StreamingLimits restrict how much streaming the server does at once. Zero means unlimited.
+type StreamingLimits struct {
+	// Maximum number of running ffmpeg transcoding processes
+	MaxTranscodes int
+	// Maximum number of files a user may play at once. All streams of a playback count as one.
+	MaxPlaybacksPerUser int
+	// One of the LimitPolicy* constants
+	Policy string
+}
+
+func readStreamingLimits() StreamingLimits {
+	return StreamingLimits{
+		MaxTranscodes:       viper.GetInt("server.streaming.maxTranscodes"),
+		MaxPlaybacksPerUser: viper.GetInt("server.streaming.maxPlaybacksPerUser"),
+		Policy:              viper.GetString("server.streaming.limitPolicy"),
+	}
+}
+
+// StreamingUtilisation is how close the server is to its streaming limits.
+type StreamingUtilisation struct {
+	Limits StreamingLimits
+	// Number of running ffmpeg transcoding processes
+	Transcodes int
+	// Number of files being played, by user ID
+	Playbacks map[uint]int
+}
+
+// Utilisation returns the current streaming utilisation and limits.
+func (m *PlaybackSessionManager) Utilisation() StreamingUtilisation {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	u := StreamingUtilisation{
+		Limits:     readStreamingLimits(),
+		Transcodes: m.countTranscodes(nil),
+		Playbacks:  map[uint]int{},
+	}
+	for userID, sessionIDs := range m.playbacksByUser() {
+		u.Playbacks[userID] = len(sessionIDs)
+	}
+	return u
+}
+
+// This is a variable so that tests can do without ffmpeg.
+var runningSyncTranscodes = ffmpeg.RunningSyncTranscodes
+
+// countTranscodes counts the running transcoding processes except the one of ignored, including
+// the ones making offline copies. m.mtx must be held.
+func (m *PlaybackSessionManager) countTranscodes(ignored *PlaybackSession) int {
+	n := runningSyncTranscodes()
+	for _, s := range m.sessions {
+		if s != ignored && isRunningTranscode(s) {
+			n++
+		}
+	}
+	return n
+}
+
+func isRunningTranscode(s *PlaybackSession) bool {
+	t := s.TranscodingSession
+	return t != nil && t.Stream.Representation.Transcoded && !t.Terminated
+}
+
+// activePlaybackWindow is how recently a session must have served a segment to count as a
+// playback. Sessions linger for playbackSessionTimeout after the client is gone, e.g. after closing
+// the player; this allows for players that buffer several segments ahead.
+const activePlaybackWindow = 12 * ffmpeg.SegmentDuration
+
+// playbacksByUser returns the session IDs of the files each user is playing, including the ones
+// served from the segment cache. Files accessed without a streaming ticket have no user and aren't
+// included. m.mtx must be held.
+func (m *PlaybackSessionManager) playbacksByUser() map[uint]map[string]bool {
+	playbacks := map[uint]map[string]bool{}
+	for _, s := range m.sessions {
+		if s.userID == 0 || time.Since(s.lastAccessed) > activePlaybackWindow {
+			continue
+		}
+		if playbacks[s.userID] == nil {
+			playbacks[s.userID] = map[string]bool{}
+		}
+		playbacks[s.userID][s.sessionID] = true
+	}
+	for sessionID, p := range m.playbacks {
+		if time.Since(p.lastAccessed) > activePlaybackWindow {
+			continue
+		}
+		if playbacks[p.userID] == nil {
+			playbacks[p.userID] = map[string]bool{}
+		}
+		playbacks[p.userID][sessionID] = true
+	}
+	return playbacks
+}
+
+// transcodeLimitReached checks whether the maximum number of transcodes is running, not counting
+// the one of ignored. m.mtx must be held.
+func (m *PlaybackSessionManager) transcodeLimitReached(ignored *PlaybackSession, limits StreamingLimits) bool {
+	return limits.MaxTranscodes > 0 && m.countTranscodes(ignored) >= limits.MaxTranscodes
+}
+
+// limitRepresentations returns the representations a manifest may advertise. Once the transcode
+// limit is reached, the limit policy replaces transcoded representations with ones that
+// checkLimits still allows, so that clients only ever request renditions we are going to serve.
+func (m *PlaybackSessionManager) limitRepresentations(
+	representations []ffmpeg.StreamRepresentation,
+	limits StreamingLimits) []ffmpeg.StreamRepresentation {
+
+	m.mtx.Lock()
+	limitReached := m.transcodeLimitReached(nil, limits)
+	m.mtx.Unlock()
+	if !limitReached {
+		return representations
+	}
+
+	type representationKey struct {
+		ffmpeg.StreamKey
+		representationID string
+	}
+	limited := []ffmpeg.StreamRepresentation{}
+	seen := map[representationKey]bool{}
+	for _, r := range representations {
+		if r.Representation.Transcoded {
+			switch limits.Policy {
+			case LimitPolicyLowerQuality:
+				if lowest, ok := ffmpeg.GetLowestPresetRepresentation(r); ok {
+					r = lowest
+				}
+			case LimitPolicyTransmux:
+				r = ffmpeg.GetTransmuxedRepresentation(r.Stream)
+			}
+		}
+		k := representationKey{r.Stream.StreamKey, r.Representation.RepresentationId}
+		if !seen[k] {
+			seen[k] = true
+			limited = append(limited, r)
+		}
+	}
+	return limited
+}
+
+// checkLimits checks whether a session for key and the requested representation may be started.
+// replaced is the session the new one replaces, e.g. after seeking, if any. m.mtx must be held.
+func (m *PlaybackSessionManager) checkLimits(
+	key PlaybackSessionKey,
+	requested ffmpeg.StreamRepresentation,
+	replaced *PlaybackSession,
+	limits StreamingLimits) error {
+
+	if err := m.checkPlaybackLimit(key, limits); err != nil {
+		return err
+	}
+
+	if !requested.Representation.Transcoded || !m.transcodeLimitReached(replaced, limits) {
+		return nil
+	}
+	if limits.Policy == LimitPolicyLowerQuality {
+		if _, cheaper := ffmpeg.GetLowestPresetRepresentation(requested); !cheaper {
+			return nil
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"file":             key.FileLocator,
+		"representationID": key.representationID,
+		"policy":           limits.Policy,
+	}).Infoln("Transcode limit reached, rejecting stream")
+	return StatusError{
+		Code: http.StatusServiceUnavailable,
+		Err:  fmt.Errorf("The server is transcoding too many streams at the moment, try again later"),
+	}
+}
+
+// checkPlaybackLimit checks whether the user of key may play another file, unless key belongs to
+// a playback they already started. Files accessed without a streaming ticket aren't limited.
+// m.mtx must be held.
+func (m *PlaybackSessionManager) checkPlaybackLimit(key PlaybackSessionKey, limits StreamingLimits) error {
+	if limits.MaxPlaybacksPerUser <= 0 || key.userID == 0 {
+		return nil
+	}
+	sessionIDs := m.playbacksByUser()[key.userID]
+	if !sessionIDs[key.sessionID] && len(sessionIDs) >= limits.MaxPlaybacksPerUser {
+		return StatusError{
+			Code: http.StatusTooManyRequests,
+			Err: fmt.Errorf("You may play at most %d files at once, stop one of the others first",
+				limits.MaxPlaybacksPerUser),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package streaming
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func addTranscodingSession(m *PlaybackSessionManager, id string, userID uint, sessionID string) *PlaybackSession {
+	s := newTestPlaybackSession(id, ffmpeg.Representation{RepresentationId: "preset:720-5000k-video", Transcoded: true})
+	s.userID = userID
+	s.sessionID = sessionID
+	s.representationID = id
+	s.lastAccessed = time.Now()
+	m.sessions[s.PlaybackSessionKey] = s
+	return s
+}
+
+func requestedTranscode(t *testing.T) ffmpeg.StreamRepresentation {
+	stream := ffmpeg.Stream{Width: 1920, Height: 1080, FrameRate: big.NewRat(24, 1), StreamType: "video"}
+	r, err := ffmpeg.StreamRepresentationFromRepresentationId(stream, "preset:720-5000k-video")
+	assert.NoError(t, err)
+	return r
+}
+
+func TestCheckLimits_Transcodes(t *testing.T) {
+	m, _ := NewPlaybackSessionManager()
+	addTranscodingSession(m, "a", 1, "alice")
+	existing := addTranscodingSession(m, "b", 2, "bob")
+	requested := requestedTranscode(t)
+	key := PlaybackSessionKey{sessionID: "carol", userID: 3, representationID: "c"}
+
+	assert.NoError(t, m.checkLimits(key, requested, nil, StreamingLimits{MaxTranscodes: 3}))
+
+	for _, policy := range []string{LimitPolicyReject, LimitPolicyLowerQuality, LimitPolicyTransmux} {
+		err := m.checkLimits(key, requested, nil, StreamingLimits{MaxTranscodes: 2, Policy: policy})
+		if assert.Error(t, err, "Requested representations are never substituted") {
+			assert.Equal(t, http.StatusServiceUnavailable, errorStatus(err))
+		}
+	}
+
+	// Seeking replaces a session, so it doesn't count
+	assert.NoError(t, m.checkLimits(existing.PlaybackSessionKey, requested, existing, StreamingLimits{MaxTranscodes: 2}))
+
+	lowest, ok := ffmpeg.GetLowestPresetRepresentation(requested)
+	assert.True(t, ok)
+	assert.NoError(t, m.checkLimits(key, lowest, nil, StreamingLimits{MaxTranscodes: 2, Policy: LimitPolicyLowerQuality}))
+	assert.Error(t, m.checkLimits(key, lowest, nil, StreamingLimits{MaxTranscodes: 2, Policy: LimitPolicyReject}))
+
+	transmuxed := ffmpeg.GetTransmuxedRepresentation(requested.Stream)
+	assert.NoError(t, m.checkLimits(key, transmuxed, nil, StreamingLimits{MaxTranscodes: 2}),
+		"Transmuxing isn't limited")
+
+	existing.TranscodingSession.Terminated = true
+	assert.NoError(t, m.checkLimits(key, requested, nil, StreamingLimits{MaxTranscodes: 2}),
+		"Finished transcodes don't count")
+}
+
+func TestCheckLimits_SyncTranscodes(t *testing.T) {
+	runningSyncTranscodes = func() int { return 1 }
+	defer func() { runningSyncTranscodes = ffmpeg.RunningSyncTranscodes }()
+	m, _ := NewPlaybackSessionManager()
+	addTranscodingSession(m, "a", 1, "alice")
+	key := PlaybackSessionKey{sessionID: "bob", userID: 2, representationID: "b"}
+
+	err := m.checkLimits(key, requestedTranscode(t), nil, StreamingLimits{MaxTranscodes: 2})
+	assert.Error(t, err, "Transcodes making offline copies count")
+	assert.Equal(t, 2, m.Utilisation().Transcodes)
+}
+
+func TestLimitRepresentations(t *testing.T) {
+	m, _ := NewPlaybackSessionManager()
+	addTranscodingSession(m, "a", 1, "alice")
+	requested := requestedTranscode(t)
+	lowest, _ := ffmpeg.GetLowestPresetRepresentation(requested)
+	transmuxed := ffmpeg.GetTransmuxedRepresentation(requested.Stream)
+	offered := []ffmpeg.StreamRepresentation{requested, lowest}
+
+	assert.Equal(t, offered, m.limitRepresentations(offered, StreamingLimits{MaxTranscodes: 2}))
+	assert.Equal(t, offered, m.limitRepresentations(offered, StreamingLimits{MaxTranscodes: 1, Policy: LimitPolicyReject}))
+	assert.Equal(t, []ffmpeg.StreamRepresentation{lowest},
+		m.limitRepresentations(offered, StreamingLimits{MaxTranscodes: 1, Policy: LimitPolicyLowerQuality}))
+	assert.Equal(t, []ffmpeg.StreamRepresentation{transmuxed},
+		m.limitRepresentations(offered, StreamingLimits{MaxTranscodes: 1, Policy: LimitPolicyTransmux}))
+}
+
+func TestCheckLimits_PlaybacksPerUser(t *testing.T) {
+	m, _ := NewPlaybackSessionManager()
+	addTranscodingSession(m, "a", 1, "first")
+	addTranscodingSession(m, "b", 1, "first")
+	addTranscodingSession(m, "c", 2, "other")
+	requested := requestedTranscode(t)
+	limits := StreamingLimits{MaxPlaybacksPerUser: 1}
+
+	err := m.checkLimits(PlaybackSessionKey{sessionID: "first", userID: 1}, requested, nil, limits)
+	assert.NoError(t, err, "Streams of the same playback count once")
+
+	err = m.checkLimits(PlaybackSessionKey{sessionID: "second", userID: 1}, requested, nil, limits)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusTooManyRequests, errorStatus(err))
+	}
+
+	u := m.Utilisation()
+	assert.Equal(t, 3, u.Transcodes)
+	assert.Equal(t, map[uint]int{1: 1, 2: 1}, u.Playbacks)
+}
+
+func TestCheckLimits_PlaybacksPerUserIgnoresIdleSessions(t *testing.T) {
+	m, _ := NewPlaybackSessionManager()
+	closed := addTranscodingSession(m, "a", 1, "closed")
+	closed.lastAccessed = time.Now().Add(-2 * activePlaybackWindow)
+	requested := requestedTranscode(t)
+
+	err := m.checkLimits(PlaybackSessionKey{sessionID: "new", userID: 1}, requested, nil,
+		StreamingLimits{MaxPlaybacksPerUser: 1})
+	assert.NoError(t, err, "Sessions that haven't been accessed recently don't count")
+	assert.Empty(t, m.Utilisation().Playbacks)
+}
+
+func TestCheckLimits_PlaybacksPerUserCountsCachedSegments(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	m, _ := NewPlaybackSessionManager()
+	limits := StreamingLimits{MaxPlaybacksPerUser: 1}
+	cached := PlaybackSessionKey{sessionID: "cached", userID: 1, representationID: "preset:720-5000k-video"}
+
+	assert.NoError(t, m.checkPlaybackLimit(cached, limits))
+	m.trackCachedSegmentServed(cached, 3)
+	p := m.playbacks["cached"]
+	if assert.NotNil(t, p, "Playbacks served from the segment cache are tracked") {
+		assert.Equal(t, 3, p.lastServedSegmentIdx)
+		assert.NotNil(t, p.expiry)
+	}
+	assert.Equal(t, map[uint]int{1: 1}, m.Utilisation().Playbacks)
+
+	assert.NoError(t, m.checkPlaybackLimit(cached, limits))
+	err := m.checkLimits(PlaybackSessionKey{sessionID: "other", userID: 1}, requestedTranscode(t), nil, limits)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusTooManyRequests, errorStatus(err))
+	}
+
+	// A session of the playback that is removed later ends it.
+	s := addTranscodingSession(m, "a", 1, "cached")
+	s.lastServedSegmentIdx = 2
+	delete(m.sessions, s.PlaybackSessionKey)
+	m.trackPlaybackStopped(s)
+	assert.Empty(t, m.playbacks)
+	assert.Empty(t, m.Utilisation().Playbacks)
+}
+
+func TestCheckLimits_PlaybacksPerUserSubtitles(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	m, _ := NewPlaybackSessionManager()
+	limits := StreamingLimits{MaxPlaybacksPerUser: 1}
+	subtitles := newTestPlaybackSession("subtitles", ffmpeg.Representation{RepresentationId: "webvtt"}).
+		TranscodingSession.Stream
+
+	var userIDs []uint
+	for _, username := range []string{"first", "second"} {
+		user, err := db.CreateUser(username, "password", false)
+		require.NoError(t, err)
+		userIDs = append(userIDs, user.ID)
+	}
+
+	for _, userID := range userIDs {
+		sessionID := fmt.Sprintf("session%d", userID)
+		items := buildSubtitlePlaylistItems([]ffmpeg.StreamRepresentation{subtitles}, sessionID, userID)
+		if !assert.Len(t, items, 1) {
+			return
+		}
+		// /olaris/s/files/jwt/<jwt>/...
+		claims, err := auth.ValidateStreamingJWT(strings.Split(items[0].URI, "/")[5])
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, userID, claims.UserID, "Subtitle tickets belong to the user playing the file")
+
+		key := PlaybackSessionKey{sessionID: sessionID, userID: claims.UserID, representationID: "webvtt"}
+		assert.NoError(t, m.checkLimits(key, subtitles, nil, limits))
+		s := newTestPlaybackSession(sessionID, subtitles.Representation)
+		s.PlaybackSessionKey = key
+		s.lastAccessed = time.Now()
+		m.sessions[key] = s
+	}
+	assert.Equal(t, map[uint]int{userIDs[0]: 1, userIDs[1]: 1}, m.Utilisation().Playbacks)
+
+	// Files accessed without a streaming ticket have no user to limit.
+	anonymous := addTranscodingSession(m, "anonymous", 0, "anonymous")
+	assert.NoError(t, m.checkLimits(PlaybackSessionKey{sessionID: "other", userID: 0}, subtitles, nil, limits))
+	assert.NotContains(t, m.Utilisation().Playbacks, anonymous.userID)
+}
@@ -2,12 +2,60 @@ package streaming
 
 import (
 	"encoding/json"
+	log "github.com/sirupsen/logrus"
 	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/metadata/db"
 	"net/http"
 )
 
 type metadataResponse struct {
 	CheckCodecs []string `json:"checkCodecs"`
+	// Whether the client can play the file as it is, without any transmuxing or transcoding,
+	// going by the capabilities in the request (see getClientCapabilities). If so, it can
+	// fetch the file itself instead of a manifest.
+	DirectPlay bool `json:"directPlay"`
+	// Names of the device profiles that clients can pass as deviceProfile.
+	DeviceProfiles []string         `json:"deviceProfiles"`
+	Markers        []metadataMarker `json:"markers"`
+	// Chapters of the file in order. HLS master playlists refer to them as session data, DASH
+	// manifests don't have them.
+	Chapters []metadataChapter `json:"chapters"`
+	// Subtitle tracks that aren't in the manifests because they consist of images. To show one,
+	// request the manifest again with burnSubtitle=<streamId> to have it burnt into the video.
+	BurnInSubtitles []metadataSubtitle `json:"burnInSubtitles"`
+	// ASS/SSA subtitle tracks with their styling, for clients that can render them themselves.
+	// They are in the manifests as WebVTT as well.
+	ASSSubtitles []metadataSubtitle `json:"assSubtitles"`
+}
+
+// metadataSubtitle is a subtitle track of the file.
+type metadataSubtitle struct {
+	StreamID int64  `json:"streamId"`
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	// Where the raw subtitles can be downloaded from, only for ASS subtitles
+	URI string `json:"uri,omitempty"`
+}
+
+// metadataMarker is a part of the file that the player can offer to skip, e.g. the intro.
+type metadataMarker struct {
+	Kind string `json:"kind"`
+	// In seconds
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// metadataChapter is a named part of the file, e.g. a scene of a movie.
+type metadataChapter struct {
+	Title string `json:"title"`
+	// In seconds
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// Whether the chapter was generated because the file has none
+	Generated bool `json:"generated"`
+	// Trickplay thumbnail at the start of the chapter relative to this file, e.g.
+	// "trickplay/sprite-001.jpg#xywh=320,0,320,180". Only if there are trickplay thumbnails.
+	Thumbnail string `json:"thumbnail,omitempty"`
 }
 
 // serveMetadata generates a list of possible codecs that we could possibly serve and returns
@@ -31,6 +79,12 @@ func serveMetadata(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	capabilities, err := getClientCapabilities(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	checkCodecs := []string{}
 
 	transmuxedVideo := ffmpeg.GetTransmuxedRepresentation(streams.GetVideoStream())
@@ -40,15 +94,17 @@ func serveMetadata(w http.ResponseWriter, r *http.Request) {
 		transmuxedVideo.Representation.Codecs,
 		transcodedVideo.Representation.Codecs)
 
-	lowQualityRepresentations := ffmpeg.GetStandardPresetVideoRepresentations(
+	// Include all codecs that we can transcode to so that the client can tell us which of the more
+	// efficient ones (HEVC, AV1) it supports.
+	lowQualityRepresentations := ffmpeg.GetAllStandardPresetVideoRepresentations(
 		streams.GetVideoStream())
 	for _, r := range lowQualityRepresentations {
 		checkCodecs = append(checkCodecs, r.Representation.Codecs)
 	}
 
 	for _, s := range streams.AudioStreams {
-		transmuxedAudio := ffmpeg.GetTransmuxedRepresentation(streams.GetVideoStream())
-		transcodedAudio := ffmpeg.GetSimilarTranscodedRepresentation(streams.GetVideoStream())
+		transmuxedAudio := ffmpeg.GetTransmuxedRepresentation(s)
+		transcodedAudio := ffmpeg.GetSimilarTranscodedRepresentation(s)
 		lowQualityAudio, _ := ffmpeg.StreamRepresentationFromRepresentationId(
 			s, "preset:128k-audio")
 
@@ -56,9 +112,76 @@ func serveMetadata(w http.ResponseWriter, r *http.Request) {
 			transmuxedAudio.Representation.Codecs,
 			transcodedAudio.Representation.Codecs,
 			lowQualityAudio.Representation.Codecs)
+
+		// So that we know whether the client can play surround sound in a better codec than AAC
+		for _, r := range ffmpeg.GetMultichannelPresetAudioRepresentations(s) {
+			checkCodecs = append(checkCodecs, r.Representation.Codecs)
+		}
+	}
+
+	markers := []metadataMarker{}
+	for _, m := range db.FindMarkersForFilePath(fileLocator.String()) {
+		markers = append(markers, metadataMarker{
+			Kind:  m.Kind,
+			Start: m.Start.Seconds(),
+			End:   m.End.Seconds(),
+		})
+	}
+
+	chapters := []metadataChapter{}
+	trickplay, err := ffmpeg.GetTrickplay(fileLocator)
+	if err != nil {
+		log.WithError(err).WithField("fileLocator", fileLocator).Warnln("Failed to read trickplay info")
+	}
+	for _, c := range getChapters(fileLocator, streams) {
+		chapter := metadataChapter{
+			Title:     c.Title,
+			Start:     c.Start.Seconds(),
+			End:       c.End.Seconds(),
+			Generated: c.Generated,
+		}
+		if trickplay != nil {
+			chapter.Thumbnail = "trickplay/" + trickplay.ThumbnailAt(c.Start)
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	burnInSubtitles := []metadataSubtitle{}
+	for _, s := range ffmpeg.GetBitmapSubtitleStreams(streams.SubtitleStreams) {
+		burnInSubtitles = append(burnInSubtitles, metadataSubtitle{
+			StreamID: s.StreamId,
+			Language: s.Language,
+			Title:    s.Title,
+		})
+	}
+
+	assSubtitles := []metadataSubtitle{}
+	for _, s := range streams.SubtitleStreams {
+		if !s.IsASSSubtitle() {
+			continue
+		}
+		uri, err := assSubtitleURI(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		assSubtitles = append(assSubtitles, metadataSubtitle{
+			StreamID: s.StreamId,
+			Language: s.Language,
+			Title:    s.Title,
+			URI:      uri,
+		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(metadataResponse{CheckCodecs: checkCodecs})
+	json.NewEncoder(w).Encode(metadataResponse{
+		CheckCodecs:     checkCodecs,
+		DirectPlay:      capabilities.CanDirectPlay(streams),
+		DeviceProfiles:  ffmpeg.DeviceProfileNames(),
+		Markers:         markers,
+		Chapters:        chapters,
+		BurnInSubtitles: burnInSubtitles,
+		ASSSubtitles:    assSubtitles,
+	})
 }
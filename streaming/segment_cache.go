@@ -0,0 +1,103 @@
+package streaming
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+)
+
+// This is a variable so that tests can use a segment cache of their own.
+var getSegmentCache = ffmpeg.GetSegmentCache
+
+// serveCachedSegment serves the requested segment from the segment cache if it's there. The
+// segment is only served if the user may play another file, and the playback is tracked for the
+// watch history, as when a PlaybackSession serves it. The transcode limit doesn't apply, cached
+// segments cost no transcoding. Returns whether the request was handled.
+func (m *PlaybackSessionManager) serveCachedSegment(
+	w http.ResponseWriter,
+	r *http.Request,
+	playbackSessionKey PlaybackSessionKey,
+	segmentIdx int,
+	mimeType string) bool {
+
+	f, err := getSegmentCache().Open(ffmpeg.SegmentCacheKey{
+		StreamKey:        playbackSessionKey.StreamKey,
+		RepresentationID: playbackSessionKey.representationID,
+		SegmentIdx:       segmentIdx,
+	})
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	m.mtx.Lock()
+	err = m.checkPlaybackLimit(playbackSessionKey, readStreamingLimits())
+	if err == nil {
+		m.trackCachedSegmentServed(playbackSessionKey, segmentIdx)
+		if s := m.sessions[playbackSessionKey]; s != nil {
+			s.skipCachedSegment(segmentIdx)
+		}
+	}
+	m.mtx.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return true
+	}
+
+	log.Info("Serving cached segment ", f.Name(), " with MIME type ", mimeType)
+	w.Header().Set("Content-Type", mimeType)
+	http.ServeContent(w, r, "", stat.ModTime(), f)
+	return true
+}
+
+// skipCachedSegment moves the session past a segment that was served from the segment cache.
+// Sessions serve their segments in order, so the next segment it serves must be the one after.
+func (s *PlaybackSession) skipCachedSegment(segmentIdx int) {
+	if segmentIdx <= s.lastServedSegmentIdx {
+		return
+	}
+	s.lastRequestedSegmentIdx = segmentIdx
+	s.lastServedSegmentIdx = segmentIdx
+	s.lastAccessed = time.Now()
+}
+
+// cacheSegment adds a segment produced by the session to the segment cache. Only transcoded
+// segments are cached, everything else is cheap to produce again.
+func (s *PlaybackSession) cacheSegment(segmentIdx int, segmentPath string) {
+	representation := s.TranscodingSession.Stream.Representation
+	if !representation.Transcoded {
+		return
+	}
+
+	err := getSegmentCache().Put(ffmpeg.SegmentCacheKey{
+		StreamKey:        s.StreamKey,
+		RepresentationID: representation.RepresentationId,
+		SegmentIdx:       segmentIdx,
+	}, segmentPath)
+	if err != nil {
+		log.WithError(err).WithField("path", segmentPath).Warnln("Failed to cache segment")
+	}
+}
+
+// cacheAvailableSegments adds all segments the session has produced to the segment cache, also
+// the ones that weren't requested yet.
+func (s *PlaybackSession) cacheAvailableSegments() {
+	if !s.TranscodingSession.Stream.Representation.Transcoded {
+		return
+	}
+	segments, err := s.TranscodingSession.AvailableSegments()
+	if err != nil {
+		return
+	}
+	for segmentIdx, segmentPath := range segments {
+		s.cacheSegment(segmentIdx, segmentPath)
+	}
+}
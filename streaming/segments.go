@@ -12,6 +12,11 @@ import (
 var videoMIMEType = "video/mp4"
 
 func serveInit(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["representationId"] == ffmpeg.IFrameRepresentationId {
+		serveIFrameInit(w, r)
+		return
+	}
+
 	sessionID := mux.Vars(r)["sessionID"]
 	streamID := mux.Vars(r)["streamId"]
 	representationId := mux.Vars(r)["representationId"]
@@ -34,13 +39,20 @@ func serveInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	playbackSession, err := PBSManager.GetPlaybackSession(
-		PlaybackSessionKey{
-			StreamKey:        streamKey,
-			sessionID:        sessionID,
-			representationID: representationId,
-			userID:           claims.UserID},
-		InitSegmentIdx)
+	playbackSessionKey := PlaybackSessionKey{
+		StreamKey:        streamKey,
+		sessionID:        sessionID,
+		representationID: representationId,
+		userID:           claims.UserID}
+	if PBSManager.serveCachedSegment(w, r, playbackSessionKey, InitSegmentIdx, videoMIMEType) {
+		return
+	}
+
+	playbackSession, err := PBSManager.GetPlaybackSession(playbackSessionKey, InitSegmentIdx)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
 	defer playbackSession.Release()
 
 	for {
@@ -53,6 +65,8 @@ func serveInit(w http.ResponseWriter, r *http.Request) {
 			log.Info("Serving path ", segmentPath, " with MIME type ", videoMIMEType)
 			w.Header().Set("Content-Type", videoMIMEType)
 			http.ServeFile(w, r, segmentPath)
+			playbackSession.countServed(segmentPath)
+			playbackSession.cacheSegment(ffmpeg.InitialSegmentIdx, segmentPath)
 
 			playbackSession.lastAccessed = time.Now()
 			return
@@ -91,14 +105,21 @@ func serveSegment(w http.ResponseWriter, r *http.Request, mimeType string) {
 		return
 	}
 
-	playbackSession, err := PBSManager.GetPlaybackSession(
-		PlaybackSessionKey{
-			streamKey,
-			sessionID,
-			representationId,
-			claims.UserID,
-		},
-		segmentIdx)
+	playbackSessionKey := PlaybackSessionKey{
+		streamKey,
+		sessionID,
+		representationId,
+		claims.UserID,
+	}
+	if PBSManager.serveCachedSegment(w, r, playbackSessionKey, segmentIdx, mimeType) {
+		return
+	}
+
+	playbackSession, err := PBSManager.GetPlaybackSession(playbackSessionKey, segmentIdx)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
 	defer playbackSession.Release()
 
 	for {
@@ -114,6 +135,8 @@ func serveSegment(w http.ResponseWriter, r *http.Request, mimeType string) {
 			log.Info("Serving path ", segmentPath, " with MIME type ", mimeType)
 			w.Header().Set("Content-Type", mimeType)
 			http.ServeFile(w, r, segmentPath)
+			playbackSession.countServed(segmentPath)
+			playbackSession.cacheSegment(segmentIdxToServe, segmentPath)
 
 			// Sometimes video.js seems to request the same segment twice, deal with that.
 			if playbackSession.lastRequestedSegmentIdx != segmentIdx {
@@ -130,6 +153,10 @@ func serveSegment(w http.ResponseWriter, r *http.Request, mimeType string) {
 }
 
 func serveMediaSegment(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["representationId"] == ffmpeg.IFrameRepresentationId {
+		serveIFrameSegment(w, r)
+		return
+	}
 	serveSegment(w, r, videoMIMEType)
 }
 
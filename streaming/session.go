@@ -2,7 +2,9 @@ package streaming
 
 import (
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,8 +22,9 @@ var PBSManager, _ = NewPlaybackSessionManager()
 
 func NewPlaybackSessionManager() (m *PlaybackSessionManager, cleanup func()) {
 	m = &PlaybackSessionManager{
-		mtx:      sync.Mutex{},
-		sessions: make(map[PlaybackSessionKey]*PlaybackSession),
+		mtx:       sync.Mutex{},
+		sessions:  make(map[PlaybackSessionKey]*PlaybackSession),
+		playbacks: make(map[string]*playback),
 	}
 
 	return m, m.CleanupSessions
@@ -31,6 +34,8 @@ type PlaybackSessionManager struct {
 	// Read-modify-write mutex for sessions. This ensures that two parallel requests don't both create a session.
 	mtx      sync.Mutex
 	sessions map[PlaybackSessionKey]*PlaybackSession
+	// Playbacks by session ID, for the watch history
+	playbacks map[string]*playback
 }
 
 type PlaybackSessionKey struct {
@@ -67,16 +72,38 @@ type PlaybackSession struct {
 	// Should be initialized to 1.
 	referenceCount int
 
+	createdAt    time.Time
 	lastAccessed time.Time
+
+	// Total size of the segments served to the client, accessed atomically
+	bytesServed int64
+
+	// Ensures the TranscodingSession is only destroyed once, see KillPlaybackSession.
+	destroyOnce sync.Once
 }
 
 func NewPlaybackSession(playbackSessionKey PlaybackSessionKey, segmentIdx int, m *PlaybackSessionManager) (*PlaybackSession, error) {
-	stream, err := ffmpeg.GetStream(playbackSessionKey.StreamKey)
+	streamRepresentation, err := getStreamRepresentation(playbackSessionKey)
 	if err != nil {
 		return nil, err
 	}
-	streamRepresentation, err := ffmpeg.StreamRepresentationFromRepresentationId(
-		stream, playbackSessionKey.representationID)
+	return newPlaybackSession(playbackSessionKey, streamRepresentation, segmentIdx, m)
+}
+
+func getStreamRepresentation(playbackSessionKey PlaybackSessionKey) (ffmpeg.StreamRepresentation, error) {
+	stream, err := ffmpeg.GetStream(playbackSessionKey.StreamKey)
+	if err != nil {
+		return ffmpeg.StreamRepresentation{}, err
+	}
+	return ffmpeg.StreamRepresentationFromRepresentationId(stream, playbackSessionKey.representationID)
+}
+
+// newPlaybackSession starts a session that serves streamRepresentation under the given key.
+func newPlaybackSession(
+	playbackSessionKey PlaybackSessionKey,
+	streamRepresentation ffmpeg.StreamRepresentation,
+	segmentIdx int,
+	m *PlaybackSessionManager) (*PlaybackSession, error) {
 
 	playbackSessionID := uuid.New().String()
 	// TODO(Leon Handreke): Find a better way to build URLs
@@ -84,10 +111,6 @@ func NewPlaybackSession(playbackSessionKey PlaybackSessionKey, segmentIdx int, m
 	feedbackURL := fmt.Sprintf("http://127.0.0.1:%d/olaris/s/ffmpeg/%s/feedback",
 		viper.GetInt("server.port"), playbackSessionID)
 
-	if err != nil {
-		return nil, fmt.Errorf("Failed to build FFmpeg feedback url: %s", err.Error())
-	}
-
 	transcodingSession, err := ffmpeg.NewTranscodingSession(
 		streamRepresentation, segmentIdx, feedbackURL)
 	if err != nil {
@@ -103,6 +126,7 @@ func NewPlaybackSession(playbackSessionKey PlaybackSessionKey, segmentIdx int, m
 		lastRequestedSegmentIdx: segmentIdx - 1,
 		lastServedSegmentIdx:    segmentIdx - 1,
 		referenceCount:          1,
+		createdAt:               time.Now(),
 		lastAccessed:            time.Now(),
 	}
 	s.startTimeoutTicker(m)
@@ -153,6 +177,14 @@ func (m *PlaybackSessionManager) GetPlaybackSession(
 
 	// We are either seeking or no session exists yet. Destroy any existing session and
 	// start a new one
+	streamRepresentation, err := getStreamRepresentation(playbackSessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkLimits(playbackSessionKey, streamRepresentation, s, readStreamingLimits()); err != nil {
+		return nil, err
+	}
+
 	if s != nil {
 		s.referenceCount--
 		s.CleanupIfRequired()
@@ -166,12 +198,13 @@ func (m *PlaybackSessionManager) GetPlaybackSession(
 		startAtSegmentIdx = segmentIdx
 	}
 
-	s, err := NewPlaybackSession(playbackSessionKey, startAtSegmentIdx, m)
+	s, err = newPlaybackSession(playbackSessionKey, streamRepresentation, startAtSegmentIdx, m)
 	if err != nil {
 		return nil, err
 	}
 
 	m.sessions[playbackSessionKey] = s
+	m.trackPlaybackStarted(s.PlaybackSessionKey, startAtSegmentIdx)
 
 	s.referenceCount++
 	go m.garbageCollectPlaybackSessions()
@@ -239,7 +272,14 @@ func (m *PlaybackSessionManager) removePlaybackSession(s *PlaybackSession) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
+	// The session may already have been removed, e.g. killed by an admin or replaced after seeking.
+	// Don't release it twice or remove its replacement.
+	if m.sessions[s.PlaybackSessionKey] != s {
+		return
+	}
+
 	delete(m.sessions, s.PlaybackSessionKey)
+	m.trackPlaybackStopped(s)
 	s.Release()
 }
 
@@ -252,10 +292,23 @@ func (s *PlaybackSession) CleanupIfRequired() {
 	if s.referenceCount > 0 {
 		return
 	}
+	s.destroy()
+}
 
-	err := s.TranscodingSession.Destroy()
-	if err != nil {
-		log.WithField("error", err).Warnln("received an error while cleaning up transcoding folder")
+func (s *PlaybackSession) destroy() {
+	s.destroyOnce.Do(func() {
+		s.cacheAvailableSegments()
+		err := s.TranscodingSession.Destroy()
+		if err != nil {
+			log.WithField("error", err).Warnln("received an error while cleaning up transcoding folder")
+		}
+	})
+}
+
+// countServed adds the size of a segment that was served to the client to bytesServed.
+func (s *PlaybackSession) countServed(segmentPath string) {
+	if stat, err := os.Stat(segmentPath); err == nil {
+		atomic.AddInt64(&s.bytesServed, stat.Size())
 	}
 }
 
@@ -0,0 +1,111 @@
+package streaming
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/olaris/olaris-server/filesystem"
+)
+
+// How a PlaybackSession produces the stream it serves.
+const (
+	// The stream is re-encoded with ffmpeg.
+	PlaybackModeTranscode = "transcode"
+	// The stream is copied into a new container without re-encoding.
+	PlaybackModeTransmux = "transmux"
+	// The stream is extracted as it is, e.g. subtitles.
+	PlaybackModeDirect = "direct"
+)
+
+// PlaybackSessionInfo is a snapshot of the state of a PlaybackSession for monitoring.
+type PlaybackSessionInfo struct {
+	ID               string
+	UserID           uint
+	FileLocator      filesystem.FileLocator
+	StreamID         int64
+	StreamType       string
+	RepresentationID string
+	Mode             string
+
+	ProgressPercent float32
+	Throttled       bool
+	Terminated      bool
+
+	// Average rate at which segments were served to the client in bits per second.
+	BitRate int64
+
+	CreatedAt    time.Time
+	LastAccessed time.Time
+}
+
+// Info returns a snapshot of the session's state.
+func (s *PlaybackSession) Info() PlaybackSessionInfo {
+	info := PlaybackSessionInfo{
+		ID:               s.playbackSessionID,
+		UserID:           s.userID,
+		FileLocator:      s.FileLocator,
+		StreamID:         s.StreamId,
+		RepresentationID: s.representationID,
+		Mode:             PlaybackModeDirect,
+		CreatedAt:        s.createdAt,
+		LastAccessed:     s.lastAccessed,
+	}
+
+	if t := s.TranscodingSession; t != nil {
+		info.StreamType = t.Stream.Stream.StreamType
+		// Differs from the requested representation if the streaming limits were reached.
+		info.RepresentationID = t.Stream.Representation.RepresentationId
+		info.ProgressPercent = t.ProgressPercent
+		info.Throttled = t.Throttled
+		info.Terminated = t.Terminated
+		if t.Stream.Representation.Transcoded {
+			info.Mode = PlaybackModeTranscode
+		} else if t.Stream.Representation.Transmuxed {
+			info.Mode = PlaybackModeTransmux
+		}
+	}
+
+	if elapsed := info.LastAccessed.Sub(info.CreatedAt).Seconds(); elapsed > 0 {
+		info.BitRate = int64(float64(atomic.LoadInt64(&s.bytesServed)*8) / elapsed)
+	}
+	return info
+}
+
+// PlaybackSessionInfos returns a snapshot of all active playback sessions, oldest first.
+func (m *PlaybackSessionManager) PlaybackSessionInfos() []PlaybackSessionInfo {
+	infos := []PlaybackSessionInfo{}
+	for _, s := range m.GetPlaybackSessions() {
+		infos = append(infos, s.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].CreatedAt.Equal(infos[j].CreatedAt) {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+	})
+	return infos
+}
+
+// KillPlaybackSession stops the playback session with the given ID and cleans up its
+// TranscodingSession right away. Requests still waiting for segments of the session fail.
+func (m *PlaybackSessionManager) KillPlaybackSession(playbackSessionID string) error {
+	m.mtx.Lock()
+	var s *PlaybackSession
+	for _, v := range m.sessions {
+		if v.playbackSessionID == playbackSessionID {
+			s = v
+			break
+		}
+	}
+	m.mtx.Unlock()
+
+	if s == nil {
+		return fmt.Errorf("No PlaybackSession with the given ID %s", playbackSessionID)
+	}
+
+	m.removePlaybackSession(s)
+	s.destroy()
+	return nil
+}
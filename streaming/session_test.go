@@ -0,0 +1,130 @@
+package streaming
+
+import (
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func newTestPlaybackSession(id string, representation ffmpeg.Representation) *PlaybackSession {
+	fileLocator, _ := filesystem.ParseFileLocator("local#/media/movie.mkv")
+	return &PlaybackSession{
+		PlaybackSessionKey: PlaybackSessionKey{
+			StreamKey:        ffmpeg.StreamKey{FileLocator: fileLocator, StreamId: 1},
+			sessionID:        "session",
+			representationID: representation.RepresentationId,
+			userID:           3,
+		},
+		playbackSessionID: id,
+		TranscodingSession: &ffmpeg.TranscodingSession{
+			Stream: ffmpeg.StreamRepresentation{
+				Stream:         ffmpeg.Stream{StreamType: "video"},
+				Representation: representation,
+			},
+			Throttled:       true,
+			ProgressPercent: 42,
+		},
+		referenceCount: 1,
+	}
+}
+
+func TestPlaybackSessionInfo(t *testing.T) {
+	s := newTestPlaybackSession("a", ffmpeg.Representation{RepresentationId: "preset:480-1000k-video", Transcoded: true})
+	s.createdAt = time.Now().Add(-10 * time.Second)
+	s.lastAccessed = s.createdAt.Add(8 * time.Second)
+	s.bytesServed = 1000000
+
+	info := s.Info()
+	assert.Equal(t, "a", info.ID)
+	assert.EqualValues(t, 3, info.UserID)
+	assert.Equal(t, "local#/media/movie.mkv", info.FileLocator.String())
+	assert.EqualValues(t, 1, info.StreamID)
+	assert.Equal(t, "video", info.StreamType)
+	assert.Equal(t, PlaybackModeTranscode, info.Mode)
+	assert.True(t, info.Throttled)
+	assert.EqualValues(t, 42, info.ProgressPercent)
+	assert.EqualValues(t, 1000000, info.BitRate)
+
+	assert.Equal(t, PlaybackModeTransmux,
+		newTestPlaybackSession("b", ffmpeg.Representation{RepresentationId: "direct", Transmuxed: true}).Info().Mode)
+	assert.Equal(t, PlaybackModeDirect,
+		newTestPlaybackSession("c", ffmpeg.Representation{RepresentationId: "webvtt"}).Info().Mode)
+}
+
+func TestPlaybackSessionInfos(t *testing.T) {
+	m, _ := NewPlaybackSessionManager()
+	older := newTestPlaybackSession("older", ffmpeg.Representation{RepresentationId: "direct", Transmuxed: true})
+	older.createdAt = time.Now().Add(-time.Minute)
+	newer := newTestPlaybackSession("newer", ffmpeg.Representation{RepresentationId: "webvtt"})
+	newer.StreamId = 2
+	newer.createdAt = time.Now()
+	m.sessions[newer.PlaybackSessionKey] = newer
+	m.sessions[older.PlaybackSessionKey] = older
+
+	infos := m.PlaybackSessionInfos()
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, "older", infos[0].ID)
+		assert.Equal(t, "newer", infos[1].ID)
+	}
+
+	assert.Error(t, m.KillPlaybackSession("unknown"))
+}
+
+func TestRemovePlaybackSession_Replaced(t *testing.T) {
+	m, _ := NewPlaybackSessionManager()
+	old := newTestPlaybackSession("old", ffmpeg.Representation{RepresentationId: "direct", Transmuxed: true})
+	replacement := newTestPlaybackSession("new", ffmpeg.Representation{RepresentationId: "direct", Transmuxed: true})
+	m.sessions[replacement.PlaybackSessionKey] = replacement
+
+	// E.g. the timeout of a session that was replaced after seeking
+	m.removePlaybackSession(old)
+
+	assert.Equal(t, replacement, m.sessions[replacement.PlaybackSessionKey])
+	assert.Equal(t, 1, old.referenceCount)
+}
+
+func TestServeCachedSegment_AdvancesLiveSession(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	cache := ffmpeg.NewSegmentCache(t.TempDir(), 1<<20)
+	getSegmentCache = func() *ffmpeg.SegmentCache { return cache }
+	defer func() { getSegmentCache = ffmpeg.GetSegmentCache }()
+
+	m, _ := NewPlaybackSessionManager()
+	s := newTestPlaybackSession("live", ffmpeg.Representation{RepresentationId: "preset:720-5000k-video", Transcoded: true})
+	s.lastRequestedSegmentIdx = 9
+	s.lastServedSegmentIdx = 9
+	m.sessions[s.PlaybackSessionKey] = s
+
+	segmentPath := path.Join(t.TempDir(), "segment.m4s")
+	require.NoError(t, os.WriteFile(segmentPath, []byte("cached"), 0644))
+	for segmentIdx := 10; segmentIdx <= 12; segmentIdx++ {
+		require.NoError(t, cache.Put(ffmpeg.SegmentCacheKey{
+			StreamKey:        s.StreamKey,
+			RepresentationID: s.representationID,
+			SegmentIdx:       segmentIdx,
+		}, segmentPath))
+		w := httptest.NewRecorder()
+		assert.True(t, m.serveCachedSegment(w, httptest.NewRequest("GET", "/", nil), s.PlaybackSessionKey, segmentIdx, videoMIMEType))
+		assert.Equal(t, "cached", w.Body.String())
+	}
+
+	// The next segment isn't cached, the live session must serve segment 13 rather than the one
+	// after the last segment it served itself.
+	next, err := m.GetPlaybackSession(s.PlaybackSessionKey, 13)
+	require.NoError(t, err)
+	assert.Same(t, s, next)
+	assert.Equal(t, 13, next.lastServedSegmentIdx+1)
+
+	// Seeking back to a cached segment leaves the session where it is.
+	w := httptest.NewRecorder()
+	assert.True(t, m.serveCachedSegment(w, httptest.NewRequest("GET", "/", nil), s.PlaybackSessionKey, 10, videoMIMEType))
+	assert.Equal(t, 12, s.lastServedSegmentIdx)
+}
@@ -0,0 +1,54 @@
+package streaming
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/olaris/olaris-server/metadata/auth"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// serveSyncJobDownload serves the file created by a finished sync job. Only the user that created
+// the job and admins may download it.
+func serveSyncJobDownload(w http.ResponseWriter, r *http.Request) {
+	job, err := db.FindSyncJobByUUID(mux.Vars(r)["uuid"])
+	if err != nil {
+		http.Error(w, "No such sync job", http.StatusNotFound)
+		return
+	}
+
+	userID, _ := auth.UserID(r.Context())
+	isAdmin, _ := auth.UserAdmin(r.Context())
+	if job.UserID != userID && !isAdmin {
+		// Don't give away that the job exists
+		http.Error(w, "No such sync job", http.StatusNotFound)
+		return
+	}
+	if job.State != db.SyncJobDone {
+		http.Error(w, fmt.Sprintf("Sync job is %s", job.State), http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(job.OutputPath)
+	if err != nil {
+		http.Error(w, "Synced file is gone", http.StatusGone)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sourceName := path.Base(job.FilePath)
+	fileName := strings.TrimSuffix(sourceName, path.Ext(sourceName)) + ".mp4"
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	// Handles range requests, so that downloads can be resumed.
+	http.ServeContent(w, r, "", stat.ModTime(), f)
+}
@@ -0,0 +1,32 @@
+package streaming
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/gorilla/mux"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+)
+
+// serveTrickplay serves the WebVTT thumbnail track and the sprite sheets it references for
+// seek-bar previews. The track refers to the sprites by relative URLs, so both live under the
+// same path.
+func serveTrickplay(w http.ResponseWriter, r *http.Request) {
+	fileLocator, statusErr := getFileLocatorOrFail(r)
+	if statusErr != nil {
+		http.Error(w, statusErr.Error(), statusErr.Status())
+		return
+	}
+
+	if !ffmpeg.HasTrickplay(fileLocator) {
+		http.Error(w, "No trickplay thumbnails have been generated for this file yet", http.StatusNotFound)
+		return
+	}
+
+	// The route only matches known file names, so this can't escape the directory.
+	fileName := mux.Vars(r)["fileName"]
+	if fileName == ffmpeg.TrickplayVTTFileName {
+		w.Header().Set("Content-Type", "text/vtt")
+	}
+	http.ServeFile(w, r, path.Join(ffmpeg.GetTrickplayDir(fileLocator), fileName))
+}
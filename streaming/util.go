@@ -25,6 +25,16 @@ func getFileLocator(urlFileLocatorStr string) (filesystem.FileLocator, error) {
 
 }
 
+// streamingUserID returns the ID of the user the streaming ticket of the request was issued to,
+// or 0 if the file is accessed without one.
+func streamingUserID(r *http.Request) uint {
+	claims, err := getStreamingClaims(mux.Vars(r)["fileLocator"])
+	if err != nil {
+		return 0
+	}
+	return claims.UserID
+}
+
 func getStreamingClaims(urlFileLocator string) (*auth.StreamingClaims, error) {
 	// Allow both with and without leading slash, but canonical version is without
 	if urlFileLocator[0] == '/' {
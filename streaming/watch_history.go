@@ -0,0 +1,150 @@
+package streaming
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+// playback is what a user watches with one streaming session, which consists of a PlaybackSession
+// per stream and representation. It's tracked for the watch history.
+type playback struct {
+	userID    uint
+	startedAt time.Time
+	// Looked up in the background, finding it takes a query. Only read it after mediaUUIDFound is
+	// closed.
+	mediaUUID      string
+	mediaUUIDFound chan struct{}
+
+	// Segments served from the segment cache have no PlaybackSession, they are tracked here.
+	lastAccessed         time.Time
+	lastServedSegmentIdx int
+	// Records the end of the playback if it's only served from the segment cache, see
+	// trackCachedSegmentServed.
+	expiry *time.Timer
+}
+
+// trackPlaybackStarted records the start of a playback at segmentIdx if key is the first one of it
+// and returns the playback. It returns nil for anonymous playbacks. m.mtx must be held.
+func (m *PlaybackSessionManager) trackPlaybackStarted(key PlaybackSessionKey, segmentIdx int) *playback {
+	if key.userID == 0 {
+		return nil
+	}
+	if p, ok := m.playbacks[key.sessionID]; ok {
+		return p
+	}
+
+	p := &playback{
+		userID:               key.userID,
+		startedAt:            time.Now(),
+		mediaUUIDFound:       make(chan struct{}),
+		lastServedSegmentIdx: segmentIdx - 1,
+	}
+	m.playbacks[key.sessionID] = p
+
+	filePath := key.FileLocator.String()
+	go func() {
+		p.mediaUUID = db.FindMediaUUIDForFilePath(filePath)
+		close(p.mediaUUIDFound)
+		createWatchEvent(&db.WatchEvent{
+			UserID:    p.userID,
+			Kind:      db.WatchEventPlaybackStarted,
+			MediaUUID: p.mediaUUID,
+			Playtime:  segmentPlaytime(segmentIdx),
+		})
+	}()
+	return p
+}
+
+// trackCachedSegmentServed tracks a playback for a segment served from the segment cache. If no
+// PlaybackSession of the playback is left when it hasn't been accessed for playbackSessionTimeout,
+// its end is recorded like when the last session is removed. m.mtx must be held.
+func (m *PlaybackSessionManager) trackCachedSegmentServed(key PlaybackSessionKey, segmentIdx int) {
+	p := m.trackPlaybackStarted(key, segmentIdx)
+	if p == nil {
+		return
+	}
+	p.lastAccessed = time.Now()
+	if segmentIdx > p.lastServedSegmentIdx {
+		p.lastServedSegmentIdx = segmentIdx
+	}
+
+	if p.expiry != nil {
+		p.expiry.Reset(playbackSessionTimeout)
+		return
+	}
+	sessionID := key.sessionID
+	p.expiry = time.AfterFunc(playbackSessionTimeout, func() {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		if m.playbacks[sessionID] != p || m.hasPlaybackSession(sessionID) {
+			return
+		}
+		m.finishPlayback(sessionID, p)
+	})
+}
+
+func (m *PlaybackSessionManager) hasPlaybackSession(sessionID string) bool {
+	for _, s := range m.sessions {
+		if s.sessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// trackPlaybackStopped records the end of a playback if s was the last PlaybackSession of it.
+// m.mtx must be held.
+func (m *PlaybackSessionManager) trackPlaybackStopped(s *PlaybackSession) {
+	p, ok := m.playbacks[s.sessionID]
+	if !ok || m.hasPlaybackSession(s.sessionID) {
+		return
+	}
+	if s.lastAccessed.After(p.lastAccessed) {
+		p.lastAccessed = s.lastAccessed
+	}
+	if s.lastServedSegmentIdx > p.lastServedSegmentIdx {
+		p.lastServedSegmentIdx = s.lastServedSegmentIdx
+	}
+	m.finishPlayback(s.sessionID, p)
+}
+
+// finishPlayback records the end of a playback. m.mtx must be held.
+func (m *PlaybackSessionManager) finishPlayback(sessionID string, p *playback) {
+	delete(m.playbacks, sessionID)
+	if p.expiry != nil {
+		p.expiry.Stop()
+	}
+
+	watched := p.lastAccessed.Sub(p.startedAt)
+	if watched < 0 {
+		watched = 0
+	}
+	event := &db.WatchEvent{
+		UserID:         p.userID,
+		Kind:           db.WatchEventPlaybackStopped,
+		Playtime:       segmentPlaytime(p.lastServedSegmentIdx),
+		WatchedSeconds: watched.Seconds(),
+	}
+	go func() {
+		<-p.mediaUUIDFound
+		event.MediaUUID = p.mediaUUID
+		createWatchEvent(event)
+	}()
+}
+
+// segmentPlaytime approximates the playback position at the start of the given segment in seconds.
+func segmentPlaytime(segmentIdx int) float64 {
+	if segmentIdx < 0 {
+		return 0
+	}
+	return (time.Duration(segmentIdx) * ffmpeg.SegmentDuration).Seconds()
+}
+
+func createWatchEvent(event *db.WatchEvent) {
+	if err := db.CreateWatchEvent(event); err != nil {
+		log.WithError(err).Warnln("Failed to record watch event")
+	}
+}
@@ -0,0 +1,39 @@
+package streaming
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/olaris/olaris-server/ffmpeg"
+	"gitlab.com/olaris/olaris-server/filesystem"
+	"gitlab.com/olaris/olaris-server/metadata/db"
+)
+
+func TestTrackPlayback_RecordsMediaUUID(t *testing.T) {
+	db.NewInMemoryDBForTests(false)
+	movie := db.Movie{Title: "Mad Max: Fury Road"}
+	require.NoError(t, db.SaveMovie(&movie))
+	locator := filesystem.FileLocator{Backend: filesystem.BackendLocal, Path: "/movies/Mad Max.mkv"}
+	movieFile := db.MovieFile{MediaItem: db.MediaItem{FilePath: locator.String()}, MovieID: movie.ID}
+	db.SaveMovieFile(&movieFile)
+
+	m, _ := NewPlaybackSessionManager()
+	key := PlaybackSessionKey{
+		StreamKey:        ffmpeg.StreamKey{FileLocator: locator},
+		sessionID:        "session",
+		representationID: "direct",
+		userID:           1,
+	}
+	m.mtx.Lock()
+	p := m.trackPlaybackStarted(key, 0)
+	m.finishPlayback(key.sessionID, p)
+	m.mtx.Unlock()
+
+	require.Eventually(t, func() bool { return len(db.WatchHistoryForUser(1, 0, 10)) == 2 },
+		time.Second, time.Millisecond)
+	for _, event := range db.WatchHistoryForUser(1, 0, 10) {
+		assert.Equal(t, movie.UUID, event.MediaUUID)
+	}
+}